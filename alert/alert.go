@@ -0,0 +1,236 @@
+package alert
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	coursesense "github.com/jacobmichels/Course-Sense-Go"
+	"github.com/jacobmichels/Course-Sense-Go/config"
+	"github.com/jacobmichels/Course-Sense-Go/notifier"
+	"github.com/jacobmichels/Course-Sense-Go/webadvisor"
+)
+
+// Monitor implements HealthMonitor
+var _ coursesense.HealthMonitor = Monitor{}
+
+const (
+	ruleConsecutiveFailures = "consecutive_failures"
+	ruleStalePoll           = "stale_poll"
+	ruleSchema              = "colleague_schema"
+	ruleSMTPAuth            = "smtp_auth"
+)
+
+// an alert is given this long to go out through every alerter
+const sendTimeout = 30 * time.Second
+
+// Records the outcome of polls and deliveries, and checks the alert rules against them on its own ticker.
+// An alert goes out once when its rule starts firing, again every RepeatSecs while it keeps firing, and a recovery message once it clears
+type Monitor struct {
+	cfg      config.Alerts
+	contact  coursesense.Watcher
+	alerters []coursesense.Alerter
+	state    *state
+}
+
+type state struct {
+	// held for a whole check, so checks running at once can't send the same alert twice
+	checking sync.Mutex
+	mu       sync.Mutex
+	// polls that failed since the last successful one
+	failures  int
+	lastError error
+	// the start time until the first successful poll
+	lastSuccess time.Time
+	// the last schema error, cleared by a successful poll
+	schemaError error
+	// the auth errors of each notifier, cleared by a successful delivery through it
+	authErrors map[string]error
+	// the rules currently firing
+	firing map[string]firing
+}
+
+type firing struct {
+	since time.Time
+	// zero until the alert was delivered
+	lastSent time.Time
+}
+
+// the alerters are the notifiers that can deliver alerts to one of the contact's channels
+func NewMonitor(cfg config.Alerts, contact coursesense.Watcher, notifiers ...coursesense.Notifier) Monitor {
+	var alerters []coursesense.Alerter
+	for _, n := range notifiers {
+		alerter, ok := n.(coursesense.Alerter)
+		if !ok || n.Channel() == "" {
+			continue
+		}
+
+		if _, ok := contact.Channel(n.Channel()); ok {
+			alerters = append(alerters, alerter)
+		}
+	}
+
+	return Monitor{cfg, contact, alerters, &state{lastSuccess: time.Now(), authErrors: make(map[string]error), firing: make(map[string]firing)}}
+}
+
+func (m Monitor) ObserveTrigger(err error) {
+	m.state.mu.Lock()
+	defer m.state.mu.Unlock()
+
+	if err == nil {
+		m.state.failures = 0
+		m.state.lastError = nil
+		m.state.lastSuccess = time.Now()
+		m.state.schemaError = nil
+		return
+	}
+
+	m.state.failures++
+	m.state.lastError = err
+	if errors.Is(err, webadvisor.ErrSchema) {
+		m.state.schemaError = err
+	}
+}
+
+func (m Monitor) ObserveDelivery(name string, err error) {
+	m.state.mu.Lock()
+	defer m.state.mu.Unlock()
+
+	switch {
+	case err == nil:
+		delete(m.state.authErrors, name)
+	case errors.Is(err, notifier.ErrSMTPAuth):
+		m.state.authErrors[name] = err
+	}
+}
+
+// Run checks the rules until the context is cancelled
+func (m Monitor) Run(ctx context.Context) {
+	log.Info().Msgf("starting alert monitor: checking every %d seconds, alerting through %d notifiers", m.cfg.CheckIntervalSecs, len(m.alerters))
+	ticker := time.NewTicker(time.Second * time.Duration(m.cfg.CheckIntervalSecs))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.Check(ctx, time.Now())
+		}
+	}
+}
+
+// Check sends the alerts due at the given time: new and repeated alerts of firing rules, and recoveries of cleared ones.
+// Checks run one at a time, observations aren't held up by the alerts being sent
+func (m Monitor) Check(ctx context.Context, now time.Time) {
+	m.state.checking.Lock()
+	defer m.state.checking.Unlock()
+
+	m.state.mu.Lock()
+	active := m.evaluate(now)
+
+	var due []coursesense.Alert
+	for rule, message := range active {
+		current, ok := m.state.firing[rule]
+		if !ok {
+			current = firing{since: now}
+			m.state.firing[rule] = current
+		}
+
+		if current.lastSent.IsZero() || (m.cfg.RepeatSecs > 0 && now.Sub(current.lastSent) >= time.Duration(m.cfg.RepeatSecs)*time.Second) {
+			due = append(due, coursesense.Alert{Rule: rule, Firing: true, Message: message, Since: current.since})
+		}
+	}
+
+	for rule, current := range m.state.firing {
+		if _, ok := active[rule]; ok {
+			continue
+		}
+
+		delete(m.state.firing, rule)
+		// nobody heard about it, so there is nothing to recover from
+		if !current.lastSent.IsZero() {
+			due = append(due, coursesense.Alert{Rule: rule, Message: recoveryMessage(rule), Since: current.since})
+		}
+	}
+	m.state.mu.Unlock()
+
+	sort.Slice(due, func(i, j int) bool { return due[i].Rule < due[j].Rule })
+	for _, alert := range due {
+		if !m.send(ctx, alert) || !alert.Firing {
+			continue
+		}
+
+		m.state.mu.Lock()
+		if current, ok := m.state.firing[alert.Rule]; ok {
+			current.lastSent = now
+			m.state.firing[alert.Rule] = current
+		}
+		m.state.mu.Unlock()
+	}
+}
+
+// returns the firing rules along with what is wrong. The state must be locked
+func (m Monitor) evaluate(now time.Time) map[string]string {
+	active := make(map[string]string)
+
+	if n := m.cfg.ConsecutiveFailures; n > 0 && m.state.failures >= n {
+		active[ruleConsecutiveFailures] = fmt.Sprintf("The last %d polls failed. Latest error: %v", m.state.failures, m.state.lastError)
+	}
+
+	if mins := m.cfg.StalePollMins; mins > 0 && now.Sub(m.state.lastSuccess) >= time.Duration(mins)*time.Minute {
+		active[ruleStalePoll] = fmt.Sprintf("No poll has succeeded in %s.", now.Sub(m.state.lastSuccess).Round(time.Minute))
+	}
+
+	if m.cfg.SchemaErrors && m.state.schemaError != nil {
+		active[ruleSchema] = fmt.Sprintf("Colleague responded in a shape we don't understand, it may have changed. Error: %v", m.state.schemaError)
+	}
+
+	if m.cfg.SMTPAuth && len(m.state.authErrors) > 0 {
+		names := make([]string, 0, len(m.state.authErrors))
+		for name := range m.state.authErrors {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		active[ruleSMTPAuth] = fmt.Sprintf("The SMTP server rejected our credentials while delivering through %v. Error: %v", names, m.state.authErrors[names[0]])
+	}
+
+	return active
+}
+
+func recoveryMessage(rule string) string {
+	switch rule {
+	case ruleSMTPAuth:
+		return "Email is being delivered again."
+	default:
+		return "Polling is succeeding again."
+	}
+}
+
+// delivers the alert through every alerter, reporting whether any of them succeeded
+func (m Monitor) send(ctx context.Context, alert coursesense.Alert) bool {
+	sendCtx, cancel := context.WithTimeout(ctx, sendTimeout)
+	defer cancel()
+
+	sent := false
+	for _, alerter := range m.alerters {
+		if err := alerter.Alert(sendCtx, alert, m.contact); err != nil {
+			log.Error().Msgf("failed to send %s alert through %s: %v", alert.Rule, alerter.Name(), err)
+			continue
+		}
+		sent = true
+	}
+
+	if sent {
+		log.Info().Bool("firing", alert.Firing).Msgf("sent %s alert", alert.Rule)
+	} else {
+		log.Error().Bool("firing", alert.Firing).Msgf("%s alert could not be delivered: %s", alert.Rule, alert.Message)
+	}
+
+	return sent
+}
@@ -0,0 +1,208 @@
+package alert
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	coursesense "github.com/jacobmichels/Course-Sense-Go"
+	"github.com/jacobmichels/Course-Sense-Go/config"
+	"github.com/jacobmichels/Course-Sense-Go/notifier"
+	"github.com/jacobmichels/Course-Sense-Go/webadvisor"
+)
+
+// records every alert it is asked to send, failing them while fail is set
+type stubAlerter struct {
+	mu    *sync.Mutex
+	sent  *[]string
+	fail  *bool
+	delay time.Duration
+}
+
+func newStubAlerter() stubAlerter {
+	return stubAlerter{&sync.Mutex{}, &[]string{}, new(bool), 0}
+}
+
+func (a stubAlerter) Name() string                     { return "email" }
+func (a stubAlerter) Channel() coursesense.ChannelKind { return coursesense.ChannelEmail }
+func (a stubAlerter) Urgent() bool                     { return true }
+
+func (a stubAlerter) Notify(ctx context.Context, notification coursesense.Notification, watchers ...coursesense.Watcher) error {
+	return nil
+}
+
+func (a stubAlerter) Alert(ctx context.Context, alert coursesense.Alert, contact coursesense.Watcher) error {
+	time.Sleep(a.delay)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	description := alert.Rule
+	if !alert.Firing {
+		description += " recovered"
+	}
+	*a.sent = append(*a.sent, description)
+
+	if *a.fail {
+		return errors.New("alerter down")
+	}
+	return nil
+}
+
+// takes the alerts sent since the last call
+func (a stubAlerter) take() []string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	sent := *a.sent
+	*a.sent = []string{}
+	return sent
+}
+
+var contact = coursesense.Watcher{Channels: []coursesense.Channel{{Kind: coursesense.ChannelEmail, Address: "ops@example.com"}}}
+
+var errPoll = errors.New("webadvisor unavailable")
+
+func TestMonitorCheck(t *testing.T) {
+	type step struct {
+		// minutes after the monitor started
+		at         int
+		polls      []error
+		deliveries []error
+		// the alerter fails this step's alerts
+		alerterDown bool
+		want        []string
+	}
+
+	failures := config.Alerts{ConsecutiveFailures: 3, RepeatSecs: 600}
+
+	tests := []struct {
+		name  string
+		cfg   config.Alerts
+		steps []step
+	}{
+		{
+			name: "failures, repeat, recovery",
+			cfg:  failures,
+			steps: []step{
+				{at: 1, polls: []error{errPoll, errPoll}},
+				{at: 2, polls: []error{errPoll}, want: []string{ruleConsecutiveFailures}},
+				{at: 5, polls: []error{errPoll}},
+				{at: 12, want: []string{ruleConsecutiveFailures}},
+				{at: 13},
+				{at: 14, polls: []error{nil}, want: []string{ruleConsecutiveFailures + " recovered"}},
+				{at: 30},
+			},
+		},
+		{
+			name: "no repeats",
+			cfg:  config.Alerts{ConsecutiveFailures: 3},
+			steps: []step{
+				{at: 1, polls: []error{errPoll, errPoll, errPoll}, want: []string{ruleConsecutiveFailures}},
+				{at: 20},
+				{at: 600},
+				{at: 601, polls: []error{nil}, want: []string{ruleConsecutiveFailures + " recovered"}},
+			},
+		},
+		{
+			name: "undelivered alerts are retried every check, and never recover",
+			cfg:  failures,
+			steps: []step{
+				{at: 1, polls: []error{errPoll, errPoll, errPoll}, alerterDown: true, want: []string{ruleConsecutiveFailures}},
+				{at: 2, alerterDown: true, want: []string{ruleConsecutiveFailures}},
+				{at: 3, polls: []error{nil}},
+			},
+		},
+		{
+			name: "delivered once the alerter is back",
+			cfg:  failures,
+			steps: []step{
+				{at: 1, polls: []error{errPoll, errPoll, errPoll}, alerterDown: true, want: []string{ruleConsecutiveFailures}},
+				{at: 2, want: []string{ruleConsecutiveFailures}},
+				{at: 3},
+				{at: 4, polls: []error{nil}, want: []string{ruleConsecutiveFailures + " recovered"}},
+			},
+		},
+		{
+			name: "stale poll",
+			cfg:  config.Alerts{StalePollMins: 30},
+			steps: []step{
+				{at: 29},
+				{at: 31, want: []string{ruleStalePoll}},
+			},
+		},
+		{
+			name: "schema and smtp auth errors",
+			cfg:  config.Alerts{SchemaErrors: true, SMTPAuth: true},
+			steps: []step{
+				{at: 1, polls: []error{fmt.Errorf("failed to decode sections: %w", webadvisor.ErrSchema)}, deliveries: []error{fmt.Errorf("%w: 535", notifier.ErrSMTPAuth)}, want: []string{ruleSchema, ruleSMTPAuth}},
+				// other delivery failures don't clear it
+				{at: 2, deliveries: []error{errors.New("timeout")}},
+				{at: 3, polls: []error{nil}, deliveries: []error{nil}, want: []string{ruleSchema + " recovered", ruleSMTPAuth + " recovered"}},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			alerter := newStubAlerter()
+			monitor := NewMonitor(test.cfg, contact, alerter)
+			start := time.Now()
+
+			for _, step := range test.steps {
+				for _, err := range step.polls {
+					monitor.ObserveTrigger(err)
+				}
+				for _, err := range step.deliveries {
+					monitor.ObserveDelivery("email", err)
+				}
+
+				*alerter.fail = step.alerterDown
+				monitor.Check(context.Background(), start.Add(time.Duration(step.at)*time.Minute))
+
+				if got := alerter.take(); strings.Join(got, ",") != strings.Join(step.want, ",") {
+					t.Fatalf("minute %d: got alerts %v, want %v", step.at, got, step.want)
+				}
+			}
+		})
+	}
+}
+
+func TestMonitorSkipsNotifiersWithoutAContactChannel(t *testing.T) {
+	alerter := newStubAlerter()
+	monitor := NewMonitor(config.Alerts{ConsecutiveFailures: 1}, coursesense.Watcher{}, alerter)
+
+	monitor.ObserveTrigger(errPoll)
+	monitor.Check(context.Background(), time.Now())
+
+	if got := alerter.take(); len(got) != 0 {
+		t.Fatalf("got alerts %v, want none without an email contact", got)
+	}
+}
+
+func TestMonitorConcurrentChecksSendOnce(t *testing.T) {
+	alerter := newStubAlerter()
+	// slow enough for the checks to overlap
+	alerter.delay = 20 * time.Millisecond
+	monitor := NewMonitor(config.Alerts{ConsecutiveFailures: 1}, contact, alerter)
+	monitor.ObserveTrigger(errPoll)
+
+	now := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			monitor.Check(context.Background(), now)
+		}()
+	}
+	wg.Wait()
+
+	if got := alerter.take(); len(got) != 1 {
+		t.Fatalf("got alerts %v, want one", got)
+	}
+}
@@ -3,16 +3,29 @@ package main
 import (
 	"context"
 	"fmt"
+	"io"
 	"os"
 	"os/signal"
+	"strings"
 	"time"
+	// embed the timezone database, the production image doesn't ship one
+	_ "time/tzdata"
 
+	coursesense "github.com/jacobmichels/Course-Sense-Go"
+	"github.com/jacobmichels/Course-Sense-Go/alert"
 	"github.com/jacobmichels/Course-Sense-Go/config"
+	"github.com/jacobmichels/Course-Sense-Go/mailsink"
 	"github.com/jacobmichels/Course-Sense-Go/notifier"
+	"github.com/jacobmichels/Course-Sense-Go/outbox"
 	"github.com/jacobmichels/Course-Sense-Go/register"
 	"github.com/jacobmichels/Course-Sense-Go/repository"
 	"github.com/jacobmichels/Course-Sense-Go/server"
+	"github.com/jacobmichels/Course-Sense-Go/telegram"
+	"github.com/jacobmichels/Course-Sense-Go/timetable"
+	"github.com/jacobmichels/Course-Sense-Go/token"
 	"github.com/jacobmichels/Course-Sense-Go/trigger"
+	"github.com/jacobmichels/Course-Sense-Go/unsubscribe"
+	"github.com/jacobmichels/Course-Sense-Go/verify"
 	"github.com/jacobmichels/Course-Sense-Go/webadvisor"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
@@ -51,10 +64,133 @@ func main() {
 		log.Fatal().Msgf("failed to create repository: %v", err)
 	}
 
-	emailNotifier := notifier.NewEmail(cfg.Notifications.EmailSmtp.Host, cfg.Notifications.EmailSmtp.Username, cfg.Notifications.EmailSmtp.Password, cfg.Notifications.EmailSmtp.From, cfg.Notifications.EmailSmtp.Port)
+	var unsubscribeService coursesense.UnsubscribeService
+	if cfg.Links.BaseURL != "" {
+		log.Info().Msg("unsubscribe links enabled")
+		unsubscribeService = unsubscribe.NewService(repository, token.NewSigner(cfg.Links.Secret), cfg.Links.BaseURL, time.Duration(cfg.Links.UnsubscribeTTLSecs)*time.Second)
+	}
+
+	var mailSinkService coursesense.MailSinkService
+	var emailTransport notifier.Transport = notifier.NewSMTPTransport(cfg.Notifications.EmailSmtp.Host, cfg.Notifications.EmailSmtp.Port, cfg.Notifications.EmailSmtp.Username, cfg.Notifications.EmailSmtp.Password, notifier.SMTPSecurity(cfg.Notifications.EmailSmtp.Security))
+	emailFrom := cfg.Notifications.EmailSmtp.From
+	if cfg.Notifications.MailSink.Dir != "" {
+		sink, err := mailsink.NewSink(cfg.Notifications.MailSink.Dir, mailsink.Format(cfg.Notifications.MailSink.Format))
+		if err != nil {
+			log.Fatal().Msgf("failed to create mail sink: %v", err)
+		}
+		mailSinkService = sink
+
+		if cfg.Notifications.MailSink.SMTPAddr != "" {
+			go func() {
+				if err := mailsink.NewListener(cfg.Notifications.MailSink.SMTPAddr, sink).Run(ctx); err != nil {
+					log.Fatal().Msgf("mail sink smtp server failure: %v", err)
+				}
+			}()
+		}
+
+		if cfg.Notifications.EmailSmtp.Host == "" {
+			log.Info().Msgf("email is captured in %s instead of being sent", cfg.Notifications.MailSink.Dir)
+			emailTransport = sink
+			if emailFrom == "" {
+				emailFrom = "coursesense@localhost"
+			}
+		}
+	}
+
+	emailNotifier, err := notifier.NewEmail(emailTransport, emailFrom, cfg.Notifications.EmailSmtp.TemplateDir, unsubscribeService)
+	if err != nil {
+		log.Fatal().Msgf("failed to create email notifier: %v", err)
+	}
+	notifiers := []coursesense.Notifier{emailNotifier}
+
+	var verificationService coursesense.VerificationService
+	if cfg.Verification.Enabled {
+		log.Info().Msg("email verification enabled")
+		verificationService = verify.NewService(repository, token.NewSigner(cfg.Links.Secret), emailNotifier, cfg.Links.BaseURL, time.Duration(cfg.Verification.TTLSecs)*time.Second, time.Duration(cfg.Verification.ResendCooldownSecs)*time.Second, cfg.Verification.MaxPerHour)
+	}
+
+	if cfg.Notifications.SMS.AccountSID != "" {
+		log.Info().Msg("sms notifications enabled")
+		notifiers = append(notifiers, notifier.NewSMS(cfg.Notifications.SMS.BaseURL, cfg.Notifications.SMS.AccountSID, cfg.Notifications.SMS.AuthToken, cfg.Notifications.SMS.From))
+	}
+
+	if len(cfg.Notifications.Webhooks) > 0 {
+		var endpoints []notifier.WebhookEndpoint
+		for _, webhook := range cfg.Notifications.Webhooks {
+			endpoints = append(endpoints, notifier.WebhookEndpoint{URL: webhook.URL, Secret: webhook.Secret, Timeout: time.Duration(webhook.TimeoutSecs) * time.Second, MaxAttempts: webhook.MaxAttempts})
+		}
+
+		log.Info().Int("count", len(endpoints)).Msg("webhook notifications enabled")
+		notifiers = append(notifiers, notifier.NewWebhook(endpoints...))
+	}
+
+	// always enabled, watchers can register their own chat webhooks even without global channels
+	notifiers = append(notifiers, notifier.NewDiscord(), notifier.NewSlack())
+	if len(cfg.Notifications.Discord.Webhooks) > 0 {
+		log.Info().Int("count", len(cfg.Notifications.Discord.Webhooks)).Msg("discord channel notifications enabled")
+		notifiers = append(notifiers, notifier.NewDiscord(cfg.Notifications.Discord.Webhooks...))
+	}
+	if len(cfg.Notifications.Slack.Webhooks) > 0 {
+		log.Info().Int("count", len(cfg.Notifications.Slack.Webhooks)).Msg("slack channel notifications enabled")
+		notifiers = append(notifiers, notifier.NewSlack(cfg.Notifications.Slack.Webhooks...))
+	}
+	notifiers = append(notifiers, notifier.NewNtfy(cfg.Notifications.Ntfy.BaseURL, cfg.Notifications.Ntfy.Token, cfg.Notifications.Ntfy.Priority, unsubscribeService, cfg.Notifications.Ntfy.Tags...))
+
+	var telegramClient telegram.Client
+	if cfg.Notifications.Telegram.Token != "" {
+		log.Info().Msg("telegram notifications enabled")
+		telegramClient = telegram.NewClient(cfg.Notifications.Telegram.BaseURL, cfg.Notifications.Telegram.Token)
+		notifiers = append(notifiers, notifier.NewTelegram(telegramClient))
+	}
+
+	if cfg.Notifications.Gotify.Token != "" {
+		log.Info().Msg("gotify notifications enabled")
+		notifiers = append(notifiers, notifier.NewGotify(cfg.Notifications.Gotify.BaseURL, cfg.Notifications.Gotify.Token, cfg.Notifications.Gotify.Priority))
+	}
+
+	active, composites, err := composeNotifiers(cfg.Notifications.Multi, notifiers)
+	if err != nil {
+		log.Fatal().Msgf("failed to create multi notifiers: %v", err)
+	}
+	// the worker keeps the children of composites, so jobs queued for them before the composite was configured still go out
+	workerNotifiers := append(append([]coursesense.Notifier{}, notifiers...), composites...)
+	notifiers = append(active, composites...)
 
-	register := register.NewRegister(webadvisorService, repository)
-	trigger := trigger.NewTrigger(webadvisorService, repository, emailNotifier)
+	conflictChecker := timetable.NewChecker(webadvisorService)
+
+	register := register.NewRegister(webadvisorService, repository, cfg.Terms, verificationService)
+	trigger := trigger.NewTrigger(webadvisorService, repository, conflictChecker, cfg.Notifications, notifiers...)
+
+	var telegramService coursesense.TelegramService
+	if cfg.Notifications.Telegram.Token != "" {
+		bot := telegram.NewBot(telegramClient, register, repository, cfg.Notifications.Telegram.WebhookSecret)
+		if cfg.Notifications.Telegram.Updates == "webhook" {
+			if err := bot.SetWebhook(ctx, strings.TrimSuffix(cfg.Links.BaseURL, "/")+"/telegram/webhook"); err != nil {
+				log.Fatal().Msgf("failed to start telegram bot: %v", err)
+			}
+			telegramService = bot
+		} else {
+			go bot.Poll(ctx, time.Duration(cfg.Notifications.Telegram.PollTimeoutSecs)*time.Second)
+		}
+	}
+
+	var monitor coursesense.HealthMonitor
+	contact := coursesense.Watcher{Channels: coursesense.LegacyContact{Email: cfg.Alerts.Contact.Email, Phone: cfg.Alerts.Contact.Phone, Topic: cfg.Alerts.Contact.Topic, DiscordWebhook: cfg.Alerts.Contact.DiscordWebhook, SlackWebhook: cfg.Alerts.Contact.SlackWebhook}.Channels()}
+	if cfg.Alerts.Contact.Telegram != "" {
+		contact.Channels = append(contact.Channels, coursesense.Channel{Kind: coursesense.ChannelTelegram, Address: cfg.Alerts.Contact.Telegram, Preference: coursesense.PreferenceAll})
+	}
+	if len(contact.Channels) > 0 {
+		if err := contact.Valid(); err != nil {
+			log.Fatal().Msgf("invalid alert contact: %v", err)
+		}
+
+		alertMonitor := alert.NewMonitor(cfg.Alerts, contact, workerNotifiers...)
+		go alertMonitor.Run(ctx)
+		monitor = alertMonitor
+	}
+
+	worker := outbox.NewWorker(repository, cfg.Outbox, monitor, workerNotifiers...)
+	go worker.Run(ctx)
 
 	go func() {
 		log.Info().Msgf("starting poll ticker: polling every %d seconds", cfg.PollIntervalSecs)
@@ -70,6 +206,9 @@ func main() {
 				if err != nil {
 					log.Error().Msgf("failure occured during trigger: %v", err)
 				}
+				if monitor != nil {
+					monitor.ObserveTrigger(err)
+				}
 			}
 		}
 	}()
@@ -79,8 +218,57 @@ func main() {
 		port = "8080"
 	}
 
-	srv := server.NewServer(fmt.Sprintf(":%s", port), register, trigger)
+	srv := server.NewServer(fmt.Sprintf(":%s", port), register, trigger, conflictChecker, worker, unsubscribeService, verificationService, mailSinkService, telegramService, cfg.Admin.Token)
 	if err = srv.Start(ctx); err != nil {
 		log.Fatal().Msgf("Server failure: %v", err)
 	}
+
+	// the memory repository saves its snapshot here
+	if closer, ok := repository.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			log.Error().Msgf("failed to close repository: %v", err)
+		}
+	}
+}
+
+// builds the configured composites, returning them along with the notifiers that aren't a child of one
+func composeNotifiers(multis []config.Multi, notifiers []coursesense.Notifier) ([]coursesense.Notifier, []coursesense.Notifier, error) {
+	byName := make(map[string]coursesense.Notifier, len(notifiers))
+	for _, n := range notifiers {
+		byName[n.Name()] = n
+	}
+
+	used := make(map[string]bool)
+	var composites []coursesense.Notifier
+	for _, multi := range multis {
+		if _, ok := byName[multi.Name]; ok {
+			return nil, nil, fmt.Errorf("multi notifier %s clashes with a notifier of the same name", multi.Name)
+		}
+
+		var children []notifier.Child
+		for _, child := range multi.Children {
+			n, ok := byName[child.Notifier]
+			if !ok {
+				return nil, nil, fmt.Errorf("multi notifier %s uses unknown or disabled notifier %s", multi.Name, child.Notifier)
+			}
+			children = append(children, notifier.Child{Notifier: n, Policy: notifier.Policy(child.Policy), Timeout: time.Duration(child.TimeoutSecs) * time.Second})
+			used[child.Notifier] = true
+		}
+
+		composite, err := notifier.NewMulti(multi.Name, children...)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create multi notifier %s: %w", multi.Name, err)
+		}
+		log.Info().Int("children", len(children)).Msgf("multi notifier %s enabled", multi.Name)
+		composites = append(composites, composite)
+	}
+
+	var active []coursesense.Notifier
+	for _, n := range notifiers {
+		if !used[n.Name()] {
+			active = append(active, n)
+		}
+	}
+
+	return active, composites, nil
 }
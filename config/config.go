@@ -2,16 +2,49 @@ package config
 
 import (
 	"fmt"
+	"net/mail"
 	"strings"
 
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/viper"
+
+	coursesense "github.com/jacobmichels/Course-Sense-Go"
 )
 
 // returns a slice of the supported db names
 // a function is used to access this list instead of a global slice to prevent accidental mutation of the slice
 func getSupportedDbs() []string {
-	return []string{"sqlite", "firestore"}
+	return []string{"sqlite", "firestore", "postgres", "memory"}
+}
+
+// returns a slice of the supported ways to secure the smtp connection
+func getSupportedSMTPSecurity() []string {
+	return []string{"implicit", "starttls", "none"}
+}
+
+// returns a slice of the supported layouts of captured emails
+func getSupportedMailSinkFormats() []string {
+	return []string{"eml", "maildir"}
+}
+
+// returns a slice of the supported ways of receiving telegram updates
+func getSupportedTelegramUpdates() []string {
+	return []string{"polling", "webhook"}
+}
+
+// returns a slice of the supported composite notifier child policies
+func getSupportedPolicies() []string {
+	return []string{"required", "best_effort", "fallback"}
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
 }
 
 // reads the config file
@@ -27,12 +60,69 @@ func ParseConfig() (Config, error) {
 	viper.SetDefault("database.firestore.credentials_file", "")
 	viper.SetDefault("database.firestore.section_collection_id", "sections")
 	viper.SetDefault("database.firestore.watcher_collection_id", "watchers")
+	viper.SetDefault("database.firestore.group_collection_id", "groups")
+	viper.SetDefault("database.firestore.job_collection_id", "jobs")
+	viper.SetDefault("database.firestore.digest_collection_id", "digests")
 	viper.SetDefault("database.sqlite.connection_string", "")
+	viper.SetDefault("database.postgres.connection_string", "")
+	viper.SetDefault("database.memory.snapshot_file", "")
 	viper.SetDefault("notifications.emailsmtp.port", 0)
 	viper.SetDefault("notifications.emailsmtp.host", "")
 	viper.SetDefault("notifications.emailsmtp.username", "")
 	viper.SetDefault("notifications.emailsmtp.password", "")
 	viper.SetDefault("notifications.emailsmtp.from", "")
+	viper.SetDefault("notifications.emailsmtp.security", "starttls")
+	viper.SetDefault("notifications.emailsmtp.template_dir", "")
+	viper.SetDefault("notifications.sms.base_url", "https://api.twilio.com")
+	viper.SetDefault("notifications.sms.account_sid", "")
+	viper.SetDefault("notifications.sms.auth_token", "")
+	viper.SetDefault("notifications.sms.from", "")
+	viper.SetDefault("notifications.ntfy.base_url", "https://ntfy.sh")
+	viper.SetDefault("notifications.ntfy.token", "")
+	viper.SetDefault("notifications.ntfy.priority", 4)
+	viper.SetDefault("notifications.gotify.base_url", "")
+	viper.SetDefault("notifications.gotify.token", "")
+	viper.SetDefault("notifications.gotify.priority", 8)
+	viper.SetDefault("notifications.notify_on_expiry", false)
+	viper.SetDefault("notifications.fair.enabled", false)
+	viper.SetDefault("notifications.fair.multiplier", 1)
+	viper.SetDefault("notifications.digest.window_secs", 3600)
+	viper.SetDefault("notifications.digest.urgent_seats", 1)
+	viper.SetDefault("notifications.mailsink.dir", "")
+	viper.SetDefault("notifications.mailsink.format", "eml")
+	viper.SetDefault("notifications.mailsink.smtp_addr", "")
+	viper.SetDefault("notifications.telegram.token", "")
+	viper.SetDefault("notifications.telegram.base_url", "https://api.telegram.org")
+	viper.SetDefault("notifications.telegram.updates", "polling")
+	viper.SetDefault("notifications.telegram.webhook_secret", "")
+	viper.SetDefault("notifications.telegram.poll_timeout_secs", 30)
+
+	viper.SetDefault("outbox.poll_interval_secs", 5)
+	viper.SetDefault("outbox.batch_size", 50)
+	viper.SetDefault("outbox.max_attempts", 8)
+	viper.SetDefault("outbox.base_backoff_secs", 30)
+	viper.SetDefault("outbox.max_backoff_secs", 3600)
+	viper.SetDefault("outbox.attempt_timeout_secs", 60)
+	viper.SetDefault("admin.token", "")
+	viper.SetDefault("links.base_url", "")
+	viper.SetDefault("links.secret", "")
+	viper.SetDefault("links.unsubscribe_ttl_secs", 30*24*60*60)
+	viper.SetDefault("alerts.contact.email", "")
+	viper.SetDefault("alerts.contact.phone", "")
+	viper.SetDefault("alerts.contact.topic", "")
+	viper.SetDefault("alerts.contact.discord_webhook", "")
+	viper.SetDefault("alerts.contact.slack_webhook", "")
+	viper.SetDefault("alerts.contact.telegram", "")
+	viper.SetDefault("alerts.consecutive_failures", 3)
+	viper.SetDefault("alerts.stale_poll_mins", 30)
+	viper.SetDefault("alerts.schema_errors", true)
+	viper.SetDefault("alerts.smtp_auth", true)
+	viper.SetDefault("alerts.check_interval_secs", 60)
+	viper.SetDefault("alerts.repeat_secs", 6*60*60)
+	viper.SetDefault("verification.enabled", false)
+	viper.SetDefault("verification.ttl_secs", 48*60*60)
+	viper.SetDefault("verification.resend_cooldown_secs", 10*60)
+	viper.SetDefault("verification.max_per_hour", 5)
 
 	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
 	viper.AutomaticEnv()
@@ -51,6 +141,13 @@ func ParseConfig() (Config, error) {
 		return Config{}, fmt.Errorf("failed to unmarshal config: %s", err)
 	}
 
+	// viper lowercases map keys, but term codes are uppercase everywhere else
+	terms := make(map[string]Term, len(cfg.Terms))
+	for code, term := range cfg.Terms {
+		terms[strings.ToUpper(code)] = term
+	}
+	cfg.Terms = terms
+
 	if err := validateConfig(cfg); err != nil {
 		return Config{}, fmt.Errorf("invalid config: %w", err)
 	}
@@ -61,7 +158,7 @@ func ParseConfig() (Config, error) {
 func validateConfig(cfg Config) error {
 	if cfg.Database.Type == "" {
 		return fmt.Errorf("no database type set. database type can be one of: %v", getSupportedDbs())
-	} else if cfg.Database.Type != "sqlite" && cfg.Database.Type != "firestore" {
+	} else if !contains(getSupportedDbs(), cfg.Database.Type) {
 		return fmt.Errorf("bad database type. database type can be one of: %v", getSupportedDbs())
 	}
 
@@ -69,5 +166,179 @@ func validateConfig(cfg Config) error {
 		log.Info().Msgf("warn: sqlite connection string is empty")
 	}
 
+	if cfg.Database.Type == "postgres" && cfg.Database.Postgres.ConnectionString == "" {
+		return fmt.Errorf("postgres connection string is required")
+	}
+
+	if cfg.Notifications.EmailSmtp.Host != "" {
+		if _, err := mail.ParseAddress(cfg.Notifications.EmailSmtp.From); err != nil {
+			return fmt.Errorf("bad email sender: %w", err)
+		}
+
+		if !contains(getSupportedSMTPSecurity(), cfg.Notifications.EmailSmtp.Security) {
+			return fmt.Errorf("bad smtp security. smtp security can be one of: %v", getSupportedSMTPSecurity())
+		}
+	}
+
+	if cfg.Notifications.MailSink.Dir != "" {
+		if !contains(getSupportedMailSinkFormats(), cfg.Notifications.MailSink.Format) {
+			return fmt.Errorf("bad mail sink format. mail sink format can be one of: %v", getSupportedMailSinkFormats())
+		}
+
+		if cfg.Notifications.EmailSmtp.From != "" {
+			if _, err := mail.ParseAddress(cfg.Notifications.EmailSmtp.From); err != nil {
+				return fmt.Errorf("bad email sender: %w", err)
+			}
+		}
+	} else if cfg.Notifications.MailSink.SMTPAddr != "" {
+		return fmt.Errorf("the mail sink smtp server needs a mail sink directory")
+	}
+
+	if cfg.Notifications.Telegram.Token != "" {
+		switch cfg.Notifications.Telegram.Updates {
+		case "polling":
+			if cfg.Notifications.Telegram.PollTimeoutSecs <= 0 {
+				return fmt.Errorf("telegram poll timeout must be positive")
+			}
+		case "webhook":
+			if cfg.Links.BaseURL == "" {
+				return fmt.Errorf("telegram webhooks need links to be configured")
+			}
+			if !validWebhookSecret(cfg.Notifications.Telegram.WebhookSecret) {
+				return fmt.Errorf("telegram webhooks need a secret of 1 to 256 letters, digits, underscores and dashes")
+			}
+		default:
+			return fmt.Errorf("bad telegram updates. telegram updates can be one of: %v", getSupportedTelegramUpdates())
+		}
+	}
+
+	if cfg.Notifications.SMS.AccountSID != "" {
+		if _, err := coursesense.NormalizePhone(cfg.Notifications.SMS.From); err != nil {
+			return fmt.Errorf("bad sms sender: %w", err)
+		}
+	}
+
+	for _, webhook := range append(cfg.Notifications.Discord.Webhooks, cfg.Notifications.Slack.Webhooks...) {
+		if !strings.HasPrefix(webhook, "https://") && !strings.HasPrefix(webhook, "http://") {
+			return fmt.Errorf("bad chat webhook url %q", webhook)
+		}
+	}
+
+	if p := cfg.Notifications.Ntfy.Priority; p < 1 || p > 5 {
+		return fmt.Errorf("ntfy priority must be between 1 and 5")
+	}
+
+	if cfg.Notifications.Gotify.Token != "" {
+		if cfg.Notifications.Gotify.BaseURL == "" {
+			return fmt.Errorf("gotify needs a base url")
+		}
+		if p := cfg.Notifications.Gotify.Priority; p < 0 || p > 10 {
+			return fmt.Errorf("gotify priority must be between 0 and 10")
+		}
+	}
+
+	for _, webhook := range cfg.Notifications.Webhooks {
+		if webhook.URL == "" || webhook.Secret == "" {
+			return fmt.Errorf("webhooks need both a url and a secret")
+		}
+	}
+
+	if cfg.Notifications.Fair.Enabled && cfg.Notifications.Fair.Multiplier <= 0 {
+		return fmt.Errorf("fair notification multiplier must be positive")
+	}
+
+	names := make(map[string]bool)
+	for _, multi := range cfg.Notifications.Multi {
+		if multi.Name == "" || names[multi.Name] {
+			return fmt.Errorf("multi notifiers need a unique name")
+		}
+		names[multi.Name] = true
+
+		if len(multi.Children) == 0 {
+			return fmt.Errorf("multi notifier %s has no children", multi.Name)
+		}
+
+		for i, child := range multi.Children {
+			if !contains(getSupportedPolicies(), child.Policy) {
+				return fmt.Errorf("bad policy for %s in multi notifier %s. policy can be one of: %v", child.Notifier, multi.Name, getSupportedPolicies())
+			}
+			if i == 0 && child.Policy == "fallback" {
+				return fmt.Errorf("the first child of multi notifier %s cannot be a fallback", multi.Name)
+			}
+			if child.TimeoutSecs < 0 {
+				return fmt.Errorf("child timeouts cannot be negative")
+			}
+		}
+	}
+
+	if cfg.Notifications.Digest.WindowSecs <= 0 {
+		return fmt.Errorf("digest window must be positive")
+	}
+
+	if cfg.Notifications.Digest.UrgentSeats < 0 {
+		return fmt.Errorf("digest urgent seats cannot be negative")
+	}
+
+	if (cfg.Links.BaseURL == "") != (cfg.Links.Secret == "") {
+		return fmt.Errorf("links need both a base url and a secret")
+	}
+
+	if cfg.Links.BaseURL != "" {
+		if !strings.HasPrefix(cfg.Links.BaseURL, "https://") && !strings.HasPrefix(cfg.Links.BaseURL, "http://") {
+			return fmt.Errorf("bad links base url %q", cfg.Links.BaseURL)
+		}
+		if cfg.Links.UnsubscribeTTLSecs <= 0 {
+			return fmt.Errorf("unsubscribe link ttl must be positive")
+		}
+	}
+
+	if cfg.Verification.Enabled {
+		if cfg.Links.BaseURL == "" {
+			return fmt.Errorf("email verification needs links to be configured")
+		}
+		if cfg.Notifications.EmailSmtp.Host == "" && cfg.Notifications.MailSink.Dir == "" {
+			return fmt.Errorf("email verification needs smtp or the mail sink to be configured")
+		}
+		if cfg.Verification.TTLSecs <= 0 {
+			return fmt.Errorf("verification ttl must be positive")
+		}
+		if cfg.Verification.ResendCooldownSecs < 0 || cfg.Verification.MaxPerHour < 0 {
+			return fmt.Errorf("verification resend cooldown and hourly cap cannot be negative")
+		}
+	}
+
+	if cfg.Alerts.ConsecutiveFailures < 0 || cfg.Alerts.StalePollMins < 0 || cfg.Alerts.RepeatSecs < 0 {
+		return fmt.Errorf("alert thresholds cannot be negative")
+	}
+
+	if cfg.Alerts.CheckIntervalSecs <= 0 {
+		return fmt.Errorf("alert check interval must be positive")
+	}
+
+	if cfg.Outbox.PollIntervalSecs <= 0 || cfg.Outbox.BatchSize <= 0 || cfg.Outbox.MaxAttempts <= 0 || cfg.Outbox.BaseBackoffSecs <= 0 || cfg.Outbox.MaxBackoffSecs <= 0 || cfg.Outbox.AttemptTimeoutSecs <= 0 {
+		return fmt.Errorf("outbox settings must be positive")
+	}
+
+	for code, term := range cfg.Terms {
+		if _, err := term.Deadline(); err != nil {
+			return fmt.Errorf("bad config for term %s: %w", code, err)
+		}
+	}
+
 	return nil
 }
+
+// telegram only accepts secret tokens made of these characters
+func validWebhookSecret(secret string) bool {
+	if len(secret) == 0 || len(secret) > 256 {
+		return false
+	}
+
+	for _, r := range secret {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '-') {
+			return false
+		}
+	}
+
+	return true
+}
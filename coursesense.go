@@ -2,8 +2,13 @@ package coursesense
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 )
 
 // Domain types are defined in this file
@@ -44,42 +49,833 @@ func (s Section) String() string {
 	return fmt.Sprintf("%s*%d*%s*%s", s.Course.Department, s.Course.Code, s.Code, s.Term)
 }
 
+// ParseSection parses a section in the DEPT*CODE*SECTION*TERM form returned by String
+func ParseSection(s string) (Section, error) {
+	parts := strings.Split(s, "*")
+	if len(parts) != 4 {
+		return Section{}, fmt.Errorf("malformed section %q", s)
+	}
+
+	code, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return Section{}, fmt.Errorf("malformed section %q", s)
+	}
+
+	return Section{Course: Course{Department: parts[0], Code: code}, Code: parts[2], Term: parts[3]}, nil
+}
+
 // Service that gets information on course sections
 type SectionService interface {
 	Exists(context.Context, Section) (bool, error)
 	GetAvailableSeats(context.Context, Section) (uint, error)
+	// Returns every section of a course offered in a term, mapped to its available seats
+	GetCourseSections(context.Context, Course, string) (map[Section]uint, error)
+	// Returns the weekly meeting times of a section
+	GetMeetings(context.Context, Section) ([]Meeting, error)
+}
+
+// Service that checks sections against a watcher's timetable
+type ConflictService interface {
+	// Returns the given sections that conflict with the timetable
+	Conflicts(context.Context, Timetable, []Section) ([]Section, error)
+}
+
+// Implemented by conflict services that can remember the meetings they look up, so a trigger looks each section up once
+type CachingConflictService interface {
+	ConflictService
+	// Returns a service that looks up the meetings of each section at most once
+	WithMeetingCache() ConflictService
 }
 
 // A user registered for notifications on a Section
 type Watcher struct {
-	Email string `json:"email"`
-	Phone string `json:"phone"`
+	// Where the watcher is notified, at most one channel of each kind
+	Channels []Channel `json:"channels"`
+	// The watch is purged once this time passes. A zero value means the watch never expires
+	ExpiresAt time.Time `json:"expires_at"`
+	// IANA timezone name used to interpret QuietHours. Defaults to UTC
+	Timezone   string     `json:"timezone"`
+	QuietHours QuietHours `json:"quiet_hours"`
+	// Set once an opening found the watcher in quiet hours. Broadcast and urgent notifiers have fired,
+	// the remaining notifiers are held until the window ends. Cleared if the seats close first
+	Held      bool      `json:"-"`
+	Timetable Timetable `json:"timetable"`
+	// Openings are gathered into a single digest message instead of being sent one by one
+	Digest bool `json:"digest"`
+	// The watcher's place in the section's queue, assigned by the repository in registration order
+	Position int `json:"-"`
+	// Set while the watcher hasn't confirmed their email address. Pending watches are never notified and are purged once this passes
+	VerifyBy time.Time `json:"-"`
+	// Language messages to the watcher are written in, e.g. "fr". Defaults to English
+	Locale string `json:"locale"`
+}
+
+// Pending reports whether the watch is waiting on the watcher to confirm their email address
+func (w Watcher) Pending() bool {
+	return !w.VerifyBy.IsZero()
 }
 
 func (w Watcher) Valid() error {
-	if w.Email == "" && w.Phone == "" {
-		return errors.New("At least one contact method needs to be present")
+	if len(w.Channels) == 0 {
+		return errors.New("At least one contact channel needs to be present")
+	}
+	seen := make(map[ChannelKind]bool)
+	for _, channel := range w.Channels {
+		if err := channel.Valid(); err != nil {
+			return err
+		}
+		if seen[channel.Kind] {
+			return fmt.Errorf("Only one %s channel can be present", channel.Kind)
+		}
+		seen[channel.Kind] = true
+	}
+	if !w.ExpiresAt.IsZero() && w.ExpiresAt.Before(time.Now()) {
+		return errors.New("Expiry cannot be in the past")
+	}
+	if _, err := time.LoadLocation(w.Timezone); err != nil {
+		return fmt.Errorf("Unknown timezone %q", w.Timezone)
+	}
+	if err := w.Timetable.Valid(); err != nil {
+		return err
 	}
 
-	return nil
+	return w.QuietHours.Valid()
+}
+
+// InQuietHours reports whether the given time falls in the watcher's quiet hours
+func (w Watcher) InQuietHours(now time.Time) bool {
+	location, err := time.LoadLocation(w.Timezone)
+	if err != nil {
+		location = time.UTC
+	}
+
+	return w.QuietHours.Contains(now.In(location))
+}
+
+// Expired reports whether the watch has passed its expiry at the given time
+func (w Watcher) Expired(now time.Time) bool {
+	return !w.ExpiresAt.IsZero() && !w.ExpiresAt.After(now)
 }
 
+// describes the watcher for logs. Webhook URLs are credentials, so only their kind is shown
 func (w Watcher) String() string {
-	return fmt.Sprintf("%s:%s", w.Email, w.Phone)
+	var contacts []string
+	for _, channel := range w.sortedChannels() {
+		if channel.Kind == ChannelDiscord || channel.Kind == ChannelSlack {
+			contacts = append(contacts, string(channel.Kind))
+			continue
+		}
+		contacts = append(contacts, channel.Address)
+	}
+
+	return strings.Join(contacts, ",")
+}
+
+// ContactKey identifies a watcher by all of its channels. Two watchers with the same key are the same person
+func (w Watcher) ContactKey() string {
+	var contacts []string
+	for _, channel := range w.sortedChannels() {
+		contacts = append(contacts, fmt.Sprintf("%s:%s", channel.Kind, channel.Address))
+	}
+
+	return strings.Join(contacts, "|")
+}
+
+// Channel returns the watcher's channel of the given kind
+func (w Watcher) Channel(kind ChannelKind) (Channel, bool) {
+	for _, channel := range w.Channels {
+		if channel.Kind == kind {
+			return channel, true
+		}
+	}
+
+	return Channel{}, false
+}
+
+// Address returns the address of the watcher's channel of the given kind, or an empty string if there is none
+func (w Watcher) Address(kind ChannelKind) string {
+	channel, _ := w.Channel(kind)
+	return channel.Address
+}
+
+// Routes reports whether the watcher wants notifications of the given kind over a channel kind
+func (w Watcher) Routes(kind ChannelKind, notification NotificationKind) bool {
+	channel, ok := w.Channel(kind)
+	return ok && channel.Wants(notification)
+}
+
+// returns the channels in the order of channelKinds
+func (w Watcher) sortedChannels() []Channel {
+	var channels []Channel
+	for _, kind := range channelKinds() {
+		if channel, ok := w.Channel(kind); ok {
+			channels = append(channels, channel)
+		}
+	}
+
+	return channels
+}
+
+type ChannelKind string
+
+const (
+	// Address is an email address
+	ChannelEmail ChannelKind = "email"
+	// Address is a phone number
+	ChannelSMS ChannelKind = "sms"
+	// Address is an ntfy topic
+	ChannelPush ChannelKind = "push"
+	// Address is a Discord incoming webhook URL, e.g. a club's channel
+	ChannelDiscord ChannelKind = "discord"
+	// Address is a Slack incoming webhook URL
+	ChannelSlack ChannelKind = "slack"
+	// Address is a Telegram chat ID, linked by sending the bot a command
+	ChannelTelegram ChannelKind = "telegram"
+)
+
+// returns the supported channel kinds, in the order they appear in contact keys
+// a function is used to access this list instead of a global slice to prevent accidental mutation of the slice
+func channelKinds() []ChannelKind {
+	return []ChannelKind{ChannelEmail, ChannelSMS, ChannelPush, ChannelDiscord, ChannelSlack, ChannelTelegram}
+}
+
+// Which notifications a watcher wants over a channel
+type ChannelPreference string
+
+const (
+	// Every notification. The default
+	PreferenceAll ChannelPreference = "all"
+	// Only seat openings, not expiry notices
+	PreferenceOpenings ChannelPreference = "openings"
+	// Nothing, the channel is kept but not notified
+	PreferenceMuted ChannelPreference = "muted"
+)
+
+// A way of reaching a watcher
+type Channel struct {
+	Kind    ChannelKind `json:"kind"`
+	Address string      `json:"address"`
+	// Set by the service once the watcher proves they own the address, it can't be set when registering
+	Verified   bool              `json:"verified"`
+	Preference ChannelPreference `json:"preference,omitempty"`
+}
+
+func (c Channel) Valid() error {
+	if c.Address == "" {
+		return fmt.Errorf("The %s channel needs an address", c.Kind)
+	}
+
+	switch c.Kind {
+	case ChannelEmail:
+	case ChannelSMS:
+		if _, err := NormalizePhone(c.Address); err != nil {
+			return err
+		}
+	case ChannelPush:
+		if !validTopic(c.Address) {
+			return errors.New("Topic must be at most 64 letters, digits, dashes and underscores")
+		}
+	// only the platforms' own hosts are accepted, so registrations can't make us post to arbitrary URLs
+	case ChannelDiscord:
+		if !strings.HasPrefix(c.Address, "https://discord.com/api/webhooks/") && !strings.HasPrefix(c.Address, "https://discordapp.com/api/webhooks/") {
+			return errors.New("Discord webhook must be a https://discord.com/api/webhooks/ URL")
+		}
+	case ChannelSlack:
+		if !strings.HasPrefix(c.Address, "https://hooks.slack.com/") {
+			return errors.New("Slack webhook must be a https://hooks.slack.com/ URL")
+		}
+	case ChannelTelegram:
+		if _, err := strconv.ParseInt(c.Address, 10, 64); err != nil {
+			return errors.New("Telegram chat ID must be a number")
+		}
+	default:
+		return fmt.Errorf("Unknown channel kind %q, channel kind can be one of: %v", c.Kind, channelKinds())
+	}
+
+	switch c.Preference {
+	case "", PreferenceAll, PreferenceOpenings, PreferenceMuted:
+		return nil
+	default:
+		return fmt.Errorf("Unknown channel preference %q", c.Preference)
+	}
+}
+
+// Wants reports whether notifications of the given kind should be sent over the channel
+func (c Channel) Wants(notification NotificationKind) bool {
+	switch c.Preference {
+	case PreferenceMuted:
+		return false
+	case PreferenceOpenings:
+		return notification == NotificationSeatsAvailable
+	default:
+		return true
+	}
+}
+
+// The flat contact fields watchers had before channels. Still accepted by the API and read from older records
+type LegacyContact struct {
+	Email          string `json:"email,omitempty"`
+	Phone          string `json:"phone,omitempty"`
+	DiscordWebhook string `json:"discord_webhook,omitempty"`
+	SlackWebhook   string `json:"slack_webhook,omitempty"`
+	Topic          string `json:"topic,omitempty"`
+}
+
+// Channels converts the set fields into channels that receive every notification
+func (c LegacyContact) Channels() []Channel {
+	addresses := []struct {
+		kind    ChannelKind
+		address string
+	}{
+		{ChannelEmail, c.Email},
+		{ChannelSMS, c.Phone},
+		{ChannelPush, c.Topic},
+		{ChannelDiscord, c.DiscordWebhook},
+		{ChannelSlack, c.SlackWebhook},
+	}
+
+	var channels []Channel
+	for _, a := range addresses {
+		if a.address != "" {
+			channels = append(channels, Channel{Kind: a.kind, Address: a.address, Preference: PreferenceAll})
+		}
+	}
+
+	return channels
+}
+
+// ntfy topics are part of the publish URL, so they are limited to characters ntfy accepts
+func validTopic(topic string) bool {
+	if len(topic) > 64 {
+		return false
+	}
+
+	for _, r := range topic {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Converts a phone number to E.164 format, e.g. +15195551234
+// Numbers without a country code are assumed to be North American
+func NormalizePhone(phone string) (string, error) {
+	international := strings.HasPrefix(strings.TrimSpace(phone), "+")
+
+	var digits strings.Builder
+	for _, r := range phone {
+		switch {
+		case r >= '0' && r <= '9':
+			digits.WriteRune(r)
+		case r == '+' || r == ' ' || r == '-' || r == '.' || r == '(' || r == ')':
+			// formatting characters
+		default:
+			return "", fmt.Errorf("Phone number %q contains invalid characters", phone)
+		}
+	}
+
+	number := digits.String()
+	switch {
+	case international && len(number) >= 8 && len(number) <= 15:
+		return "+" + number, nil
+	case !international && len(number) == 10:
+		return "+1" + number, nil
+	case !international && len(number) == 11 && number[0] == '1':
+		return "+" + number, nil
+	}
+
+	return "", fmt.Errorf("Phone number %q is not a valid phone number", phone)
+}
+
+// A daily window during which non-urgent notifications are held. Times are HH:MM in the watcher's timezone
+// and the window may wrap past midnight, e.g. 22:00 to 07:00
+type QuietHours struct {
+	Start string `json:"start"`
+	End   string `json:"end"`
+	// Urgent notifiers (e.g. SMS) still fire during quiet hours unless this is set
+	HoldUrgent bool `json:"hold_urgent"`
+}
+
+// Enabled reports whether quiet hours have been set
+func (q QuietHours) Enabled() bool {
+	return q.Start != "" || q.End != ""
+}
+
+func (q QuietHours) Valid() error {
+	if !q.Enabled() {
+		return nil
+	}
+
+	if _, err := clockMinutes(q.Start); err != nil {
+		return errors.New("Quiet hours start must be formatted as HH:MM")
+	}
+	if _, err := clockMinutes(q.End); err != nil {
+		return errors.New("Quiet hours end must be formatted as HH:MM")
+	}
+
+	return nil
+}
+
+// Contains reports whether the wall clock time of t falls inside the window
+func (q QuietHours) Contains(t time.Time) bool {
+	if !q.Enabled() {
+		return false
+	}
+
+	startMinute, err := clockMinutes(q.Start)
+	if err != nil {
+		return false
+	}
+	endMinute, err := clockMinutes(q.End)
+	if err != nil {
+		return false
+	}
+
+	minute := t.Hour()*60 + t.Minute()
+
+	if startMinute <= endMinute {
+		return minute >= startMinute && minute < endMinute
+	}
+
+	// window wraps past midnight
+	return minute >= startMinute || minute < endMinute
+}
+
+// converts an HH:MM wall clock time into minutes after midnight
+func clockMinutes(clock string) (int, error) {
+	t, err := time.Parse("15:04", clock)
+	if err != nil {
+		return 0, err
+	}
+
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// A weekly block of time, such as a lecture. Times are HH:MM
+type Meeting struct {
+	Days  []time.Weekday `json:"days"`
+	Start string         `json:"start"`
+	End   string         `json:"end"`
+}
+
+func (m Meeting) Valid() error {
+	if len(m.Days) == 0 {
+		return errors.New("A meeting needs at least one day")
+	}
+	for _, day := range m.Days {
+		if day < time.Sunday || day > time.Saturday {
+			return errors.New("Meeting days must be between 0 (Sunday) and 6 (Saturday)")
+		}
+	}
+
+	start, err := clockMinutes(m.Start)
+	if err != nil {
+		return errors.New("Meeting start must be formatted as HH:MM")
+	}
+	end, err := clockMinutes(m.End)
+	if err != nil {
+		return errors.New("Meeting end must be formatted as HH:MM")
+	}
+	if end <= start {
+		return errors.New("Meeting end must be after its start")
+	}
+
+	return nil
+}
+
+// Overlaps reports whether two meetings share a day and overlap in time on it
+func (m Meeting) Overlaps(other Meeting) bool {
+	sharesDay := false
+	for _, day := range m.Days {
+		for _, otherDay := range other.Days {
+			sharesDay = sharesDay || day == otherDay
+		}
+	}
+	if !sharesDay {
+		return false
+	}
+
+	start, err := clockMinutes(m.Start)
+	if err != nil {
+		return false
+	}
+	end, err := clockMinutes(m.End)
+	if err != nil {
+		return false
+	}
+	otherStart, err := clockMinutes(other.Start)
+	if err != nil {
+		return false
+	}
+	otherEnd, err := clockMinutes(other.End)
+	if err != nil {
+		return false
+	}
+
+	return start < otherEnd && otherStart < end
+}
+
+// A watcher's current schedule, either as sections they are enrolled in or as raw meeting blocks
+// Openings that conflict with it are flagged in notifications, or skipped entirely if SkipConflicts is set
+type Timetable struct {
+	Sections      []Section `json:"sections"`
+	Meetings      []Meeting `json:"meetings"`
+	SkipConflicts bool      `json:"skip_conflicts"`
+}
+
+// Empty reports whether no timetable has been provided
+func (t Timetable) Empty() bool {
+	return len(t.Sections) == 0 && len(t.Meetings) == 0
+}
+
+func (t Timetable) Valid() error {
+	for _, section := range t.Sections {
+		if err := section.Valid(); err != nil {
+			return err
+		}
+	}
+
+	for _, meeting := range t.Meetings {
+		if err := meeting.Valid(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// A Watcher registered on a Section
+type Watch struct {
+	Section Section `json:"section"`
+	Watcher Watcher `json:"watcher"`
+}
+
+// A single registration covering several sections of the same course in a term
+// The watcher is notified once with every section that has seats, after which the whole group is cleared
+type WatchGroup struct {
+	ID     string `json:"id"`
+	Course Course `json:"course"`
+	Term   string `json:"term"`
+	// An empty list watches every section of the course in the term, including sections added after registration
+	Sections []Section `json:"sections"`
+	Watcher  Watcher   `json:"watcher"`
+}
+
+// WholeCourse reports whether the group watches every section of its course
+func (g WatchGroup) WholeCourse() bool {
+	return len(g.Sections) == 0
+}
+
+func (g WatchGroup) Valid() error {
+	if err := g.Course.Valid(); err != nil {
+		return err
+	}
+	if g.Term == "" {
+		return errors.New("Term cannot be empty")
+	}
+
+	for _, section := range g.Sections {
+		if err := section.Valid(); err != nil {
+			return err
+		}
+		if section.Course != g.Course || section.Term != g.Term {
+			return errors.New("All sections in a watch group must belong to the same course and term")
+		}
+	}
+
+	return g.Watcher.Valid()
+}
+
+func (g WatchGroup) String() string {
+	if g.WholeCourse() {
+		return fmt.Sprintf("%s*%d*%s", g.Course.Department, g.Course.Code, g.Term)
+	}
+
+	var codes []string
+	for _, section := range g.Sections {
+		codes = append(codes, section.Code)
+	}
+
+	return fmt.Sprintf("%s*%d*{%s}*%s", g.Course.Department, g.Course.Code, strings.Join(codes, ","), g.Term)
+}
+
+// SectionCodes returns the codes of the group's sections, sorted and each once
+func (g WatchGroup) SectionCodes() []string {
+	seen := make(map[string]bool)
+	var codes []string
+	for _, section := range g.Sections {
+		if !seen[section.Code] {
+			seen[section.Code] = true
+			codes = append(codes, section.Code)
+		}
+	}
+	sort.Strings(codes)
+
+	return codes
+}
+
+// SameWatch reports whether both groups watch the same sections of a course for the same contact, in whatever order
+func (g WatchGroup) SameWatch(other WatchGroup) bool {
+	return g.Watcher.ContactKey() == other.Watcher.ContactKey() && g.Course == other.Course && g.Term == other.Term &&
+		strings.Join(g.SectionCodes(), ",") == strings.Join(other.SectionCodes(), ",")
 }
 
 // Service that persists watched sections
 type Repository interface {
-	AddWatcher(context.Context, Section, Watcher) error
+	Outbox
+	Digests
+	// Persists the watcher to the section, reporting false if the watcher already watches it.
+	// An existing watch is left as it is
+	AddWatcher(context.Context, Section, Watcher) (bool, error)
 	GetWatchedSections(context.Context) ([]Section, error)
 	GetWatchers(context.Context, Section) ([]Watcher, error)
 	// This function removes a section and its watchers. It will also remove the associated course if no other sections reference it
 	Cleanup(context.Context, Section) error
+	// Removes every watch that expired at or before the given time, cleaning up sections left without watchers. The removed watches are returned.
+	// The jobs returned by notices, which may be nil, are enqueued along with the removal
+	PurgeExpired(ctx context.Context, now time.Time, notices func(Watch) []Job) ([]Watch, error)
+	// Removes every pending watch and watch group whose verification deadline is at or before the given time, cleaning up sections left without watchers.
+	// The number of removed watches and groups is returned
+	PurgeUnverified(ctx context.Context, now time.Time) (int, error)
+	// Removes a single watcher from a section, cleaning up the section if no watchers remain
+	RemoveWatcher(context.Context, Section, Watcher) error
+	// Overwrites the stored watcher on a section that has the same contact details
+	UpdateWatcher(context.Context, Section, Watcher) error
+	// Applies the changes to a section's watchers and enqueues the jobs in a single transaction
+	SettleSection(context.Context, SectionUpdate, ...Job) error
+	// Persists a watch group, reporting false if the watcher already has a group watching the same sections.
+	// An existing group is left as it is. The group's ID is assigned by the repository
+	AddWatchGroup(context.Context, WatchGroup) (bool, error)
+	GetWatchGroups(context.Context) ([]WatchGroup, error)
+	// Overwrites the watcher of the group with the same ID, enqueuing the jobs in the same transaction
+	UpdateWatchGroup(context.Context, WatchGroup, ...Job) error
+	// Removes a watch group and all of its sections, enqueuing the jobs in the same transaction
+	RemoveWatchGroup(context.Context, string, ...Job) error
+}
+
+// Changes to a section's watchers once they have been notified
+type SectionUpdate struct {
+	Section Section
+	// Watchers to remove. The section is cleaned up if none are left
+	Remove []Watcher
+	// Watchers to overwrite, matched on their contact details
+	Update []Watcher
+}
+
+type JobStatus string
+
+const (
+	// Waiting for its next delivery attempt
+	JobPending JobStatus = "pending"
+	// Delivery was given up on after too many failed attempts. Dead jobs stay in the outbox until replayed
+	JobDead JobStatus = "dead"
+)
+
+// A notification waiting in the outbox to be delivered to some watchers by one notifier
+type Job struct {
+	// Assigned by the repository
+	ID string `json:"id"`
+	// Name of the notifier delivering the job
+	Notifier     string       `json:"notifier"`
+	Notification Notification `json:"notification"`
+	Watchers     []Watcher    `json:"watchers"`
+	// Contact keys of the watchers each part of a composite notifier still has to reach, nil if every part reaches every watcher
+	Parts         map[string][]string `json:"parts,omitempty"`
+	Status        JobStatus           `json:"status"`
+	Attempts      int                 `json:"attempts"`
+	NextAttemptAt time.Time           `json:"next_attempt_at"`
+	LastError     string              `json:"last_error,omitempty"`
+	CreatedAt     time.Time           `json:"created_at"`
+}
+
+// Stores notification jobs until they are delivered
+type Outbox interface {
+	// Returns up to limit pending jobs due at the given time, pushing their next attempt back by the lease
+	// so they aren't claimed again while being delivered
+	ClaimJobs(ctx context.Context, now time.Time, limit int, lease time.Duration) ([]Job, error)
+	// Overwrites the job with the same ID
+	UpdateJob(context.Context, Job) error
+	// Removes a delivered job
+	CompleteJob(context.Context, string) error
+	GetJob(context.Context, string) (Job, error)
+	// Returns every job with the given status, oldest first
+	GetJobs(context.Context, JobStatus) ([]Job, error)
+}
+
+// Openings gathered for a digest watcher, sent as one notification once the window closes
+type Digest struct {
+	// Assigned by the repository
+	ID      string
+	Watcher Watcher
+	// The openings gathered so far, as a seat notification
+	Notification Notification
+	// When the digest is sent. Pulled in to the current time by an urgent opening
+	FlushAt time.Time
+}
+
+// Stores the digests of watchers, one per watcher
+type Digests interface {
+	// Merges the digest into the pending one of the same watcher, or stores it if the watcher has none.
+	// The merged digest keeps the earlier flush time and the latest watcher
+	AddToDigest(context.Context, Digest) error
+	// Returns the digests due at the given time
+	GetDueDigests(ctx context.Context, now time.Time) ([]Digest, error)
+	// Removes a sent digest, enqueuing the jobs delivering it in the same transaction
+	FlushDigest(context.Context, Digest, ...Job) error
+}
+
+// Admin operations on the outbox
+type OutboxService interface {
+	// Returns the jobs delivery was given up on
+	FailedJobs(context.Context) ([]Job, error)
+	// Puts a dead job back in the queue for immediate delivery
+	Replay(context.Context, string) error
+}
+
+type NotificationKind string
+
+const (
+	// Seats have been found in the watched sections
+	NotificationSeatsAvailable NotificationKind = "seats_available"
+	// The watch expired before seats were found and is no longer being polled
+	NotificationWatchExpired NotificationKind = "watch_expired"
+)
+
+// A message sent to Watchers about one or more Sections
+type Notification struct {
+	Kind     NotificationKind `json:"kind"`
+	Sections []Section        `json:"sections"`
+	// Set when the notification is about a whole course watch rather than specific sections.
+	// Sections still lists the open sections of a seat notification, but is empty when such a watch expires
+	Course *Course `json:"course,omitempty"`
+	Term   string  `json:"term,omitempty"`
+	// The sections that conflict with the recipient's timetable. Every other section is conflict-free
+	Conflicts []Section `json:"conflicts,omitempty"`
+	// Available seats per section, only set for seat notifications
+	Seats map[Section]uint `json:"-"`
+}
+
+// ConflictFree reports whether a section in the notification fits the recipient's timetable
+func (n Notification) ConflictFree(section Section) bool {
+	for _, conflict := range n.Conflicts {
+		if conflict == section {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Merge returns the notification with the sections of a later one added. Seat counts are taken from the later notification
+func (n Notification) Merge(later Notification) Notification {
+	merged := Notification{Kind: n.Kind, Seats: make(map[Section]uint, len(n.Seats)+len(later.Seats))}
+	// a digest spanning several courses isn't about one course
+	if n.Course != nil && later.Course != nil && *n.Course == *later.Course && n.Term == later.Term {
+		merged.Course, merged.Term = n.Course, n.Term
+	}
+
+	for _, notification := range []Notification{n, later} {
+		for _, section := range notification.Sections {
+			if _, ok := merged.Seats[section]; !ok {
+				merged.Sections = append(merged.Sections, section)
+			}
+			merged.Seats[section] = notification.Seats[section]
+		}
+	}
+
+	// the later notification reflects the watcher's current timetable
+	for _, section := range merged.Sections {
+		if !later.ConflictFree(section) || (!contains(later.Sections, section) && !n.ConflictFree(section)) {
+			merged.Conflicts = append(merged.Conflicts, section)
+		}
+	}
+
+	return merged
+}
+
+func contains(sections []Section, section Section) bool {
+	for _, s := range sections {
+		if s == section {
+			return true
+		}
+	}
+
+	return false
+}
+
+// JSON has no struct map keys, so seats are encoded as a list
+type notificationSeats struct {
+	Section Section `json:"section"`
+	Seats   uint    `json:"seats"`
+}
+
+func (n Notification) MarshalJSON() ([]byte, error) {
+	type notification Notification
+	encoded := struct {
+		notification
+		Seats []notificationSeats `json:"seats,omitempty"`
+	}{notification: notification(n)}
+
+	for _, section := range n.Sections {
+		if seats, ok := n.Seats[section]; ok {
+			encoded.Seats = append(encoded.Seats, notificationSeats{section, seats})
+		}
+	}
+
+	return json.Marshal(encoded)
+}
+
+func (n *Notification) UnmarshalJSON(data []byte) error {
+	type notification Notification
+	var decoded struct {
+		notification
+		Seats []notificationSeats `json:"seats"`
+	}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+
+	*n = Notification(decoded.notification)
+	if len(decoded.Seats) > 0 {
+		n.Seats = make(map[Section]uint, len(decoded.Seats))
+		for _, seats := range decoded.Seats {
+			n.Seats[seats.Section] = seats.Seats
+		}
+	}
+
+	return nil
 }
 
 // A type that sends can send notifications to Watchers
 type Notifier interface {
-	Notify(context.Context, Section, ...Watcher) error
+	// Identifies the notifier in outbox jobs, so it must be unique and stable across restarts
+	Name() string
+	// The kind of channel the notifier reaches watchers through. It is only given watchers that chose that channel.
+	// Notifiers with an empty kind broadcast to destinations of their own and are given every watcher, unless they are composite
+	Channel() ChannelKind
+	Notify(context.Context, Notification, ...Watcher) error
+	// Urgent notifiers are allowed to fire during a watcher's quiet hours
+	Urgent() bool
+}
+
+// Implemented by notifiers delivering through other notifiers. They have no channel of their own but don't broadcast either,
+// they are only given the watchers one of their children reaches
+type CompositeNotifier interface {
+	Notifier
+	Routes(Watcher, NotificationKind) bool
+	// The parts delivering independently of each other. Each is held during quiet hours and retried on its own,
+	// so a job names the watchers every part still has to reach
+	Parts() []NotifierPart
+}
+
+// An independent part of a composite notifier
+type NotifierPart struct {
+	// Unique within the composite
+	Name string
+	// Allowed to fire during a watcher's quiet hours
+	Urgent bool
 }
 
 type TriggerService interface {
@@ -88,4 +884,117 @@ type TriggerService interface {
 
 type RegistrationService interface {
 	Register(context.Context, Section, Watcher) error
+	RegisterGroup(context.Context, WatchGroup) error
+}
+
+var (
+	// The token was not signed by us or is malformed
+	ErrInvalidToken = errors.New("invalid token")
+	// The token was signed by us but is past its expiry
+	ErrExpiredToken = errors.New("expired token")
+	// The watch a link points to no longer exists
+	ErrWatchNotFound = errors.New("watch not found")
+	// The mail sink holds no email with the id
+	ErrEmailNotFound = errors.New("email not found")
+	// The address was sent as many verification emails as it may get for now
+	ErrTooManyVerifications = errors.New("too many verification emails")
+)
+
+// Lets watchers stop their watches through signed links, without logging in
+type UnsubscribeService interface {
+	// Returns a link removing the watches a notification to the watcher is about, or an empty string if links are disabled
+	UnsubscribeURL(Notification, Watcher) string
+	// Removes the watches identified by the token of an unsubscribe link. Watches that are already gone are ignored
+	Unsubscribe(ctx context.Context, token string) error
+}
+
+// An email asking a watcher to confirm their address before their watch becomes active
+type Verification struct {
+	Email string
+	// What is being watched, e.g. a section or a watch group
+	Watch string
+	// Opening the link activates the watch
+	URL       string
+	ExpiresAt time.Time
+	// Language the email is written in, the watcher's locale
+	Locale string
+}
+
+// Delivers verification emails. It is separate from the notifiers so tests and development setups can capture the emails
+type VerificationSender interface {
+	SendVerification(context.Context, Verification) error
+}
+
+// Confirms watchers' email addresses before their watches become active (double opt-in)
+type VerificationService interface {
+	// Returns the deadline for confirming a watcher registered now, or a zero time if the watcher needs no verification
+	Deadline(Watcher) time.Time
+	// Sends the watcher a link activating their pending watch on the section. A link for the same watch is only resent
+	// after a cooldown, and an address only gets so many an hour before ErrTooManyVerifications is returned
+	RequestSection(context.Context, Section, Watcher) error
+	// Sends the group's watcher a link activating the pending group, limited like RequestSection
+	RequestGroup(context.Context, WatchGroup) error
+	// Activates the watch identified by the token of a verification link. Watches that are already active are ignored
+	Verify(ctx context.Context, token string) error
+}
+
+// A message to the operators about the service's health
+type Alert struct {
+	// The rule that fired, e.g. "consecutive_failures"
+	Rule string
+	// False once the problem has cleared, the alert is then a recovery message
+	Firing  bool
+	Message string
+	// When the problem was first noticed
+	Since time.Time
+}
+
+// Title summarizes the alert in a line
+func (a Alert) Title() string {
+	if a.Firing {
+		return fmt.Sprintf("Course Sense alert: %s", a.Rule)
+	}
+
+	return fmt.Sprintf("Course Sense recovered: %s", a.Rule)
+}
+
+// Notifiers that can also deliver operator alerts, to the operators' own contact channels
+type Alerter interface {
+	Notifier
+	Alert(context.Context, Alert, Watcher) error
+}
+
+// Watches the outcome of polls and deliveries, alerting operators when they look unhealthy
+type HealthMonitor interface {
+	// Records the outcome of a trigger, nil if it succeeded
+	ObserveTrigger(error)
+	// Records the outcome of delivering a job through a notifier, nil if it succeeded
+	ObserveDelivery(notifier string, err error)
+}
+
+// An email the development mail sink captured instead of delivering
+type CapturedEmail struct {
+	ID      string
+	From    string
+	To      string
+	Subject string
+	Date    time.Time
+	// The bodies are only filled in when a single email is fetched
+	Text string
+	HTML string
+	Raw  []byte
+}
+
+// Lists the emails captured by the development mail sink
+type MailSinkService interface {
+	// Returns the captured emails, newest first
+	Emails(context.Context) ([]CapturedEmail, error)
+	// Returns a captured email along with its bodies, or ErrEmailNotFound
+	Email(ctx context.Context, id string) (CapturedEmail, error)
+}
+
+// Handles the chat commands Telegram users send the bot, e.g. /watch, when updates arrive through a webhook
+type TelegramService interface {
+	// Handles an update as posted by Telegram. The secret is the one the request carried, ErrInvalidToken is returned if it doesn't match
+	HandleUpdate(ctx context.Context, secret string, update []byte) error
 }
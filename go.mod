@@ -6,6 +6,7 @@ require (
 	cloud.google.com/go/firestore v1.10.0
 	github.com/golang-migrate/migrate/v4 v4.16.2
 	github.com/julienschmidt/httprouter v1.3.0
+	github.com/lib/pq v1.10.9
 	github.com/rs/zerolog v1.29.1
 	github.com/spf13/viper v1.16.0
 	google.golang.org/api v0.128.0
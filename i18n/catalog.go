@@ -0,0 +1,93 @@
+package i18n
+
+// Key identifies a message in the catalogs
+type Key string
+
+// register responses
+const (
+	ParseFailed         Key = "parse_failed"
+	InvalidRequest      Key = "invalid_request"
+	RegisterFailed      Key = "register_failed"
+	RegisterGroupFailed Key = "register_group_failed"
+	Registered          Key = "registered"
+	RegisteredGroup     Key = "registered_group"
+	ConfirmByEmail      Key = "confirm_by_email"
+)
+
+// notifications
+const (
+	SMSOpening      Key = "sms_opening"
+	SMSExpired      Key = "sms_expired"
+	Conflicts       Key = "conflicts"
+	CourseSection   Key = "course_section"
+	CourseSections  Key = "course_sections"
+	AndMoreSections Key = "and_more_sections"
+)
+
+// telegram bot replies
+const (
+	BotHelp        Key = "bot_help"
+	BotWatching    Key = "bot_watching"
+	BotBadSection  Key = "bot_bad_section"
+	BotWatchFailed Key = "bot_watch_failed"
+	BotNoWatches   Key = "bot_no_watches"
+	BotWatches     Key = "bot_watches"
+	BotStopped     Key = "bot_stopped"
+	BotNotWatching Key = "bot_not_watching"
+	BotFailed      Key = "bot_failed"
+)
+
+var catalogs = map[string]map[Key]string{
+	English: {
+		ParseFailed:         "Failed to parse request",
+		InvalidRequest:      "Invalid request body",
+		RegisterFailed:      "Registration failed, please ensure the course you are registering for exists. If error persists please contact service owner",
+		RegisterGroupFailed: "Registration failed, please ensure the sections or course you are registering for exist. If error persists please contact service owner",
+		Registered:          "Registered for section",
+		RegisteredGroup:     "Registered for sections",
+		ConfirmByEmail:      ", check your email to confirm the watch",
+
+		SMSOpening:      "Course Sense: space found in %s. Get over to WebAdvisor to claim it!",
+		SMSExpired:      "Course Sense: your watch on %s expired, we have stopped watching it.",
+		Conflicts:       "conflicts",
+		CourseSection:   "course section",
+		CourseSections:  "course sections",
+		AndMoreSections: "%s and %d more",
+
+		BotHelp:        "Send /watch DEPT*CODE*SECTION*TERM, e.g. /watch CIS*2750*0101*F23, to be messaged here when space opens up. /list shows your watches and /stop removes them, or just one with /stop CIS*2750*0101*F23.",
+		BotWatching:    "Watching %s, we will message you here when space opens up.",
+		BotBadSection:  "%q isn't a section, send it as DEPT*CODE*SECTION*TERM, e.g. CIS*2750*0101*F23.",
+		BotWatchFailed: "Couldn't watch %s, please make sure the section exists.",
+		BotNoWatches:   "You aren't watching anything.",
+		BotWatches:     "You are watching:\n%s",
+		BotStopped:     "Stopped watching %s.",
+		BotNotWatching: "You aren't watching %s.",
+		BotFailed:      "Something went wrong, please try again later.",
+	},
+	French: {
+		ParseFailed:         "Impossible de lire la requête",
+		InvalidRequest:      "Corps de requête invalide",
+		RegisterFailed:      "L'inscription a échoué, vérifiez que le cours demandé existe. Si l'erreur persiste, contactez le responsable du service",
+		RegisterGroupFailed: "L'inscription a échoué, vérifiez que les sections ou le cours demandés existent. Si l'erreur persiste, contactez le responsable du service",
+		Registered:          "Inscription à la section enregistrée",
+		RegisteredGroup:     "Inscription aux sections enregistrée",
+		ConfirmByEmail:      ", consultez vos courriels pour confirmer la surveillance",
+
+		SMSOpening:      "Course Sense : des places se sont libérées dans %s. Rendez-vous sur WebAdvisor pour les réserver !",
+		SMSExpired:      "Course Sense : votre surveillance de %s a expiré, nous avons cessé de la suivre.",
+		Conflicts:       "conflit d'horaire",
+		CourseSection:   "section de cours",
+		CourseSections:  "sections de cours",
+		AndMoreSections: "%s et %d de plus",
+
+		BotHelp:        "Envoyez /watch DEPT*CODE*SECTION*TRIMESTRE, par exemple /watch CIS*2750*0101*F23, pour recevoir un message ici lorsque des places se libèrent. /list affiche vos surveillances et /stop les supprime, ou une seule avec /stop CIS*2750*0101*F23.",
+		BotWatching:    "Surveillance de %s activée, nous vous écrirons ici lorsque des places se libèrent.",
+		BotBadSection:  "%q n'est pas une section, envoyez-la sous la forme DEPT*CODE*SECTION*TRIMESTRE, par exemple CIS*2750*0101*F23.",
+		BotWatchFailed: "Impossible de surveiller %s, vérifiez que la section existe.",
+		BotNoWatches:   "Vous ne surveillez rien.",
+		BotWatches:     "Vous surveillez :\n%s",
+		BotStopped:     "Surveillance arrêtée : %s.",
+		BotNotWatching: "Vous ne surveillez pas %s.",
+		BotFailed:      "Une erreur est survenue, veuillez réessayer plus tard.",
+	},
+}
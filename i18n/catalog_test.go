@@ -0,0 +1,51 @@
+package i18n
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// the formatting verbs of a message, e.g. %s or %d
+var verbs = regexp.MustCompile(`%[-+# 0-9.]*[a-zA-Z%]`)
+
+func TestCatalogsDefineEveryKey(t *testing.T) {
+	defaults := catalogs[English]
+	if len(defaults) == 0 {
+		t.Fatal("the English catalog is empty")
+	}
+
+	for _, locale := range Locales() {
+		t.Run(locale, func(t *testing.T) {
+			catalog, ok := catalogs[locale]
+			if !ok {
+				t.Fatalf("no catalog for %s", locale)
+			}
+
+			for key, message := range defaults {
+				translated, ok := catalog[key]
+				if !ok || strings.TrimSpace(translated) == "" {
+					t.Errorf("%s is missing %s", locale, key)
+					continue
+				}
+
+				// arguments are passed in the same order whatever the locale
+				if got, want := verbs.FindAllString(translated, -1), verbs.FindAllString(message, -1); strings.Join(got, " ") != strings.Join(want, " ") {
+					t.Errorf("%s %s has verbs %v, want %v", locale, key, got, want)
+				}
+			}
+
+			for key := range catalog {
+				if _, ok := defaults[key]; !ok {
+					t.Errorf("%s defines %s, which English doesn't", locale, key)
+				}
+			}
+		})
+	}
+
+	for locale := range catalogs {
+		if _, ok := Normalize(locale); !ok {
+			t.Errorf("catalog %s isn't a supported locale", locale)
+		}
+	}
+}
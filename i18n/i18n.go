@@ -0,0 +1,90 @@
+package i18n
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The locales messages are available in. English is the fallback for any message missing from another catalog
+const (
+	English = "en"
+	French  = "fr"
+)
+
+// Locales returns the supported locales, English first
+func Locales() []string {
+	return []string{English, French}
+}
+
+// Normalize returns the supported locale of a language tag, e.g. "fr" for "fr-CA". Tags are matched on their primary language
+func Normalize(tag string) (string, bool) {
+	language, _, _ := strings.Cut(strings.TrimSpace(tag), "-")
+	language, _, _ = strings.Cut(language, "_")
+	language = strings.ToLower(language)
+
+	for _, locale := range Locales() {
+		if language == locale {
+			return locale, true
+		}
+	}
+
+	return "", false
+}
+
+// Match returns the supported locale an Accept-Language header prefers most, or "" if it accepts none of them
+func Match(header string) string {
+	type preference struct {
+		tag     string
+		quality float64
+	}
+
+	var preferences []preference
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(part, ";")
+		tag = strings.TrimSpace(tag)
+		if tag == "" {
+			continue
+		}
+
+		quality := 1.0
+		if params = strings.TrimSpace(params); strings.HasPrefix(params, "q=") {
+			parsed, err := strconv.ParseFloat(strings.TrimPrefix(params, "q="), 64)
+			if err != nil {
+				continue
+			}
+			quality = parsed
+		}
+
+		// q=0 means the language is not acceptable
+		if quality > 0 {
+			preferences = append(preferences, preference{tag, quality})
+		}
+	}
+
+	// ties keep the order of the header
+	sort.SliceStable(preferences, func(i, j int) bool { return preferences[i].quality > preferences[j].quality })
+	for _, p := range preferences {
+		if locale, ok := Normalize(p.tag); ok {
+			return locale
+		}
+	}
+
+	return ""
+}
+
+// T returns the message for the key in the locale, formatted with the args.
+// Unknown locales and messages missing from a catalog fall back to English
+func T(locale string, key Key, args ...any) string {
+	message, ok := catalogs[locale][key]
+	if !ok {
+		message = catalogs[English][key]
+	}
+
+	if len(args) == 0 {
+		return message
+	}
+
+	return fmt.Sprintf(message, args...)
+}
@@ -0,0 +1,280 @@
+package mailsink
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	coursesense "github.com/jacobmichels/Course-Sense-Go"
+	"github.com/jacobmichels/Course-Sense-Go/notifier"
+)
+
+// Sink implements MailSinkService and can stand in for the SMTP transport
+var _ coursesense.MailSinkService = Sink{}
+var _ notifier.Transport = Sink{}
+
+// how captured emails are laid out on disk
+type Format string
+
+const (
+	// one .eml file per email, directly in the directory
+	FormatEML Format = "eml"
+	// a Maildir, so the directory can be opened in a mail client
+	FormatMaildir Format = "maildir"
+)
+
+// makes file names unique within the process, on top of the time and randomness
+var deliveries uint64
+
+// Captures emails as files instead of delivering them, for development and CI
+type Sink struct {
+	dir    string
+	format Format
+}
+
+// creates the directory, and the Maildir subdirectories if needed
+func NewSink(dir string, format Format) (Sink, error) {
+	subdirs := []string{""}
+	switch format {
+	case FormatEML:
+	case FormatMaildir:
+		subdirs = []string{"tmp", "new", "cur"}
+	default:
+		return Sink{}, fmt.Errorf("unknown mail sink format %q", format)
+	}
+
+	for _, subdir := range subdirs {
+		if err := os.MkdirAll(filepath.Join(dir, subdir), 0o755); err != nil {
+			return Sink{}, fmt.Errorf("failed to create mail sink directory: %w", err)
+		}
+	}
+
+	return Sink{dir, format}, nil
+}
+
+// Send captures every envelope, prefixed with the envelope's sender and recipient like a local delivery would
+func (s Sink) Send(ctx context.Context, envelopes ...notifier.Envelope) error {
+	failures := notifier.RecipientErrors{}
+	for _, envelope := range envelopes {
+		if _, err := s.Write(envelope.From, envelope.To, envelope.Data); err != nil {
+			failures[envelope.To] = err
+		}
+	}
+
+	if len(failures) > 0 {
+		return failures
+	}
+
+	return nil
+}
+
+// Write captures a message for one recipient, returning its id
+func (s Sink) Write(from, to string, data []byte) (string, error) {
+	id, err := newID()
+	if err != nil {
+		return "", err
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "Return-Path: <%s>\r\nDelivered-To: %s\r\n", from, to)
+	msg.Write(data)
+
+	// written aside and renamed into place, so readers never see half an email
+	tmp, final := filepath.Join(s.dir, "."+id+".tmp"), filepath.Join(s.dir, id+".eml")
+	if s.format == FormatMaildir {
+		tmp, final = filepath.Join(s.dir, "tmp", id), filepath.Join(s.dir, "new", id)
+	}
+
+	if err := os.WriteFile(tmp, msg.Bytes(), 0o644); err != nil {
+		return "", fmt.Errorf("failed to write email: %w", err)
+	}
+	if err := os.Rename(tmp, final); err != nil {
+		os.Remove(tmp)
+		return "", fmt.Errorf("failed to deliver email: %w", err)
+	}
+
+	log.Info().Msgf("Email to %s captured in %s", to, final)
+	return filepath.Base(final), nil
+}
+
+// a Maildir style unique name: seconds, then microseconds, pid, a counter and randomness
+func newID() (string, error) {
+	random := make([]byte, 4)
+	if _, err := rand.Read(random); err != nil {
+		return "", fmt.Errorf("failed to generate email id: %w", err)
+	}
+
+	now := time.Now()
+	return fmt.Sprintf("%d.M%06dP%dQ%dR%s", now.Unix(), now.Nanosecond()/1000, os.Getpid(), atomic.AddUint64(&deliveries, 1), hex.EncodeToString(random)), nil
+}
+
+// the directories captured emails are found in
+func (s Sink) dirs() []string {
+	if s.format == FormatMaildir {
+		return []string{filepath.Join(s.dir, "new"), filepath.Join(s.dir, "cur")}
+	}
+
+	return []string{s.dir}
+}
+
+func (s Sink) Emails(ctx context.Context) ([]coursesense.CapturedEmail, error) {
+	var emails []coursesense.CapturedEmail
+	for _, dir := range s.dirs() {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list captured emails: %w", err)
+		}
+
+		for _, entry := range entries {
+			if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+				continue
+			}
+
+			email, err := s.read(filepath.Join(dir, entry.Name()), false)
+			if errors.Is(err, fs.ErrNotExist) {
+				// a mail client moved it from new to cur in the meantime
+				continue
+			}
+			if err != nil {
+				log.Warn().Msgf("skipping unreadable captured email %s: %v", entry.Name(), err)
+				continue
+			}
+			emails = append(emails, email)
+		}
+	}
+
+	// ids start with the time they were captured, so they sort in capture order
+	sort.Slice(emails, func(i, j int) bool { return emails[i].ID > emails[j].ID })
+
+	return emails, nil
+}
+
+func (s Sink) Email(ctx context.Context, id string) (coursesense.CapturedEmail, error) {
+	// ids are file names, anything else could escape the directory
+	if id == "" || strings.HasPrefix(id, ".") || filepath.Base(id) != id {
+		return coursesense.CapturedEmail{}, coursesense.ErrEmailNotFound
+	}
+
+	for _, dir := range s.dirs() {
+		email, err := s.read(filepath.Join(dir, id), true)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+
+		return email, err
+	}
+
+	return coursesense.CapturedEmail{}, coursesense.ErrEmailNotFound
+}
+
+// parses a captured email, with its bodies if asked for
+func (s Sink) read(path string, bodies bool) (coursesense.CapturedEmail, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return coursesense.CapturedEmail{}, err
+	}
+
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return coursesense.CapturedEmail{}, fmt.Errorf("failed to parse email: %w", err)
+	}
+
+	var decoder mime.WordDecoder
+	subject, err := decoder.DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil {
+		subject = msg.Header.Get("Subject")
+	}
+
+	email := coursesense.CapturedEmail{
+		ID:      filepath.Base(path),
+		From:    msg.Header.Get("From"),
+		To:      msg.Header.Get("Delivered-To"),
+		Subject: subject,
+	}
+	if email.To == "" {
+		email.To = msg.Header.Get("To")
+	}
+	if email.Date, err = msg.Header.Date(); err != nil {
+		// fall back to when it was captured
+		if info, err := os.Stat(path); err == nil {
+			email.Date = info.ModTime()
+		}
+	}
+
+	if !bodies {
+		return email, nil
+	}
+
+	email.Raw = raw
+	if email.Text, email.HTML, err = readBodies(msg.Header.Get("Content-Type"), msg.Body); err != nil {
+		return coursesense.CapturedEmail{}, err
+	}
+
+	return email, nil
+}
+
+// returns the plain text and html bodies of a single part or multipart/alternative message.
+// Quoted-printable parts are decoded by the multipart reader
+func readBodies(contentType string, body io.Reader) (string, string, error) {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = "text/plain"
+	}
+
+	if !strings.HasPrefix(mediaType, "multipart/") {
+		contents, err := io.ReadAll(body)
+		if err != nil {
+			return "", "", fmt.Errorf("failed to read body: %w", err)
+		}
+		switch mediaType {
+		case "text/plain":
+			return string(contents), "", nil
+		case "text/html":
+			return "", string(contents), nil
+		default:
+			// attachments aren't shown
+			return "", "", nil
+		}
+	}
+
+	var text, html string
+	parts := multipart.NewReader(body, params["boundary"])
+	for {
+		part, err := parts.NextPart()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return "", "", fmt.Errorf("failed to read part: %w", err)
+		}
+
+		partText, partHTML, err := readBodies(part.Header.Get("Content-Type"), part)
+		if err != nil {
+			return "", "", err
+		}
+		if text == "" {
+			text = partText
+		}
+		if html == "" {
+			html = partHTML
+		}
+	}
+
+	return text, html, nil
+}
@@ -0,0 +1,145 @@
+package mailsink
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	coursesense "github.com/jacobmichels/Course-Sense-Go"
+	"github.com/jacobmichels/Course-Sense-Go/notifier"
+)
+
+const message = "From: coursesense@example.com\r\n" +
+	"To: a@example.com\r\n" +
+	"Subject: =?utf-8?q?Seats_open_in_CIS*2750?=\r\n" +
+	"Date: Fri, 01 Sep 2023 12:00:00 +0000\r\n" +
+	"MIME-Version: 1.0\r\n" +
+	"Content-Type: multipart/alternative; boundary=b\r\n" +
+	"\r\n" +
+	"--b\r\n" +
+	"Content-Type: text/plain; charset=utf-8\r\n" +
+	"\r\n" +
+	"3 seats open\r\n" +
+	"--b\r\n" +
+	"Content-Type: text/html; charset=utf-8\r\n" +
+	"\r\n" +
+	"<p>3 seats open</p>\r\n" +
+	"--b--\r\n"
+
+// returns the names of the files in the directory
+func files(t *testing.T, dir string) []string {
+	t.Helper()
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("failed to list %s: %v", dir, err)
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			names = append(names, entry.Name())
+		}
+	}
+
+	return names
+}
+
+func TestSink(t *testing.T) {
+	tests := []struct {
+		format Format
+		// where captured emails land, relative to the sink's directory
+		delivered string
+		// where emails are written before being moved into place, empty if it's the sink's directory itself
+		staged string
+		eml    bool
+	}{
+		{format: FormatEML, delivered: ".", eml: true},
+		{format: FormatMaildir, delivered: "new", staged: "tmp"},
+	}
+
+	for _, test := range tests {
+		t.Run(string(test.format), func(t *testing.T) {
+			ctx := context.Background()
+			dir := t.TempDir()
+			sink, err := NewSink(dir, test.format)
+			if err != nil {
+				t.Fatalf("failed to create sink: %v", err)
+			}
+
+			err = sink.Send(ctx,
+				notifier.Envelope{From: "bounces@example.com", To: "a@example.com", Data: []byte(message)},
+				notifier.Envelope{From: "bounces@example.com", To: "b@example.com", Data: []byte(message)},
+			)
+			if err != nil {
+				t.Fatalf("failed to send: %v", err)
+			}
+
+			delivered := files(t, filepath.Join(dir, test.delivered))
+			if len(delivered) != 2 {
+				t.Fatalf("got files %v, want both emails delivered to %s", delivered, test.delivered)
+			}
+			for _, name := range delivered {
+				if strings.HasSuffix(name, ".eml") != test.eml {
+					t.Errorf("got file %s, want an .eml file only in the eml format", name)
+				}
+			}
+			if test.staged != "" {
+				if staged := files(t, filepath.Join(dir, test.staged)); len(staged) != 0 {
+					t.Errorf("got files %v left in %s", staged, test.staged)
+				}
+			}
+
+			emails, err := sink.Emails(ctx)
+			if err != nil {
+				t.Fatalf("failed to list emails: %v", err)
+			}
+			if len(emails) != 2 || emails[0].To != "b@example.com" || emails[1].To != "a@example.com" {
+				t.Fatalf("got emails %v, want both, newest first", emails)
+			}
+			if emails[0].Subject != "Seats open in CIS*2750" || emails[0].Text != "" {
+				t.Fatalf("got listed email %+v, want its decoded subject without bodies", emails[0])
+			}
+
+			email, err := sink.Email(ctx, emails[1].ID)
+			if err != nil {
+				t.Fatalf("failed to get email %s: %v", emails[1].ID, err)
+			}
+			if email.Text != "3 seats open" || email.HTML != "<p>3 seats open</p>" || email.From != "coursesense@example.com" {
+				t.Fatalf("got email %+v, want its headers and both bodies", email)
+			}
+
+			// a mail client reading a Maildir moves emails to cur, where they are still found
+			if test.format == FormatMaildir {
+				if err := os.Rename(filepath.Join(dir, "new", email.ID), filepath.Join(dir, "cur", email.ID)); err != nil {
+					t.Fatalf("failed to move email: %v", err)
+				}
+				if _, err := sink.Email(ctx, email.ID); err != nil {
+					t.Fatalf("failed to get email moved to cur: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestSinkRejectsPaths(t *testing.T) {
+	sink, err := NewSink(t.TempDir(), FormatMaildir)
+	if err != nil {
+		t.Fatalf("failed to create sink: %v", err)
+	}
+
+	for _, id := range []string{"", ".", "..", "../new", "new/x", ".hidden"} {
+		if _, err := sink.Email(context.Background(), id); !errors.Is(err, coursesense.ErrEmailNotFound) {
+			t.Errorf("got %v for id %q, want ErrEmailNotFound", err, id)
+		}
+	}
+}
+
+func TestNewSinkRejectsUnknownFormats(t *testing.T) {
+	if _, err := NewSink(t.TempDir(), "mbox"); err == nil {
+		t.Fatal("created a sink in an unknown format")
+	}
+}
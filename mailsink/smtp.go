@@ -0,0 +1,246 @@
+package mailsink
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// a session is dropped after this long without a command
+	sessionTimeout = 5 * time.Minute
+	// larger messages are rejected
+	maxMessageSize = 10 << 20
+)
+
+// Listener is a minimal SMTP server capturing everything it receives into a sink, so the real email notifier can be pointed at it.
+// It accepts any sender, recipient and credentials. STARTTLS isn't offered, so the notifier's security has to be "none"
+type Listener struct {
+	addr string
+	sink Sink
+}
+
+func NewListener(addr string, sink Sink) Listener {
+	return Listener{addr, sink}
+}
+
+// Run accepts connections until the context is cancelled
+func (l Listener) Run(ctx context.Context) error {
+	var config net.ListenConfig
+	listener, err := config.Listen(ctx, "tcp", l.addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", l.addr, err)
+	}
+	log.Info().Msgf("mail sink accepting smtp on %s", listener.Addr())
+
+	go func() {
+		<-ctx.Done()
+		listener.Close()
+	}()
+
+	var sessions sync.WaitGroup
+	defer sessions.Wait()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("failed to accept smtp connection: %w", err)
+		}
+
+		sessions.Add(1)
+		go func() {
+			defer sessions.Done()
+			l.serve(ctx, conn)
+		}()
+	}
+}
+
+// a transaction in progress
+type transaction struct {
+	// set by MAIL, the sender may be empty
+	started bool
+	from    string
+	to      []string
+}
+
+func (l Listener) serve(ctx context.Context, conn net.Conn) {
+	defer conn.Close()
+	// closing the connection interrupts a session blocked on a read
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	text := textproto.NewConn(conn)
+	reply := func(code int, message string) error {
+		return text.PrintfLine("%d %s", code, message)
+	}
+
+	if err := reply(220, "coursesense mail sink ready"); err != nil {
+		return
+	}
+
+	var tx transaction
+	for {
+		if err := conn.SetDeadline(time.Now().Add(sessionTimeout)); err != nil {
+			return
+		}
+
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+
+		verb, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "HELO":
+			err = reply(250, "coursesense")
+		case "EHLO":
+			err = text.PrintfLine("250-coursesense\r\n250-8BITMIME\r\n250-SIZE %d\r\n250 AUTH PLAIN LOGIN", maxMessageSize)
+		case "AUTH":
+			err = l.auth(text, arg)
+		case "MAIL":
+			from, ok := parsePath(arg, "FROM:")
+			if !ok {
+				err = reply(501, "syntax: MAIL FROM:<address>")
+				break
+			}
+			tx = transaction{started: true, from: from}
+			err = reply(250, "OK")
+		case "RCPT":
+			to, ok := parsePath(arg, "TO:")
+			switch {
+			case !tx.started:
+				err = reply(503, "need MAIL first")
+			case !ok || to == "":
+				err = reply(501, "syntax: RCPT TO:<address>")
+			default:
+				tx.to = append(tx.to, to)
+				err = reply(250, "OK")
+			}
+		case "DATA":
+			if len(tx.to) == 0 {
+				err = reply(503, "need RCPT first")
+				break
+			}
+			err = l.data(text, tx)
+			tx = transaction{}
+		case "RSET":
+			tx = transaction{}
+			err = reply(250, "OK")
+		case "NOOP":
+			err = reply(250, "OK")
+		case "QUIT":
+			reply(221, "bye")
+			return
+		default:
+			err = reply(502, "command not implemented")
+		}
+
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				log.Debug().Msgf("mail sink smtp session ended: %v", err)
+			}
+			return
+		}
+	}
+}
+
+// accepts whatever credentials are given
+func (l Listener) auth(text *textproto.Conn, arg string) error {
+	mechanism, initial, _ := strings.Cut(arg, " ")
+	switch strings.ToUpper(mechanism) {
+	case "PLAIN":
+		if initial == "" {
+			if err := text.PrintfLine("334 "); err != nil {
+				return err
+			}
+			if _, err := text.ReadLine(); err != nil {
+				return err
+			}
+		}
+	case "LOGIN":
+		// base64 prompts for the username and password
+		for _, prompt := range []string{"VXNlcm5hbWU6", "UGFzc3dvcmQ6"} {
+			if initial != "" {
+				initial = ""
+				continue
+			}
+			if err := text.PrintfLine("334 %s", prompt); err != nil {
+				return err
+			}
+			if _, err := text.ReadLine(); err != nil {
+				return err
+			}
+		}
+	default:
+		return text.PrintfLine("504 unrecognized authentication mechanism")
+	}
+
+	return text.PrintfLine("235 authenticated")
+}
+
+// reads the message and captures a copy for every recipient
+func (l Listener) data(text *textproto.Conn, tx transaction) error {
+	if err := text.PrintfLine("354 end data with <CR><LF>.<CR><LF>"); err != nil {
+		return err
+	}
+
+	reader := text.DotReader()
+	data, err := io.ReadAll(io.LimitReader(reader, maxMessageSize+1))
+	if err != nil {
+		return err
+	}
+	if len(data) > maxMessageSize {
+		if _, err := io.Copy(io.Discard, reader); err != nil {
+			return err
+		}
+		return text.PrintfLine("552 message exceeds %d bytes", maxMessageSize)
+	}
+
+	// the dot reader turned the line endings into \n
+	data = bytes.ReplaceAll(data, []byte("\n"), []byte("\r\n"))
+	for _, to := range tx.to {
+		if _, err := l.sink.Write(tx.from, to, data); err != nil {
+			log.Error().Msgf("mail sink failed to capture email to %s: %v", to, err)
+			return text.PrintfLine("451 failed to store message")
+		}
+	}
+
+	return text.PrintfLine("250 OK captured")
+}
+
+// returns the address of a MAIL FROM or RCPT TO argument, e.g. "FROM:<a@b.c> BODY=8BITMIME". The null sender <> is allowed
+func parsePath(arg, prefix string) (string, bool) {
+	if len(arg) < len(prefix) || !strings.EqualFold(arg[:len(prefix)], prefix) {
+		return "", false
+	}
+
+	path := strings.TrimSpace(arg[len(prefix):])
+	if !strings.HasPrefix(path, "<") {
+		return "", false
+	}
+	end := strings.Index(path, ">")
+	if end < 0 {
+		return "", false
+	}
+
+	return path[1:end], true
+}
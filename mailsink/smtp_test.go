@@ -0,0 +1,178 @@
+package mailsink
+
+import (
+	"context"
+	"net"
+	"net/textproto"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/jacobmichels/Course-Sense-Go/notifier"
+)
+
+// starts a listener on a free local port, returning its address once it accepts connections
+func listen(t *testing.T, sink Sink) string {
+	t.Helper()
+
+	free, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to find a free port: %v", err)
+	}
+	addr := free.Addr().String()
+	free.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan error)
+	go func() { stopped <- NewListener(addr, sink).Run(ctx) }()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-stopped; err != nil {
+			t.Errorf("listener failed: %v", err)
+		}
+	})
+
+	for i := 0; i < 100; i++ {
+		if conn, err := net.Dial("tcp", addr); err == nil {
+			conn.Close()
+			return addr
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Fatalf("listener never accepted connections on %s", addr)
+	return ""
+}
+
+func TestListenerCapturesTransportDeliveries(t *testing.T) {
+	ctx := context.Background()
+	sink, err := NewSink(t.TempDir(), FormatEML)
+	if err != nil {
+		t.Fatalf("failed to create sink: %v", err)
+	}
+
+	host, port, err := net.SplitHostPort(listen(t, sink))
+	if err != nil {
+		t.Fatalf("bad listener address: %v", err)
+	}
+	portNumber, _ := strconv.Atoi(port)
+
+	transport := notifier.NewSMTPTransport(host, portNumber, "user", "password", notifier.SMTPPlain)
+	err = transport.Send(ctx,
+		notifier.Envelope{From: "bounces@example.com", To: "a@example.com", Data: []byte(message)},
+		notifier.Envelope{From: "bounces@example.com", To: "b@example.com", Data: []byte(message)},
+	)
+	if err != nil {
+		t.Fatalf("failed to send: %v", err)
+	}
+
+	emails, err := sink.Emails(ctx)
+	if err != nil {
+		t.Fatalf("failed to list emails: %v", err)
+	}
+	if len(emails) != 2 {
+		t.Fatalf("got emails %v, want one per envelope", emails)
+	}
+
+	email, err := sink.Email(ctx, emails[0].ID)
+	if err != nil {
+		t.Fatalf("failed to get email: %v", err)
+	}
+	if email.To != "b@example.com" || email.Text != "3 seats open" || email.HTML != "<p>3 seats open</p>" {
+		t.Fatalf("got email %+v, want the message as sent", email)
+	}
+}
+
+func TestListenerSession(t *testing.T) {
+	tests := []struct {
+		name string
+		// commands sent in order, along with the reply code expected for each
+		commands []string
+		codes    []int
+		captured int
+	}{
+		{
+			name:     "recipient before sender",
+			commands: []string{"RCPT TO:<a@example.com>"},
+			codes:    []int{503},
+		},
+		{
+			name:     "data before recipients",
+			commands: []string{"MAIL FROM:<bounces@example.com>", "DATA"},
+			codes:    []int{250, 503},
+		},
+		{
+			name:     "malformed paths",
+			commands: []string{"MAIL FROM:bounces@example.com", "MAIL FROM:<>", "RCPT TO:<>"},
+			codes:    []int{501, 250, 501},
+		},
+		{
+			name:     "reset drops the transaction",
+			commands: []string{"MAIL FROM:<bounces@example.com>", "RCPT TO:<a@example.com>", "RSET", "DATA"},
+			codes:    []int{250, 250, 250, 503},
+		},
+		{
+			name:     "unknown command",
+			commands: []string{"VRFY a@example.com"},
+			codes:    []int{502},
+		},
+		{
+			name:     "message to several recipients",
+			commands: []string{"HELO test", "MAIL FROM:<bounces@example.com> BODY=8BITMIME", "rcpt to:<a@example.com>", "RCPT TO:<b@example.com>", "DATA"},
+			codes:    []int{250, 250, 250, 250, 354},
+			captured: 2,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			sink, err := NewSink(t.TempDir(), FormatMaildir)
+			if err != nil {
+				t.Fatalf("failed to create sink: %v", err)
+			}
+
+			conn, err := textproto.Dial("tcp", listen(t, sink))
+			if err != nil {
+				t.Fatalf("failed to connect: %v", err)
+			}
+			defer conn.Close()
+
+			if _, _, err := conn.ReadResponse(220); err != nil {
+				t.Fatalf("got no greeting: %v", err)
+			}
+			for i, command := range test.commands {
+				if err := conn.PrintfLine("%s", command); err != nil {
+					t.Fatalf("failed to send %s: %v", command, err)
+				}
+				if code, message, _ := conn.ReadResponse(0); code != test.codes[i] {
+					t.Fatalf("got %d %s for %s, want %d", code, message, command, test.codes[i])
+				}
+			}
+
+			if test.captured > 0 {
+				if err := conn.PrintfLine("%s.", message); err != nil {
+					t.Fatalf("failed to send message: %v", err)
+				}
+				if _, _, err := conn.ReadResponse(250); err != nil {
+					t.Fatalf("message wasn't accepted: %v", err)
+				}
+			}
+
+			if _, err := conn.Cmd("QUIT"); err != nil {
+				t.Fatalf("failed to quit: %v", err)
+			}
+			if _, _, err := conn.ReadResponse(221); err != nil {
+				t.Fatalf("got no goodbye: %v", err)
+			}
+
+			emails, err := sink.Emails(ctx)
+			if err != nil {
+				t.Fatalf("failed to list emails: %v", err)
+			}
+			if len(emails) != test.captured {
+				t.Fatalf("got %d emails captured, want %d", len(emails), test.captured)
+			}
+		})
+	}
+}
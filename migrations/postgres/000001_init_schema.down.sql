@@ -0,0 +1,9 @@
+DROP TABLE digests;
+DROP TABLE jobs;
+DROP TABLE watch_group_channels;
+DROP TABLE watch_group_sections;
+DROP TABLE watch_groups;
+DROP TABLE watcher_channels;
+DROP TABLE watchers;
+DROP TABLE sections;
+DROP TABLE courses;
@@ -0,0 +1,111 @@
+-- the schema sqlite reached through its migrations. Times are unix seconds, as in sqlite
+CREATE TABLE courses (
+	id BIGSERIAL PRIMARY KEY,
+	code INTEGER NOT NULL,
+	department TEXT NOT NULL,
+	UNIQUE (code, department)
+);
+
+CREATE TABLE sections (
+	id BIGSERIAL PRIMARY KEY,
+	code TEXT NOT NULL,
+	term TEXT NOT NULL,
+	course_id BIGINT NOT NULL REFERENCES courses (id),
+	UNIQUE (code, term, course_id)
+);
+
+CREATE TABLE watchers (
+	id BIGSERIAL PRIMARY KEY,
+	section_id BIGINT NOT NULL REFERENCES sections (id),
+	position INTEGER NOT NULL DEFAULT 0,
+	-- identifies the watcher across all of its channels
+	contact_key TEXT NOT NULL,
+	expires_at BIGINT,
+	timezone TEXT NOT NULL DEFAULT '',
+	quiet_start TEXT NOT NULL DEFAULT '',
+	quiet_end TEXT NOT NULL DEFAULT '',
+	quiet_hold_urgent BOOLEAN NOT NULL DEFAULT FALSE,
+	held BOOLEAN NOT NULL DEFAULT FALSE,
+	-- json encoded, or empty if the watcher has no timetable
+	timetable TEXT NOT NULL DEFAULT '',
+	digest BOOLEAN NOT NULL DEFAULT FALSE,
+	-- the deadline to confirm a pending watch, NULL once it is active
+	verify_by BIGINT,
+	locale TEXT NOT NULL DEFAULT '',
+	UNIQUE (contact_key, section_id)
+);
+
+CREATE INDEX watchers_expires_at ON watchers (expires_at) WHERE expires_at IS NOT NULL;
+CREATE INDEX watchers_verify_by ON watchers (verify_by) WHERE verify_by IS NOT NULL;
+
+CREATE TABLE watcher_channels (
+	id BIGSERIAL PRIMARY KEY,
+	watcher_id BIGINT NOT NULL REFERENCES watchers (id),
+	kind TEXT NOT NULL,
+	address TEXT NOT NULL,
+	verified BOOLEAN NOT NULL DEFAULT FALSE,
+	preference TEXT NOT NULL DEFAULT '',
+	UNIQUE (watcher_id, kind)
+);
+
+CREATE INDEX watcher_channels_address ON watcher_channels (kind, address);
+
+CREATE TABLE watch_groups (
+	id BIGSERIAL PRIMARY KEY,
+	department TEXT NOT NULL,
+	course_code INTEGER NOT NULL,
+	term TEXT NOT NULL,
+	contact_key TEXT NOT NULL,
+	expires_at BIGINT,
+	timezone TEXT NOT NULL DEFAULT '',
+	quiet_start TEXT NOT NULL DEFAULT '',
+	quiet_end TEXT NOT NULL DEFAULT '',
+	quiet_hold_urgent BOOLEAN NOT NULL DEFAULT FALSE,
+	held BOOLEAN NOT NULL DEFAULT FALSE,
+	timetable TEXT NOT NULL DEFAULT '',
+	digest BOOLEAN NOT NULL DEFAULT FALSE,
+	verify_by BIGINT,
+	locale TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE watch_group_sections (
+	group_id BIGINT NOT NULL REFERENCES watch_groups (id),
+	code TEXT NOT NULL,
+	UNIQUE (group_id, code)
+);
+
+CREATE TABLE watch_group_channels (
+	id BIGSERIAL PRIMARY KEY,
+	group_id BIGINT NOT NULL REFERENCES watch_groups (id),
+	kind TEXT NOT NULL,
+	address TEXT NOT NULL,
+	verified BOOLEAN NOT NULL DEFAULT FALSE,
+	preference TEXT NOT NULL DEFAULT '',
+	UNIQUE (group_id, kind)
+);
+
+CREATE INDEX watch_group_channels_address ON watch_group_channels (kind, address);
+
+CREATE TABLE jobs (
+	id BIGSERIAL PRIMARY KEY,
+	notifier TEXT NOT NULL,
+	-- the job's notification and watchers, json encoded
+	payload TEXT NOT NULL,
+	status TEXT NOT NULL DEFAULT 'pending',
+	attempts INTEGER NOT NULL DEFAULT 0,
+	next_attempt_at BIGINT NOT NULL,
+	last_error TEXT NOT NULL DEFAULT '',
+	created_at BIGINT NOT NULL
+);
+
+CREATE INDEX jobs_due ON jobs (status, next_attempt_at);
+
+CREATE TABLE digests (
+	id BIGSERIAL PRIMARY KEY,
+	contact_key TEXT NOT NULL UNIQUE,
+	-- the digest's notification and watcher, json encoded
+	payload TEXT NOT NULL,
+	flush_at BIGINT NOT NULL
+);
+
+CREATE INDEX digests_due ON digests (flush_at);
@@ -0,0 +1 @@
+ALTER TABLE "watchers" ADD COLUMN "expires_at" INTEGER;
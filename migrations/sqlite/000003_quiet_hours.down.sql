@@ -0,0 +1,5 @@
+ALTER TABLE "watchers" DROP COLUMN "held";
+ALTER TABLE "watchers" DROP COLUMN "quiet_hold_urgent";
+ALTER TABLE "watchers" DROP COLUMN "quiet_end";
+ALTER TABLE "watchers" DROP COLUMN "quiet_start";
+ALTER TABLE "watchers" DROP COLUMN "timezone";
@@ -0,0 +1,5 @@
+ALTER TABLE "watchers" ADD COLUMN "timezone" TEXT NOT NULL DEFAULT '';
+ALTER TABLE "watchers" ADD COLUMN "quiet_start" TEXT NOT NULL DEFAULT '';
+ALTER TABLE "watchers" ADD COLUMN "quiet_end" TEXT NOT NULL DEFAULT '';
+ALTER TABLE "watchers" ADD COLUMN "quiet_hold_urgent" INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE "watchers" ADD COLUMN "held" INTEGER NOT NULL DEFAULT 0;
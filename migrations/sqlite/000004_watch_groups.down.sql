@@ -0,0 +1,2 @@
+DROP TABLE watch_group_sections;
+DROP TABLE watch_groups;
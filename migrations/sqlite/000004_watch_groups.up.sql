@@ -0,0 +1,21 @@
+CREATE TABLE "watch_groups" (
+	"id"	INTEGER,
+	"department"	TEXT NOT NULL,
+	"course_code"	INTEGER NOT NULL,
+	"term"	TEXT NOT NULL,
+	"email"	TEXT NOT NULL,
+	"expires_at"	INTEGER,
+	"timezone"	TEXT NOT NULL DEFAULT '',
+	"quiet_start"	TEXT NOT NULL DEFAULT '',
+	"quiet_end"	TEXT NOT NULL DEFAULT '',
+	"quiet_hold_urgent"	INTEGER NOT NULL DEFAULT 0,
+	"held"	INTEGER NOT NULL DEFAULT 0,
+	PRIMARY KEY("id" AUTOINCREMENT)
+);
+
+CREATE TABLE "watch_group_sections" (
+	"group_id"	INTEGER NOT NULL,
+	"code"	TEXT NOT NULL,
+	UNIQUE("group_id","code"),
+	FOREIGN KEY("group_id") REFERENCES "watch_groups"("id")
+);
@@ -0,0 +1,2 @@
+ALTER TABLE "watch_groups" DROP COLUMN "timetable";
+ALTER TABLE "watchers" DROP COLUMN "timetable";
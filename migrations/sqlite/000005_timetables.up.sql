@@ -0,0 +1,2 @@
+ALTER TABLE "watchers" ADD COLUMN "timetable" TEXT NOT NULL DEFAULT '';
+ALTER TABLE "watch_groups" ADD COLUMN "timetable" TEXT NOT NULL DEFAULT '';
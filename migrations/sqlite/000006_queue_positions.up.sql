@@ -0,0 +1,4 @@
+ALTER TABLE "watchers" ADD COLUMN "position" INTEGER NOT NULL DEFAULT 0;
+
+-- existing watchers keep their registration order
+UPDATE "watchers" SET "position" = "id";
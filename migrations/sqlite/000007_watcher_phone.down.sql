@@ -0,0 +1,27 @@
+ALTER TABLE "watch_groups" DROP COLUMN "phone";
+
+-- phone-only watchers can't be represented without a phone column
+DELETE FROM "watchers" WHERE "email" = '';
+
+CREATE TABLE "watchers_old" (
+	"id"	INTEGER,
+	"email"	TEXT NOT NULL,
+	"section_id"	INTEGER NOT NULL,
+	"expires_at"	INTEGER,
+	"timezone"	TEXT NOT NULL DEFAULT '',
+	"quiet_start"	TEXT NOT NULL DEFAULT '',
+	"quiet_end"	TEXT NOT NULL DEFAULT '',
+	"quiet_hold_urgent"	INTEGER NOT NULL DEFAULT 0,
+	"held"	INTEGER NOT NULL DEFAULT 0,
+	"timetable"	TEXT NOT NULL DEFAULT '',
+	"position"	INTEGER NOT NULL DEFAULT 0,
+	UNIQUE("email","section_id"),
+	PRIMARY KEY("id" AUTOINCREMENT),
+	FOREIGN KEY("section_id") REFERENCES "sections"("id")
+);
+
+INSERT OR IGNORE INTO "watchers_old" ("id", "email", "section_id", "expires_at", "timezone", "quiet_start", "quiet_end", "quiet_hold_urgent", "held", "timetable", "position")
+SELECT "id", "email", "section_id", "expires_at", "timezone", "quiet_start", "quiet_end", "quiet_hold_urgent", "held", "timetable", "position" FROM "watchers";
+
+DROP TABLE "watchers";
+ALTER TABLE "watchers_old" RENAME TO "watchers";
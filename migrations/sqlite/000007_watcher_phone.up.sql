@@ -0,0 +1,26 @@
+-- sqlite can't alter constraints, so the watchers table is rebuilt with the phone included in its uniqueness
+CREATE TABLE "watchers_new" (
+	"id"	INTEGER,
+	"email"	TEXT NOT NULL DEFAULT '',
+	"phone"	TEXT NOT NULL DEFAULT '',
+	"section_id"	INTEGER NOT NULL,
+	"expires_at"	INTEGER,
+	"timezone"	TEXT NOT NULL DEFAULT '',
+	"quiet_start"	TEXT NOT NULL DEFAULT '',
+	"quiet_end"	TEXT NOT NULL DEFAULT '',
+	"quiet_hold_urgent"	INTEGER NOT NULL DEFAULT 0,
+	"held"	INTEGER NOT NULL DEFAULT 0,
+	"timetable"	TEXT NOT NULL DEFAULT '',
+	"position"	INTEGER NOT NULL DEFAULT 0,
+	UNIQUE("email","phone","section_id"),
+	PRIMARY KEY("id" AUTOINCREMENT),
+	FOREIGN KEY("section_id") REFERENCES "sections"("id")
+);
+
+INSERT INTO "watchers_new" ("id", "email", "section_id", "expires_at", "timezone", "quiet_start", "quiet_end", "quiet_hold_urgent", "held", "timetable", "position")
+SELECT "id", "email", "section_id", "expires_at", "timezone", "quiet_start", "quiet_end", "quiet_hold_urgent", "held", "timetable", "position" FROM "watchers";
+
+DROP TABLE "watchers";
+ALTER TABLE "watchers_new" RENAME TO "watchers";
+
+ALTER TABLE "watch_groups" ADD COLUMN "phone" TEXT NOT NULL DEFAULT '';
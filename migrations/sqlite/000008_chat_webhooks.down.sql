@@ -0,0 +1,30 @@
+ALTER TABLE "watch_groups" DROP COLUMN "slack_webhook";
+ALTER TABLE "watch_groups" DROP COLUMN "discord_webhook";
+ALTER TABLE "watch_groups" DROP COLUMN "contact_key";
+
+-- watchers reachable only through chat webhooks can't be represented without the webhook columns
+DELETE FROM "watchers" WHERE "email" = '' AND "phone" = '';
+
+CREATE TABLE "watchers_old" (
+	"id"	INTEGER,
+	"email"	TEXT NOT NULL DEFAULT '',
+	"phone"	TEXT NOT NULL DEFAULT '',
+	"section_id"	INTEGER NOT NULL,
+	"expires_at"	INTEGER,
+	"timezone"	TEXT NOT NULL DEFAULT '',
+	"quiet_start"	TEXT NOT NULL DEFAULT '',
+	"quiet_end"	TEXT NOT NULL DEFAULT '',
+	"quiet_hold_urgent"	INTEGER NOT NULL DEFAULT 0,
+	"held"	INTEGER NOT NULL DEFAULT 0,
+	"timetable"	TEXT NOT NULL DEFAULT '',
+	"position"	INTEGER NOT NULL DEFAULT 0,
+	UNIQUE("email","phone","section_id"),
+	PRIMARY KEY("id" AUTOINCREMENT),
+	FOREIGN KEY("section_id") REFERENCES "sections"("id")
+);
+
+INSERT OR IGNORE INTO "watchers_old" ("id", "email", "phone", "section_id", "expires_at", "timezone", "quiet_start", "quiet_end", "quiet_hold_urgent", "held", "timetable", "position")
+SELECT "id", "email", "phone", "section_id", "expires_at", "timezone", "quiet_start", "quiet_end", "quiet_hold_urgent", "held", "timetable", "position" FROM "watchers";
+
+DROP TABLE "watchers";
+ALTER TABLE "watchers_old" RENAME TO "watchers";
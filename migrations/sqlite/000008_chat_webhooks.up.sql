@@ -0,0 +1,32 @@
+-- watchers may now be reached through chat webhooks alone, so uniqueness moves to a key covering every contact method
+CREATE TABLE "watchers_new" (
+	"id"	INTEGER,
+	"contact_key"	TEXT NOT NULL,
+	"email"	TEXT NOT NULL DEFAULT '',
+	"phone"	TEXT NOT NULL DEFAULT '',
+	"discord_webhook"	TEXT NOT NULL DEFAULT '',
+	"slack_webhook"	TEXT NOT NULL DEFAULT '',
+	"section_id"	INTEGER NOT NULL,
+	"expires_at"	INTEGER,
+	"timezone"	TEXT NOT NULL DEFAULT '',
+	"quiet_start"	TEXT NOT NULL DEFAULT '',
+	"quiet_end"	TEXT NOT NULL DEFAULT '',
+	"quiet_hold_urgent"	INTEGER NOT NULL DEFAULT 0,
+	"held"	INTEGER NOT NULL DEFAULT 0,
+	"timetable"	TEXT NOT NULL DEFAULT '',
+	"position"	INTEGER NOT NULL DEFAULT 0,
+	UNIQUE("contact_key","section_id"),
+	PRIMARY KEY("id" AUTOINCREMENT),
+	FOREIGN KEY("section_id") REFERENCES "sections"("id")
+);
+
+INSERT INTO "watchers_new" ("id", "contact_key", "email", "phone", "section_id", "expires_at", "timezone", "quiet_start", "quiet_end", "quiet_hold_urgent", "held", "timetable", "position")
+SELECT "id", "email" || '|' || "phone" || '||', "email", "phone", "section_id", "expires_at", "timezone", "quiet_start", "quiet_end", "quiet_hold_urgent", "held", "timetable", "position" FROM "watchers";
+
+DROP TABLE "watchers";
+ALTER TABLE "watchers_new" RENAME TO "watchers";
+
+ALTER TABLE "watch_groups" ADD COLUMN "contact_key" TEXT NOT NULL DEFAULT '';
+ALTER TABLE "watch_groups" ADD COLUMN "discord_webhook" TEXT NOT NULL DEFAULT '';
+ALTER TABLE "watch_groups" ADD COLUMN "slack_webhook" TEXT NOT NULL DEFAULT '';
+UPDATE "watch_groups" SET "contact_key" = "email" || '|' || "phone" || '||';
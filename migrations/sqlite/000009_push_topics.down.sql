@@ -0,0 +1,10 @@
+-- watchers reachable only through a topic can't be represented without the topic column
+DELETE FROM "watchers" WHERE "email" = '' AND "phone" = '' AND "discord_webhook" = '' AND "slack_webhook" = '';
+DELETE FROM "watch_group_sections" WHERE "group_id" IN (SELECT "id" FROM "watch_groups" WHERE "email" = '' AND "phone" = '' AND "discord_webhook" = '' AND "slack_webhook" = '');
+DELETE FROM "watch_groups" WHERE "email" = '' AND "phone" = '' AND "discord_webhook" = '' AND "slack_webhook" = '';
+
+UPDATE "watchers" SET "contact_key" = substr("contact_key", 1, length("contact_key") - length("topic") - 1);
+UPDATE "watch_groups" SET "contact_key" = substr("contact_key", 1, length("contact_key") - length("topic") - 1);
+
+ALTER TABLE "watch_groups" DROP COLUMN "topic";
+ALTER TABLE "watchers" DROP COLUMN "topic";
@@ -0,0 +1,6 @@
+ALTER TABLE "watchers" ADD COLUMN "topic" TEXT NOT NULL DEFAULT '';
+ALTER TABLE "watch_groups" ADD COLUMN "topic" TEXT NOT NULL DEFAULT '';
+
+-- the topic is part of the contact key
+UPDATE "watchers" SET "contact_key" = "contact_key" || '|';
+UPDATE "watch_groups" SET "contact_key" = "contact_key" || '|';
@@ -0,0 +1,2 @@
+DROP INDEX "jobs_due";
+DROP TABLE "jobs";
@@ -0,0 +1,14 @@
+CREATE TABLE "jobs" (
+	"id"	INTEGER,
+	"notifier"	TEXT NOT NULL,
+	-- the job's notification and watchers, json encoded
+	"payload"	TEXT NOT NULL,
+	"status"	TEXT NOT NULL DEFAULT 'pending',
+	"attempts"	INTEGER NOT NULL DEFAULT 0,
+	"next_attempt_at"	INTEGER NOT NULL,
+	"last_error"	TEXT NOT NULL DEFAULT '',
+	"created_at"	INTEGER NOT NULL,
+	PRIMARY KEY("id" AUTOINCREMENT)
+);
+
+CREATE INDEX "jobs_due" ON "jobs" ("status", "next_attempt_at");
@@ -0,0 +1,29 @@
+ALTER TABLE "watchers" ADD COLUMN "email" TEXT NOT NULL DEFAULT '';
+ALTER TABLE "watchers" ADD COLUMN "phone" TEXT NOT NULL DEFAULT '';
+ALTER TABLE "watchers" ADD COLUMN "topic" TEXT NOT NULL DEFAULT '';
+ALTER TABLE "watchers" ADD COLUMN "discord_webhook" TEXT NOT NULL DEFAULT '';
+ALTER TABLE "watchers" ADD COLUMN "slack_webhook" TEXT NOT NULL DEFAULT '';
+ALTER TABLE "watch_groups" ADD COLUMN "email" TEXT NOT NULL DEFAULT '';
+ALTER TABLE "watch_groups" ADD COLUMN "phone" TEXT NOT NULL DEFAULT '';
+ALTER TABLE "watch_groups" ADD COLUMN "topic" TEXT NOT NULL DEFAULT '';
+ALTER TABLE "watch_groups" ADD COLUMN "discord_webhook" TEXT NOT NULL DEFAULT '';
+ALTER TABLE "watch_groups" ADD COLUMN "slack_webhook" TEXT NOT NULL DEFAULT '';
+
+UPDATE "watchers" SET
+	"email" = coalesce((SELECT json_extract("value", '$.address') FROM json_each("channels") WHERE json_extract("value", '$.kind') = 'email'), ''),
+	"phone" = coalesce((SELECT json_extract("value", '$.address') FROM json_each("channels") WHERE json_extract("value", '$.kind') = 'sms'), ''),
+	"topic" = coalesce((SELECT json_extract("value", '$.address') FROM json_each("channels") WHERE json_extract("value", '$.kind') = 'push'), ''),
+	"discord_webhook" = coalesce((SELECT json_extract("value", '$.address') FROM json_each("channels") WHERE json_extract("value", '$.kind') = 'discord'), ''),
+	"slack_webhook" = coalesce((SELECT json_extract("value", '$.address') FROM json_each("channels") WHERE json_extract("value", '$.kind') = 'slack'), '');
+UPDATE "watch_groups" SET
+	"email" = coalesce((SELECT json_extract("value", '$.address') FROM json_each("channels") WHERE json_extract("value", '$.kind') = 'email'), ''),
+	"phone" = coalesce((SELECT json_extract("value", '$.address') FROM json_each("channels") WHERE json_extract("value", '$.kind') = 'sms'), ''),
+	"topic" = coalesce((SELECT json_extract("value", '$.address') FROM json_each("channels") WHERE json_extract("value", '$.kind') = 'push'), ''),
+	"discord_webhook" = coalesce((SELECT json_extract("value", '$.address') FROM json_each("channels") WHERE json_extract("value", '$.kind') = 'discord'), ''),
+	"slack_webhook" = coalesce((SELECT json_extract("value", '$.address') FROM json_each("channels") WHERE json_extract("value", '$.kind') = 'slack'), '');
+
+UPDATE "watchers" SET "contact_key" = "email" || '|' || "phone" || '|' || "discord_webhook" || '|' || "slack_webhook" || '|' || "topic";
+UPDATE "watch_groups" SET "contact_key" = "email" || '|' || "phone" || '|' || "discord_webhook" || '|' || "slack_webhook" || '|' || "topic";
+
+ALTER TABLE "watchers" DROP COLUMN "channels";
+ALTER TABLE "watch_groups" DROP COLUMN "channels";
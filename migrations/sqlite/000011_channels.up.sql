@@ -0,0 +1,43 @@
+-- contact methods become a list of channels, each with its own verified flag and preference
+ALTER TABLE "watchers" ADD COLUMN "channels" TEXT NOT NULL DEFAULT '[]';
+ALTER TABLE "watch_groups" ADD COLUMN "channels" TEXT NOT NULL DEFAULT '[]';
+
+UPDATE "watchers" SET "channels" = (SELECT json_group_array(json("channel")) FROM (
+	SELECT json_object('kind', 'email', 'address', "email", 'verified', json('false'), 'preference', 'all') AS "channel" WHERE "email" != ''
+	UNION ALL SELECT json_object('kind', 'sms', 'address', "phone", 'verified', json('false'), 'preference', 'all') AS "channel" WHERE "phone" != ''
+	UNION ALL SELECT json_object('kind', 'push', 'address', "topic", 'verified', json('false'), 'preference', 'all') AS "channel" WHERE "topic" != ''
+	UNION ALL SELECT json_object('kind', 'discord', 'address', "discord_webhook", 'verified', json('false'), 'preference', 'all') AS "channel" WHERE "discord_webhook" != ''
+	UNION ALL SELECT json_object('kind', 'slack', 'address', "slack_webhook", 'verified', json('false'), 'preference', 'all') AS "channel" WHERE "slack_webhook" != ''
+));
+UPDATE "watch_groups" SET "channels" = (SELECT json_group_array(json("channel")) FROM (
+	SELECT json_object('kind', 'email', 'address', "email", 'verified', json('false'), 'preference', 'all') AS "channel" WHERE "email" != ''
+	UNION ALL SELECT json_object('kind', 'sms', 'address', "phone", 'verified', json('false'), 'preference', 'all') AS "channel" WHERE "phone" != ''
+	UNION ALL SELECT json_object('kind', 'push', 'address', "topic", 'verified', json('false'), 'preference', 'all') AS "channel" WHERE "topic" != ''
+	UNION ALL SELECT json_object('kind', 'discord', 'address', "discord_webhook", 'verified', json('false'), 'preference', 'all') AS "channel" WHERE "discord_webhook" != ''
+	UNION ALL SELECT json_object('kind', 'slack', 'address', "slack_webhook", 'verified', json('false'), 'preference', 'all') AS "channel" WHERE "slack_webhook" != ''
+));
+
+-- the contact key lists each channel as kind:address
+UPDATE "watchers" SET "contact_key" = substr(
+	CASE WHEN "email" != '' THEN '|email:' || "email" ELSE '' END ||
+	CASE WHEN "phone" != '' THEN '|sms:' || "phone" ELSE '' END ||
+	CASE WHEN "topic" != '' THEN '|push:' || "topic" ELSE '' END ||
+	CASE WHEN "discord_webhook" != '' THEN '|discord:' || "discord_webhook" ELSE '' END ||
+	CASE WHEN "slack_webhook" != '' THEN '|slack:' || "slack_webhook" ELSE '' END, 2);
+UPDATE "watch_groups" SET "contact_key" = substr(
+	CASE WHEN "email" != '' THEN '|email:' || "email" ELSE '' END ||
+	CASE WHEN "phone" != '' THEN '|sms:' || "phone" ELSE '' END ||
+	CASE WHEN "topic" != '' THEN '|push:' || "topic" ELSE '' END ||
+	CASE WHEN "discord_webhook" != '' THEN '|discord:' || "discord_webhook" ELSE '' END ||
+	CASE WHEN "slack_webhook" != '' THEN '|slack:' || "slack_webhook" ELSE '' END, 2);
+
+ALTER TABLE "watchers" DROP COLUMN "email";
+ALTER TABLE "watchers" DROP COLUMN "phone";
+ALTER TABLE "watchers" DROP COLUMN "topic";
+ALTER TABLE "watchers" DROP COLUMN "discord_webhook";
+ALTER TABLE "watchers" DROP COLUMN "slack_webhook";
+ALTER TABLE "watch_groups" DROP COLUMN "email";
+ALTER TABLE "watch_groups" DROP COLUMN "phone";
+ALTER TABLE "watch_groups" DROP COLUMN "topic";
+ALTER TABLE "watch_groups" DROP COLUMN "discord_webhook";
+ALTER TABLE "watch_groups" DROP COLUMN "slack_webhook";
@@ -0,0 +1,5 @@
+DROP INDEX "digests_due";
+DROP TABLE "digests";
+
+ALTER TABLE "watch_groups" DROP COLUMN "digest";
+ALTER TABLE "watchers" DROP COLUMN "digest";
@@ -0,0 +1,14 @@
+ALTER TABLE "watchers" ADD COLUMN "digest" INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE "watch_groups" ADD COLUMN "digest" INTEGER NOT NULL DEFAULT 0;
+
+CREATE TABLE "digests" (
+	"id"	INTEGER,
+	"contact_key"	TEXT NOT NULL,
+	-- the digest's notification and watcher, json encoded
+	"payload"	TEXT NOT NULL,
+	"flush_at"	INTEGER NOT NULL,
+	UNIQUE("contact_key"),
+	PRIMARY KEY("id" AUTOINCREMENT)
+);
+
+CREATE INDEX "digests_due" ON "digests" ("flush_at");
@@ -0,0 +1,2 @@
+ALTER TABLE "watch_groups" DROP COLUMN "verify_by";
+ALTER TABLE "watchers" DROP COLUMN "verify_by";
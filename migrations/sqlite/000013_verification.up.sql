@@ -0,0 +1,3 @@
+-- unix seconds by which a pending watch must be confirmed, NULL once it is active
+ALTER TABLE "watchers" ADD COLUMN "verify_by" INTEGER;
+ALTER TABLE "watch_groups" ADD COLUMN "verify_by" INTEGER;
@@ -0,0 +1,2 @@
+ALTER TABLE "watch_groups" DROP COLUMN "locale";
+ALTER TABLE "watchers" DROP COLUMN "locale";
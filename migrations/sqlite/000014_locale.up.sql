@@ -0,0 +1,3 @@
+-- language messages to the watcher are written in, empty for English
+ALTER TABLE "watchers" ADD COLUMN "locale" TEXT NOT NULL DEFAULT '';
+ALTER TABLE "watch_groups" ADD COLUMN "locale" TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,10 @@
+ALTER TABLE "watchers" ADD COLUMN "channels" TEXT NOT NULL DEFAULT '[]';
+ALTER TABLE "watch_groups" ADD COLUMN "channels" TEXT NOT NULL DEFAULT '[]';
+
+UPDATE "watchers" SET "channels" = (SELECT json_group_array(json_object('kind', "kind", 'address', "address", 'verified', json(CASE WHEN "verified" THEN 'true' ELSE 'false' END), 'preference', "preference"))
+	FROM (SELECT * FROM "watcher_channels" WHERE "watcher_id" = "watchers"."id" ORDER BY rowid));
+UPDATE "watch_groups" SET "channels" = (SELECT json_group_array(json_object('kind', "kind", 'address', "address", 'verified', json(CASE WHEN "verified" THEN 'true' ELSE 'false' END), 'preference', "preference"))
+	FROM (SELECT * FROM "watch_group_channels" WHERE "group_id" = "watch_groups"."id" ORDER BY rowid));
+
+DROP TABLE "watcher_channels";
+DROP TABLE "watch_group_channels";
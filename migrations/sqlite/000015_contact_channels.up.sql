@@ -0,0 +1,34 @@
+-- channels move out of the json column into their own tables, one row per contact method of a watch
+CREATE TABLE "watcher_channels" (
+	"watcher_id"	INTEGER NOT NULL,
+	"kind"	TEXT NOT NULL,
+	"address"	TEXT NOT NULL,
+	"verified"	INTEGER NOT NULL DEFAULT 0,
+	"preference"	TEXT NOT NULL DEFAULT '',
+	UNIQUE("watcher_id","kind"),
+	FOREIGN KEY("watcher_id") REFERENCES "watchers"("id")
+);
+
+CREATE TABLE "watch_group_channels" (
+	"group_id"	INTEGER NOT NULL,
+	"kind"	TEXT NOT NULL,
+	"address"	TEXT NOT NULL,
+	"verified"	INTEGER NOT NULL DEFAULT 0,
+	"preference"	TEXT NOT NULL DEFAULT '',
+	UNIQUE("group_id","kind"),
+	FOREIGN KEY("group_id") REFERENCES "watch_groups"("id")
+);
+
+-- lets a contact's watches be found by any of its addresses
+CREATE INDEX "watcher_channels_address" ON "watcher_channels" ("kind", "address");
+CREATE INDEX "watch_group_channels_address" ON "watch_group_channels" ("kind", "address");
+
+INSERT INTO "watcher_channels" ("watcher_id", "kind", "address", "verified", "preference")
+SELECT "watchers"."id", json_extract("value", '$.kind'), json_extract("value", '$.address'), coalesce(json_extract("value", '$.verified'), 0), coalesce(json_extract("value", '$.preference'), '')
+FROM "watchers", json_each("watchers"."channels") ORDER BY "watchers"."id", json_each."key";
+INSERT INTO "watch_group_channels" ("group_id", "kind", "address", "verified", "preference")
+SELECT "watch_groups"."id", json_extract("value", '$.kind'), json_extract("value", '$.address'), coalesce(json_extract("value", '$.verified'), 0), coalesce(json_extract("value", '$.preference'), '')
+FROM "watch_groups", json_each("watch_groups"."channels") ORDER BY "watch_groups"."id", json_each."key";
+
+ALTER TABLE "watchers" DROP COLUMN "channels";
+ALTER TABLE "watch_groups" DROP COLUMN "channels";
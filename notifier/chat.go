@@ -0,0 +1,256 @@
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	coursesense "github.com/jacobmichels/Course-Sense-Go"
+)
+
+// shared plumbing for the chat and push notifiers
+
+const webAdvisorURL = "https://colleague-ss.uoguelph.ca/Student/Courses"
+
+const (
+	// attempts made on a message before giving up, only rate limited attempts are retried
+	chatMaxAttempts = 3
+	// longest we'll wait on a rate limit before giving up on the message
+	chatMaxRetryAfter = 30 * time.Second
+)
+
+// returns a WebAdvisor search for the course
+func webAdvisorCourseURL(course coursesense.Course) string {
+	return webAdvisorURL + "/Search?keyword=" + url.QueryEscape(fmt.Sprintf("%s*%d", course.Department, course.Code))
+}
+
+// returns a WebAdvisor link for the notification, searching for its course when there is only one
+func notificationURL(notification coursesense.Notification) string {
+	if notification.Course != nil {
+		return webAdvisorCourseURL(*notification.Course)
+	}
+
+	if len(notification.Sections) == 0 {
+		return webAdvisorURL
+	}
+
+	course := notification.Sections[0].Course
+	for _, section := range notification.Sections[1:] {
+		if section.Course != course {
+			return webAdvisorURL
+		}
+	}
+
+	return webAdvisorCourseURL(course)
+}
+
+func chatTitle(notification coursesense.Notification) string {
+	switch notification.Kind {
+	case coursesense.NotificationWatchExpired:
+		return "Watch expired"
+	default:
+		return "Seats available"
+	}
+}
+
+// describes a section's state for chat messages
+func chatSectionDetails(notification coursesense.Notification, section coursesense.Section) string {
+	var details string
+	switch notification.Kind {
+	case coursesense.NotificationWatchExpired:
+		details = "No longer watched"
+	default:
+		seats := notification.Seats[section]
+		details = fmt.Sprintf("%d seats open", seats)
+		if seats == 1 {
+			details = "1 seat open"
+		}
+	}
+
+	if !notification.ConflictFree(section) {
+		details += ", conflicts with your timetable"
+	}
+
+	return details
+}
+
+type chatTarget struct {
+	url string
+	// global channels are shared, so they don't get details personal to a watcher
+	global bool
+}
+
+// returns the webhooks a notification is posted to without duplicates: the global ones for broadcast notifiers,
+// otherwise each watcher's own webhook of the given kind.
+// global channels only hear about openings, expiry notices are only of interest to the watcher
+func chatTargets(global []string, notification coursesense.Notification, watchers []coursesense.Watcher, kind coursesense.ChannelKind) []chatTarget {
+	seen := make(map[string]bool)
+	var targets []chatTarget
+	add := func(url string, global bool) {
+		if url != "" && !seen[url] {
+			seen[url] = true
+			targets = append(targets, chatTarget{url, global})
+		}
+	}
+
+	if len(global) > 0 {
+		if notification.Kind != coursesense.NotificationWatchExpired {
+			for _, url := range global {
+				add(url, true)
+			}
+		}
+		return targets
+	}
+
+	for _, watcher := range watchers {
+		add(watcher.Address(kind), false)
+	}
+
+	return targets
+}
+
+// broadcast chat notifiers are named apart from the per-watcher ones, jobs are matched to notifiers by name
+func chatName(name string, global []string) string {
+	if len(global) > 0 {
+		return name + "-broadcast"
+	}
+
+	return name
+}
+
+// broadcast chat notifiers post to their own channels, so they are given every watcher
+func chatChannel(kind coursesense.ChannelKind, global []string) coursesense.ChannelKind {
+	if len(global) > 0 {
+		return ""
+	}
+
+	return kind
+}
+
+// returns the notification as seen by a target, without timetable conflicts for global channels
+func (t chatTarget) notification(notification coursesense.Notification) coursesense.Notification {
+	if t.global {
+		notification.Conflicts = nil
+	}
+
+	return notification
+}
+
+// returns how long a rate limited response asks us to wait
+type retryAfterFunc func(res *http.Response, body []byte) time.Duration
+
+// reads the standard Retry-After header, in seconds
+func retryAfterHeader(res *http.Response, body []byte) time.Duration {
+	secs, err := strconv.ParseFloat(res.Header.Get("Retry-After"), 64)
+	if err != nil || secs < 0 {
+		return time.Second
+	}
+
+	return time.Duration(secs * float64(time.Second))
+}
+
+// posts a JSON message to a chat webhook or push server, waiting out rate limits
+func postJSON(ctx context.Context, client *http.Client, target string, header http.Header, message any, retryAfter retryAfterFunc) error {
+	body, err := json.Marshal(message)
+	if err != nil {
+		return fmt.Errorf("failed to encode message: %w", err)
+	}
+
+	for attempt := 1; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, "POST", target, bytes.NewReader(body))
+		if err != nil {
+			return fmt.Errorf("failed to create request: %w", err)
+		}
+		for key, values := range header {
+			req.Header[key] = values
+		}
+		req.Header.Set("Content-Type", "application/json")
+
+		res, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		responseBody, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		res.Body.Close()
+
+		if res.StatusCode >= 200 && res.StatusCode <= 299 {
+			return nil
+		}
+		if res.StatusCode != http.StatusTooManyRequests {
+			return fmt.Errorf("unexpected status %s: %s", res.Status, responseBody)
+		}
+
+		wait := retryAfter(res, responseBody)
+		if attempt == chatMaxAttempts || wait > chatMaxRetryAfter {
+			return fmt.Errorf("rate limited, retry after %s", wait)
+		}
+
+		log.Debug().Msgf("rate limited by %s, retrying in %s", req.URL.Host, wait)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// limits the sections listed in a message, returning how many were left out
+func chatSections(sections []coursesense.Section, limit int) ([]coursesense.Section, int) {
+	if len(sections) <= limit {
+		return sections, 0
+	}
+
+	return sections[:limit], len(sections) - limit
+}
+
+// returns the body of an operator alert
+func alertText(alert coursesense.Alert) string {
+	if alert.Firing {
+		return fmt.Sprintf("%s\n\nFirst noticed at %s.", alert.Message, alert.Since.UTC().Format(time.RFC1123))
+	}
+
+	return fmt.Sprintf("%s\n\nThe problem started at %s.", alert.Message, alert.Since.UTC().Format(time.RFC1123))
+}
+
+// returns a one paragraph summary of the notification, for push messages
+func summaryBody(notification coursesense.Notification) string {
+	var sections []string
+	for _, section := range notification.Sections {
+		description := fmt.Sprintf("%s %d %s %s", section.Course.Department, section.Course.Code, section.Code, section.Term)
+		if !notification.ConflictFree(section) {
+			description += " (conflicts with your timetable)"
+		}
+		sections = append(sections, description)
+	}
+
+	noun := "course section"
+	if len(sections) > 1 {
+		noun = "course sections"
+	}
+
+	if notification.Course != nil {
+		course := fmt.Sprintf("%s %d %s", notification.Course.Department, notification.Course.Code, notification.Term)
+		switch notification.Kind {
+		case coursesense.NotificationWatchExpired:
+			return fmt.Sprintf("Your watch on all sections of %s expired before any space was found, so we have stopped watching it.", course)
+		default:
+			return fmt.Sprintf("Space has been found in the following %s of %s: %s. Get over to WebAdvisor to claim the spot!", noun, course, strings.Join(sections, ", "))
+		}
+	}
+
+	switch notification.Kind {
+	case coursesense.NotificationWatchExpired:
+		return fmt.Sprintf("Your watch on the following %s expired before any space was found, so we have stopped watching: %s.", noun, strings.Join(sections, ", "))
+	default:
+		return fmt.Sprintf("Space has been found in the following %s: %s. Get over to WebAdvisor to claim the spot!", noun, strings.Join(sections, ", "))
+	}
+}
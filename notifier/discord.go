@@ -0,0 +1,160 @@
+package notifier
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	coursesense "github.com/jacobmichels/Course-Sense-Go"
+)
+
+var _ coursesense.Alerter = Discord{}
+
+const (
+	discordColorOpen    = 0x2ecc71
+	discordColorExpired = 0x95a5a6
+	discordColorAlert   = 0xe74c3c
+	// discord rejects embeds with more than 25 fields, one is kept for the overflow note
+	discordMaxFields = 24
+)
+
+// Posts embeds to Discord incoming webhooks
+type Discord struct {
+	http *http.Client
+	// channels that hear about every opening. Without any, each watcher's own webhook is notified instead
+	webhooks []string
+}
+
+// NewDiscord returns a notifier posting to watchers' own webhooks, or a broadcast notifier posting to the given webhooks
+func NewDiscord(webhooks ...string) Discord {
+	return Discord{&http.Client{Timeout: 10 * time.Second}, webhooks}
+}
+
+type DiscordMessage struct {
+	Username string         `json:"username"`
+	Embeds   []DiscordEmbed `json:"embeds"`
+}
+
+type DiscordEmbed struct {
+	Title       string              `json:"title"`
+	Description string              `json:"description,omitempty"`
+	URL         string              `json:"url,omitempty"`
+	Color       int                 `json:"color"`
+	Fields      []DiscordEmbedField `json:"fields"`
+	Timestamp   time.Time           `json:"timestamp"`
+}
+
+type DiscordEmbedField struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline"`
+}
+
+func (d Discord) Name() string {
+	return chatName("discord", d.webhooks)
+}
+
+func (d Discord) Channel() coursesense.ChannelKind {
+	return chatChannel(coursesense.ChannelDiscord, d.webhooks)
+}
+
+func (d Discord) Notify(ctx context.Context, notification coursesense.Notification, watchers ...coursesense.Watcher) error {
+	targets := chatTargets(d.webhooks, notification, watchers, coursesense.ChannelDiscord)
+	if len(targets) == 0 {
+		return nil
+	}
+
+	// every webhook gets a chance at the message, even if an earlier one failed.
+	// Webhooks that couldn't be reached are reported in a RecipientErrors, keyed by URL like the watchers' addresses
+	failures := RecipientErrors{}
+	for _, target := range targets {
+		if err := postJSON(ctx, d.http, target.url, nil, discordMessage(target.notification(notification)), discordRetryAfter); err != nil {
+			log.Error().Msgf("failed to post discord notification: %v", err)
+			failures[target.url] = err
+			continue
+		}
+		log.Info().Msg("Notification posted to discord")
+	}
+
+	if len(failures) > 0 {
+		return fmt.Errorf("failed to post to %d of %d discord webhooks: %w", len(failures), len(targets), failures)
+	}
+
+	return nil
+}
+
+// broadcast channels are shared with students, so only the per-watcher notifier posts alerts
+func (d Discord) Alert(ctx context.Context, alert coursesense.Alert, contact coursesense.Watcher) error {
+	webhook := contact.Address(coursesense.ChannelDiscord)
+	if len(d.webhooks) > 0 || webhook == "" {
+		return nil
+	}
+
+	embed := DiscordEmbed{
+		Title:       alert.Title(),
+		Description: alertText(alert),
+		Color:       discordColorAlert,
+		Fields:      []DiscordEmbedField{},
+		Timestamp:   time.Now().UTC(),
+	}
+	if !alert.Firing {
+		embed.Color = discordColorOpen
+	}
+
+	if err := postJSON(ctx, d.http, webhook, nil, DiscordMessage{Username: "Course Sense", Embeds: []DiscordEmbed{embed}}, discordRetryAfter); err != nil {
+		return fmt.Errorf("failed to post discord alert: %w", err)
+	}
+
+	return nil
+}
+
+func (d Discord) Urgent() bool {
+	return false
+}
+
+func discordMessage(notification coursesense.Notification) DiscordMessage {
+	embed := DiscordEmbed{
+		Title:     chatTitle(notification),
+		URL:       notificationURL(notification),
+		Color:     discordColorOpen,
+		Fields:    []DiscordEmbedField{},
+		Timestamp: time.Now().UTC(),
+	}
+
+	switch notification.Kind {
+	case coursesense.NotificationWatchExpired:
+		embed.Color = discordColorExpired
+		embed.Description = "The watch expired before any space was found, so we have stopped watching."
+	default:
+		embed.Description = "Get over to WebAdvisor to claim the spot!"
+	}
+	if notification.Course != nil {
+		embed.Description = fmt.Sprintf("Any section of %s*%d in %s. %s", notification.Course.Department, notification.Course.Code, notification.Term, embed.Description)
+	}
+
+	sections, more := chatSections(notification.Sections, discordMaxFields)
+	for _, section := range sections {
+		embed.Fields = append(embed.Fields, DiscordEmbedField{Name: section.String(), Value: chatSectionDetails(notification, section), Inline: true})
+	}
+	if more > 0 {
+		embed.Fields = append(embed.Fields, DiscordEmbedField{Name: "More sections", Value: fmt.Sprintf("and %d more", more)})
+	}
+
+	return DiscordMessage{Username: "Course Sense", Embeds: []DiscordEmbed{embed}}
+}
+
+// discord reports the wait in the body, which is more precise than the header
+func discordRetryAfter(res *http.Response, body []byte) time.Duration {
+	var limit struct {
+		RetryAfter float64 `json:"retry_after"`
+	}
+	if err := json.Unmarshal(body, &limit); err == nil && limit.RetryAfter > 0 {
+		return time.Duration(limit.RetryAfter * float64(time.Second))
+	}
+
+	return retryAfterHeader(res, body)
+}
@@ -0,0 +1,77 @@
+package notifier
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	coursesense "github.com/jacobmichels/Course-Sense-Go"
+)
+
+var _ coursesense.Notifier = Gotify{}
+
+// Pushes every opening to a Gotify application
+type Gotify struct {
+	http     *http.Client
+	baseURL  string
+	token    string
+	priority int
+}
+
+// baseURL is the server root, token is the application's token
+func NewGotify(baseURL, token string, priority int) Gotify {
+	return Gotify{&http.Client{Timeout: 10 * time.Second}, strings.TrimSuffix(baseURL, "/"), token, priority}
+}
+
+type GotifyMessage struct {
+	Title    string         `json:"title"`
+	Message  string         `json:"message"`
+	Priority int            `json:"priority"`
+	Extras   map[string]any `json:"extras"`
+}
+
+func (g Gotify) Name() string {
+	return "gotify"
+}
+
+// the application is shared, so it hears about every watcher
+func (g Gotify) Channel() coursesense.ChannelKind {
+	return ""
+}
+
+func (g Gotify) Notify(ctx context.Context, notification coursesense.Notification, watchers ...coursesense.Watcher) error {
+	// the application is shared rather than a watcher's own, so it only hears about openings
+	if notification.Kind == coursesense.NotificationWatchExpired {
+		return nil
+	}
+	// and doesn't get details personal to a watcher
+	notification.Conflicts = nil
+
+	message := GotifyMessage{
+		Title:    chatTitle(notification),
+		Message:  summaryBody(notification),
+		Priority: g.priority,
+		Extras: map[string]any{
+			"client::notification": map[string]any{
+				"click": map[string]string{"url": notificationURL(notification)},
+			},
+		},
+	}
+
+	header := http.Header{}
+	header.Set("X-Gotify-Key", g.token)
+	if err := postJSON(ctx, g.http, g.baseURL+"/message", header, message, retryAfterHeader); err != nil {
+		return fmt.Errorf("failed to push to gotify: %w", err)
+	}
+	log.Info().Msg("Notification pushed to gotify")
+
+	return nil
+}
+
+func (g Gotify) Urgent() bool {
+	return true
+}
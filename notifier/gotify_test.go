@@ -0,0 +1,75 @@
+package notifier
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	coursesense "github.com/jacobmichels/Course-Sense-Go"
+)
+
+func TestGotifyNotify(t *testing.T) {
+	recorder := &jsonServer{}
+	server := httptest.NewServer(recorder)
+	defer server.Close()
+
+	gotify := NewGotify(server.URL+"/", "app-token", 7)
+	notification := seatsNotification()
+	if err := gotify.Notify(context.Background(), notification, pushWatcher("course-sense-a")); err != nil {
+		t.Fatalf("failed to notify: %v", err)
+	}
+
+	if len(recorder.requests) != 1 {
+		t.Fatalf("got %d requests, want 1", len(recorder.requests))
+	}
+	req := recorder.requests[0]
+	if req.path != "/message" || req.header.Get("X-Gotify-Key") != "app-token" || req.header.Get("Content-Type") != "application/json" {
+		t.Fatalf("got a request to %q with headers %v, want a JSON message keyed with the app token", req.path, req.header)
+	}
+
+	var message struct {
+		Title    string `json:"title"`
+		Message  string `json:"message"`
+		Priority int    `json:"priority"`
+		Extras   struct {
+			Notification struct {
+				Click struct {
+					URL string `json:"url"`
+				} `json:"click"`
+			} `json:"client::notification"`
+		} `json:"extras"`
+	}
+	if err := json.Unmarshal(req.body, &message); err != nil {
+		t.Fatalf("failed to decode message: %v", err)
+	}
+
+	if message.Title != "Seats available" || message.Priority != 7 {
+		t.Fatalf("got title %q and priority %d", message.Title, message.Priority)
+	}
+
+	if message.Extras.Notification.Click.URL != notificationURL(notification) {
+		t.Fatalf("got click url %q, want %q", message.Extras.Notification.Click.URL, notificationURL(notification))
+	}
+
+	// the application is shared, so conflicts with one watcher's timetable are left out
+	if !strings.Contains(message.Message, "CIS 2750 0102 F23") || strings.Contains(message.Message, "conflicts") {
+		t.Fatalf("got message %q, want every section without conflicts", message.Message)
+	}
+}
+
+func TestGotifySkipsExpiries(t *testing.T) {
+	recorder := &jsonServer{}
+	server := httptest.NewServer(recorder)
+	defer server.Close()
+
+	expired := coursesense.Notification{Kind: coursesense.NotificationWatchExpired, Sections: []coursesense.Section{section}}
+	if err := NewGotify(server.URL, "app-token", 7).Notify(context.Background(), expired, pushWatcher("course-sense-a")); err != nil {
+		t.Fatalf("failed to notify: %v", err)
+	}
+
+	if len(recorder.requests) != 0 {
+		t.Fatalf("got %d requests for an expiry, want none", len(recorder.requests))
+	}
+}
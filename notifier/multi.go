@@ -0,0 +1,297 @@
+package notifier
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	coursesense "github.com/jacobmichels/Course-Sense-Go"
+)
+
+var _ coursesense.CompositeNotifier = Multi{}
+
+// Policy decides how a child's failure affects a Multi delivery
+type Policy string
+
+const (
+	// The delivery fails if the child can't reach a watcher and no fallback after it does
+	PolicyRequired Policy = "required"
+	// Failures are reported in the results but never fail the delivery
+	PolicyBestEffort Policy = "best_effort"
+	// Only runs for the watchers the previous child didn't reach, e.g. SMS when email fails
+	PolicyFallback Policy = "fallback"
+)
+
+type Child struct {
+	Notifier coursesense.Notifier
+	Policy   Policy
+	// Bounds the child's delivery. Zero leaves it to the caller's context
+	Timeout time.Duration
+}
+
+// Result is the outcome of one child's delivery
+type Result struct {
+	Notifier string
+	Policy   Policy
+	// Watchers the child was given, zero if it was skipped
+	Watchers int
+	Err      error
+	Elapsed  time.Duration
+}
+
+func (r Result) Skipped() bool {
+	return r.Watchers == 0
+}
+
+// MultiError holds the results of the required children that left watchers unreached
+type MultiError []Result
+
+func (m MultiError) Error() string {
+	failures := make([]string, 0, len(m))
+	for _, result := range m {
+		failures = append(failures, fmt.Sprintf("%s: %v", result.Notifier, result.Err))
+	}
+
+	return fmt.Sprintf("required notifiers failed: %s", strings.Join(failures, "; "))
+}
+
+// Multi delivers through several notifiers as one, each with its own failure policy.
+// Every required or best-effort child starts a chain along with the fallbacks listed after it. Chains run in parallel,
+// the children of a chain one after the other
+type Multi struct {
+	name     string
+	children []Child
+}
+
+func NewMulti(name string, children ...Child) (Multi, error) {
+	if len(children) == 0 {
+		return Multi{}, errors.New("multi notifier needs at least one child")
+	}
+
+	for i, child := range children {
+		switch child.Policy {
+		case PolicyRequired, PolicyBestEffort:
+		case PolicyFallback:
+			if i == 0 {
+				return Multi{}, fmt.Errorf("first child %s cannot be a fallback", child.Notifier.Name())
+			}
+		default:
+			return Multi{}, fmt.Errorf("unknown policy %q for %s", child.Policy, child.Notifier.Name())
+		}
+	}
+
+	return Multi{name, children}, nil
+}
+
+func (m Multi) Name() string {
+	return m.name
+}
+
+// watchers are routed to each child by the child's channel
+func (m Multi) Channel() coursesense.ChannelKind {
+	return ""
+}
+
+// reports whether a child reaches the watcher with notifications of the given kind
+func (m Multi) Routes(watcher coursesense.Watcher, kind coursesense.NotificationKind) bool {
+	for _, child := range m.children {
+		if child.Notifier.Channel() == "" || watcher.Routes(child.Notifier.Channel(), kind) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// urgent if any part is. The trigger holds each part on its own, see Parts
+func (m Multi) Urgent() bool {
+	for _, part := range m.Parts() {
+		if part.Urgent {
+			return true
+		}
+	}
+
+	return false
+}
+
+// a part is a chain, named after its first child. Fallbacks stand in for that child, so they are held along with it
+func (m Multi) Parts() []coursesense.NotifierPart {
+	var parts []coursesense.NotifierPart
+	for _, chain := range m.chains() {
+		head := m.children[chain[0]].Notifier
+		parts = append(parts, coursesense.NotifierPart{Name: head.Name(), Urgent: head.Urgent()})
+	}
+
+	return parts
+}
+
+// returns the [start, end) bounds of every chain
+func (m Multi) chains() [][2]int {
+	var chains [][2]int
+	for start := 0; start < len(m.children); {
+		end := start + 1
+		for end < len(m.children) && m.children[end].Policy == PolicyFallback {
+			end++
+		}
+
+		chains = append(chains, [2]int{start, end})
+		start = end
+	}
+
+	return chains
+}
+
+func (m Multi) Notify(ctx context.Context, notification coursesense.Notification, watchers ...coursesense.Watcher) error {
+	_, _, err := m.Deliver(ctx, notification, nil, watchers...)
+	return err
+}
+
+// Deliver notifies the watchers through every part, each reaching the watchers listed for it by contact key, or every
+// watcher if parts is nil. Returns a result per child in the order they were given, and the contact keys of the watchers
+// each required part left unreached for a retry to go through. The error is a MultiError if a required part left watchers unreached
+func (m Multi) Deliver(ctx context.Context, notification coursesense.Notification, parts map[string][]string, watchers ...coursesense.Watcher) ([]Result, map[string][]string, error) {
+	results := make([]Result, len(m.children))
+	var failures MultiError
+	remaining := make(map[string][]string)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	for _, chain := range m.chains() {
+		targets := watchers
+		if parts != nil {
+			targets = withKeys(watchers, parts[m.children[chain[0]].Notifier.Name()])
+		}
+
+		wg.Add(1)
+		go func(start, end int, targets []coursesense.Watcher) {
+			defer wg.Done()
+
+			failed, missed := m.runChain(ctx, start, end, notification, targets, results)
+			if failed == nil {
+				return
+			}
+
+			mu.Lock()
+			failures = append(failures, *failed)
+			remaining[m.children[start].Notifier.Name()] = missed
+			mu.Unlock()
+		}(chain[0], chain[1], targets)
+	}
+	wg.Wait()
+
+	if len(failures) > 0 {
+		return results, remaining, failures
+	}
+
+	return results, nil, nil
+}
+
+// runs the children in [start, end), each fallback on the watchers left unreached before it.
+// Returns the last failed result and the contact keys of the watchers still unreached if the chain is required and some are
+func (m Multi) runChain(ctx context.Context, start, end int, notification coursesense.Notification, watchers []coursesense.Watcher, results []Result) (*Result, []string) {
+	pending := watchers
+	// contact keys of the watchers a child failed to reach and no later child has
+	failed := make(map[string]bool)
+	var lastFailure *Result
+	for i := start; i < end; i++ {
+		child := m.children[i]
+		results[i] = Result{Notifier: child.Notifier.Name(), Policy: child.Policy}
+
+		var targets, unrouted []coursesense.Watcher
+		for _, watcher := range pending {
+			if child.Notifier.Channel() == "" || watcher.Routes(child.Notifier.Channel(), notification.Kind) {
+				targets = append(targets, watcher)
+			} else {
+				unrouted = append(unrouted, watcher)
+			}
+		}
+
+		if len(targets) == 0 {
+			continue
+		}
+
+		began := time.Now()
+		err := m.notifyChild(ctx, child, notification, targets)
+		results[i].Watchers = len(targets)
+		results[i].Err = err
+		results[i].Elapsed = time.Since(began)
+		if err != nil {
+			lastFailure = &results[i]
+		}
+
+		missed := Unreached(child.Notifier, err, targets)
+		for _, watcher := range targets {
+			delete(failed, watcher.ContactKey())
+		}
+		for _, watcher := range missed {
+			failed[watcher.ContactKey()] = true
+		}
+
+		// watchers the child couldn't reach or route to move on to the fallbacks
+		pending = append(unrouted, missed...)
+	}
+
+	if m.children[start].Policy != PolicyRequired || len(failed) == 0 {
+		return nil, nil
+	}
+
+	var missed []string
+	for _, watcher := range watchers {
+		if failed[watcher.ContactKey()] {
+			missed = append(missed, watcher.ContactKey())
+		}
+	}
+
+	return lastFailure, missed
+}
+
+func (m Multi) notifyChild(ctx context.Context, child Child, notification coursesense.Notification, watchers []coursesense.Watcher) error {
+	if child.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, child.Timeout)
+		defer cancel()
+	}
+
+	return child.Notifier.Notify(ctx, notification, watchers...)
+}
+
+// returns the watchers with the given contact keys
+func withKeys(watchers []coursesense.Watcher, keys []string) []coursesense.Watcher {
+	wanted := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		wanted[key] = true
+	}
+
+	var matched []coursesense.Watcher
+	for _, watcher := range watchers {
+		if wanted[watcher.ContactKey()] {
+			matched = append(matched, watcher)
+		}
+	}
+
+	return matched
+}
+
+// Unreached returns the watchers a failed delivery didn't reach. Notifiers reporting RecipientErrors only failed the listed addresses
+func Unreached(notifier coursesense.Notifier, err error, watchers []coursesense.Watcher) []coursesense.Watcher {
+	if err == nil {
+		return nil
+	}
+
+	var failures RecipientErrors
+	if !errors.As(err, &failures) || notifier.Channel() == "" {
+		return watchers
+	}
+
+	var failed []coursesense.Watcher
+	for _, watcher := range watchers {
+		if _, ok := failures[watcher.Address(notifier.Channel())]; ok {
+			failed = append(failed, watcher)
+		}
+	}
+
+	return failed
+}
@@ -16,7 +16,19 @@ func NewNoop() Noop {
 	return Noop{}
 }
 
-func (n Noop) Notify(ctx context.Context, section coursesense.Section, watchers ...coursesense.Watcher) error {
-	log.Info().Str("section", section.String()).Int("watcher_count", len(watchers)).Msg("noop notifier called")
+func (n Noop) Name() string {
+	return "noop"
+}
+
+func (n Noop) Channel() coursesense.ChannelKind {
+	return ""
+}
+
+func (n Noop) Notify(ctx context.Context, notification coursesense.Notification, watchers ...coursesense.Watcher) error {
+	log.Info().Str("kind", string(notification.Kind)).Int("section_count", len(notification.Sections)).Int("watcher_count", len(watchers)).Msg("noop notifier called")
 	return nil
 }
+
+func (n Noop) Urgent() bool {
+	return false
+}
@@ -0,0 +1,144 @@
+package notifier
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	coursesense "github.com/jacobmichels/Course-Sense-Go"
+)
+
+var _ coursesense.Alerter = Ntfy{}
+
+// priority of expiry notices on ntfy's 1-5 scale, they don't need to interrupt anyone
+const ntfyLowPriority = 2
+
+// Publishes push notifications to watchers' ntfy topics
+type Ntfy struct {
+	http    *http.Client
+	baseURL string
+	token   string
+	// priority of opening notifications
+	priority int
+	tags     []string
+	// makes the unsubscribe links, nil if they are disabled
+	unsubscribe coursesense.UnsubscribeService
+}
+
+// baseURL is the server root, e.g. https://ntfy.sh. token may be empty for servers without auth
+func NewNtfy(baseURL, token string, priority int, unsubscribe coursesense.UnsubscribeService, tags ...string) Ntfy {
+	return Ntfy{&http.Client{Timeout: 10 * time.Second}, strings.TrimSuffix(baseURL, "/"), token, priority, tags, unsubscribe}
+}
+
+// the body of a JSON publish request
+type NtfyMessage struct {
+	Topic    string       `json:"topic"`
+	Title    string       `json:"title"`
+	Message  string       `json:"message"`
+	Priority int          `json:"priority"`
+	Tags     []string     `json:"tags,omitempty"`
+	Click    string       `json:"click,omitempty"`
+	Actions  []NtfyAction `json:"actions,omitempty"`
+}
+
+// a button on the notification, see https://docs.ntfy.sh/publish/#action-buttons
+type NtfyAction struct {
+	Action string `json:"action"`
+	Label  string `json:"label"`
+	URL    string `json:"url"`
+	Method string `json:"method,omitempty"`
+	// dismisses the notification once the action succeeds
+	Clear bool `json:"clear,omitempty"`
+}
+
+func (n Ntfy) Name() string {
+	return "ntfy"
+}
+
+func (n Ntfy) Channel() coursesense.ChannelKind {
+	return coursesense.ChannelPush
+}
+
+func (n Ntfy) Notify(ctx context.Context, notification coursesense.Notification, watchers ...coursesense.Watcher) error {
+	header := http.Header{}
+	if n.token != "" {
+		header.Set("Authorization", "Bearer "+n.token)
+	}
+
+	// every topic gets a chance at the message. Topics that couldn't be reached are reported in a RecipientErrors
+	failures := RecipientErrors{}
+	for _, watcher := range watchers {
+		topic := watcher.Address(coursesense.ChannelPush)
+		if topic == "" {
+			continue
+		}
+
+		if err := postJSON(ctx, n.http, n.baseURL, header, n.message(notification, watcher, topic), retryAfterHeader); err != nil {
+			log.Error().Msgf("failed to publish to ntfy topic %s: %v", topic, err)
+			failures[topic] = err
+			continue
+		}
+		log.Info().Msgf("Notification published to ntfy topic %s", topic)
+	}
+
+	if len(failures) > 0 {
+		return failures
+	}
+
+	return nil
+}
+
+func (n Ntfy) Alert(ctx context.Context, alert coursesense.Alert, contact coursesense.Watcher) error {
+	topic := contact.Address(coursesense.ChannelPush)
+	if topic == "" {
+		return nil
+	}
+
+	header := http.Header{}
+	if n.token != "" {
+		header.Set("Authorization", "Bearer "+n.token)
+	}
+
+	message := NtfyMessage{Topic: topic, Title: alert.Title(), Message: alertText(alert), Priority: n.priority, Tags: []string{"warning"}}
+	if !alert.Firing {
+		message.Priority = ntfyLowPriority
+		message.Tags = []string{"white_check_mark"}
+	}
+
+	if err := postJSON(ctx, n.http, n.baseURL, header, message, retryAfterHeader); err != nil {
+		return fmt.Errorf("failed to publish alert to ntfy topic %s: %w", topic, err)
+	}
+
+	return nil
+}
+
+// push notifications exist to reach the watcher right away, so they fire during quiet hours
+func (n Ntfy) Urgent() bool {
+	return true
+}
+
+func (n Ntfy) message(notification coursesense.Notification, watcher coursesense.Watcher, topic string) NtfyMessage {
+	priority := n.priority
+	if notification.Kind == coursesense.NotificationWatchExpired {
+		priority = ntfyLowPriority
+	}
+
+	message := NtfyMessage{
+		Topic:    topic,
+		Title:    chatTitle(notification),
+		Message:  summaryBody(notification),
+		Priority: priority,
+		Tags:     n.tags,
+		Click:    notificationURL(notification),
+	}
+	// a button posting to the link, so stopping doesn't need a browser
+	if link := unsubscribeURL(n.unsubscribe, notification, watcher); link != "" {
+		message.Actions = []NtfyAction{{Action: "http", Label: "Stop watching", URL: link, Method: "POST", Clear: true}}
+	}
+
+	return message
+}
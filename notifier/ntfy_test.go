@@ -0,0 +1,193 @@
+package notifier
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	coursesense "github.com/jacobmichels/Course-Sense-Go"
+)
+
+// a request received by a jsonServer
+type jsonRequest struct {
+	path   string
+	header http.Header
+	body   []byte
+}
+
+// records the JSON posted to it, answering 200 unless the message's topic has a status set
+type jsonServer struct {
+	mu       sync.Mutex
+	requests []jsonRequest
+	// status answered per ntfy topic
+	fail map[string]int
+}
+
+func (s *jsonServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = append(s.requests, jsonRequest{r.URL.Path, r.Header, body})
+
+	var message struct {
+		Topic string `json:"topic"`
+	}
+	if err := json.Unmarshal(body, &message); err == nil {
+		if status, ok := s.fail[message.Topic]; ok {
+			w.WriteHeader(status)
+			return
+		}
+	}
+}
+
+type stubUnsubscribe struct{}
+
+func (stubUnsubscribe) UnsubscribeURL(notification coursesense.Notification, watcher coursesense.Watcher) string {
+	return "https://example.com/unsubscribe?to=" + watcher.Address(coursesense.ChannelPush)
+}
+
+func (stubUnsubscribe) Unsubscribe(ctx context.Context, token string) error {
+	return nil
+}
+
+func pushWatcher(topic string) coursesense.Watcher {
+	return coursesense.Watcher{Channels: []coursesense.Channel{{Kind: coursesense.ChannelPush, Address: topic}}}
+}
+
+func TestNtfyNotify(t *testing.T) {
+	expired := coursesense.Notification{Kind: coursesense.NotificationWatchExpired, Sections: []coursesense.Section{section}}
+
+	tests := []struct {
+		name         string
+		notification coursesense.Notification
+		unsubscribe  coursesense.UnsubscribeService
+		wantTitle    string
+		wantPriority int
+		wantActions  []NtfyAction
+	}{
+		{
+			name:         "opening",
+			notification: seatsNotification(),
+			wantTitle:    "Seats available",
+			wantPriority: 4,
+		},
+		{
+			name:         "opening with unsubscribe links",
+			notification: seatsNotification(),
+			unsubscribe:  stubUnsubscribe{},
+			wantTitle:    "Seats available",
+			wantPriority: 4,
+			wantActions:  []NtfyAction{{Action: "http", Label: "Stop watching", URL: "https://example.com/unsubscribe?to=course-sense-a", Method: "POST", Clear: true}},
+		},
+		{
+			name:         "expiry",
+			notification: expired,
+			wantTitle:    "Watch expired",
+			wantPriority: ntfyLowPriority,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			recorder := &jsonServer{}
+			server := httptest.NewServer(recorder)
+			defer server.Close()
+
+			ntfy := NewNtfy(server.URL+"/", "tk_secret", 4, test.unsubscribe, "school", "tada")
+			if err := ntfy.Notify(context.Background(), test.notification, pushWatcher("course-sense-a"), contactWatcher("a@example.com", "")); err != nil {
+				t.Fatalf("failed to notify: %v", err)
+			}
+
+			if len(recorder.requests) != 1 {
+				t.Fatalf("got %d requests, want one for the watcher with a topic", len(recorder.requests))
+			}
+			req := recorder.requests[0]
+			if req.path != "/" || req.header.Get("Authorization") != "Bearer tk_secret" || req.header.Get("Content-Type") != "application/json" {
+				t.Fatalf("got a request to %q with headers %v, want an authorized JSON publish to the root", req.path, req.header)
+			}
+
+			var message NtfyMessage
+			if err := json.Unmarshal(req.body, &message); err != nil {
+				t.Fatalf("failed to decode message: %v", err)
+			}
+
+			if message.Topic != "course-sense-a" || message.Title != test.wantTitle || message.Priority != test.wantPriority {
+				t.Fatalf("got topic %q, title %q and priority %d, want %q and %d", message.Topic, message.Title, message.Priority, test.wantTitle, test.wantPriority)
+			}
+
+			if len(message.Tags) != 2 || message.Tags[0] != "school" || message.Tags[1] != "tada" {
+				t.Fatalf("got tags %v, want the configured tags", message.Tags)
+			}
+
+			if message.Click != notificationURL(test.notification) || message.Message != summaryBody(test.notification) {
+				t.Fatalf("got click %q and message %q", message.Click, message.Message)
+			}
+
+			if len(message.Actions) != len(test.wantActions) || (len(message.Actions) == 1 && message.Actions[0] != test.wantActions[0]) {
+				t.Fatalf("got actions %+v, want %+v", message.Actions, test.wantActions)
+			}
+		})
+	}
+}
+
+func TestNtfyReportsFailedTopics(t *testing.T) {
+	recorder := &jsonServer{fail: map[string]int{"course-sense-b": http.StatusForbidden}}
+	server := httptest.NewServer(recorder)
+	defer server.Close()
+
+	watchers := []coursesense.Watcher{pushWatcher("course-sense-a"), pushWatcher("course-sense-b"), pushWatcher("course-sense-c")}
+	ntfy := NewNtfy(server.URL, "", 3, nil)
+	err := ntfy.Notify(context.Background(), seatsNotification(), watchers...)
+
+	var failures RecipientErrors
+	if !errors.As(err, &failures) || len(failures) != 1 || failures["course-sense-b"] == nil {
+		t.Fatalf("got error %v, want the failed topic only", err)
+	}
+
+	if len(recorder.requests) != 3 {
+		t.Fatalf("got %d requests, want every topic tried", len(recorder.requests))
+	}
+	if recorder.requests[0].header.Get("Authorization") != "" {
+		t.Fatal("got an authorization header without a token")
+	}
+}
+
+func TestNtfyAlert(t *testing.T) {
+	tests := []struct {
+		name         string
+		firing       bool
+		wantPriority int
+		wantTag      string
+	}{
+		{"firing", true, 5, "warning"},
+		{"recovered", false, ntfyLowPriority, "white_check_mark"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			recorder := &jsonServer{}
+			server := httptest.NewServer(recorder)
+			defer server.Close()
+
+			alert := coursesense.Alert{Rule: "consecutive_failures", Firing: test.firing, Message: "5 failures in a row"}
+			if err := NewNtfy(server.URL, "", 5, nil).Alert(context.Background(), alert, pushWatcher("ops")); err != nil {
+				t.Fatalf("failed to alert: %v", err)
+			}
+
+			var message NtfyMessage
+			if err := json.Unmarshal(recorder.requests[0].body, &message); err != nil {
+				t.Fatalf("failed to decode message: %v", err)
+			}
+
+			if message.Title != alert.Title() || message.Priority != test.wantPriority || len(message.Tags) != 1 || message.Tags[0] != test.wantTag {
+				t.Fatalf("got title %q, priority %d and tags %v", message.Title, message.Priority, message.Tags)
+			}
+		})
+	}
+}
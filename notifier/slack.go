@@ -0,0 +1,148 @@
+package notifier
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	coursesense "github.com/jacobmichels/Course-Sense-Go"
+	"github.com/jacobmichels/Course-Sense-Go/i18n"
+)
+
+var _ coursesense.Alerter = Slack{}
+
+const (
+	// slack allows at most 10 fields in a section block
+	slackFieldsPerBlock = 10
+	slackMaxSections    = 40
+)
+
+// Posts Block Kit messages to Slack incoming webhooks
+type Slack struct {
+	http *http.Client
+	// channels that hear about every opening. Without any, each watcher's own webhook is notified instead
+	webhooks []string
+}
+
+// NewSlack returns a notifier posting to watchers' own webhooks, or a broadcast notifier posting to the given webhooks
+func NewSlack(webhooks ...string) Slack {
+	return Slack{&http.Client{Timeout: 10 * time.Second}, webhooks}
+}
+
+type SlackMessage struct {
+	// shown in notifications and clients that can't render blocks
+	Text   string       `json:"text"`
+	Blocks []SlackBlock `json:"blocks,omitempty"`
+}
+
+type SlackBlock struct {
+	Type     string        `json:"type"`
+	Text     *SlackText    `json:"text,omitempty"`
+	Fields   []SlackText   `json:"fields,omitempty"`
+	Elements []SlackButton `json:"elements,omitempty"`
+}
+
+type SlackText struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+type SlackButton struct {
+	Type string    `json:"type"`
+	Text SlackText `json:"text"`
+	URL  string    `json:"url"`
+}
+
+func (s Slack) Name() string {
+	return chatName("slack", s.webhooks)
+}
+
+func (s Slack) Channel() coursesense.ChannelKind {
+	return chatChannel(coursesense.ChannelSlack, s.webhooks)
+}
+
+func (s Slack) Notify(ctx context.Context, notification coursesense.Notification, watchers ...coursesense.Watcher) error {
+	targets := chatTargets(s.webhooks, notification, watchers, coursesense.ChannelSlack)
+	if len(targets) == 0 {
+		return nil
+	}
+
+	// every webhook gets a chance at the message, even if an earlier one failed.
+	// Webhooks that couldn't be reached are reported in a RecipientErrors, keyed by URL like the watchers' addresses
+	failures := RecipientErrors{}
+	for _, target := range targets {
+		if err := postJSON(ctx, s.http, target.url, nil, slackMessage(target.notification(notification)), retryAfterHeader); err != nil {
+			log.Error().Msgf("failed to post slack notification: %v", err)
+			failures[target.url] = err
+			continue
+		}
+		log.Info().Msg("Notification posted to slack")
+	}
+
+	if len(failures) > 0 {
+		return fmt.Errorf("failed to post to %d of %d slack webhooks: %w", len(failures), len(targets), failures)
+	}
+
+	return nil
+}
+
+// broadcast channels are shared with students, so only the per-watcher notifier posts alerts
+func (s Slack) Alert(ctx context.Context, alert coursesense.Alert, contact coursesense.Watcher) error {
+	webhook := contact.Address(coursesense.ChannelSlack)
+	if len(s.webhooks) > 0 || webhook == "" {
+		return nil
+	}
+
+	if err := postJSON(ctx, s.http, webhook, nil, SlackMessage{Text: fmt.Sprintf("*%s*\n%s", alert.Title(), alertText(alert))}, retryAfterHeader); err != nil {
+		return fmt.Errorf("failed to post slack alert: %w", err)
+	}
+
+	return nil
+}
+
+func (s Slack) Urgent() bool {
+	return false
+}
+
+func slackMessage(notification coursesense.Notification) SlackMessage {
+	// chat messages are only written in English, the fallback text matches the blocks
+	text := smsBody(notification, i18n.English)
+	// section codes are wrapped in backticks, their asterisks would otherwise be read as bold markers
+	blocks := []SlackBlock{
+		{Type: "header", Text: &SlackText{Type: "plain_text", Text: chatTitle(notification)}},
+	}
+
+	if notification.Course != nil {
+		blocks = append(blocks, SlackBlock{Type: "section", Text: &SlackText{Type: "mrkdwn", Text: fmt.Sprintf("Any section of `%s*%d` in %s", notification.Course.Department, notification.Course.Code, notification.Term)}})
+	}
+
+	sections, more := chatSections(notification.Sections, slackMaxSections)
+	for start := 0; start < len(sections); start += slackFieldsPerBlock {
+		end := start + slackFieldsPerBlock
+		if end > len(sections) {
+			end = len(sections)
+		}
+
+		block := SlackBlock{Type: "section"}
+		for _, section := range sections[start:end] {
+			block.Fields = append(block.Fields, SlackText{Type: "mrkdwn", Text: fmt.Sprintf("`%s`\n%s", section.String(), chatSectionDetails(notification, section))})
+		}
+		blocks = append(blocks, block)
+	}
+	if more > 0 {
+		blocks = append(blocks, SlackBlock{Type: "section", Text: &SlackText{Type: "mrkdwn", Text: fmt.Sprintf("_and %d more_", more)}})
+	}
+
+	if notification.Kind != coursesense.NotificationWatchExpired {
+		blocks = append(blocks, SlackBlock{Type: "actions", Elements: []SlackButton{{
+			Type: "button",
+			Text: SlackText{Type: "plain_text", Text: "Open WebAdvisor"},
+			URL:  notificationURL(notification),
+		}}})
+	}
+
+	return SlackMessage{Text: text, Blocks: blocks}
+}
@@ -0,0 +1,144 @@
+package notifier
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	coursesense "github.com/jacobmichels/Course-Sense-Go"
+	"github.com/jacobmichels/Course-Sense-Go/i18n"
+)
+
+var _ coursesense.Alerter = SMS{}
+
+// Sends text messages through a Twilio compatible REST API
+type SMS struct {
+	http       *http.Client
+	baseURL    string
+	accountSID string
+	authToken  string
+	from       string
+}
+
+// baseURL is the API root, e.g. https://api.twilio.com
+func NewSMS(baseURL, accountSID, authToken, from string) SMS {
+	return SMS{&http.Client{Timeout: 10 * time.Second}, strings.TrimSuffix(baseURL, "/"), accountSID, authToken, from}
+}
+
+func (s SMS) Name() string {
+	return "sms"
+}
+
+func (s SMS) Channel() coursesense.ChannelKind {
+	return coursesense.ChannelSMS
+}
+
+// every phone gets a chance at the message. Phones that couldn't be reached are reported in a RecipientErrors
+func (s SMS) Notify(ctx context.Context, notification coursesense.Notification, watchers ...coursesense.Watcher) error {
+	failures := RecipientErrors{}
+	for _, watcher := range watchers {
+		phone := watcher.Address(coursesense.ChannelSMS)
+		if phone == "" {
+			continue
+		}
+
+		to, err := coursesense.NormalizePhone(phone)
+		if err != nil {
+			failures[phone] = err
+			continue
+		}
+
+		if err := s.send(ctx, to, smsBody(notification, watcher.Locale)); err != nil {
+			log.Error().Msgf("failed to send notification SMS to %s: %v", to, err)
+			failures[phone] = err
+			continue
+		}
+		log.Info().Msgf("Notification SMS sent to %s", watcher)
+	}
+
+	if len(failures) > 0 {
+		return failures
+	}
+
+	return nil
+}
+
+func (s SMS) Alert(ctx context.Context, alert coursesense.Alert, contact coursesense.Watcher) error {
+	phone := contact.Address(coursesense.ChannelSMS)
+	if phone == "" {
+		return nil
+	}
+
+	to, err := coursesense.NormalizePhone(phone)
+	if err != nil {
+		return fmt.Errorf("failed to alert %s: %w", phone, err)
+	}
+
+	if err := s.send(ctx, to, fmt.Sprintf("%s. %s", alert.Title(), alert.Message)); err != nil {
+		return fmt.Errorf("failed to alert %s: %w", to, err)
+	}
+
+	return nil
+}
+
+// texts interrupt the watcher, so they are allowed to fire during quiet hours
+func (s SMS) Urgent() bool {
+	return true
+}
+
+func (s SMS) send(ctx context.Context, to, body string) error {
+	form := url.Values{}
+	form.Set("To", to)
+	form.Set("From", s.from)
+	form.Set("Body", body)
+
+	endpoint := fmt.Sprintf("%s/2010-04-01/Accounts/%s/Messages.json", s.baseURL, url.PathEscape(s.accountSID))
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.SetBasicAuth(s.accountSID, s.authToken)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	res, err := s.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		return fmt.Errorf("unexpected status %s: %s", res.Status, body)
+	}
+
+	return nil
+}
+
+// returns a message in the locale short enough to fit in a couple of SMS segments
+func smsBody(notification coursesense.Notification, locale string) string {
+	var sections []string
+	for _, section := range notification.Sections {
+		description := section.String()
+		if !notification.ConflictFree(section) {
+			description += fmt.Sprintf(" (%s)", i18n.T(locale, i18n.Conflicts))
+		}
+		sections = append(sections, description)
+	}
+
+	switch notification.Kind {
+	case coursesense.NotificationWatchExpired:
+		if notification.Course != nil {
+			return i18n.T(locale, i18n.SMSExpired, fmt.Sprintf("%s*%d*%s", notification.Course.Department, notification.Course.Code, notification.Term))
+		}
+		return i18n.T(locale, i18n.SMSExpired, strings.Join(sections, ", "))
+	default:
+		return i18n.T(locale, i18n.SMSOpening, strings.Join(sections, ", "))
+	}
+}
@@ -0,0 +1,127 @@
+package notifier
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	coursesense "github.com/jacobmichels/Course-Sense-Go"
+)
+
+// records the messages posted to a Twilio compatible API, failing those sent to the given number
+type smsServer struct {
+	mu       sync.Mutex
+	messages []url.Values
+	failTo   string
+}
+
+func (s *smsServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	username, password, ok := r.BasicAuth()
+	if !ok || username != "AC123" || password != "token" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	if r.Method != "POST" || r.URL.Path != "/2010-04-01/Accounts/AC123/Messages.json" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.messages = append(s.messages, r.PostForm)
+
+	if r.PostForm.Get("To") == s.failTo {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+func TestSMSNotify(t *testing.T) {
+	recorder := &smsServer{failTo: "+15195559999"}
+	server := httptest.NewServer(recorder)
+	defer server.Close()
+
+	watchers := []coursesense.Watcher{
+		contactWatcher("", "(519) 555-1234"),
+		contactWatcher("", "+1 519 555 9999"),
+		contactWatcher("", "519-555-12"),
+		// no phone, so not texted
+		contactWatcher("a@example.com", ""),
+	}
+
+	sms := NewSMS(server.URL+"/", "AC123", "token", "+15195550000")
+	err := sms.Notify(context.Background(), seatsNotification(), watchers...)
+
+	var failures RecipientErrors
+	if !errors.As(err, &failures) {
+		t.Fatalf("got error %v, want RecipientErrors", err)
+	}
+	if len(failures) != 2 || failures["+1 519 555 9999"] == nil || failures["519-555-12"] == nil {
+		t.Fatalf("got failures %v, want the failed send and the invalid number by their watchers' addresses", failures)
+	}
+
+	unreached := Unreached(sms, err, watchers)
+	if len(unreached) != 2 || unreached[0].ContactKey() != watchers[1].ContactKey() || unreached[1].ContactKey() != watchers[2].ContactKey() {
+		t.Fatalf("got unreached %v, want the two failed watchers", unreached)
+	}
+
+	if len(recorder.messages) != 2 {
+		t.Fatalf("got %d messages posted, want one for each valid number", len(recorder.messages))
+	}
+
+	for i, to := range []string{"+15195551234", "+15195559999"} {
+		message := recorder.messages[i]
+		if message.Get("To") != to || message.Get("From") != "+15195550000" {
+			t.Fatalf("got message to %q from %q, want to %q", message.Get("To"), message.Get("From"), to)
+		}
+
+		if !strings.Contains(message.Get("Body"), section.String()) || !strings.Contains(message.Get("Body"), other.String()) {
+			t.Fatalf("got body %q, want both sections", message.Get("Body"))
+		}
+	}
+}
+
+func TestSMSAlert(t *testing.T) {
+	recorder := &smsServer{}
+	server := httptest.NewServer(recorder)
+	defer server.Close()
+
+	tests := []struct {
+		name      string
+		authToken string
+		wantErr   bool
+	}{
+		{"valid credentials", "token", false},
+		{"wrong credentials", "wrong", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sms := NewSMS(server.URL, "AC123", test.authToken, "+15195550000")
+			alert := coursesense.Alert{Rule: "consecutive_failures", Firing: true, Message: "5 failures in a row"}
+			err := sms.Alert(context.Background(), alert, contactWatcher("", "519.555.1234"))
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got error %v, want error %v", err, test.wantErr)
+			}
+		})
+	}
+
+	if len(recorder.messages) != 1 || recorder.messages[0].Get("To") != "+15195551234" {
+		t.Fatalf("got messages %v, want the alert posted once with valid credentials", recorder.messages)
+	}
+	if body := recorder.messages[0].Get("Body"); body != "Course Sense alert: consecutive_failures. 5 failures in a row" {
+		t.Fatalf("got body %q, want the alert's title and message", body)
+	}
+}
@@ -1,52 +1,220 @@
 package notifier
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
-	"net/smtp"
+	"html"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"time"
 
 	"github.com/rs/zerolog/log"
 
 	coursesense "github.com/jacobmichels/Course-Sense-Go"
 )
 
-var _ coursesense.Notifier = Email{}
+var _ coursesense.Alerter = Email{}
+var _ coursesense.VerificationSender = Email{}
 
 type Email struct {
-	host     string
-	port     int
-	username string
-	password string
-	from     string
+	transport Transport
+	from      string
+	templates emailTemplates
+	// makes the unsubscribe links, nil if they are disabled
+	unsubscribe coursesense.UnsubscribeService
 }
 
-func NewEmail(host, username, password, from string, port int) Email {
-	return Email{host, port, username, password, from}
+// templateDir overrides the embedded email templates, it may be empty
+func NewEmail(transport Transport, from, templateDir string, unsubscribe coursesense.UnsubscribeService) (Email, error) {
+	templates, err := loadEmailTemplates(templateDir)
+	if err != nil {
+		return Email{}, fmt.Errorf("failed to load email templates: %w", err)
+	}
+
+	return Email{transport, from, templates, unsubscribe}, nil
 }
 
-func (e Email) Notify(ctx context.Context, section coursesense.Section, watchers ...coursesense.Watcher) error {
-	auth := smtp.PlainAuth("", e.username, e.password, e.host)
+func (e Email) Name() string {
+	return "email"
+}
 
-	for _, watcher := range watchers {
-		msg := []byte(fmt.Sprintf(`From: jacob.michels2025@gmail.com
-To: %s
-Subject: Course Sense Notification
+func (e Email) Channel() coursesense.ChannelKind {
+	return coursesense.ChannelEmail
+}
 
-Hello from Course Sense!
+// sends every watcher their email over a single connection. Watchers that couldn't be reached are reported in a RecipientErrors
+func (e Email) Notify(ctx context.Context, notification coursesense.Notification, watchers ...coursesense.Watcher) error {
+	failures := RecipientErrors{}
 
-Space has been found in the following course section: %s %d %s %s. Get over to WebAdvisor to claim the spot!
+	var envelopes []Envelope
+	for _, watcher := range watchers {
+		to := watcher.Address(coursesense.ChannelEmail)
+		if to == "" {
+			continue
+		}
 
-Thanks for using Course Sense.`, watcher.Email, section.Course.Department, section.Course.Code, section.Code, section.Term))
-		if watcher.Email == "" {
+		content, err := e.templates.render(notification, watcher, unsubscribeURL(e.unsubscribe, notification, watcher))
+		if err != nil {
+			failures[to] = err
 			continue
 		}
 
-		err := smtp.SendMail(fmt.Sprintf("%s:%d", e.host, e.port), auth, e.from, []string{watcher.Email}, msg)
+		msg, err := e.message(to, content, time.Now())
 		if err != nil {
-			return fmt.Errorf("failed to notify %s: %w", watcher.Email, err)
+			failures[to] = err
+			continue
+		}
+
+		envelopes = append(envelopes, Envelope{From: e.from, To: to, Data: msg})
+	}
+
+	if len(envelopes) > 0 {
+		var sendFailures RecipientErrors
+		if err := e.transport.Send(ctx, envelopes...); errors.As(err, &sendFailures) {
+			for recipient, err := range sendFailures {
+				failures[recipient] = err
+			}
+		} else if err != nil {
+			return fmt.Errorf("failed to send notification emails: %w", err)
+		}
+	}
+
+	for _, envelope := range envelopes {
+		if _, failed := failures[envelope.To]; !failed {
+			log.Info().Msgf("Notification email sent to %s", envelope.To)
 		}
-		log.Info().Msgf("Notification email sent to %s", watcher)
+	}
+
+	if len(failures) > 0 {
+		return failures
+	}
+
+	return nil
+}
+
+// sends the email asking a watcher to confirm their address
+func (e Email) SendVerification(ctx context.Context, verification coursesense.Verification) error {
+	content, err := e.templates.renderVerification(verification)
+	if err != nil {
+		return err
+	}
+
+	msg, err := e.message(verification.Email, content, time.Now())
+	if err != nil {
+		return err
+	}
+
+	if err := e.transport.Send(ctx, Envelope{From: e.from, To: verification.Email, Data: msg}); err != nil {
+		return fmt.Errorf("failed to send verification email: %w", err)
+	}
+
+	log.Info().Msgf("Verification email sent to %s", verification.Email)
+	return nil
+}
+
+// sends an operator alert as a plain message, without templates or unsubscribe links
+func (e Email) Alert(ctx context.Context, alert coursesense.Alert, contact coursesense.Watcher) error {
+	to := contact.Address(coursesense.ChannelEmail)
+	if to == "" {
+		return nil
+	}
+
+	text := alertText(alert)
+	content := renderedEmail{subject: alert.Title(), text: text, html: "<p>" + strings.ReplaceAll(html.EscapeString(text), "\n\n", "</p><p>") + "</p>"}
+	msg, err := e.message(to, content, time.Now())
+	if err != nil {
+		return err
+	}
+
+	if err := e.transport.Send(ctx, Envelope{From: e.from, To: to, Data: msg}); err != nil {
+		return fmt.Errorf("failed to send alert email: %w", err)
 	}
 
 	return nil
 }
+
+// email isn't urgent, it is held during quiet hours
+func (e Email) Urgent() bool {
+	return false
+}
+
+// builds a multipart/alternative message with plain text and html versions of the content
+func (e Email) message(to string, content renderedEmail, now time.Time) ([]byte, error) {
+	messageID, err := newMessageID(e.from)
+	if err != nil {
+		return nil, err
+	}
+
+	var body bytes.Buffer
+	parts := multipart.NewWriter(&body)
+	if err := writeQuotedPrintablePart(parts, "text/plain; charset=utf-8", content.text); err != nil {
+		return nil, err
+	}
+	if err := writeQuotedPrintablePart(parts, "text/html; charset=utf-8", content.html); err != nil {
+		return nil, err
+	}
+	if err := parts.Close(); err != nil {
+		return nil, fmt.Errorf("failed to finish message: %w", err)
+	}
+
+	var msg bytes.Buffer
+	headers := [][2]string{
+		{"From", (&mail.Address{Name: "Course Sense", Address: e.from}).String()},
+		{"To", (&mail.Address{Address: to}).String()},
+		{"Subject", mime.QEncoding.Encode("utf-8", content.subject)},
+		{"Date", now.Format(time.RFC1123Z)},
+		{"Message-ID", messageID},
+		{"MIME-Version", "1.0"},
+		{"Content-Type", "multipart/alternative; boundary=" + parts.Boundary()},
+	}
+	// one-click unsubscribe, see RFC 8058
+	if content.unsubscribeURL != "" {
+		headers = append(headers, [2]string{"List-Unsubscribe", "<" + content.unsubscribeURL + ">"}, [2]string{"List-Unsubscribe-Post", "List-Unsubscribe=One-Click"})
+	}
+	for _, header := range headers {
+		fmt.Fprintf(&msg, "%s: %s\r\n", header[0], header[1])
+	}
+	msg.WriteString("\r\n")
+	msg.Write(body.Bytes())
+
+	return msg.Bytes(), nil
+}
+
+func writeQuotedPrintablePart(parts *multipart.Writer, contentType, content string) error {
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Type", contentType)
+	header.Set("Content-Transfer-Encoding", "quoted-printable")
+
+	part, err := parts.CreatePart(header)
+	if err != nil {
+		return fmt.Errorf("failed to create %s part: %w", contentType, err)
+	}
+
+	encoder := quotedprintable.NewWriter(part)
+	if _, err := encoder.Write([]byte(content)); err != nil {
+		return fmt.Errorf("failed to write %s part: %w", contentType, err)
+	}
+
+	return encoder.Close()
+}
+
+// returns a unique Message-ID on the sender's domain
+func newMessageID(from string) (string, error) {
+	id, err := newEventID()
+	if err != nil {
+		return "", err
+	}
+
+	domain := "coursesense"
+	if at := strings.LastIndex(from, "@"); at >= 0 && at < len(from)-1 {
+		domain = from[at+1:]
+	}
+
+	return fmt.Sprintf("<%s@%s>", id, domain), nil
+}
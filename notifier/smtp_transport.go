@@ -0,0 +1,248 @@
+package notifier
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"sort"
+	"strings"
+	"time"
+)
+
+// how the connection to the SMTP server is secured
+type SMTPSecurity string
+
+const (
+	// TLS from the first byte, usually on port 465
+	SMTPImplicitTLS SMTPSecurity = "implicit"
+	// upgrade with STARTTLS, failing if the server doesn't offer it
+	SMTPStartTLS SMTPSecurity = "starttls"
+	// no encryption. Credentials are only sent in the clear to localhost
+	SMTPPlain SMTPSecurity = "none"
+)
+
+// ErrSMTPAuth is returned when the SMTP server rejects the credentials
+var ErrSMTPAuth = errors.New("smtp authentication failed")
+
+// Transport hands finished messages over for delivery
+type Transport interface {
+	// Sends every envelope. Recipients that couldn't be reached are reported in a RecipientErrors
+	Send(ctx context.Context, envelopes ...Envelope) error
+}
+
+var _ Transport = SMTPTransport{}
+
+// Sends messages over SMTP, honouring context deadlines and cancellation
+type SMTPTransport struct {
+	host     string
+	port     int
+	username string
+	password string
+	security SMTPSecurity
+	// timeout used when the context has no deadline
+	timeout time.Duration
+}
+
+func NewSMTPTransport(host string, port int, username, password string, security SMTPSecurity) SMTPTransport {
+	return SMTPTransport{host, port, username, password, security, 30 * time.Second}
+}
+
+// a message for a single recipient
+type Envelope struct {
+	From string
+	To   string
+	Data []byte
+}
+
+// RecipientErrors holds the recipients a batch failed to reach, keyed by address
+type RecipientErrors map[string]error
+
+func (r RecipientErrors) Error() string {
+	recipients := make([]string, 0, len(r))
+	for recipient := range r {
+		recipients = append(recipients, recipient)
+	}
+	sort.Strings(recipients)
+
+	failures := make([]string, 0, len(recipients))
+	for _, recipient := range recipients {
+		failures = append(failures, fmt.Sprintf("%s: %v", recipient, r[recipient]))
+	}
+
+	return fmt.Sprintf("failed to send to %d recipients: %s", len(r), strings.Join(failures, "; "))
+}
+
+// Is reports whether any recipient failed with the target error
+func (r RecipientErrors) Is(target error) bool {
+	for _, err := range r {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// sends every envelope over one authenticated connection. A recipient the server rejects doesn't stop the batch,
+// failures are returned as RecipientErrors. The connection is reopened if it breaks mid batch
+func (t SMTPTransport) Send(ctx context.Context, envelopes ...Envelope) error {
+	failures := RecipientErrors{}
+
+	var session *smtpSession
+	defer func() {
+		if session != nil {
+			session.close()
+		}
+	}()
+
+	for _, envelope := range envelopes {
+		if err := ctx.Err(); err != nil {
+			failures[envelope.To] = err
+			continue
+		}
+
+		if session == nil {
+			var err error
+			if session, err = t.open(ctx); err != nil {
+				failures[envelope.To] = err
+				continue
+			}
+		}
+
+		// without a deadline on the context, each message gets the full timeout
+		err := session.conn.SetDeadline(t.deadline(ctx))
+		if err == nil {
+			err = session.send(envelope)
+		}
+		if err == nil {
+			continue
+		}
+		failures[envelope.To] = err
+
+		// a rejection leaves the connection usable once the transaction is reset, anything else means it's gone
+		var reply *textproto.Error
+		if errors.As(err, &reply) && session.client.Reset() == nil {
+			continue
+		}
+		session.abort()
+		session = nil
+	}
+
+	if len(failures) > 0 {
+		return failures
+	}
+
+	return nil
+}
+
+func (t SMTPTransport) deadline(ctx context.Context) time.Time {
+	if deadline, ok := ctx.Deadline(); ok {
+		return deadline
+	}
+
+	return time.Now().Add(t.timeout)
+}
+
+type smtpSession struct {
+	conn   net.Conn
+	client *smtp.Client
+	// stops the goroutine watching for context cancellation
+	stop chan struct{}
+}
+
+func (t SMTPTransport) open(ctx context.Context) (*smtpSession, error) {
+	addr := net.JoinHostPort(t.host, fmt.Sprint(t.port))
+	tlsConfig := &tls.Config{ServerName: t.host}
+
+	var conn net.Conn
+	var err error
+	if t.security == SMTPImplicitTLS {
+		dialer := tls.Dialer{Config: tlsConfig}
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	} else {
+		var dialer net.Dialer
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", addr, err)
+	}
+
+	if err := conn.SetDeadline(t.deadline(ctx)); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to set deadline: %w", err)
+	}
+
+	// net/smtp doesn't take a context, so cancellation interrupts whatever read or write is in flight
+	session := &smtpSession{conn: conn, stop: make(chan struct{})}
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.SetDeadline(time.Now())
+		case <-session.stop:
+		}
+	}()
+
+	if session.client, err = smtp.NewClient(conn, t.host); err != nil {
+		session.abort()
+		return nil, fmt.Errorf("failed to start smtp session: %w", err)
+	}
+
+	if t.security == SMTPStartTLS {
+		if ok, _ := session.client.Extension("STARTTLS"); !ok {
+			session.abort()
+			return nil, errors.New("server doesn't support STARTTLS")
+		}
+		if err := session.client.StartTLS(tlsConfig); err != nil {
+			session.abort()
+			return nil, fmt.Errorf("failed to start tls: %w", err)
+		}
+	}
+
+	if t.username != "" {
+		if err := session.client.Auth(smtp.PlainAuth("", t.username, t.password, t.host)); err != nil {
+			session.abort()
+			return nil, fmt.Errorf("%w: %v", ErrSMTPAuth, err)
+		}
+	}
+
+	return session, nil
+}
+
+func (s *smtpSession) send(envelope Envelope) error {
+	if err := s.client.Mail(envelope.From); err != nil {
+		return fmt.Errorf("sender rejected: %w", err)
+	}
+	if err := s.client.Rcpt(envelope.To); err != nil {
+		return fmt.Errorf("recipient rejected: %w", err)
+	}
+
+	w, err := s.client.Data()
+	if err != nil {
+		return fmt.Errorf("data rejected: %w", err)
+	}
+	if _, err := w.Write(envelope.Data); err != nil {
+		w.Close()
+		return fmt.Errorf("failed to write message: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("message rejected: %w", err)
+	}
+
+	return nil
+}
+
+// ends the session politely
+func (s *smtpSession) close() {
+	s.client.Quit()
+	s.abort()
+}
+
+// drops the connection without waiting on the server
+func (s *smtpSession) abort() {
+	close(s.stop)
+	s.conn.Close()
+}
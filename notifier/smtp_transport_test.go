@@ -0,0 +1,171 @@
+package notifier
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"net"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// a scripted SMTP server checking PLAIN credentials and rejecting one recipient, recording who it accepted mail for
+type smtpStub struct {
+	username string
+	password string
+	reject   string
+
+	mu        sync.Mutex
+	delivered []string
+}
+
+// serves connections on a free local port until the test ends, returning the port
+func (s *smtpStub) listen(t *testing.T) int {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+func (s *smtpStub) serve(conn net.Conn) {
+	defer conn.Close()
+	text := textproto.NewConn(conn)
+
+	var rcpt string
+	text.PrintfLine("220 stub ready")
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+
+		verb, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "EHLO":
+			text.PrintfLine("250-stub\r\n250 AUTH PLAIN")
+		case "AUTH":
+			credentials, _ := base64.StdEncoding.DecodeString(strings.TrimPrefix(arg, "PLAIN "))
+			if string(credentials) != "\x00"+s.username+"\x00"+s.password {
+				text.PrintfLine("535 5.7.8 authentication credentials invalid")
+				continue
+			}
+			text.PrintfLine("235 authenticated")
+		case "MAIL", "RSET":
+			rcpt = ""
+			text.PrintfLine("250 OK")
+		case "RCPT":
+			to := strings.Trim(strings.TrimPrefix(arg, "TO:"), "<>")
+			if to == s.reject {
+				text.PrintfLine("550 5.1.1 no such user")
+				continue
+			}
+			rcpt = to
+			text.PrintfLine("250 OK")
+		case "DATA":
+			text.PrintfLine("354 go ahead")
+			if _, err := text.ReadDotBytes(); err != nil {
+				return
+			}
+
+			s.mu.Lock()
+			s.delivered = append(s.delivered, rcpt)
+			s.mu.Unlock()
+			text.PrintfLine("250 OK")
+		case "QUIT":
+			text.PrintfLine("221 bye")
+			return
+		default:
+			text.PrintfLine("502 command not implemented")
+		}
+	}
+}
+
+func envelopes(recipients ...string) []Envelope {
+	var envelopes []Envelope
+	for _, to := range recipients {
+		envelopes = append(envelopes, Envelope{From: "coursesense@example.com", To: to, Data: []byte("Subject: test\r\n\r\nhello\r\n")})
+	}
+
+	return envelopes
+}
+
+func TestSMTPTransportSend(t *testing.T) {
+	tests := []struct {
+		name       string
+		password   string
+		reject     string
+		wantFailed []string
+		wantSent   []string
+		wantAuth   bool
+	}{
+		{
+			name:     "delivered",
+			password: "password",
+			wantSent: []string{"a@example.com", "b@example.com", "c@example.com"},
+		},
+		{
+			name:       "rejected recipient",
+			password:   "password",
+			reject:     "b@example.com",
+			wantFailed: []string{"b@example.com"},
+			wantSent:   []string{"a@example.com", "c@example.com"},
+		},
+		{
+			name:       "wrong password",
+			password:   "wrong",
+			wantFailed: []string{"a@example.com", "b@example.com", "c@example.com"},
+			wantAuth:   true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			stub := &smtpStub{username: "user", password: "password", reject: test.reject}
+			transport := NewSMTPTransport("127.0.0.1", stub.listen(t), "user", test.password, SMTPPlain)
+
+			err := transport.Send(context.Background(), envelopes("a@example.com", "b@example.com", "c@example.com")...)
+			if len(test.wantFailed) == 0 {
+				if err != nil {
+					t.Fatalf("failed to send: %v", err)
+				}
+			} else {
+				var failures RecipientErrors
+				if !errors.As(err, &failures) || len(failures) != len(test.wantFailed) {
+					t.Fatalf("got error %v, want failures for %v", err, test.wantFailed)
+				}
+				for _, recipient := range test.wantFailed {
+					if failures[recipient] == nil {
+						t.Fatalf("got failures %v, want one for %s", failures, recipient)
+					}
+				}
+			}
+
+			if errors.Is(err, ErrSMTPAuth) != test.wantAuth {
+				t.Fatalf("got error %v, want it to wrap ErrSMTPAuth: %v", err, test.wantAuth)
+			}
+
+			stub.mu.Lock()
+			defer stub.mu.Unlock()
+			if strings.Join(stub.delivered, ",") != strings.Join(test.wantSent, ",") {
+				t.Fatalf("got deliveries to %v, want %v", stub.delivered, test.wantSent)
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package notifier
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/rs/zerolog/log"
+
+	coursesense "github.com/jacobmichels/Course-Sense-Go"
+	"github.com/jacobmichels/Course-Sense-Go/telegram"
+)
+
+var _ coursesense.Alerter = Telegram{}
+
+// Messages the Telegram chats watchers linked through the bot
+type Telegram struct {
+	client telegram.Client
+}
+
+func NewTelegram(client telegram.Client) Telegram {
+	return Telegram{client}
+}
+
+func (t Telegram) Name() string {
+	return "telegram"
+}
+
+func (t Telegram) Channel() coursesense.ChannelKind {
+	return coursesense.ChannelTelegram
+}
+
+// every chat gets a chance at the message. Chats that couldn't be reached are reported in a RecipientErrors
+func (t Telegram) Notify(ctx context.Context, notification coursesense.Notification, watchers ...coursesense.Watcher) error {
+	failures := RecipientErrors{}
+	for _, watcher := range watchers {
+		chat := watcher.Address(coursesense.ChannelTelegram)
+		if chat == "" {
+			continue
+		}
+
+		if err := t.send(ctx, chat, telegramText(notification, watcher)); err != nil {
+			log.Error().Msgf("failed to send telegram notification: %v", err)
+			failures[chat] = err
+			continue
+		}
+		log.Info().Msgf("Notification sent to telegram for %s", watcher)
+	}
+
+	if len(failures) > 0 {
+		return failures
+	}
+
+	return nil
+}
+
+func (t Telegram) Alert(ctx context.Context, alert coursesense.Alert, contact coursesense.Watcher) error {
+	chat := contact.Address(coursesense.ChannelTelegram)
+	if chat == "" {
+		return nil
+	}
+
+	if err := t.send(ctx, chat, fmt.Sprintf("%s\n\n%s", alert.Title(), alertText(alert))); err != nil {
+		return fmt.Errorf("failed to send telegram alert: %w", err)
+	}
+
+	return nil
+}
+
+// messages buzz the watcher's phone like texts, so they are allowed to fire during quiet hours
+func (t Telegram) Urgent() bool {
+	return true
+}
+
+func (t Telegram) send(ctx context.Context, chat, text string) error {
+	id, err := strconv.ParseInt(chat, 10, 64)
+	if err != nil {
+		return fmt.Errorf("bad telegram chat id %q: %w", chat, err)
+	}
+
+	return t.client.SendMessage(ctx, id, text)
+}
+
+// the text message in the watcher's locale, with a link to claim the seats
+func telegramText(notification coursesense.Notification, watcher coursesense.Watcher) string {
+	text := smsBody(notification, watcher.Locale)
+	if notification.Kind != coursesense.NotificationWatchExpired {
+		text += "\n\n" + notificationURL(notification)
+	}
+
+	return text
+}
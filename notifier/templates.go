@@ -0,0 +1,261 @@
+package notifier
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	coursesense "github.com/jacobmichels/Course-Sense-Go"
+	"github.com/jacobmichels/Course-Sense-Go/i18n"
+)
+
+//go:embed templates
+var defaultTemplates embed.FS
+
+const (
+	subjectTemplate   = "subject.txt.tmpl"
+	emailTextTemplate = "email.txt.tmpl"
+	emailHTMLTemplate = "email.html.tmpl"
+
+	verifySubjectTemplate = "verify_subject.txt.tmpl"
+	verifyTextTemplate    = "verify.txt.tmpl"
+	verifyHTMLTemplate    = "verify.html.tmpl"
+)
+
+// the templates of every supported locale, English always among them
+type emailTemplates map[string]localeTemplates
+
+type localeTemplates struct {
+	notification templateSet
+	verification templateSet
+}
+
+// the subject, plain text and html templates of one kind of email
+type templateSet struct {
+	subject *texttemplate.Template
+	text    *texttemplate.Template
+	html    *htmltemplate.Template
+}
+
+// loads the email templates of every locale. Files in dir override the embedded defaults one by one, dir may be empty.
+// Other locales live in a subdirectory named after the locale, e.g. fr/email.txt.tmpl, and fall back to the English file
+func loadEmailTemplates(dir string) (emailTemplates, error) {
+	templates := make(emailTemplates)
+	for _, locale := range i18n.Locales() {
+		notification, err := loadTemplateSet(dir, locale, subjectTemplate, emailTextTemplate, emailHTMLTemplate)
+		if err != nil {
+			return nil, err
+		}
+
+		verification, err := loadTemplateSet(dir, locale, verifySubjectTemplate, verifyTextTemplate, verifyHTMLTemplate)
+		if err != nil {
+			return nil, err
+		}
+
+		templates[locale] = localeTemplates{notification, verification}
+	}
+
+	return templates, nil
+}
+
+// returns the templates of the locale, or the English ones if it isn't supported
+func (t emailTemplates) locale(locale string) localeTemplates {
+	if templates, ok := t[locale]; ok {
+		return templates
+	}
+
+	return t[i18n.English]
+}
+
+func loadTemplateSet(dir, locale, subjectName, textName, htmlName string) (templateSet, error) {
+	subject, err := readLocaleTemplate(dir, locale, subjectName)
+	if err != nil {
+		return templateSet{}, err
+	}
+	text, err := readLocaleTemplate(dir, locale, textName)
+	if err != nil {
+		return templateSet{}, err
+	}
+	html, err := readLocaleTemplate(dir, locale, htmlName)
+	if err != nil {
+		return templateSet{}, err
+	}
+
+	var templates templateSet
+	if templates.subject, err = texttemplate.New(subjectName).Option("missingkey=error").Parse(subject); err != nil {
+		return templateSet{}, fmt.Errorf("failed to parse %s: %w", subjectName, err)
+	}
+	if templates.text, err = texttemplate.New(textName).Option("missingkey=error").Parse(text); err != nil {
+		return templateSet{}, fmt.Errorf("failed to parse %s: %w", textName, err)
+	}
+	if templates.html, err = htmltemplate.New(htmlName).Option("missingkey=error").Parse(html); err != nil {
+		return templateSet{}, fmt.Errorf("failed to parse %s: %w", htmlName, err)
+	}
+
+	return templates, nil
+}
+
+// reads the locale's own template, from dir before the embedded defaults, and falls back to the English one
+func readLocaleTemplate(dir, locale, name string) (string, error) {
+	if locale != i18n.English {
+		if dir != "" {
+			contents, err := os.ReadFile(filepath.Join(dir, locale, name))
+			if err == nil {
+				return string(contents), nil
+			}
+			if !os.IsNotExist(err) {
+				return "", fmt.Errorf("failed to read %s template %s: %w", locale, name, err)
+			}
+		}
+
+		contents, err := fs.ReadFile(defaultTemplates, "templates/"+locale+"/"+name)
+		if err == nil {
+			return string(contents), nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return "", fmt.Errorf("failed to read default %s template %s: %w", locale, name, err)
+		}
+	}
+
+	return readTemplate(dir, name)
+}
+
+func readTemplate(dir, name string) (string, error) {
+	if dir != "" {
+		contents, err := os.ReadFile(filepath.Join(dir, name))
+		if err == nil {
+			return string(contents), nil
+		}
+		if !os.IsNotExist(err) {
+			return "", fmt.Errorf("failed to read template %s: %w", name, err)
+		}
+	}
+
+	contents, err := fs.ReadFile(defaultTemplates, "templates/"+name)
+	if err != nil {
+		return "", fmt.Errorf("failed to read default template %s: %w", name, err)
+	}
+
+	return string(contents), nil
+}
+
+// the data available to email templates
+type emailData struct {
+	Expired bool
+	// set when every section of a course is watched
+	Course *coursesense.Course
+	Term   string
+	// short description of what was watched, e.g. "CIS 2750 F23" or "CIS 2750 0101 F23 and 2 more"
+	Target string
+	// "course section" or "course sections", in the watcher's locale
+	Noun     string
+	URL      string
+	Sections []emailSection
+	Watcher  coursesense.Watcher
+	// empty if unsubscribe links are disabled
+	UnsubscribeURL string
+}
+
+type emailSection struct {
+	ID         string
+	Department string
+	Code       int
+	Section    string
+	Term       string
+	// zero when unknown, e.g. in expiry notices
+	Seats        uint
+	ConflictFree bool
+}
+
+func newEmailData(notification coursesense.Notification, watcher coursesense.Watcher, unsubscribeURL string) emailData {
+	data := emailData{
+		Expired:        notification.Kind == coursesense.NotificationWatchExpired,
+		Course:         notification.Course,
+		Term:           notification.Term,
+		Noun:           i18n.T(watcher.Locale, i18n.CourseSection),
+		URL:            notificationURL(notification),
+		Sections:       []emailSection{},
+		Watcher:        watcher,
+		UnsubscribeURL: unsubscribeURL,
+	}
+
+	for _, section := range notification.Sections {
+		data.Sections = append(data.Sections, emailSection{
+			ID:           section.String(),
+			Department:   section.Course.Department,
+			Code:         section.Course.Code,
+			Section:      section.Code,
+			Term:         section.Term,
+			Seats:        notification.Seats[section],
+			ConflictFree: notification.ConflictFree(section),
+		})
+	}
+	if len(data.Sections) > 1 {
+		data.Noun = i18n.T(watcher.Locale, i18n.CourseSections)
+	}
+
+	switch {
+	case notification.Course != nil:
+		data.Target = fmt.Sprintf("%s %d %s", notification.Course.Department, notification.Course.Code, notification.Term)
+	case len(data.Sections) > 0:
+		first := data.Sections[0]
+		data.Target = fmt.Sprintf("%s %d %s %s", first.Department, first.Code, first.Section, first.Term)
+		if len(data.Sections) > 1 {
+			data.Target = i18n.T(watcher.Locale, i18n.AndMoreSections, data.Target, len(data.Sections)-1)
+		}
+	}
+
+	return data
+}
+
+type renderedEmail struct {
+	subject        string
+	text           string
+	html           string
+	unsubscribeURL string
+}
+
+func (t emailTemplates) render(notification coursesense.Notification, watcher coursesense.Watcher, unsubscribeURL string) (renderedEmail, error) {
+	content, err := t.locale(watcher.Locale).notification.execute(newEmailData(notification, watcher, unsubscribeURL))
+	if err != nil {
+		return renderedEmail{}, err
+	}
+	content.unsubscribeURL = unsubscribeURL
+
+	return content, nil
+}
+
+// the data available to verification email templates
+type verificationData struct {
+	// what is being watched, e.g. "CIS*2750*0101*F23"
+	Watch     string
+	URL       string
+	ExpiresAt time.Time
+}
+
+func (t emailTemplates) renderVerification(verification coursesense.Verification) (renderedEmail, error) {
+	return t.locale(verification.Locale).verification.execute(verificationData{verification.Watch, verification.URL, verification.ExpiresAt})
+}
+
+func (t templateSet) execute(data any) (renderedEmail, error) {
+	var subject, text, html strings.Builder
+	if err := t.subject.Execute(&subject, data); err != nil {
+		return renderedEmail{}, fmt.Errorf("failed to render subject: %w", err)
+	}
+	if err := t.text.Execute(&text, data); err != nil {
+		return renderedEmail{}, fmt.Errorf("failed to render text body: %w", err)
+	}
+	if err := t.html.Execute(&html, data); err != nil {
+		return renderedEmail{}, fmt.Errorf("failed to render html body: %w", err)
+	}
+
+	// the subject is a single header line, whatever the template produced
+	return renderedEmail{subject: strings.Join(strings.Fields(subject.String()), " "), text: text.String(), html: html.String()}, nil
+}
@@ -0,0 +1,108 @@
+package notifier
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	coursesense "github.com/jacobmichels/Course-Sense-Go"
+	"github.com/jacobmichels/Course-Sense-Go/i18n"
+)
+
+func TestEmailTemplatesRender(t *testing.T) {
+	templates, err := loadEmailTemplates("")
+	if err != nil {
+		t.Fatalf("failed to load templates: %v", err)
+	}
+
+	wholeCourse := seatsNotification()
+	wholeCourse.Course = &course
+	wholeCourse.Term = "F23"
+
+	expired := coursesense.Notification{Kind: coursesense.NotificationWatchExpired, Sections: []coursesense.Section{section}}
+	expiredCourse := coursesense.Notification{Kind: coursesense.NotificationWatchExpired, Course: &course, Term: "F23"}
+
+	tests := []struct {
+		name         string
+		notification coursesense.Notification
+		// in the subject, and in the text of whole course notifications
+		wantTarget string
+		// listed in both bodies
+		wantSections []string
+		// openings link to WebAdvisor, expiries don't
+		wantURL bool
+	}{
+		{"seats in sections", seatsNotification(), "CIS 2750 0101 F23", []string{"CIS 2750 0101", "CIS 2750 0102"}, true},
+		{"seats in a whole course", wholeCourse, "CIS 2750 F23", []string{"CIS 2750 0101", "CIS 2750 0102"}, true},
+		{"expired sections", expired, "CIS 2750 0101 F23", []string{"CIS 2750 0101"}, false},
+		{"expired whole course", expiredCourse, "CIS 2750 F23", nil, false},
+	}
+
+	const unsubscribe = "https://example.com/unsubscribe?token=a&b"
+	for _, locale := range i18n.Locales() {
+		for _, test := range tests {
+			t.Run(locale+" "+test.name, func(t *testing.T) {
+				watcher := contactWatcher("a@example.com", "")
+				watcher.Locale = locale
+
+				content, err := templates.render(test.notification, watcher, unsubscribe)
+				if err != nil {
+					t.Fatalf("failed to render: %v", err)
+				}
+
+				if !strings.Contains(content.subject, test.wantTarget) || strings.Contains(content.subject, "\n") {
+					t.Fatalf("got subject %q, want one line naming %s", content.subject, test.wantTarget)
+				}
+
+				for _, body := range []string{content.text, content.html} {
+					for _, want := range test.wantSections {
+						if !strings.Contains(body, want) {
+							t.Fatalf("got body %q, want it to list %s", body, want)
+						}
+					}
+					if strings.Contains(body, webAdvisorURL) != test.wantURL {
+						t.Fatalf("got body %q, want a WebAdvisor link: %v", body, test.wantURL)
+					}
+				}
+				if test.notification.Course != nil && !strings.Contains(content.text, test.wantTarget) {
+					t.Fatalf("got text %q, want it to name %s", content.text, test.wantTarget)
+				}
+
+				if !strings.Contains(content.text, unsubscribe) || !strings.Contains(content.html, `href="https://example.com/unsubscribe?token=a&amp;b"`) {
+					t.Fatalf("got text %q and html %q, want the unsubscribe link in both", content.text, content.html)
+				}
+			})
+		}
+	}
+}
+
+func TestVerificationTemplatesRender(t *testing.T) {
+	templates, err := loadEmailTemplates("")
+	if err != nil {
+		t.Fatalf("failed to load templates: %v", err)
+	}
+
+	for _, locale := range i18n.Locales() {
+		t.Run(locale, func(t *testing.T) {
+			verification := coursesense.Verification{
+				Email:     "a@example.com",
+				Watch:     "CIS*2750*0101*F23",
+				URL:       "https://example.com/verify?token=abc",
+				ExpiresAt: time.Date(2023, time.September, 1, 12, 0, 0, 0, time.UTC),
+				Locale:    locale,
+			}
+
+			content, err := templates.renderVerification(verification)
+			if err != nil {
+				t.Fatalf("failed to render: %v", err)
+			}
+
+			if !strings.Contains(content.subject, verification.Watch) {
+				t.Fatalf("got subject %q, want it to name the watch", content.subject)
+			}
+			if !strings.Contains(content.text, verification.URL) || !strings.Contains(content.html, verification.URL) {
+				t.Fatalf("got text %q and html %q, want the link in both", content.text, content.html)
+			}
+		})
+	}
+}
@@ -0,0 +1,14 @@
+package notifier
+
+import (
+	coursesense "github.com/jacobmichels/Course-Sense-Go"
+)
+
+// returns the watcher's unsubscribe link for the notification, or an empty string if links are disabled
+func unsubscribeURL(unsubscribe coursesense.UnsubscribeService, notification coursesense.Notification, watcher coursesense.Watcher) string {
+	if unsubscribe == nil {
+		return ""
+	}
+
+	return unsubscribe.UnsubscribeURL(notification, watcher)
+}
@@ -0,0 +1,236 @@
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	coursesense "github.com/jacobmichels/Course-Sense-Go"
+)
+
+var _ coursesense.Notifier = Webhook{}
+
+// the version of the payload sent to webhooks. Bump it on breaking changes to WebhookPayload
+const webhookPayloadVersion = 1
+
+const (
+	// unix timestamp the payload was signed at. Receivers should reject old timestamps to prevent replays
+	webhookTimestampHeader = "X-CourseSense-Timestamp"
+	// hex encoded HMAC-SHA256 of "<timestamp>.<body>", keyed with the endpoint's secret
+	webhookSignatureHeader = "X-CourseSense-Signature"
+)
+
+type WebhookEndpoint struct {
+	URL    string
+	Secret string
+	// Timeout of a single delivery attempt
+	Timeout time.Duration
+	// Attempts made before giving up on a notification, backing off exponentially between them
+	MaxAttempts int
+}
+
+// Posts signed notification events to HTTP endpoints
+type Webhook struct {
+	http      *http.Client
+	endpoints []WebhookEndpoint
+	// delay before the first retry, doubled after every failed attempt
+	backoff time.Duration
+}
+
+func NewWebhook(endpoints ...WebhookEndpoint) Webhook {
+	for i := range endpoints {
+		if endpoints[i].Timeout <= 0 {
+			endpoints[i].Timeout = 10 * time.Second
+		}
+		if endpoints[i].MaxAttempts <= 0 {
+			endpoints[i].MaxAttempts = 3
+		}
+	}
+
+	return Webhook{&http.Client{}, endpoints, time.Second}
+}
+
+type WebhookPayload struct {
+	Version  int                 `json:"version"`
+	EventID  string              `json:"event_id"`
+	Kind     string              `json:"kind"`
+	Sections []WebhookSection    `json:"sections"`
+	Watchers []WebhookWatcher    `json:"watchers"`
+	Course   *coursesense.Course `json:"course,omitempty"`
+	Term     string              `json:"term,omitempty"`
+	SentAt   time.Time           `json:"sent_at"`
+}
+
+type WebhookSection struct {
+	Section      coursesense.Section `json:"section"`
+	ID           string              `json:"id"`
+	Seats        uint                `json:"seats"`
+	ConflictFree bool                `json:"conflict_free"`
+}
+
+type WebhookWatcher struct {
+	Email string `json:"email,omitempty"`
+	Phone string `json:"phone,omitempty"`
+}
+
+func (wh Webhook) Name() string {
+	return "webhook"
+}
+
+// endpoints are the operator's own integrations, so they hear about every watcher
+func (wh Webhook) Channel() coursesense.ChannelKind {
+	return ""
+}
+
+func (wh Webhook) Notify(ctx context.Context, notification coursesense.Notification, watchers ...coursesense.Watcher) error {
+	payload, err := newWebhookPayload(notification, watchers)
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode webhook payload: %w", err)
+	}
+
+	// every endpoint gets a chance at the event, even if an earlier one failed
+	var failures []error
+	for _, endpoint := range wh.endpoints {
+		if err := wh.deliver(ctx, endpoint, body); err != nil {
+			log.Error().Str("event_id", payload.EventID).Msgf("failed to deliver webhook to %s: %v", endpoint.URL, err)
+			failures = append(failures, err)
+			continue
+		}
+		log.Info().Str("event_id", payload.EventID).Msgf("Notification webhook delivered to %s", endpoint.URL)
+	}
+
+	if len(failures) > 0 {
+		return fmt.Errorf("failed to deliver event %s to %d of %d webhooks: %w", payload.EventID, len(failures), len(wh.endpoints), failures[0])
+	}
+
+	return nil
+}
+
+// webhooks feed other systems rather than people, so they aren't held during quiet hours
+func (wh Webhook) Urgent() bool {
+	return true
+}
+
+func newWebhookPayload(notification coursesense.Notification, watchers []coursesense.Watcher) (WebhookPayload, error) {
+	eventID, err := newEventID()
+	if err != nil {
+		return WebhookPayload{}, err
+	}
+
+	payload := WebhookPayload{
+		Version:  webhookPayloadVersion,
+		EventID:  eventID,
+		Kind:     string(notification.Kind),
+		Sections: []WebhookSection{},
+		Watchers: []WebhookWatcher{},
+		Course:   notification.Course,
+		Term:     notification.Term,
+		SentAt:   time.Now().UTC(),
+	}
+
+	for _, section := range notification.Sections {
+		payload.Sections = append(payload.Sections, WebhookSection{
+			Section:      section,
+			ID:           section.String(),
+			Seats:        notification.Seats[section],
+			ConflictFree: notification.ConflictFree(section),
+		})
+	}
+
+	for _, watcher := range watchers {
+		payload.Watchers = append(payload.Watchers, WebhookWatcher{Email: watcher.Address(coursesense.ChannelEmail), Phone: watcher.Address(coursesense.ChannelSMS)})
+	}
+
+	return payload, nil
+}
+
+// posts the body to an endpoint, retrying with exponential backoff on network errors, 429s and 5xxs
+func (wh Webhook) deliver(ctx context.Context, endpoint WebhookEndpoint, body []byte) error {
+	backoff := wh.backoff
+
+	var err error
+	for attempt := 1; attempt <= endpoint.MaxAttempts; attempt++ {
+		var retry bool
+		retry, err = wh.post(ctx, endpoint, body)
+		if err == nil || !retry || attempt == endpoint.MaxAttempts {
+			break
+		}
+
+		log.Debug().Msgf("webhook attempt %d to %s failed, retrying in %s: %v", attempt, endpoint.URL, backoff, err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+
+	return err
+}
+
+// makes a single signed delivery attempt, reporting whether a failure is worth retrying
+func (wh Webhook) post(ctx context.Context, endpoint WebhookEndpoint, body []byte) (bool, error) {
+	attemptCtx, cancel := context.WithTimeout(ctx, endpoint.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(attemptCtx, "POST", endpoint.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	// the timestamp is signed along with the body so a captured request can't be replayed later
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(webhookTimestampHeader, timestamp)
+	req.Header.Set(webhookSignatureHeader, "sha256="+SignWebhook(endpoint.Secret, timestamp, body))
+
+	res, err := wh.http.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 200 && res.StatusCode <= 299 {
+		return false, nil
+	}
+
+	responseBody, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+	retry := res.StatusCode == http.StatusTooManyRequests || res.StatusCode >= 500
+	return retry, fmt.Errorf("unexpected status %s: %s", res.Status, responseBody)
+}
+
+// SignWebhook returns the hex encoded signature of a webhook body, as sent in the signature header
+// Receivers compute the same value to verify a request came from Course Sense
+func SignWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func newEventID() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", fmt.Errorf("failed to generate event id: %w", err)
+	}
+
+	return hex.EncodeToString(id), nil
+}
@@ -0,0 +1,175 @@
+package notifier
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	coursesense "github.com/jacobmichels/Course-Sense-Go"
+)
+
+var (
+	course  = coursesense.Course{Department: "CIS", Code: 2750}
+	section = coursesense.Section{Course: course, Code: "0101", Term: "F23"}
+	other   = coursesense.Section{Course: course, Code: "0102", Term: "F23"}
+)
+
+func seatsNotification() coursesense.Notification {
+	return coursesense.Notification{
+		Kind:      coursesense.NotificationSeatsAvailable,
+		Sections:  []coursesense.Section{section, other},
+		Seats:     map[coursesense.Section]uint{section: 3, other: 1},
+		Conflicts: []coursesense.Section{other},
+	}
+}
+
+func contactWatcher(email, phone string) coursesense.Watcher {
+	var watcher coursesense.Watcher
+	if email != "" {
+		watcher.Channels = append(watcher.Channels, coursesense.Channel{Kind: coursesense.ChannelEmail, Address: email})
+	}
+	if phone != "" {
+		watcher.Channels = append(watcher.Channels, coursesense.Channel{Kind: coursesense.ChannelSMS, Address: phone})
+	}
+
+	return watcher
+}
+
+// a webhook that retries without waiting
+func testWebhook(endpoints ...WebhookEndpoint) Webhook {
+	wh := NewWebhook(endpoints...)
+	wh.backoff = time.Millisecond
+	return wh
+}
+
+func TestWebhookSignsPayload(t *testing.T) {
+	var req *http.Request
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req = r
+		body, _ = io.ReadAll(r.Body)
+	}))
+	defer server.Close()
+
+	wh := testWebhook(WebhookEndpoint{URL: server.URL, Secret: "secret"})
+	before := time.Now().Unix()
+	if err := wh.Notify(context.Background(), seatsNotification(), contactWatcher("a@example.com", "+15195551234")); err != nil {
+		t.Fatalf("failed to notify: %v", err)
+	}
+
+	if req.Method != "POST" || req.Header.Get("Content-Type") != "application/json" {
+		t.Fatalf("got %s with content type %q, want a JSON POST", req.Method, req.Header.Get("Content-Type"))
+	}
+
+	timestamp := req.Header.Get(webhookTimestampHeader)
+	signed, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || signed < before || signed > time.Now().Unix() {
+		t.Fatalf("got timestamp %q, want the unix time of the delivery", timestamp)
+	}
+
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	if want := "sha256=" + hex.EncodeToString(mac.Sum(nil)); req.Header.Get(webhookSignatureHeader) != want {
+		t.Fatalf("got signature %q, want %q", req.Header.Get(webhookSignatureHeader), want)
+	}
+
+	var payload WebhookPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		t.Fatalf("failed to decode payload: %v", err)
+	}
+
+	if payload.Version != webhookPayloadVersion || payload.Kind != string(coursesense.NotificationSeatsAvailable) || len(payload.EventID) != 32 {
+		t.Fatalf("got version %d, kind %q and event id %q", payload.Version, payload.Kind, payload.EventID)
+	}
+
+	want := []WebhookSection{
+		{Section: section, ID: section.String(), Seats: 3, ConflictFree: true},
+		{Section: other, ID: other.String(), Seats: 1, ConflictFree: false},
+	}
+	if len(payload.Sections) != len(want) || payload.Sections[0] != want[0] || payload.Sections[1] != want[1] {
+		t.Fatalf("got sections %+v, want %+v", payload.Sections, want)
+	}
+
+	if len(payload.Watchers) != 1 || payload.Watchers[0] != (WebhookWatcher{Email: "a@example.com", Phone: "+15195551234"}) {
+		t.Fatalf("got watchers %+v, want the watcher's email and phone", payload.Watchers)
+	}
+}
+
+func TestWebhookRetries(t *testing.T) {
+	tests := []struct {
+		name string
+		// statuses answered in turn, the last repeating
+		statuses     []int
+		wantAttempts int
+		wantErr      bool
+	}{
+		{"delivered", []int{http.StatusNoContent}, 1, false},
+		{"server error then delivered", []int{http.StatusBadGateway, http.StatusOK}, 2, false},
+		{"rate limited then delivered", []int{http.StatusTooManyRequests, http.StatusOK}, 2, false},
+		{"server errors until out of attempts", []int{http.StatusServiceUnavailable}, 3, true},
+		{"bad request", []int{http.StatusBadRequest}, 1, true},
+		{"unauthorized", []int{http.StatusUnauthorized, http.StatusOK}, 1, true},
+		{"not found", []int{http.StatusNotFound}, 1, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var mu sync.Mutex
+			attempts := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				defer mu.Unlock()
+
+				status := test.statuses[len(test.statuses)-1]
+				if attempts < len(test.statuses) {
+					status = test.statuses[attempts]
+				}
+				attempts++
+				w.WriteHeader(status)
+			}))
+			defer server.Close()
+
+			wh := testWebhook(WebhookEndpoint{URL: server.URL, Secret: "secret", MaxAttempts: 3})
+			err := wh.Notify(context.Background(), seatsNotification(), contactWatcher("a@example.com", ""))
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got error %v, want error %v", err, test.wantErr)
+			}
+
+			if attempts != test.wantAttempts {
+				t.Fatalf("got %d attempts, want %d", attempts, test.wantAttempts)
+			}
+		})
+	}
+}
+
+func TestWebhookDeliversToEveryEndpoint(t *testing.T) {
+	delivered := 0
+	ok := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		delivered++
+	}))
+	defer ok.Close()
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer failing.Close()
+
+	wh := testWebhook(WebhookEndpoint{URL: failing.URL, Secret: "a"}, WebhookEndpoint{URL: ok.URL, Secret: "b"})
+	if err := wh.Notify(context.Background(), seatsNotification()); err == nil {
+		t.Fatal("got no error when an endpoint failed")
+	}
+
+	if delivered != 1 {
+		t.Fatalf("got %d deliveries to the working endpoint after the other failed, want 1", delivered)
+	}
+}
@@ -0,0 +1,223 @@
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	coursesense "github.com/jacobmichels/Course-Sense-Go"
+	"github.com/jacobmichels/Course-Sense-Go/config"
+	"github.com/jacobmichels/Course-Sense-Go/notifier"
+)
+
+// Worker implements OutboxService
+var _ coursesense.OutboxService = Worker{}
+
+// Delivers the notification jobs queued by the trigger, retrying failures with exponential backoff
+type Worker struct {
+	outbox    coursesense.Outbox
+	cfg       config.Outbox
+	notifiers map[string]coursesense.Notifier
+	// nil if operator alerts are disabled
+	monitor coursesense.HealthMonitor
+}
+
+func NewWorker(o coursesense.Outbox, cfg config.Outbox, m coursesense.HealthMonitor, n ...coursesense.Notifier) Worker {
+	notifiers := make(map[string]coursesense.Notifier, len(n))
+	for _, notifier := range n {
+		notifiers[notifier.Name()] = notifier
+	}
+
+	return Worker{o, cfg, notifiers, m}
+}
+
+// Run delivers due jobs until the context is cancelled
+func (w Worker) Run(ctx context.Context) {
+	log.Info().Msgf("starting outbox worker: polling every %d seconds", w.cfg.PollIntervalSecs)
+	ticker := time.NewTicker(time.Second * time.Duration(w.cfg.PollIntervalSecs))
+	defer ticker.Stop()
+
+	for {
+		if err := w.Process(ctx); err != nil {
+			log.Error().Msgf("failure occured while processing the outbox: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Process makes one delivery attempt on every due job
+func (w Worker) Process(ctx context.Context) error {
+	for {
+		jobs, err := w.outbox.ClaimJobs(ctx, time.Now(), w.cfg.BatchSize, w.lease())
+		if err != nil {
+			return fmt.Errorf("failed to claim jobs: %w", err)
+		}
+
+		for _, job := range jobs {
+			if err := w.deliver(ctx, job); err != nil {
+				return err
+			}
+		}
+
+		if len(jobs) < w.cfg.BatchSize {
+			return nil
+		}
+	}
+}
+
+// claimed jobs aren't claimed again until an attempt would have timed out
+func (w Worker) lease() time.Duration {
+	return time.Duration(w.cfg.AttemptTimeoutSecs)*time.Second + 30*time.Second
+}
+
+// attempts a job, completing it on success and scheduling a retry or dead-lettering it on failure
+// only errors saving the job's new state are returned
+func (w Worker) deliver(ctx context.Context, job coursesense.Job) error {
+	remaining, err := w.notify(ctx, job)
+	if err == nil {
+		if err := w.outbox.CompleteJob(ctx, job.ID); err != nil {
+			return fmt.Errorf("failed to complete job %s: %w", job.ID, err)
+		}
+		log.Debug().Str("job", job.ID).Msgf("delivered %s job", job.Notifier)
+		return nil
+	}
+
+	// retries only go to the recipients that weren't reached
+	job = remaining
+	job.Attempts++
+	job.LastError = err.Error()
+	if job.Attempts >= w.cfg.MaxAttempts {
+		job.Status = coursesense.JobDead
+		log.Error().Str("job", job.ID).Msgf("giving up on %s job after %d attempts: %v", job.Notifier, job.Attempts, err)
+	} else {
+		job.NextAttemptAt = time.Now().Add(w.backoff(job.Attempts))
+		log.Warn().Str("job", job.ID).Msgf("%s job failed, retrying at %s: %v", job.Notifier, job.NextAttemptAt.Format(time.RFC3339), err)
+	}
+
+	if err := w.outbox.UpdateJob(ctx, job); err != nil {
+		return fmt.Errorf("failed to update job %s: %w", job.ID, err)
+	}
+
+	return nil
+}
+
+// attempts a job, returning it narrowed to what a retry still has to deliver if the attempt fails
+func (w Worker) notify(ctx context.Context, job coursesense.Job) (coursesense.Job, error) {
+	n, ok := w.notifiers[job.Notifier]
+	if !ok {
+		// the notifier may have been disabled since the job was queued, it can be replayed once it's back
+		return job, fmt.Errorf("unknown notifier %q", job.Notifier)
+	}
+
+	attemptCtx, cancel := context.WithTimeout(ctx, time.Duration(w.cfg.AttemptTimeoutSecs)*time.Second)
+	defer cancel()
+
+	multi, ok := n.(notifier.Multi)
+	if !ok {
+		err := n.Notify(attemptCtx, job.Notification, job.Watchers...)
+		w.observe(job.Notifier, err)
+		job.Watchers = notifier.Unreached(n, err, job.Watchers)
+		return job, err
+	}
+
+	// only the parts that failed are retried, each for the watchers it missed
+	results, remaining, err := multi.Deliver(attemptCtx, job.Notification, job.Parts, job.Watchers...)
+	for _, result := range results {
+		switch {
+		case result.Skipped():
+			log.Debug().Str("job", job.ID).Msgf("%s skipped %s", job.Notifier, result.Notifier)
+		case result.Err != nil:
+			log.Warn().Str("job", job.ID).Str("policy", string(result.Policy)).Dur("elapsed", result.Elapsed).Msgf("%s failed through %s: %v", job.Notifier, result.Notifier, result.Err)
+		default:
+			log.Debug().Str("job", job.ID).Dur("elapsed", result.Elapsed).Msgf("%s delivered through %s to %d watchers", job.Notifier, result.Notifier, result.Watchers)
+		}
+
+		if !result.Skipped() {
+			w.observe(result.Notifier, result.Err)
+		}
+	}
+
+	if err != nil {
+		job.Parts = remaining
+		job.Watchers = partWatchers(job.Watchers, remaining)
+	}
+
+	return job, err
+}
+
+// returns the watchers at least one of the parts still has to reach
+func partWatchers(watchers []coursesense.Watcher, parts map[string][]string) []coursesense.Watcher {
+	keys := make(map[string]bool)
+	for _, part := range parts {
+		for _, key := range part {
+			keys[key] = true
+		}
+	}
+
+	var remaining []coursesense.Watcher
+	for _, watcher := range watchers {
+		if keys[watcher.ContactKey()] {
+			remaining = append(remaining, watcher)
+		}
+	}
+
+	return remaining
+}
+
+func (w Worker) observe(notifier string, err error) {
+	if w.monitor != nil {
+		w.monitor.ObserveDelivery(notifier, err)
+	}
+}
+
+// returns the delay before the retry following the given number of failed attempts
+func (w Worker) backoff(attempts int) time.Duration {
+	backoff := time.Duration(w.cfg.BaseBackoffSecs) * time.Second
+	max := time.Duration(w.cfg.MaxBackoffSecs) * time.Second
+	for i := 1; i < attempts && backoff < max; i++ {
+		backoff *= 2
+	}
+
+	if backoff > max {
+		return max
+	}
+
+	return backoff
+}
+
+func (w Worker) FailedJobs(ctx context.Context) ([]coursesense.Job, error) {
+	jobs, err := w.outbox.GetJobs(ctx, coursesense.JobDead)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get dead jobs: %w", err)
+	}
+
+	return jobs, nil
+}
+
+func (w Worker) Replay(ctx context.Context, id string) error {
+	job, err := w.outbox.GetJob(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if job.Status != coursesense.JobDead {
+		return fmt.Errorf("job %s is %s, only dead jobs can be replayed", id, job.Status)
+	}
+
+	job.Status = coursesense.JobPending
+	job.Attempts = 0
+	job.NextAttemptAt = time.Now()
+	if err := w.outbox.UpdateJob(ctx, job); err != nil {
+		return fmt.Errorf("failed to requeue job %s: %w", id, err)
+	}
+
+	log.Info().Str("job", id).Msgf("replaying %s job", job.Notifier)
+	return nil
+}
@@ -0,0 +1,244 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	coursesense "github.com/jacobmichels/Course-Sense-Go"
+	"github.com/jacobmichels/Course-Sense-Go/config"
+	"github.com/jacobmichels/Course-Sense-Go/notifier"
+	"github.com/jacobmichels/Course-Sense-Go/repository"
+)
+
+var section = coursesense.Section{Course: coursesense.Course{Department: "CIS", Code: 2750}, Code: "0101", Term: "F23"}
+
+var cfg = config.Outbox{BatchSize: 10, MaxAttempts: 5, AttemptTimeoutSecs: 5}
+
+// counts the requests made to it, failing the ones that mention the failing recipient
+type stubServer struct {
+	failing string
+
+	mu       sync.Mutex
+	requests []string
+}
+
+func (s *stubServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	request := r.URL.Path + " " + string(body)
+
+	s.mu.Lock()
+	s.requests = append(s.requests, request)
+	s.mu.Unlock()
+
+	if strings.Contains(request, s.failing) {
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+func (s *stubServer) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.requests)
+}
+
+// queues the job along with a watch, as the trigger does
+func enqueue(t *testing.T, repo coursesense.Repository, job coursesense.Job) {
+	t.Helper()
+	ctx := context.Background()
+
+	if _, err := repo.AddWatcher(ctx, section, job.Watchers[0]); err != nil {
+		t.Fatalf("failed to add watcher: %v", err)
+	}
+	if err := repo.SettleSection(ctx, coursesense.SectionUpdate{Section: section, Remove: job.Watchers[:1]}, job); err != nil {
+		t.Fatalf("failed to queue job: %v", err)
+	}
+}
+
+func TestRetriesOnlyReachFailedRecipients(t *testing.T) {
+	tests := []struct {
+		name     string
+		notifier func(url string) coursesense.Notifier
+		kind     coursesense.ChannelKind
+		// addresses of the watchers, relative to the stub server for webhooks
+		addresses []string
+		failing   string
+	}{
+		{
+			name:      "sms",
+			notifier:  func(url string) coursesense.Notifier { return notifier.NewSMS(url, "AC123", "token", "+15195550000") },
+			kind:      coursesense.ChannelSMS,
+			addresses: []string{"+15195550001", "+15195550002", "+15195550003"},
+			failing:   "5195550002",
+		},
+		{
+			name:      "ntfy",
+			notifier:  func(url string) coursesense.Notifier { return notifier.NewNtfy(url, "", 3, nil) },
+			kind:      coursesense.ChannelPush,
+			addresses: []string{"first-topic", "failing-topic", "third-topic"},
+			failing:   "failing-topic",
+		},
+		{
+			name:      "discord",
+			notifier:  func(url string) coursesense.Notifier { return notifier.NewDiscord() },
+			kind:      coursesense.ChannelDiscord,
+			addresses: []string{"/first", "/failing", "/third"},
+			failing:   "/failing",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			server := &stubServer{failing: test.failing}
+			srv := httptest.NewServer(server)
+			defer srv.Close()
+
+			n := test.notifier(srv.URL)
+			var watchers []coursesense.Watcher
+			for _, address := range test.addresses {
+				if strings.HasPrefix(address, "/") {
+					address = srv.URL + address
+				}
+				watchers = append(watchers, coursesense.Watcher{Channels: []coursesense.Channel{{Kind: test.kind, Address: address}}})
+			}
+
+			repo, err := repository.New(ctx, config.Database{Type: "memory"})
+			if err != nil {
+				t.Fatalf("failed to create repository: %v", err)
+			}
+			notification := coursesense.Notification{Kind: coursesense.NotificationSeatsAvailable, Sections: []coursesense.Section{section}, Seats: map[coursesense.Section]uint{section: 3}}
+			enqueue(t, repo, coursesense.Job{Notifier: n.Name(), Notification: notification, Watchers: watchers})
+
+			worker := NewWorker(repo, cfg, nil, n)
+			if err := worker.Process(ctx); err != nil {
+				t.Fatalf("failed to process outbox: %v", err)
+			}
+
+			if got := server.count(); got != len(watchers) {
+				t.Fatalf("got %d requests on the first attempt, want one per watcher", got)
+			}
+
+			jobs, err := repo.GetJobs(ctx, coursesense.JobPending)
+			if err != nil {
+				t.Fatalf("failed to get jobs: %v", err)
+			}
+			if len(jobs) != 1 || len(jobs[0].Watchers) != 1 || jobs[0].Watchers[0].Address(test.kind) != watchers[1].Address(test.kind) {
+				t.Fatalf("got pending jobs %v, want one for the failed watcher", jobs)
+			}
+
+			// the retry is due right away, as there is no backoff
+			if err := worker.Process(ctx); err != nil {
+				t.Fatalf("failed to process outbox: %v", err)
+			}
+			if got := server.count(); got != len(watchers)+1 {
+				t.Fatalf("got %d requests after the retry, want only the failed watcher retried", got)
+			}
+		})
+	}
+}
+
+// records the watchers it is given, failing the ones at the failing address
+type stubNotifier struct {
+	name    string
+	channel coursesense.ChannelKind
+	failing string
+
+	mu   *sync.Mutex
+	sent *[]string
+}
+
+func (n stubNotifier) Name() string                     { return n.name }
+func (n stubNotifier) Channel() coursesense.ChannelKind { return n.channel }
+func (n stubNotifier) Urgent() bool                     { return false }
+
+func (n stubNotifier) Notify(ctx context.Context, notification coursesense.Notification, watchers ...coursesense.Watcher) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	failures := notifier.RecipientErrors{}
+	for _, watcher := range watchers {
+		address := watcher.Address(n.channel)
+		*n.sent = append(*n.sent, n.name+" "+address)
+		if address == n.failing {
+			failures[address] = errors.New("rejected")
+		}
+	}
+
+	if len(failures) > 0 {
+		return failures
+	}
+
+	return nil
+}
+
+func TestRetriesOnlyReachFailedParts(t *testing.T) {
+	var mu sync.Mutex
+	var sent []string
+	email := stubNotifier{name: "email", channel: coursesense.ChannelEmail, failing: "b@example.com", mu: &mu, sent: &sent}
+	push := stubNotifier{name: "push", channel: coursesense.ChannelPush, failing: "b-topic", mu: &mu, sent: &sent}
+	sms := stubNotifier{name: "sms", channel: coursesense.ChannelSMS, mu: &mu, sent: &sent}
+
+	multi, err := notifier.NewMulti("multi",
+		notifier.Child{Notifier: email, Policy: notifier.PolicyRequired},
+		notifier.Child{Notifier: push, Policy: notifier.PolicyBestEffort},
+		notifier.Child{Notifier: sms, Policy: notifier.PolicyRequired},
+	)
+	if err != nil {
+		t.Fatalf("failed to create multi notifier: %v", err)
+	}
+
+	watcher := func(name string) coursesense.Watcher {
+		return coursesense.Watcher{Channels: []coursesense.Channel{
+			{Kind: coursesense.ChannelEmail, Address: name + "@example.com"},
+			{Kind: coursesense.ChannelPush, Address: name + "-topic"},
+			{Kind: coursesense.ChannelSMS, Address: "+1519555000" + name},
+		}}
+	}
+	a, b, c := watcher("a"), watcher("b"), watcher("c")
+
+	ctx := context.Background()
+	repo, err := repository.New(ctx, config.Database{Type: "memory"})
+	if err != nil {
+		t.Fatalf("failed to create repository: %v", err)
+	}
+	notification := coursesense.Notification{Kind: coursesense.NotificationSeatsAvailable, Sections: []coursesense.Section{section}, Seats: map[coursesense.Section]uint{section: 3}}
+	// c is in quiet hours, so only the urgent sms part reaches them
+	parts := map[string][]string{
+		"email": {a.ContactKey(), b.ContactKey()},
+		"push":  {a.ContactKey(), b.ContactKey()},
+		"sms":   {a.ContactKey(), b.ContactKey(), c.ContactKey()},
+	}
+	enqueue(t, repo, coursesense.Job{Notifier: multi.Name(), Notification: notification, Watchers: []coursesense.Watcher{a, b, c}, Parts: parts})
+
+	worker := NewWorker(repo, cfg, nil, multi)
+	if err := worker.Process(ctx); err != nil {
+		t.Fatalf("failed to process outbox: %v", err)
+	}
+	if len(sent) != 7 {
+		t.Fatalf("got deliveries %v on the first attempt, want each part to reach its watchers", sent)
+	}
+
+	jobs, err := repo.GetJobs(ctx, coursesense.JobPending)
+	if err != nil {
+		t.Fatalf("failed to get jobs: %v", err)
+	}
+	if len(jobs) != 1 || len(jobs[0].Watchers) != 1 || len(jobs[0].Parts) != 1 || strings.Join(jobs[0].Parts["email"], ",") != b.ContactKey() {
+		t.Fatalf("got pending jobs %v, want one for the email part to b", jobs)
+	}
+
+	// the retry is due right away, as there is no backoff
+	sent = nil
+	if err := worker.Process(ctx); err != nil {
+		t.Fatalf("failed to process outbox: %v", err)
+	}
+	if strings.Join(sent, ",") != "email b@example.com" {
+		t.Fatalf("got deliveries %v on the retry, want only the failed email", sent)
+	}
+}
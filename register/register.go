@@ -3,8 +3,11 @@ package register
 import (
 	"context"
 	"fmt"
+	"strings"
+	"time"
 
 	coursesense "github.com/jacobmichels/Course-Sense-Go"
+	"github.com/jacobmichels/Course-Sense-Go/config"
 )
 
 // Register implements RegistrationService
@@ -13,16 +16,22 @@ var _ coursesense.RegistrationService = Register{}
 type Register struct {
 	sectionService coursesense.SectionService
 	repository     coursesense.Repository
+	terms          map[string]config.Term
+	// nil if watches are active without confirming the watcher's email
+	verificationService coursesense.VerificationService
 }
 
-func NewRegister(s coursesense.SectionService, r coursesense.Repository) Register {
-	return Register{s, r}
+func NewRegister(s coursesense.SectionService, r coursesense.Repository, terms map[string]config.Term, v coursesense.VerificationService) Register {
+	return Register{s, r, terms, v}
 }
 
 func (r Register) Register(ctx context.Context, section coursesense.Section, watcher coursesense.Watcher) error {
 	// Registration steps
 	// 1. Ensure the section exists
-	// 2. Use the watcher service to persist the watcher to the section
+	// 2. Normalize the watcher's contact details so duplicates are detected
+	// 3. Default the watch expiry to the term's last add date
+	// 4. Use the watcher service to persist the watcher to the section, pending if their email needs confirming
+	// 5. Send the link confirming a pending watch. Registering a watch that exists only resends the link if it is still pending
 
 	exists, err := r.sectionService.Exists(ctx, section)
 	if err != nil {
@@ -33,9 +42,191 @@ func (r Register) Register(ctx context.Context, section coursesense.Section, wat
 		return fmt.Errorf("section %s does not exist", section)
 	}
 
-	if err := r.repository.AddWatcher(ctx, section, watcher); err != nil {
+	watcher, err = normalizeWatcher(watcher)
+	if err != nil {
+		return err
+	}
+
+	if watcher.ExpiresAt.IsZero() {
+		expiry, err := r.termDeadline(section.Term)
+		if err != nil {
+			return err
+		}
+		watcher.ExpiresAt = expiry
+	}
+
+	if r.verificationService != nil {
+		watcher.VerifyBy = r.verificationService.Deadline(watcher)
+	}
+
+	added, err := r.repository.AddWatcher(ctx, section, watcher)
+	if err != nil {
 		return fmt.Errorf("failed to persist %s to %s: %w", watcher, section, err)
 	}
 
+	if !watcher.Pending() {
+		return nil
+	}
+
+	// the stored watch's deadline is the one its link has to match
+	if !added {
+		var ok bool
+		if watcher, ok, err = r.storedWatcher(ctx, section, watcher); err != nil || !ok || !watcher.Pending() {
+			return err
+		}
+	}
+
+	if err := r.verificationService.RequestSection(ctx, section, watcher); err != nil {
+		return fmt.Errorf("failed to request verification of %s: %w", watcher, err)
+	}
+
+	return nil
+}
+
+// returns the stored watch of the watcher on the section, reporting false if it is gone
+func (r Register) storedWatcher(ctx context.Context, section coursesense.Section, watcher coursesense.Watcher) (coursesense.Watcher, bool, error) {
+	watchers, err := r.repository.GetWatchers(ctx, section)
+	if err != nil {
+		return coursesense.Watcher{}, false, fmt.Errorf("failed to get watchers for %s: %w", section, err)
+	}
+
+	for _, stored := range watchers {
+		if stored.ContactKey() == watcher.ContactKey() {
+			return stored, true, nil
+		}
+	}
+
+	return coursesense.Watcher{}, false, nil
+}
+
+func (r Register) RegisterGroup(ctx context.Context, group coursesense.WatchGroup) error {
+	// Registration steps
+	// 1. Ensure every section in the group exists, or that the course is offered in the term for whole course watches
+	// 2. Normalize the watcher's contact details
+	// 3. Default the watch expiry to the term's last add date
+	// 4. Persist the group, pending if the watcher's email needs confirming
+	// 5. Send the link confirming a pending group. Registering a group that exists only resends the link if it is still pending
+
+	if group.WholeCourse() {
+		sections, err := r.sectionService.GetCourseSections(ctx, group.Course, group.Term)
+		if err != nil {
+			return fmt.Errorf("failed to get sections of %s: %w", group, err)
+		}
+
+		if len(sections) == 0 {
+			return fmt.Errorf("course %s has no sections", group)
+		}
+	}
+
+	for _, section := range group.Sections {
+		exists, err := r.sectionService.Exists(ctx, section)
+		if err != nil {
+			return fmt.Errorf("failed to check if section exists: %w", err)
+		}
+
+		if !exists {
+			return fmt.Errorf("section %s does not exist", section)
+		}
+	}
+
+	watcher, err := normalizeWatcher(group.Watcher)
+	if err != nil {
+		return err
+	}
+	group.Watcher = watcher
+
+	if group.Watcher.ExpiresAt.IsZero() {
+		expiry, err := r.termDeadline(group.Term)
+		if err != nil {
+			return err
+		}
+		group.Watcher.ExpiresAt = expiry
+	}
+
+	if r.verificationService != nil {
+		group.Watcher.VerifyBy = r.verificationService.Deadline(group.Watcher)
+	}
+
+	added, err := r.repository.AddWatchGroup(ctx, group)
+	if err != nil {
+		return fmt.Errorf("failed to persist %s to %s: %w", group.Watcher, group, err)
+	}
+
+	if !group.Watcher.Pending() {
+		return nil
+	}
+
+	// the stored group's deadline is the one its link has to match
+	if !added {
+		var ok bool
+		if group, ok, err = r.storedGroup(ctx, group); err != nil || !ok || !group.Watcher.Pending() {
+			return err
+		}
+	}
+
+	if err := r.verificationService.RequestGroup(ctx, group); err != nil {
+		return fmt.Errorf("failed to request verification of %s: %w", group.Watcher, err)
+	}
+
 	return nil
 }
+
+// returns the stored group watching the same sections as the given one, reporting false if it is gone
+func (r Register) storedGroup(ctx context.Context, group coursesense.WatchGroup) (coursesense.WatchGroup, bool, error) {
+	groups, err := r.repository.GetWatchGroups(ctx)
+	if err != nil {
+		return coursesense.WatchGroup{}, false, fmt.Errorf("failed to get watch groups: %w", err)
+	}
+
+	for _, stored := range groups {
+		if stored.SameWatch(group) {
+			return stored, true, nil
+		}
+	}
+
+	return coursesense.WatchGroup{}, false, nil
+}
+
+// puts the watcher's phone number in E.164 format and spells out default channel preferences
+func normalizeWatcher(watcher coursesense.Watcher) (coursesense.Watcher, error) {
+	// copied so the caller's channels aren't modified
+	channels := make([]coursesense.Channel, len(watcher.Channels))
+	for i, channel := range watcher.Channels {
+		if channel.Preference == "" {
+			channel.Preference = coursesense.PreferenceAll
+		}
+
+		if channel.Kind == coursesense.ChannelSMS {
+			phone, err := coursesense.NormalizePhone(channel.Address)
+			if err != nil {
+				return coursesense.Watcher{}, err
+			}
+			channel.Address = phone
+		}
+
+		channels[i] = channel
+	}
+	watcher.Channels = channels
+
+	return watcher, nil
+}
+
+// returns the configured last add date for the term, or a zero time if none is configured
+// returns an error if the deadline has already passed
+func (r Register) termDeadline(term string) (time.Time, error) {
+	t, ok := r.terms[strings.ToUpper(term)]
+	if !ok {
+		return time.Time{}, nil
+	}
+
+	deadline, err := t.Deadline()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to get deadline for term %s: %w", term, err)
+	}
+
+	if deadline.Before(time.Now()) {
+		return time.Time{}, fmt.Errorf("the last add date for term %s has passed", term)
+	}
+
+	return deadline, nil
+}
@@ -0,0 +1,242 @@
+package register
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	coursesense "github.com/jacobmichels/Course-Sense-Go"
+	"github.com/jacobmichels/Course-Sense-Go/config"
+	"github.com/jacobmichels/Course-Sense-Go/repository"
+	"github.com/jacobmichels/Course-Sense-Go/token"
+	"github.com/jacobmichels/Course-Sense-Go/verify"
+)
+
+var (
+	course   = coursesense.Course{Department: "CIS", Code: 2750}
+	sections = []coursesense.Section{
+		{Course: course, Code: "0101", Term: "F23"},
+		{Course: course, Code: "0102", Term: "F23"},
+		{Course: course, Code: "0103", Term: "F23"},
+	}
+)
+
+type stubSections struct{}
+
+func (stubSections) Exists(ctx context.Context, section coursesense.Section) (bool, error) {
+	return true, nil
+}
+
+func (stubSections) GetAvailableSeats(ctx context.Context, section coursesense.Section) (uint, error) {
+	return 0, nil
+}
+
+func (stubSections) GetCourseSections(ctx context.Context, course coursesense.Course, term string) (map[coursesense.Section]uint, error) {
+	return map[coursesense.Section]uint{sections[0]: 0}, nil
+}
+
+func (stubSections) GetMeetings(ctx context.Context, section coursesense.Section) ([]coursesense.Meeting, error) {
+	return nil, nil
+}
+
+// captures the verification emails instead of sending them
+type captureSender struct {
+	sent *[]coursesense.Verification
+}
+
+func (c captureSender) SendVerification(ctx context.Context, verification coursesense.Verification) error {
+	*c.sent = append(*c.sent, verification)
+	return nil
+}
+
+func emailWatcher(address string) coursesense.Watcher {
+	return coursesense.Watcher{Channels: []coursesense.Channel{{Kind: coursesense.ChannelEmail, Address: address}}}
+}
+
+func TestRegisterSendsVerification(t *testing.T) {
+	type registration struct {
+		section coursesense.Section
+		address string
+		// activates the watch through the last link sent before registering
+		verifyFirst bool
+		wantErr     error
+	}
+
+	tests := []struct {
+		name          string
+		cooldown      time.Duration
+		maxPerHour    int
+		registrations []registration
+		wantSent      int
+	}{
+		{
+			name:          "new watch",
+			cooldown:      time.Hour,
+			registrations: []registration{{section: sections[0], address: "a@example.com"}},
+			wantSent:      1,
+		},
+		{
+			name:     "repeated registrations within the cooldown",
+			cooldown: time.Hour,
+			registrations: []registration{
+				{section: sections[0], address: "a@example.com"},
+				{section: sections[0], address: "a@example.com"},
+				{section: sections[0], address: "A@example.com"},
+			},
+			wantSent: 1,
+		},
+		{
+			name: "repeated registrations without a cooldown",
+			registrations: []registration{
+				{section: sections[0], address: "a@example.com"},
+				{section: sections[0], address: "a@example.com"},
+			},
+			wantSent: 2,
+		},
+		{
+			name: "registering an active watch",
+			registrations: []registration{
+				{section: sections[0], address: "a@example.com"},
+				{section: sections[0], address: "a@example.com", verifyFirst: true},
+			},
+			wantSent: 1,
+		},
+		{
+			name:       "hourly cap on an address",
+			cooldown:   time.Hour,
+			maxPerHour: 2,
+			registrations: []registration{
+				{section: sections[0], address: "a@example.com"},
+				{section: sections[1], address: "a@example.com"},
+				{section: sections[2], address: "a@example.com", wantErr: coursesense.ErrTooManyVerifications},
+				{section: sections[2], address: "b@example.com"},
+			},
+			wantSent: 3,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			repo, err := repository.New(ctx, config.Database{Type: "memory"})
+			if err != nil {
+				t.Fatalf("failed to create repository: %v", err)
+			}
+
+			var sent []coursesense.Verification
+			verification := verify.NewService(repo, token.NewSigner("secret"), captureSender{&sent}, "https://example.com", time.Hour, test.cooldown, test.maxPerHour)
+			register := NewRegister(stubSections{}, repo, nil, verification)
+
+			for _, r := range test.registrations {
+				if r.verifyFirst {
+					link, err := url.Parse(sent[len(sent)-1].URL)
+					if err != nil {
+						t.Fatalf("bad verification link: %v", err)
+					}
+					if err := verification.Verify(ctx, link.Query().Get("token")); err != nil {
+						t.Fatalf("failed to verify: %v", err)
+					}
+				}
+
+				err := register.Register(ctx, r.section, emailWatcher(r.address))
+				if !errors.Is(err, r.wantErr) {
+					t.Fatalf("registering %s on %s: got error %v, want %v", r.address, r.section, err, r.wantErr)
+				}
+			}
+
+			if len(sent) != test.wantSent {
+				t.Fatalf("got %d verification emails, want %d", len(sent), test.wantSent)
+			}
+		})
+	}
+}
+
+func TestRegisterDedupesWatchers(t *testing.T) {
+	ctx := context.Background()
+	repo, err := repository.New(ctx, config.Database{Type: "memory"})
+	if err != nil {
+		t.Fatalf("failed to create repository: %v", err)
+	}
+	register := NewRegister(stubSections{}, repo, nil, nil)
+
+	for _, address := range []string{"a@example.com", "b@example.com", "a@example.com"} {
+		if err := register.Register(ctx, sections[0], emailWatcher(address)); err != nil {
+			t.Fatalf("failed to register %s: %v", address, err)
+		}
+	}
+
+	watchers, err := repo.GetWatchers(ctx, sections[0])
+	if err != nil {
+		t.Fatalf("failed to get watchers: %v", err)
+	}
+
+	var got []string
+	for _, watcher := range watchers {
+		got = append(got, watcher.Address(coursesense.ChannelEmail))
+	}
+	if strings.Join(got, ",") != "a@example.com,b@example.com" {
+		t.Fatalf("got watchers %v, want a and b once each in registration order", got)
+	}
+}
+
+func TestRegisterGroupSendsVerification(t *testing.T) {
+	tests := []struct {
+		name string
+		// activates the group through the last link sent before registering again
+		verifyFirst bool
+		wantSent    int
+	}{
+		{name: "registering a pending group", wantSent: 2},
+		{name: "registering an active group", verifyFirst: true, wantSent: 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			repo, err := repository.New(ctx, config.Database{Type: "memory"})
+			if err != nil {
+				t.Fatalf("failed to create repository: %v", err)
+			}
+
+			var sent []coursesense.Verification
+			verification := verify.NewService(repo, token.NewSigner("secret"), captureSender{&sent}, "https://example.com", time.Hour, 0, 0)
+			register := NewRegister(stubSections{}, repo, nil, verification)
+			group := coursesense.WatchGroup{Course: course, Term: "F23", Sections: sections[:2], Watcher: emailWatcher("a@example.com")}
+
+			if err := register.RegisterGroup(ctx, group); err != nil {
+				t.Fatalf("failed to register group: %v", err)
+			}
+
+			if test.verifyFirst {
+				link, err := url.Parse(sent[len(sent)-1].URL)
+				if err != nil {
+					t.Fatalf("bad verification link: %v", err)
+				}
+				if err := verification.Verify(ctx, link.Query().Get("token")); err != nil {
+					t.Fatalf("failed to verify: %v", err)
+				}
+			}
+
+			// the same sections in another order are the same group
+			group.Sections = []coursesense.Section{sections[1], sections[0]}
+			if err := register.RegisterGroup(ctx, group); err != nil {
+				t.Fatalf("failed to register group again: %v", err)
+			}
+
+			if len(sent) != test.wantSent {
+				t.Fatalf("got %d verification emails, want %d", len(sent), test.wantSent)
+			}
+
+			groups, err := repo.GetWatchGroups(ctx)
+			if err != nil {
+				t.Fatalf("failed to get watch groups: %v", err)
+			}
+			if len(groups) != 1 || groups[0].Watcher.Pending() == test.verifyFirst {
+				t.Fatalf("got groups %v, want one group, pending until verified", groups)
+			}
+		})
+	}
+}
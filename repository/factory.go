@@ -17,6 +17,12 @@ func New(ctx context.Context, cfg config.Database) (coursesense.Repository, erro
 	} else if cfg.Type == "sqlite" {
 		log.Info().Msg("using sqlite repository")
 		return newSQLiteRepository(ctx, cfg.SQLite)
+	} else if cfg.Type == "postgres" {
+		log.Info().Msg("using postgres repository")
+		return newPostgresRepository(ctx, cfg.Postgres)
+	} else if cfg.Type == "memory" {
+		log.Info().Msg("using memory repository")
+		return newMemoryRepository(cfg.Memory)
 	} else {
 		return nil, errors.New("invalid database type")
 	}
@@ -4,6 +4,8 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"sort"
+	"time"
 
 	"cloud.google.com/go/firestore"
 	coursesense "github.com/jacobmichels/Course-Sense-Go"
@@ -19,8 +21,62 @@ type FirestoreRepository struct {
 }
 
 type FirestoreWatcher struct {
-	Watcher   coursesense.Watcher `json:"watcher"`
-	SectionID string              `json:"sectionID"`
+	Watcher   storedWatcher `json:"watcher"`
+	SectionID string        `json:"sectionID"`
+}
+
+// a watcher as stored. Documents written before channels existed hold flat contact fields instead
+type storedWatcher struct {
+	coursesense.Watcher
+	legacyContact
+}
+
+// only ever read, new documents don't set them
+type legacyContact struct {
+	Email          string `firestore:",omitempty"`
+	Phone          string `firestore:",omitempty"`
+	DiscordWebhook string `firestore:",omitempty"`
+	SlackWebhook   string `firestore:",omitempty"`
+	Topic          string `firestore:",omitempty"`
+}
+
+func newStoredWatcher(watcher coursesense.Watcher) storedWatcher {
+	return storedWatcher{Watcher: watcher}
+}
+
+// returns the stored watcher, with the channels of older documents taken from their contact fields
+func (w storedWatcher) watcher() coursesense.Watcher {
+	watcher := w.Watcher
+	if len(watcher.Channels) == 0 {
+		watcher.Channels = coursesense.LegacyContact(w.legacyContact).Channels()
+	}
+
+	return watcher
+}
+
+type FirestoreJob struct {
+	Notifier string `json:"notifier"`
+	// the job's notification and watchers, json encoded
+	Payload       string                `json:"payload"`
+	Status        coursesense.JobStatus `json:"status"`
+	Attempts      int                   `json:"attempts"`
+	NextAttemptAt time.Time             `json:"nextAttemptAt"`
+	LastError     string                `json:"lastError"`
+	CreatedAt     time.Time             `json:"createdAt"`
+}
+
+type FirestoreDigest struct {
+	ContactKey string `json:"contactKey"`
+	// the digest's notification and watcher, json encoded
+	Payload string    `json:"payload"`
+	FlushAt time.Time `json:"flushAt"`
+}
+
+type FirestoreWatchGroup struct {
+	Course   coursesense.Course    `json:"course"`
+	Term     string                `json:"term"`
+	Sections []coursesense.Section `json:"sections"`
+	Watcher  storedWatcher         `json:"watcher"`
 }
 
 func newFirestoreRepository(ctx context.Context, cfg config.Firestore) (FirestoreRepository, error) {
@@ -43,27 +99,27 @@ func newFirestoreRepository(ctx context.Context, cfg config.Firestore) (Firestor
 	return FirestoreRepository{client, cfg}, nil
 }
 
-func (f FirestoreRepository) AddWatcher(ctx context.Context, section coursesense.Section, watcher coursesense.Watcher) error {
+func (f FirestoreRepository) AddWatcher(ctx context.Context, section coursesense.Section, watcher coursesense.Watcher) (bool, error) {
 	// Steps:
 	// 1. Retrieve the section document, creating it if it doesn't exist
-	// 2. Inspect the current watchers. If the new watcher is already a watcher, stop and return a nil error
-	// 3. Append the new watcher to the watchers array
+	// 2. Inspect the current watchers. If the new watcher is already a watcher, stop and report nothing was added
+	// 3. Append the new watcher to the watchers array, at the back of the section's queue
 	// 4. Update the document in the collection
 
 	documents, err := f.firestore.Collection(f.cfg.SectionCollectionID).Where("Code", "==", section.Code).Where("Term", "==", section.Term).Where("Course.Code", "==", section.Course.Code).Where("Course.Department", "==", section.Course.Department).Documents(ctx).GetAll()
 	if err != nil {
-		return fmt.Errorf("failed to get matching section documents: %w", err)
+		return false, fmt.Errorf("failed to get matching section documents: %w", err)
 	}
 
 	if len(documents) > 1 {
-		return errors.New("more than one matching document found, expected 0 or 1")
+		return false, errors.New("more than one matching document found, expected 0 or 1")
 	}
 
 	var sectionID string
 	if len(documents) == 0 {
 		ref, _, err := f.firestore.Collection(f.cfg.SectionCollectionID).Add(ctx, section)
 		if err != nil {
-			return fmt.Errorf("failed to add %s to collection: %w", section, err)
+			return false, fmt.Errorf("failed to add %s to collection: %w", section, err)
 		}
 		sectionID = ref.ID
 	} else {
@@ -72,29 +128,36 @@ func (f FirestoreRepository) AddWatcher(ctx context.Context, section coursesense
 
 	documents, err = f.firestore.Collection(f.cfg.WatcherCollectionID).Where("SectionID", "==", sectionID).Documents(ctx).GetAll()
 	if err != nil {
-		return fmt.Errorf("failed to get matching watcher documents: %w", err)
+		return false, fmt.Errorf("failed to get matching watcher documents: %w", err)
 	}
 
+	position := 0
 	for _, document := range documents {
 		var firestoreWatcher FirestoreWatcher
 		err := document.DataTo(&firestoreWatcher)
 		if err != nil {
-			return fmt.Errorf("failed to deserialize watcher: %w", err)
+			return false, fmt.Errorf("failed to deserialize watcher: %w", err)
 		}
 
-		if firestoreWatcher.Watcher.Email == watcher.Email && firestoreWatcher.Watcher.Phone == watcher.Phone {
+		if firestoreWatcher.Watcher.watcher().ContactKey() == watcher.ContactKey() {
 			// Watcher already watching this section, nothing to do
-			return nil
+			return false, nil
+		}
+
+		if firestoreWatcher.Watcher.Position > position {
+			position = firestoreWatcher.Watcher.Position
 		}
 	}
 
-	newWatcher := FirestoreWatcher{Watcher: watcher, SectionID: sectionID}
+	// new watchers join the back of the section's queue
+	watcher.Position = position + 1
+	newWatcher := FirestoreWatcher{Watcher: newStoredWatcher(watcher), SectionID: sectionID}
 	_, _, err = f.firestore.Collection(f.cfg.WatcherCollectionID).Add(ctx, newWatcher)
 	if err != nil {
-		return fmt.Errorf("failed to write new watcher to collection: %w", err)
+		return false, fmt.Errorf("failed to write new watcher to collection: %w", err)
 	}
 
-	return nil
+	return true, nil
 }
 
 func (f FirestoreRepository) GetWatchedSections(ctx context.Context) ([]coursesense.Section, error) {
@@ -147,7 +210,7 @@ func (f FirestoreRepository) GetWatchers(ctx context.Context, section coursesens
 			return nil, fmt.Errorf("failed to deserialize document: %w", err)
 		}
 
-		results = append(results, result.Watcher)
+		results = append(results, result.Watcher.watcher())
 	}
 
 	return results, nil
@@ -188,3 +251,569 @@ func (f FirestoreRepository) Cleanup(ctx context.Context, section coursesense.Se
 
 	return nil
 }
+
+func (f FirestoreRepository) PurgeExpired(ctx context.Context, now time.Time, notices func(coursesense.Watch) []coursesense.Job) ([]coursesense.Watch, error) {
+	// Steps:
+	// 1. Find watcher documents with an expiry at or before now
+	// 2. Look up the section each watcher belongs to, then delete the watcher along with enqueuing its notices
+	// 3. Delete any of those sections left without watchers
+
+	documents, err := f.firestore.Collection(f.cfg.WatcherCollectionID).Where("Watcher.ExpiresAt", ">", time.Time{}).Where("Watcher.ExpiresAt", "<=", now).Documents(ctx).GetAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get expired watcher documents: %w", err)
+	}
+
+	var results []coursesense.Watch
+	sections := make(map[string]*firestore.DocumentRef)
+	for _, document := range documents {
+		var firestoreWatcher FirestoreWatcher
+		if err := document.DataTo(&firestoreWatcher); err != nil {
+			return nil, fmt.Errorf("failed to deserialize watcher: %w", err)
+		}
+
+		sectionRef := f.firestore.Collection(f.cfg.SectionCollectionID).Doc(firestoreWatcher.SectionID)
+		sectionDocument, err := sectionRef.Get(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get section document: %w", err)
+		}
+
+		var section coursesense.Section
+		if err := sectionDocument.DataTo(&section); err != nil {
+			return nil, fmt.Errorf("failed to deserialize section: %w", err)
+		}
+
+		watch := coursesense.Watch{Section: section, Watcher: firestoreWatcher.Watcher.watcher()}
+		err = f.firestore.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+			if err := tx.Delete(document.Ref); err != nil {
+				return err
+			}
+
+			if notices == nil {
+				return nil
+			}
+			return f.enqueueJobs(tx, now, notices(watch)...)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to delete watcher: %w", err)
+		}
+
+		results = append(results, watch)
+		sections[sectionRef.ID] = sectionRef
+	}
+
+	for sectionID, sectionRef := range sections {
+		remaining, err := f.firestore.Collection(f.cfg.WatcherCollectionID).Where("SectionID", "==", sectionID).Limit(1).Documents(ctx).GetAll()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get remaining watcher documents: %w", err)
+		}
+
+		if len(remaining) > 0 {
+			continue
+		}
+
+		if _, err := sectionRef.Delete(ctx); err != nil {
+			return nil, fmt.Errorf("failed to delete section: %w", err)
+		}
+	}
+
+	return results, nil
+}
+
+func (f FirestoreRepository) PurgeUnverified(ctx context.Context, now time.Time) (int, error) {
+	// Steps:
+	// 1. Delete watcher documents with a verification deadline at or before now
+	// 2. Delete any of their sections left without watchers
+	// 3. Delete watch group documents with a verification deadline at or before now
+
+	documents, err := f.firestore.Collection(f.cfg.WatcherCollectionID).Where("Watcher.VerifyBy", ">", time.Time{}).Where("Watcher.VerifyBy", "<=", now).Documents(ctx).GetAll()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get unverified watcher documents: %w", err)
+	}
+
+	sections := make(map[string]*firestore.DocumentRef)
+	for _, document := range documents {
+		var firestoreWatcher FirestoreWatcher
+		if err := document.DataTo(&firestoreWatcher); err != nil {
+			return 0, fmt.Errorf("failed to deserialize watcher: %w", err)
+		}
+
+		if _, err := document.Ref.Delete(ctx); err != nil {
+			return 0, fmt.Errorf("failed to delete watcher: %w", err)
+		}
+
+		sectionRef := f.firestore.Collection(f.cfg.SectionCollectionID).Doc(firestoreWatcher.SectionID)
+		sections[sectionRef.ID] = sectionRef
+	}
+
+	for sectionID, sectionRef := range sections {
+		remaining, err := f.firestore.Collection(f.cfg.WatcherCollectionID).Where("SectionID", "==", sectionID).Limit(1).Documents(ctx).GetAll()
+		if err != nil {
+			return 0, fmt.Errorf("failed to get remaining watcher documents: %w", err)
+		}
+
+		if len(remaining) > 0 {
+			continue
+		}
+
+		if _, err := sectionRef.Delete(ctx); err != nil {
+			return 0, fmt.Errorf("failed to delete section: %w", err)
+		}
+	}
+
+	groups, err := f.firestore.Collection(f.cfg.GroupCollectionID).Where("Watcher.VerifyBy", ">", time.Time{}).Where("Watcher.VerifyBy", "<=", now).Documents(ctx).GetAll()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get unverified watch group documents: %w", err)
+	}
+
+	for _, document := range groups {
+		if _, err := document.Ref.Delete(ctx); err != nil {
+			return 0, fmt.Errorf("failed to delete watch group: %w", err)
+		}
+	}
+
+	return len(documents) + len(groups), nil
+}
+
+func (f FirestoreRepository) RemoveWatcher(ctx context.Context, section coursesense.Section, watcher coursesense.Watcher) error {
+	sectionDocument, err := f.getSectionDocument(ctx, section)
+	if err != nil {
+		return err
+	}
+
+	documents, err := f.getWatcherDocuments(ctx, sectionDocument.Ref.ID, watcher)
+	if err != nil {
+		return err
+	}
+
+	for _, document := range documents {
+		if _, err := document.Ref.Delete(ctx); err != nil {
+			return fmt.Errorf("failed to delete watcher: %w", err)
+		}
+	}
+
+	remaining, err := f.firestore.Collection(f.cfg.WatcherCollectionID).Where("SectionID", "==", sectionDocument.Ref.ID).Limit(1).Documents(ctx).GetAll()
+	if err != nil {
+		return fmt.Errorf("failed to get remaining watcher documents: %w", err)
+	}
+
+	if len(remaining) == 0 {
+		if _, err := sectionDocument.Ref.Delete(ctx); err != nil {
+			return fmt.Errorf("failed to delete section: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (f FirestoreRepository) UpdateWatcher(ctx context.Context, section coursesense.Section, watcher coursesense.Watcher) error {
+	sectionDocument, err := f.getSectionDocument(ctx, section)
+	if err != nil {
+		return err
+	}
+
+	documents, err := f.getWatcherDocuments(ctx, sectionDocument.Ref.ID, watcher)
+	if err != nil {
+		return err
+	}
+
+	for _, document := range documents {
+		_, err := document.Ref.Set(ctx, FirestoreWatcher{Watcher: newStoredWatcher(watcher), SectionID: sectionDocument.Ref.ID})
+		if err != nil {
+			return fmt.Errorf("failed to update watcher: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (f FirestoreRepository) AddWatchGroup(ctx context.Context, group coursesense.WatchGroup) (bool, error) {
+	documents, err := f.firestore.Collection(f.cfg.GroupCollectionID).Where("Term", "==", group.Term).Where("Course.Code", "==", group.Course.Code).Where("Course.Department", "==", group.Course.Department).Documents(ctx).GetAll()
+	if err != nil {
+		return false, fmt.Errorf("failed to get matching group documents: %w", err)
+	}
+
+	for _, document := range documents {
+		var existing FirestoreWatchGroup
+		if err := document.DataTo(&existing); err != nil {
+			return false, fmt.Errorf("failed to deserialize document: %w", err)
+		}
+
+		if (coursesense.WatchGroup{Course: existing.Course, Term: existing.Term, Sections: existing.Sections, Watcher: existing.Watcher.watcher()}).SameWatch(group) {
+			// Watcher already has this group, nothing to do
+			return false, nil
+		}
+	}
+
+	_, _, err = f.firestore.Collection(f.cfg.GroupCollectionID).Add(ctx, FirestoreWatchGroup{Course: group.Course, Term: group.Term, Sections: group.Sections, Watcher: newStoredWatcher(group.Watcher)})
+	if err != nil {
+		return false, fmt.Errorf("failed to add %s to collection: %w", group, err)
+	}
+
+	return true, nil
+}
+
+func (f FirestoreRepository) GetWatchGroups(ctx context.Context) ([]coursesense.WatchGroup, error) {
+	documents, err := f.firestore.Collection(f.cfg.GroupCollectionID).Documents(ctx).GetAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get all documents in groups collection: %w", err)
+	}
+
+	var results []coursesense.WatchGroup
+	for _, document := range documents {
+		var result FirestoreWatchGroup
+		err = document.DataTo(&result)
+		if err != nil {
+			return nil, fmt.Errorf("failed to deserialize document: %w", err)
+		}
+
+		results = append(results, coursesense.WatchGroup{ID: document.Ref.ID, Course: result.Course, Term: result.Term, Sections: result.Sections, Watcher: result.Watcher.watcher()})
+	}
+
+	return results, nil
+}
+
+func (f FirestoreRepository) UpdateWatchGroup(ctx context.Context, group coursesense.WatchGroup, jobs ...coursesense.Job) error {
+	err := f.firestore.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		if err := tx.Update(f.firestore.Collection(f.cfg.GroupCollectionID).Doc(group.ID), []firestore.Update{{Path: "Watcher", Value: group.Watcher}}); err != nil {
+			return err
+		}
+
+		return f.enqueueJobs(tx, time.Now(), jobs...)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update watch group: %w", err)
+	}
+
+	return nil
+}
+
+func (f FirestoreRepository) RemoveWatchGroup(ctx context.Context, id string, jobs ...coursesense.Job) error {
+	err := f.firestore.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		if err := tx.Delete(f.firestore.Collection(f.cfg.GroupCollectionID).Doc(id)); err != nil {
+			return err
+		}
+
+		return f.enqueueJobs(tx, time.Now(), jobs...)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete watch group: %w", err)
+	}
+
+	return nil
+}
+
+func (f FirestoreRepository) SettleSection(ctx context.Context, update coursesense.SectionUpdate, jobs ...coursesense.Job) error {
+	sectionDocument, err := f.getSectionDocument(ctx, update.Section)
+	if err != nil {
+		return err
+	}
+
+	remove := make(map[string]bool, len(update.Remove))
+	for _, watcher := range update.Remove {
+		remove[watcher.ContactKey()] = true
+	}
+	updates := make(map[string]coursesense.Watcher, len(update.Update))
+	for _, watcher := range update.Update {
+		updates[watcher.ContactKey()] = watcher
+	}
+
+	err = f.firestore.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		documents, err := tx.Documents(f.firestore.Collection(f.cfg.WatcherCollectionID).Where("SectionID", "==", sectionDocument.Ref.ID)).GetAll()
+		if err != nil {
+			return fmt.Errorf("failed to get watcher documents: %w", err)
+		}
+
+		remaining := len(documents)
+		for _, document := range documents {
+			var firestoreWatcher FirestoreWatcher
+			if err := document.DataTo(&firestoreWatcher); err != nil {
+				return fmt.Errorf("failed to deserialize watcher: %w", err)
+			}
+
+			key := firestoreWatcher.Watcher.watcher().ContactKey()
+			if remove[key] {
+				if err := tx.Delete(document.Ref); err != nil {
+					return err
+				}
+				remaining--
+			} else if watcher, ok := updates[key]; ok {
+				if err := tx.Set(document.Ref, FirestoreWatcher{Watcher: newStoredWatcher(watcher), SectionID: sectionDocument.Ref.ID}); err != nil {
+					return err
+				}
+			}
+		}
+
+		if remaining == 0 {
+			if err := tx.Delete(sectionDocument.Ref); err != nil {
+				return err
+			}
+		}
+
+		return f.enqueueJobs(tx, time.Now(), jobs...)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to settle section: %w", err)
+	}
+
+	return nil
+}
+
+// creates jobs in the outbox as part of a transaction, due immediately
+func (f FirestoreRepository) enqueueJobs(tx *firestore.Transaction, now time.Time, jobs ...coursesense.Job) error {
+	for _, job := range jobs {
+		payload, err := encodeJobPayload(job)
+		if err != nil {
+			return err
+		}
+
+		document := FirestoreJob{Notifier: job.Notifier, Payload: payload, Status: coursesense.JobPending, NextAttemptAt: now, CreatedAt: now}
+		if err := tx.Create(f.firestore.Collection(f.cfg.JobCollectionID).NewDoc(), document); err != nil {
+			return fmt.Errorf("failed to enqueue job: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func jobFromDocument(document *firestore.DocumentSnapshot) (coursesense.Job, error) {
+	var firestoreJob FirestoreJob
+	if err := document.DataTo(&firestoreJob); err != nil {
+		return coursesense.Job{}, fmt.Errorf("failed to deserialize job: %w", err)
+	}
+
+	job := coursesense.Job{
+		ID:            document.Ref.ID,
+		Notifier:      firestoreJob.Notifier,
+		Status:        firestoreJob.Status,
+		Attempts:      firestoreJob.Attempts,
+		NextAttemptAt: firestoreJob.NextAttemptAt,
+		LastError:     firestoreJob.LastError,
+		CreatedAt:     firestoreJob.CreatedAt,
+	}
+	if err := decodeJobPayload(firestoreJob.Payload, &job); err != nil {
+		return coursesense.Job{}, err
+	}
+
+	return job, nil
+}
+
+func (f FirestoreRepository) ClaimJobs(ctx context.Context, now time.Time, limit int, lease time.Duration) ([]coursesense.Job, error) {
+	var jobs []coursesense.Job
+	err := f.firestore.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		// the transaction function may be retried, so start over each time
+		jobs = nil
+
+		// due jobs are filtered in memory, querying on both fields would need a composite index
+		documents, err := tx.Documents(f.firestore.Collection(f.cfg.JobCollectionID).Where("Status", "==", coursesense.JobPending)).GetAll()
+		if err != nil {
+			return fmt.Errorf("failed to get pending job documents: %w", err)
+		}
+
+		refs := make(map[string]*firestore.DocumentRef)
+		for _, document := range documents {
+			job, err := jobFromDocument(document)
+			if err != nil {
+				return err
+			}
+
+			if !job.NextAttemptAt.After(now) {
+				jobs = append(jobs, job)
+				refs[job.ID] = document.Ref
+			}
+		}
+
+		sort.Slice(jobs, func(i, j int) bool { return jobs[i].NextAttemptAt.Before(jobs[j].NextAttemptAt) })
+		if len(jobs) > limit {
+			jobs = jobs[:limit]
+		}
+
+		leasedUntil := now.Add(lease)
+		for i := range jobs {
+			if err := tx.Update(refs[jobs[i].ID], []firestore.Update{{Path: "NextAttemptAt", Value: leasedUntil}}); err != nil {
+				return err
+			}
+			jobs[i].NextAttemptAt = leasedUntil
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim jobs: %w", err)
+	}
+
+	return jobs, nil
+}
+
+func (f FirestoreRepository) UpdateJob(ctx context.Context, job coursesense.Job) error {
+	payload, err := encodeJobPayload(job)
+	if err != nil {
+		return err
+	}
+
+	document := FirestoreJob{Notifier: job.Notifier, Payload: payload, Status: job.Status, Attempts: job.Attempts, NextAttemptAt: job.NextAttemptAt, LastError: job.LastError, CreatedAt: job.CreatedAt}
+	if _, err := f.firestore.Collection(f.cfg.JobCollectionID).Doc(job.ID).Set(ctx, document); err != nil {
+		return fmt.Errorf("failed to update job: %w", err)
+	}
+
+	return nil
+}
+
+func (f FirestoreRepository) CompleteJob(ctx context.Context, id string) error {
+	if _, err := f.firestore.Collection(f.cfg.JobCollectionID).Doc(id).Delete(ctx); err != nil {
+		return fmt.Errorf("failed to delete job: %w", err)
+	}
+
+	return nil
+}
+
+func (f FirestoreRepository) GetJob(ctx context.Context, id string) (coursesense.Job, error) {
+	document, err := f.firestore.Collection(f.cfg.JobCollectionID).Doc(id).Get(ctx)
+	if err != nil {
+		return coursesense.Job{}, fmt.Errorf("failed to get job document: %w", err)
+	}
+
+	return jobFromDocument(document)
+}
+
+func (f FirestoreRepository) GetJobs(ctx context.Context, status coursesense.JobStatus) ([]coursesense.Job, error) {
+	documents, err := f.firestore.Collection(f.cfg.JobCollectionID).Where("Status", "==", status).Documents(ctx).GetAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get job documents: %w", err)
+	}
+
+	var jobs []coursesense.Job
+	for _, document := range documents {
+		job, err := jobFromDocument(document)
+		if err != nil {
+			return nil, err
+		}
+
+		jobs = append(jobs, job)
+	}
+
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].CreatedAt.Before(jobs[j].CreatedAt) })
+	return jobs, nil
+}
+
+func digestFromDocument(document *firestore.DocumentSnapshot) (coursesense.Digest, error) {
+	var firestoreDigest FirestoreDigest
+	if err := document.DataTo(&firestoreDigest); err != nil {
+		return coursesense.Digest{}, fmt.Errorf("failed to deserialize digest: %w", err)
+	}
+
+	digest := coursesense.Digest{ID: document.Ref.ID, FlushAt: firestoreDigest.FlushAt}
+	if err := decodeDigestPayload(firestoreDigest.Payload, &digest); err != nil {
+		return coursesense.Digest{}, err
+	}
+
+	return digest, nil
+}
+
+func (f FirestoreRepository) AddToDigest(ctx context.Context, digest coursesense.Digest) error {
+	key := digest.Watcher.ContactKey()
+	err := f.firestore.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		documents, err := tx.Documents(f.firestore.Collection(f.cfg.DigestCollectionID).Where("ContactKey", "==", key)).GetAll()
+		if err != nil {
+			return fmt.Errorf("failed to get matching digest documents: %w", err)
+		}
+
+		merged := digest
+		ref := f.firestore.Collection(f.cfg.DigestCollectionID).NewDoc()
+		if len(documents) > 0 {
+			existing, err := digestFromDocument(documents[0])
+			if err != nil {
+				return err
+			}
+			merged = mergeDigest(existing, digest)
+			ref = documents[0].Ref
+		}
+
+		payload, err := encodeDigestPayload(merged)
+		if err != nil {
+			return err
+		}
+
+		return tx.Set(ref, FirestoreDigest{ContactKey: key, Payload: payload, FlushAt: merged.FlushAt})
+	})
+	if err != nil {
+		return fmt.Errorf("failed to add to digest: %w", err)
+	}
+
+	return nil
+}
+
+func (f FirestoreRepository) GetDueDigests(ctx context.Context, now time.Time) ([]coursesense.Digest, error) {
+	documents, err := f.firestore.Collection(f.cfg.DigestCollectionID).Where("FlushAt", "<=", now).Documents(ctx).GetAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get due digest documents: %w", err)
+	}
+
+	var digests []coursesense.Digest
+	for _, document := range documents {
+		digest, err := digestFromDocument(document)
+		if err != nil {
+			return nil, err
+		}
+
+		digests = append(digests, digest)
+	}
+
+	return digests, nil
+}
+
+func (f FirestoreRepository) FlushDigest(ctx context.Context, digest coursesense.Digest, jobs ...coursesense.Job) error {
+	err := f.firestore.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		if err := tx.Delete(f.firestore.Collection(f.cfg.DigestCollectionID).Doc(digest.ID)); err != nil {
+			return err
+		}
+
+		return f.enqueueJobs(tx, time.Now(), jobs...)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to flush digest: %w", err)
+	}
+
+	return nil
+}
+
+// returns the document of a section already stored in firestore
+func (f FirestoreRepository) getSectionDocument(ctx context.Context, section coursesense.Section) (*firestore.DocumentSnapshot, error) {
+	documents, err := f.firestore.Collection(f.cfg.SectionCollectionID).Where("Code", "==", section.Code).Where("Term", "==", section.Term).Where("Course.Code", "==", section.Course.Code).Where("Course.Department", "==", section.Course.Department).Documents(ctx).GetAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get matching section documents: %w", err)
+	}
+
+	// sanity check, we should never have more than one matching document
+	if len(documents) > 1 {
+		return nil, errors.New("more than one matching document found, expected 0 or 1")
+	}
+
+	if len(documents) == 0 {
+		return nil, errors.New("section not found in firestore")
+	}
+
+	return documents[0], nil
+}
+
+// returns the documents of a section's watchers that have the same contact details as the given watcher
+func (f FirestoreRepository) getWatcherDocuments(ctx context.Context, sectionID string, watcher coursesense.Watcher) ([]*firestore.DocumentSnapshot, error) {
+	// matched in memory, documents written before a contact method existed don't have its field to query on
+	documents, err := f.firestore.Collection(f.cfg.WatcherCollectionID).Where("SectionID", "==", sectionID).Documents(ctx).GetAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get matching watcher documents: %w", err)
+	}
+
+	var matches []*firestore.DocumentSnapshot
+	for _, document := range documents {
+		var firestoreWatcher FirestoreWatcher
+		if err := document.DataTo(&firestoreWatcher); err != nil {
+			return nil, fmt.Errorf("failed to deserialize watcher: %w", err)
+		}
+
+		if firestoreWatcher.Watcher.watcher().ContactKey() == watcher.ContactKey() {
+			matches = append(matches, document)
+		}
+	}
+
+	return matches, nil
+}
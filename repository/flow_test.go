@@ -0,0 +1,111 @@
+package repository
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	coursesense "github.com/jacobmichels/Course-Sense-Go"
+	"github.com/jacobmichels/Course-Sense-Go/config"
+	"github.com/jacobmichels/Course-Sense-Go/outbox"
+	"github.com/jacobmichels/Course-Sense-Go/register"
+	"github.com/jacobmichels/Course-Sense-Go/trigger"
+)
+
+// reports the seats of every section
+type stubSections map[coursesense.Section]uint
+
+func (s stubSections) Exists(ctx context.Context, section coursesense.Section) (bool, error) {
+	_, ok := s[section]
+	return ok, nil
+}
+
+func (s stubSections) GetAvailableSeats(ctx context.Context, section coursesense.Section) (uint, error) {
+	return s[section], nil
+}
+
+func (s stubSections) GetCourseSections(ctx context.Context, course coursesense.Course, term string) (map[coursesense.Section]uint, error) {
+	return s, nil
+}
+
+func (s stubSections) GetMeetings(ctx context.Context, section coursesense.Section) ([]coursesense.Meeting, error) {
+	return nil, nil
+}
+
+type stubConflicts struct{}
+
+func (stubConflicts) Conflicts(ctx context.Context, timetable coursesense.Timetable, sections []coursesense.Section) ([]coursesense.Section, error) {
+	return nil, nil
+}
+
+// records the notifications it delivers
+type recordingNotifier struct {
+	mu        *sync.Mutex
+	delivered *[]coursesense.Job
+}
+
+func (n recordingNotifier) Name() string                     { return "email" }
+func (n recordingNotifier) Channel() coursesense.ChannelKind { return coursesense.ChannelEmail }
+func (n recordingNotifier) Urgent() bool                     { return false }
+
+func (n recordingNotifier) Notify(ctx context.Context, notification coursesense.Notification, watchers ...coursesense.Watcher) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	*n.delivered = append(*n.delivered, coursesense.Job{Notification: notification, Watchers: watchers})
+	return nil
+}
+
+func TestRegisterTriggerDeliver(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, repo coursesense.Repository) {
+		ctx := context.Background()
+		sections := stubSections{first: 0, second: 0}
+
+		reg := register.NewRegister(sections, repo, nil, nil)
+		for _, address := range []string{"a@example.com", "b@example.com", "a@example.com"} {
+			if err := reg.Register(ctx, first, emailWatcher(address)); err != nil {
+				t.Fatalf("failed to register %s: %v", address, err)
+			}
+		}
+		if err := reg.Register(ctx, second, emailWatcher("c@example.com")); err != nil {
+			t.Fatalf("failed to register: %v", err)
+		}
+
+		var mu sync.Mutex
+		var delivered []coursesense.Job
+		n := recordingNotifier{&mu, &delivered}
+		trig := trigger.NewTrigger(sections, repo, stubConflicts{}, config.Notifications{}, n)
+		worker := outbox.NewWorker(repo, config.Outbox{BatchSize: 10, MaxAttempts: 5, AttemptTimeoutSecs: 5}, nil, n)
+
+		// nothing opens
+		if err := trig.Trigger(ctx); err != nil {
+			t.Fatalf("trigger failed: %v", err)
+		}
+		if jobs, err := repo.GetJobs(ctx, coursesense.JobPending); err != nil || len(jobs) != 0 {
+			t.Fatalf("got jobs %v, %v before any seats opened", jobs, err)
+		}
+
+		sections[first] = 2
+		if err := trig.Trigger(ctx); err != nil {
+			t.Fatalf("trigger failed: %v", err)
+		}
+		if err := worker.Process(ctx); err != nil {
+			t.Fatalf("failed to process outbox: %v", err)
+		}
+
+		if len(delivered) != 1 || len(delivered[0].Watchers) != 2 || delivered[0].Notification.Seats[first] != 2 {
+			t.Fatalf("got deliveries %v, want one to both watchers of the opened section", delivered)
+		}
+		if got := delivered[0].Watchers; got[0].Address(coursesense.ChannelEmail) != "a@example.com" || got[1].Address(coursesense.ChannelEmail) != "b@example.com" {
+			t.Fatalf("got watchers %v, want them in queue order", got)
+		}
+
+		if jobs, err := repo.GetJobs(ctx, coursesense.JobPending); err != nil || len(jobs) != 0 {
+			t.Fatalf("got jobs %v, %v left after delivery", jobs, err)
+		}
+		watched, err := repo.GetWatchedSections(ctx)
+		if err != nil || len(watched) != 1 || watched[0] != second {
+			t.Fatalf("got watched sections %v, %v, want only the section still closed", watched, err)
+		}
+	})
+}
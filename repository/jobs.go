@@ -0,0 +1,89 @@
+package repository
+
+import (
+	"encoding/json"
+	"fmt"
+
+	coursesense "github.com/jacobmichels/Course-Sense-Go"
+)
+
+// the parts of a job stored as a single json document
+type jobPayload struct {
+	Notification coursesense.Notification `json:"notification"`
+	Watchers     []payloadWatcher         `json:"watchers"`
+	Parts        map[string][]string      `json:"parts,omitempty"`
+}
+
+// a job's watcher. Jobs queued before channels existed hold flat contact fields instead
+type payloadWatcher struct {
+	coursesense.Watcher
+	coursesense.LegacyContact
+}
+
+func encodeJobPayload(job coursesense.Job) (string, error) {
+	watchers := make([]payloadWatcher, len(job.Watchers))
+	for i, watcher := range job.Watchers {
+		watchers[i] = payloadWatcher{Watcher: watcher}
+	}
+
+	payload, err := json.Marshal(jobPayload{job.Notification, watchers, job.Parts})
+	if err != nil {
+		return "", fmt.Errorf("failed to encode job payload: %w", err)
+	}
+
+	return string(payload), nil
+}
+
+func decodeJobPayload(payload string, job *coursesense.Job) error {
+	var decoded jobPayload
+	if err := json.Unmarshal([]byte(payload), &decoded); err != nil {
+		return fmt.Errorf("failed to decode job payload: %w", err)
+	}
+
+	job.Notification = decoded.Notification
+	job.Parts = decoded.Parts
+	job.Watchers = make([]coursesense.Watcher, len(decoded.Watchers))
+	for i, watcher := range decoded.Watchers {
+		job.Watchers[i] = watcher.Watcher
+		if len(watcher.Watcher.Channels) == 0 {
+			job.Watchers[i].Channels = watcher.LegacyContact.Channels()
+		}
+	}
+
+	return nil
+}
+
+// a digest's notification and watcher are stored like a job's
+func encodeDigestPayload(digest coursesense.Digest) (string, error) {
+	return encodeJobPayload(coursesense.Job{Notification: digest.Notification, Watchers: []coursesense.Watcher{digest.Watcher}})
+}
+
+func decodeDigestPayload(payload string, digest *coursesense.Digest) error {
+	var job coursesense.Job
+	if err := decodeJobPayload(payload, &job); err != nil {
+		return err
+	}
+
+	if len(job.Watchers) != 1 {
+		return fmt.Errorf("expected one watcher in digest payload, found %d", len(job.Watchers))
+	}
+
+	digest.Notification = job.Notification
+	digest.Watcher = job.Watchers[0]
+	return nil
+}
+
+// returns the stored digest with a newer one merged in. The digest keeps the earlier flush time and the newer watcher
+func mergeDigest(existing, digest coursesense.Digest) coursesense.Digest {
+	merged := coursesense.Digest{
+		ID:           existing.ID,
+		Watcher:      digest.Watcher,
+		Notification: existing.Notification.Merge(digest.Notification),
+		FlushAt:      existing.FlushAt,
+	}
+	if digest.FlushAt.Before(merged.FlushAt) {
+		merged.FlushAt = digest.FlushAt
+	}
+
+	return merged
+}
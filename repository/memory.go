@@ -0,0 +1,721 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	coursesense "github.com/jacobmichels/Course-Sense-Go"
+	"github.com/jacobmichels/Course-Sense-Go/config"
+)
+
+var _ coursesense.Repository = MemoryRepository{}
+
+// Holds everything in memory, for tests and demos. It behaves like the sqlite repository:
+// sections are removed along with their last watcher, jobs and digests are stored encoded as they would be in a database.
+// Nothing survives a restart unless a snapshot file is configured, which is read on creation and written by Close
+type MemoryRepository struct {
+	store *memoryStore
+	cfg   config.Memory
+}
+
+type memoryStore struct {
+	mu    sync.Mutex
+	state memoryState
+}
+
+// everything the repository holds, as written to the snapshot file
+type memoryState struct {
+	// in the order they were first watched
+	Sections []memorySection `json:"sections"`
+	Groups   []memoryGroup   `json:"groups"`
+	Jobs     []memoryJob     `json:"jobs"`
+	Digests  []memoryDigest  `json:"digests"`
+	// the last ids assigned, counted apart like a database's tables
+	LastGroupID  int `json:"last_group_id"`
+	LastJobID    int `json:"last_job_id"`
+	LastDigestID int `json:"last_digest_id"`
+}
+
+// a section and its watchers. A course only exists through its sections, so it goes with the last of them
+type memorySection struct {
+	Section  coursesense.Section `json:"section"`
+	Watchers []memoryWatcher     `json:"watchers"`
+}
+
+// a watcher along with the fields its json encoding leaves out
+type memoryWatcher struct {
+	coursesense.Watcher
+	Held     bool      `json:"held"`
+	Position int       `json:"position"`
+	VerifyBy time.Time `json:"verify_by"`
+}
+
+type memoryGroup struct {
+	ID     int                `json:"id"`
+	Course coursesense.Course `json:"course"`
+	Term   string             `json:"term"`
+	// the codes of the watched sections, empty for a whole course
+	Sections []string      `json:"sections"`
+	Watcher  memoryWatcher `json:"watcher"`
+}
+
+type memoryJob struct {
+	ID       int    `json:"id"`
+	Notifier string `json:"notifier"`
+	// the job's notification and watchers, json encoded
+	Payload       string                `json:"payload"`
+	Status        coursesense.JobStatus `json:"status"`
+	Attempts      int                   `json:"attempts"`
+	NextAttemptAt time.Time             `json:"next_attempt_at"`
+	LastError     string                `json:"last_error"`
+	CreatedAt     time.Time             `json:"created_at"`
+}
+
+type memoryDigest struct {
+	ID         int    `json:"id"`
+	ContactKey string `json:"contact_key"`
+	// the digest's notification and watcher, json encoded
+	Payload string    `json:"payload"`
+	FlushAt time.Time `json:"flush_at"`
+}
+
+// creates a new repository held in memory, restoring the snapshot file if there is one
+func newMemoryRepository(cfg config.Memory) (MemoryRepository, error) {
+	r := MemoryRepository{&memoryStore{}, cfg}
+	if cfg.SnapshotFile == "" {
+		log.Info().Msg("memory repository has no snapshot file, everything is lost on exit")
+		return r, nil
+	}
+
+	data, err := os.ReadFile(cfg.SnapshotFile)
+	if errors.Is(err, os.ErrNotExist) {
+		log.Info().Msgf("no snapshot at %s, starting empty", cfg.SnapshotFile)
+		return r, nil
+	} else if err != nil {
+		return MemoryRepository{}, fmt.Errorf("failed to read snapshot: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &r.store.state); err != nil {
+		return MemoryRepository{}, fmt.Errorf("failed to decode snapshot: %w", err)
+	}
+
+	log.Info().Msgf("restored snapshot from %s", cfg.SnapshotFile)
+	return r, nil
+}
+
+// Close writes the snapshot file, if one is configured
+func (r MemoryRepository) Close() error {
+	if r.cfg.SnapshotFile == "" {
+		return nil
+	}
+
+	r.store.mu.Lock()
+	data, err := json.Marshal(r.store.state)
+	r.store.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("failed to encode snapshot: %w", err)
+	}
+
+	// written beside the snapshot and renamed over it, so a crash never leaves half a snapshot
+	tmp, err := os.CreateTemp(filepath.Dir(r.cfg.SnapshotFile), ".snapshot-*")
+	if err != nil {
+		return fmt.Errorf("failed to create snapshot: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), r.cfg.SnapshotFile); err != nil {
+		return fmt.Errorf("failed to save snapshot: %w", err)
+	}
+
+	log.Info().Msgf("snapshot written to %s", r.cfg.SnapshotFile)
+	return nil
+}
+
+func newMemoryWatcher(watcher coursesense.Watcher) memoryWatcher {
+	watcher = copyWatcher(watcher)
+	return memoryWatcher{Watcher: watcher, Held: watcher.Held, Position: watcher.Position, VerifyBy: watcher.VerifyBy}
+}
+
+func (w memoryWatcher) watcher() coursesense.Watcher {
+	watcher := copyWatcher(w.Watcher)
+	watcher.Held = w.Held
+	watcher.Position = w.Position
+	watcher.VerifyBy = w.VerifyBy
+	return watcher
+}
+
+// returns a copy sharing no slices with the watcher, so neither the caller nor the store can change the other's
+func copyWatcher(watcher coursesense.Watcher) coursesense.Watcher {
+	watcher.Channels = append([]coursesense.Channel(nil), watcher.Channels...)
+	watcher.Timetable.Sections = append([]coursesense.Section(nil), watcher.Timetable.Sections...)
+
+	meetings := watcher.Timetable.Meetings
+	watcher.Timetable.Meetings = nil
+	for _, meeting := range meetings {
+		meeting.Days = append([]time.Weekday(nil), meeting.Days...)
+		watcher.Timetable.Meetings = append(watcher.Timetable.Meetings, meeting)
+	}
+
+	return watcher
+}
+
+// returns the index of the section, or -1 if it isn't watched
+func (s *memoryState) section(section coursesense.Section) int {
+	for i := range s.Sections {
+		if s.Sections[i].Section == section {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// returns the index of the section, or an error like the databases give for a section that isn't watched
+func (s *memoryState) watchedSection(section coursesense.Section) (int, error) {
+	i := s.section(section)
+	if i < 0 {
+		return 0, fmt.Errorf("section %s not found", section)
+	}
+
+	return i, nil
+}
+
+// removes the watchers of the section matching the predicate, returning them
+func (s *memoryState) removeWatchers(i int, remove func(memoryWatcher) bool) []memoryWatcher {
+	var kept, removed []memoryWatcher
+	for _, watcher := range s.Sections[i].Watchers {
+		if remove(watcher) {
+			removed = append(removed, watcher)
+		} else {
+			kept = append(kept, watcher)
+		}
+	}
+	s.Sections[i].Watchers = kept
+
+	return removed
+}
+
+// removes the sections left without watchers
+func (s *memoryState) prune() {
+	var kept []memorySection
+	for _, section := range s.Sections {
+		if len(section.Watchers) > 0 {
+			kept = append(kept, section)
+		}
+	}
+	s.Sections = kept
+}
+
+// increments the counter, returning the new id
+func next(last *int) int {
+	*last++
+	return *last
+}
+
+// stores jobs in the outbox, due at the given time
+func (s *memoryState) enqueue(now time.Time, jobs ...coursesense.Job) error {
+	for _, job := range jobs {
+		payload, err := encodeJobPayload(job)
+		if err != nil {
+			return err
+		}
+
+		s.Jobs = append(s.Jobs, memoryJob{ID: next(&s.LastJobID), Notifier: job.Notifier, Payload: payload, Status: coursesense.JobPending, NextAttemptAt: now, CreatedAt: now})
+	}
+
+	return nil
+}
+
+func (r MemoryRepository) AddWatcher(ctx context.Context, section coursesense.Section, watcher coursesense.Watcher) (bool, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	s := &r.store.state
+
+	i := s.section(section)
+	if i < 0 {
+		s.Sections = append(s.Sections, memorySection{Section: section})
+		i = len(s.Sections) - 1
+	}
+
+	// new watchers join the back of the section's queue
+	position := 0
+	for _, existing := range s.Sections[i].Watchers {
+		if existing.Watcher.ContactKey() == watcher.ContactKey() {
+			log.Debug().Msg("watcher already exists in memory")
+			return false, nil
+		}
+
+		if existing.Position > position {
+			position = existing.Position
+		}
+	}
+
+	watcher.Position = position + 1
+	s.Sections[i].Watchers = append(s.Sections[i].Watchers, newMemoryWatcher(watcher))
+	return true, nil
+}
+
+func (r MemoryRepository) GetWatchedSections(ctx context.Context) ([]coursesense.Section, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	var sections []coursesense.Section
+	for _, section := range r.store.state.Sections {
+		sections = append(sections, section.Section)
+	}
+
+	log.Info().Int("count", len(sections)).Msg("retrieved watched sections")
+
+	return sections, nil
+}
+
+func (r MemoryRepository) GetWatchers(ctx context.Context, section coursesense.Section) ([]coursesense.Watcher, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	i, err := r.store.state.watchedSection(section)
+	if err != nil {
+		return nil, err
+	}
+
+	var watchers []coursesense.Watcher
+	for _, watcher := range r.store.state.Sections[i].Watchers {
+		watchers = append(watchers, watcher.watcher())
+	}
+	sort.SliceStable(watchers, func(a, b int) bool { return watchers[a].Position < watchers[b].Position })
+
+	log.Info().Int("count", len(watchers)).Msg("retrieved watchers for section")
+
+	return watchers, nil
+}
+
+func (r MemoryRepository) Cleanup(ctx context.Context, section coursesense.Section) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	s := &r.store.state
+
+	i, err := s.watchedSection(section)
+	if err != nil {
+		return err
+	}
+
+	// the course is gone too once no other section of it is watched
+	s.Sections = append(s.Sections[:i], s.Sections[i+1:]...)
+	return nil
+}
+
+func (r MemoryRepository) PurgeExpired(ctx context.Context, now time.Time, notices func(coursesense.Watch) []coursesense.Job) ([]coursesense.Watch, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	s := &r.store.state
+
+	var watches []coursesense.Watch
+	for i := range s.Sections {
+		removed := s.removeWatchers(i, func(w memoryWatcher) bool {
+			return !w.ExpiresAt.IsZero() && !w.ExpiresAt.After(now)
+		})
+
+		for _, watcher := range removed {
+			watches = append(watches, coursesense.Watch{Section: s.Sections[i].Section, Watcher: watcher.watcher()})
+		}
+	}
+	s.prune()
+
+	if notices != nil {
+		for _, watch := range watches {
+			if err := s.enqueue(now, notices(watch)...); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return watches, nil
+}
+
+func (r MemoryRepository) PurgeUnverified(ctx context.Context, now time.Time) (int, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	s := &r.store.state
+
+	unverified := func(w memoryWatcher) bool {
+		return !w.VerifyBy.IsZero() && !w.VerifyBy.After(now)
+	}
+
+	count := 0
+	for i := range s.Sections {
+		count += len(s.removeWatchers(i, unverified))
+	}
+	s.prune()
+
+	var groups []memoryGroup
+	for _, group := range s.Groups {
+		if unverified(group.Watcher) {
+			count++
+			continue
+		}
+		groups = append(groups, group)
+	}
+	s.Groups = groups
+
+	return count, nil
+}
+
+func (r MemoryRepository) RemoveWatcher(ctx context.Context, section coursesense.Section, watcher coursesense.Watcher) error {
+	return r.SettleSection(ctx, coursesense.SectionUpdate{Section: section, Remove: []coursesense.Watcher{watcher}})
+}
+
+func (r MemoryRepository) UpdateWatcher(ctx context.Context, section coursesense.Section, watcher coursesense.Watcher) error {
+	return r.SettleSection(ctx, coursesense.SectionUpdate{Section: section, Update: []coursesense.Watcher{watcher}})
+}
+
+func (r MemoryRepository) SettleSection(ctx context.Context, update coursesense.SectionUpdate, jobs ...coursesense.Job) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	s := &r.store.state
+
+	i, err := s.watchedSection(update.Section)
+	if err != nil {
+		return err
+	}
+
+	// checked before anything changes, so a failure leaves the section as it was
+	for _, job := range jobs {
+		if _, err := encodeJobPayload(job); err != nil {
+			return err
+		}
+	}
+
+	remove := make(map[string]bool)
+	for _, watcher := range update.Remove {
+		remove[watcher.ContactKey()] = true
+	}
+	s.removeWatchers(i, func(w memoryWatcher) bool { return remove[w.Watcher.ContactKey()] })
+
+	// watchers keep their place in the queue
+	for _, watcher := range update.Update {
+		for j, existing := range s.Sections[i].Watchers {
+			if existing.Watcher.ContactKey() == watcher.ContactKey() {
+				watcher.Position = existing.Position
+				s.Sections[i].Watchers[j] = newMemoryWatcher(watcher)
+			}
+		}
+	}
+	s.prune()
+
+	return s.enqueue(time.Now(), jobs...)
+}
+
+func (r MemoryRepository) AddWatchGroup(ctx context.Context, group coursesense.WatchGroup) (bool, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	s := &r.store.state
+
+	for _, stored := range s.Groups {
+		if stored.group().SameWatch(group) {
+			log.Debug().Msg("watch group already exists in memory")
+			return false, nil
+		}
+	}
+
+	// like the databases, only the codes are kept and each is kept once
+	s.Groups = append(s.Groups, memoryGroup{ID: next(&s.LastGroupID), Course: group.Course, Term: group.Term, Sections: group.SectionCodes(), Watcher: newMemoryWatcher(group.Watcher)})
+	return true, nil
+}
+
+func (g memoryGroup) group() coursesense.WatchGroup {
+	group := coursesense.WatchGroup{ID: strconv.Itoa(g.ID), Course: g.Course, Term: g.Term, Watcher: g.Watcher.watcher()}
+	for _, code := range g.Sections {
+		group.Sections = append(group.Sections, coursesense.Section{Course: g.Course, Code: code, Term: g.Term})
+	}
+
+	return group
+}
+
+func (r MemoryRepository) GetWatchGroups(ctx context.Context) ([]coursesense.WatchGroup, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	var groups []coursesense.WatchGroup
+	for _, stored := range r.store.state.Groups {
+		groups = append(groups, stored.group())
+	}
+
+	log.Info().Int("count", len(groups)).Msg("retrieved watch groups")
+
+	return groups, nil
+}
+
+func (r MemoryRepository) UpdateWatchGroup(ctx context.Context, group coursesense.WatchGroup, jobs ...coursesense.Job) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	s := &r.store.state
+
+	for _, job := range jobs {
+		if _, err := encodeJobPayload(job); err != nil {
+			return err
+		}
+	}
+
+	for i := range s.Groups {
+		if strconv.Itoa(s.Groups[i].ID) == group.ID {
+			s.Groups[i].Watcher = newMemoryWatcher(group.Watcher)
+		}
+	}
+
+	return s.enqueue(time.Now(), jobs...)
+}
+
+func (r MemoryRepository) RemoveWatchGroup(ctx context.Context, id string, jobs ...coursesense.Job) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	s := &r.store.state
+
+	for _, job := range jobs {
+		if _, err := encodeJobPayload(job); err != nil {
+			return err
+		}
+	}
+
+	var groups []memoryGroup
+	for _, group := range s.Groups {
+		if strconv.Itoa(group.ID) != id {
+			groups = append(groups, group)
+		}
+	}
+	s.Groups = groups
+
+	return s.enqueue(time.Now(), jobs...)
+}
+
+func (j memoryJob) job() (coursesense.Job, error) {
+	job := coursesense.Job{
+		ID:            strconv.Itoa(j.ID),
+		Notifier:      j.Notifier,
+		Status:        j.Status,
+		Attempts:      j.Attempts,
+		NextAttemptAt: j.NextAttemptAt,
+		LastError:     j.LastError,
+		CreatedAt:     j.CreatedAt,
+	}
+	if err := decodeJobPayload(j.Payload, &job); err != nil {
+		return coursesense.Job{}, err
+	}
+
+	return job, nil
+}
+
+func (r MemoryRepository) ClaimJobs(ctx context.Context, now time.Time, limit int, lease time.Duration) ([]coursesense.Job, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	s := &r.store.state
+
+	var due []int
+	for i, job := range s.Jobs {
+		if job.Status == coursesense.JobPending && !job.NextAttemptAt.After(now) {
+			due = append(due, i)
+		}
+	}
+	sort.SliceStable(due, func(a, b int) bool {
+		return s.Jobs[due[a]].NextAttemptAt.Before(s.Jobs[due[b]].NextAttemptAt)
+	})
+	if len(due) > limit {
+		due = due[:limit]
+	}
+
+	var jobs []coursesense.Job
+	for _, i := range due {
+		s.Jobs[i].NextAttemptAt = now.Add(lease)
+
+		job, err := s.Jobs[i].job()
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+
+	return jobs, nil
+}
+
+func (r MemoryRepository) UpdateJob(ctx context.Context, job coursesense.Job) error {
+	payload, err := encodeJobPayload(job)
+	if err != nil {
+		return err
+	}
+
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	s := &r.store.state
+
+	for i := range s.Jobs {
+		if strconv.Itoa(s.Jobs[i].ID) == job.ID {
+			stored := &s.Jobs[i]
+			stored.Notifier = job.Notifier
+			stored.Payload = payload
+			stored.Status = job.Status
+			stored.Attempts = job.Attempts
+			stored.NextAttemptAt = job.NextAttemptAt
+			stored.LastError = job.LastError
+		}
+	}
+
+	return nil
+}
+
+func (r MemoryRepository) CompleteJob(ctx context.Context, id string) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	s := &r.store.state
+
+	var jobs []memoryJob
+	for _, job := range s.Jobs {
+		if strconv.Itoa(job.ID) != id {
+			jobs = append(jobs, job)
+		}
+	}
+	s.Jobs = jobs
+
+	return nil
+}
+
+func (r MemoryRepository) GetJob(ctx context.Context, id string) (coursesense.Job, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	for _, job := range r.store.state.Jobs {
+		if strconv.Itoa(job.ID) == id {
+			return job.job()
+		}
+	}
+
+	return coursesense.Job{}, fmt.Errorf("job %s not found", id)
+}
+
+func (r MemoryRepository) GetJobs(ctx context.Context, status coursesense.JobStatus) ([]coursesense.Job, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	var jobs []coursesense.Job
+	for _, stored := range r.store.state.Jobs {
+		if stored.Status != status {
+			continue
+		}
+
+		job, err := stored.job()
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+
+	// jobs are stored in id order, so ties keep it
+	sort.SliceStable(jobs, func(a, b int) bool { return jobs[a].CreatedAt.Before(jobs[b].CreatedAt) })
+
+	return jobs, nil
+}
+
+func (d memoryDigest) digest() (coursesense.Digest, error) {
+	digest := coursesense.Digest{ID: strconv.Itoa(d.ID), FlushAt: d.FlushAt}
+	if err := decodeDigestPayload(d.Payload, &digest); err != nil {
+		return coursesense.Digest{}, err
+	}
+
+	return digest, nil
+}
+
+func (r MemoryRepository) AddToDigest(ctx context.Context, digest coursesense.Digest) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	s := &r.store.state
+
+	key := digest.Watcher.ContactKey()
+	for i := range s.Digests {
+		if s.Digests[i].ContactKey != key {
+			continue
+		}
+
+		existing, err := s.Digests[i].digest()
+		if err != nil {
+			return err
+		}
+
+		merged := mergeDigest(existing, digest)
+		payload, err := encodeDigestPayload(merged)
+		if err != nil {
+			return err
+		}
+
+		s.Digests[i].Payload = payload
+		s.Digests[i].FlushAt = merged.FlushAt
+		return nil
+	}
+
+	payload, err := encodeDigestPayload(digest)
+	if err != nil {
+		return err
+	}
+
+	s.Digests = append(s.Digests, memoryDigest{ID: next(&s.LastDigestID), ContactKey: key, Payload: payload, FlushAt: digest.FlushAt})
+	return nil
+}
+
+func (r MemoryRepository) GetDueDigests(ctx context.Context, now time.Time) ([]coursesense.Digest, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	var digests []coursesense.Digest
+	for _, stored := range r.store.state.Digests {
+		if stored.FlushAt.After(now) {
+			continue
+		}
+
+		digest, err := stored.digest()
+		if err != nil {
+			return nil, err
+		}
+		digests = append(digests, digest)
+	}
+
+	sort.SliceStable(digests, func(a, b int) bool { return digests[a].FlushAt.Before(digests[b].FlushAt) })
+
+	return digests, nil
+}
+
+func (r MemoryRepository) FlushDigest(ctx context.Context, digest coursesense.Digest, jobs ...coursesense.Job) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	s := &r.store.state
+
+	for _, job := range jobs {
+		if _, err := encodeJobPayload(job); err != nil {
+			return err
+		}
+	}
+
+	var digests []memoryDigest
+	for _, stored := range s.Digests {
+		if strconv.Itoa(stored.ID) != digest.ID {
+			digests = append(digests, stored)
+		}
+	}
+	s.Digests = digests
+
+	return s.enqueue(time.Now(), jobs...)
+}
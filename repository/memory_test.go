@@ -0,0 +1,100 @@
+package repository
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	coursesense "github.com/jacobmichels/Course-Sense-Go"
+	"github.com/jacobmichels/Course-Sense-Go/config"
+)
+
+func TestMemorySnapshotRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	cfg := config.Memory{SnapshotFile: filepath.Join(t.TempDir(), "snapshot.json")}
+	now := time.Now().Truncate(time.Second)
+
+	repo, err := newMemoryRepository(cfg)
+	if err != nil {
+		t.Fatalf("failed to create repository: %v", err)
+	}
+
+	pending := emailWatcher("pending@example.com")
+	pending.VerifyBy = now.Add(time.Hour)
+	held := emailWatcher("held@example.com")
+	held.Held = true
+	addWatcher(t, repo, first, emailWatcher("a@example.com"))
+	addWatcher(t, repo, first, pending)
+	addWatcher(t, repo, first, held)
+	if _, err := repo.AddWatchGroup(ctx, coursesense.WatchGroup{Course: course, Term: "F23", Sections: []coursesense.Section{first, second}, Watcher: emailWatcher("group@example.com")}); err != nil {
+		t.Fatalf("failed to add group: %v", err)
+	}
+	job := coursesense.Job{Notifier: "email", Notification: seatNotification(first), Watchers: []coursesense.Watcher{emailWatcher("a@example.com")}}
+	if err := repo.SettleSection(ctx, coursesense.SectionUpdate{Section: first, Remove: job.Watchers}, job); err != nil {
+		t.Fatalf("failed to settle section: %v", err)
+	}
+	if err := repo.AddToDigest(ctx, coursesense.Digest{Watcher: emailWatcher("digest@example.com"), Notification: seatNotification(second), FlushAt: now}); err != nil {
+		t.Fatalf("failed to add to digest: %v", err)
+	}
+
+	if err := repo.Close(); err != nil {
+		t.Fatalf("failed to write snapshot: %v", err)
+	}
+	restored, err := newMemoryRepository(cfg)
+	if err != nil {
+		t.Fatalf("failed to restore snapshot: %v", err)
+	}
+
+	watchers, err := restored.GetWatchers(ctx, first)
+	if err != nil {
+		t.Fatalf("failed to get watchers: %v", err)
+	}
+	if len(watchers) != 2 || watchers[0].Position != 2 || !watchers[0].VerifyBy.Equal(pending.VerifyBy) || watchers[1].Position != 3 || !watchers[1].Held {
+		t.Fatalf("got watchers %+v, want the pending and held watchers with their places in the queue", watchers)
+	}
+
+	groups, err := restored.GetWatchGroups(ctx)
+	if err != nil || len(groups) != 1 || len(groups[0].Sections) != 2 {
+		t.Fatalf("got groups %v, %v, want the group", groups, err)
+	}
+
+	jobs, err := restored.GetJobs(ctx, coursesense.JobPending)
+	if err != nil || len(jobs) != 1 || jobs[0].Watchers[0].ContactKey() != "email:a@example.com" {
+		t.Fatalf("got jobs %v, %v, want the queued job", jobs, err)
+	}
+
+	digests, err := restored.GetDueDigests(ctx, now)
+	if err != nil || len(digests) != 1 || digests[0].Watcher.ContactKey() != "email:digest@example.com" {
+		t.Fatalf("got digests %v, %v, want the digest", digests, err)
+	}
+
+	// ids carry on from the snapshot rather than starting over
+	if err := restored.SettleSection(ctx, coursesense.SectionUpdate{Section: first}, job); err != nil {
+		t.Fatalf("failed to settle section: %v", err)
+	}
+	jobs, err = restored.GetJobs(ctx, coursesense.JobPending)
+	if err != nil || len(jobs) != 2 || jobs[0].ID == jobs[1].ID {
+		t.Fatalf("got jobs %v, %v, want a new id for the new job", jobs, err)
+	}
+}
+
+func TestMemoryWithoutSnapshot(t *testing.T) {
+	// a missing snapshot file starts the repository empty
+	repo, err := newMemoryRepository(config.Memory{SnapshotFile: filepath.Join(t.TempDir(), "missing.json")})
+	if err != nil {
+		t.Fatalf("failed to create repository: %v", err)
+	}
+	if sections, err := repo.GetWatchedSections(context.Background()); err != nil || len(sections) != 0 {
+		t.Fatalf("got sections %v, %v, want none", sections, err)
+	}
+
+	// and nothing is written without a file configured
+	repo, err = newMemoryRepository(config.Memory{})
+	if err != nil {
+		t.Fatalf("failed to create repository: %v", err)
+	}
+	if err := repo.Close(); err != nil {
+		t.Fatalf("failed to close: %v", err)
+	}
+}
@@ -0,0 +1,815 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database/postgres"
+	_ "github.com/golang-migrate/migrate/v4/source/file"
+	coursesense "github.com/jacobmichels/Course-Sense-Go"
+	"github.com/jacobmichels/Course-Sense-Go/config"
+	_ "github.com/lib/pq"
+)
+
+var _ coursesense.Repository = PostgresRepository{}
+
+// Shares its schema with sqlite. Several instances may use the same database, jobs are claimed with row locks
+type PostgresRepository struct {
+	db  *sql.DB
+	cfg config.Postgres
+}
+
+// channels are kept in insertion order by their serial id
+var (
+	pgWatcherChannels = channelTable{"watcher_channels", "watcher_id", "id"}
+	pgGroupChannels   = channelTable{"watch_group_channels", "group_id", "id"}
+)
+
+// creates a new repository backed by postgres
+// returns an error if the connection cannot be established or if a ping fails
+func newPostgresRepository(ctx context.Context, cfg config.Postgres) (PostgresRepository, error) {
+	db, err := sql.Open("postgres", cfg.ConnectionString)
+	if err != nil {
+		return PostgresRepository{}, fmt.Errorf("failed to open connection to postgres: %w", err)
+	}
+
+	if err = db.PingContext(ctx); err != nil {
+		return PostgresRepository{}, fmt.Errorf("failed to ping db: %w", err)
+	}
+
+	log.Info().Msg("connected to postgres")
+
+	driver, err := postgres.WithInstance(db, &postgres.Config{})
+	if err != nil {
+		return PostgresRepository{}, fmt.Errorf("failed to create migration driver: %w", err)
+	}
+
+	m, err := migrate.NewWithDatabaseInstance("file://migrations/postgres", "postgres", driver)
+	if err != nil {
+		return PostgresRepository{}, fmt.Errorf("failed to create migration: %w", err)
+	}
+
+	if err = m.Up(); err != nil {
+		if errors.Is(err, migrate.ErrNoChange) {
+			log.Info().Msg("database already fully migrated")
+			return PostgresRepository{db, cfg}, nil
+		}
+		return PostgresRepository{}, fmt.Errorf("failed to execute migrations: %w", err)
+	}
+
+	log.Info().Msg("database migrated")
+	return PostgresRepository{db, cfg}, nil
+}
+
+func (r PostgresRepository) AddWatcher(ctx context.Context, section coursesense.Section, watcher coursesense.Watcher) (bool, error) {
+	txCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	tx, err := r.db.BeginTx(txCtx, &sql.TxOptions{})
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	// the upserts return the existing row's id on conflict. Updating the section locks it until the commit,
+	// so concurrent registrations on a section take queue positions one after the other
+	var course_id int
+	err = tx.QueryRowContext(txCtx, "INSERT INTO courses (code, department) VALUES ($1, $2) ON CONFLICT (code, department) DO UPDATE SET code=EXCLUDED.code RETURNING id", section.Course.Code, section.Course.Department).Scan(&course_id)
+	if err != nil {
+		return false, fmt.Errorf("failed to persist course: %w", err)
+	}
+
+	var section_id int
+	err = tx.QueryRowContext(txCtx, "INSERT INTO sections (code, term, course_id) VALUES ($1, $2, $3) ON CONFLICT (code, term, course_id) DO UPDATE SET code=EXCLUDED.code RETURNING id", section.Code, section.Term, course_id).Scan(&section_id)
+	if err != nil {
+		return false, fmt.Errorf("failed to persist section: %w", err)
+	}
+
+	row, err := newSQLWatcher(watcher)
+	if err != nil {
+		return false, err
+	}
+
+	// new watchers join the back of the section's queue
+	var watcher_id int
+	args := append([]any{section_id}, row.values()...)
+	err = tx.QueryRowContext(txCtx, "INSERT INTO watchers (section_id, position, "+watcherColumns+") VALUES ($1, (SELECT COALESCE(MAX(position), 0) + 1 FROM watchers WHERE section_id=$1), "+watcherPlaceholders(1)+") ON CONFLICT (contact_key, section_id) DO NOTHING RETURNING id", args...).Scan(&watcher_id)
+	if errors.Is(err, sql.ErrNoRows) {
+		log.Debug().Msg("watcher already exists in db")
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("failed to persist watcher: %w", err)
+	}
+
+	if err := pgWatcherChannels.set(txCtx, tx, watcher_id, watcher.Channels); err != nil {
+		return false, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return true, nil
+}
+
+func (r PostgresRepository) GetWatchedSections(ctx context.Context) ([]coursesense.Section, error) {
+	rows, err := r.db.QueryContext(ctx, "SELECT courses.code, courses.department, sections.code, sections.term FROM sections JOIN courses ON sections.course_id=courses.id")
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch sections from the db: %w", err)
+	}
+	defer rows.Close()
+
+	var sections []coursesense.Section
+	for rows.Next() {
+		var section coursesense.Section
+		if err := rows.Scan(&section.Course.Code, &section.Course.Department, &section.Code, &section.Term); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+
+		sections = append(sections, section)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate rows: %w", err)
+	}
+
+	log.Info().Int("count", len(sections)).Msg("retrieved watched sections")
+
+	return sections, nil
+}
+
+func (r PostgresRepository) GetWatchers(ctx context.Context, section coursesense.Section) ([]coursesense.Watcher, error) {
+	section_id, err := getSectionID(ctx, r.db, section)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get section_id from db: %w", err)
+	}
+
+	channels, err := pgWatcherChannels.get(ctx, r.db, "SELECT id FROM watchers WHERE section_id=$1", section_id)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := r.db.QueryContext(ctx, "SELECT id, position, "+watcherColumns+" FROM watchers WHERE section_id=$1 ORDER BY position", section_id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch relevant watchers from db: %w", err)
+	}
+	defer rows.Close()
+
+	var watchers []coursesense.Watcher
+	for rows.Next() {
+		var watcher sqlWatcher
+		var watcher_id, position int
+		if err := rows.Scan(append([]any{&watcher_id, &position}, watcher.fields()...)...); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+
+		result, err := watcher.watcher(channels[watcher_id])
+		if err != nil {
+			return nil, err
+		}
+		result.Position = position
+
+		watchers = append(watchers, result)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate rows: %w", err)
+	}
+
+	log.Info().Int("count", len(watchers)).Msg("retrieved watchers for section")
+
+	return watchers, nil
+}
+
+func (r PostgresRepository) Cleanup(ctx context.Context, section coursesense.Section) error {
+	txCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	tx, err := r.db.BeginTx(txCtx, &sql.TxOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	section_id, err := getSectionID(txCtx, tx, section)
+	if err != nil {
+		return fmt.Errorf("failed to get section_id from db: %w", err)
+	}
+
+	if err := deleteWatchers(txCtx, tx, pgWatcherChannels, "section_id=$1", section_id); err != nil {
+		return err
+	}
+
+	// with no watchers left the section is removed, and its course if no other sections reference it
+	if err := pruneSection(txCtx, tx, section_id); err != nil {
+		return fmt.Errorf("failed to prune section: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+func (r PostgresRepository) PurgeExpired(ctx context.Context, now time.Time, notices func(coursesense.Watch) []coursesense.Job) ([]coursesense.Watch, error) {
+	txCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	tx, err := r.db.BeginTx(txCtx, &sql.TxOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	// the expired watchers stay locked until they are deleted, so another instance purging at the same time can't return them too
+	rows, err := tx.QueryContext(txCtx, "SELECT watchers.id, sections.id, sections.code, sections.term, courses.code, courses.department, "+watcherColumns+" FROM watchers JOIN sections ON watchers.section_id=sections.id JOIN courses ON sections.course_id=courses.id WHERE watchers.expires_at IS NOT NULL AND watchers.expires_at<=$1 FOR UPDATE OF watchers", now.Unix())
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch expired watchers from the db: %w", err)
+	}
+
+	var watches []coursesense.Watch
+	var rowsRead []sqlWatcher
+	var watcher_ids []int
+	section_ids := make(map[int]struct{})
+
+	defer rows.Close()
+	for rows.Next() {
+		var watch coursesense.Watch
+		var watcher sqlWatcher
+		var watcher_id, section_id int
+
+		dest := append([]any{&watcher_id, &section_id, &watch.Section.Code, &watch.Section.Term, &watch.Section.Course.Code, &watch.Section.Course.Department}, watcher.fields()...)
+		if err := rows.Scan(dest...); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+
+		watches = append(watches, watch)
+		rowsRead = append(rowsRead, watcher)
+		watcher_ids = append(watcher_ids, watcher_id)
+		section_ids[section_id] = struct{}{}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate rows: %w", err)
+	}
+	rows.Close()
+
+	channels, err := pgWatcherChannels.get(txCtx, tx, "SELECT id FROM watchers WHERE expires_at IS NOT NULL AND expires_at<=$1", now.Unix())
+	if err != nil {
+		return nil, err
+	}
+
+	for i, watcher_id := range watcher_ids {
+		if watches[i].Watcher, err = rowsRead[i].watcher(channels[watcher_id]); err != nil {
+			return nil, err
+		}
+
+		if err := deleteWatchers(txCtx, tx, pgWatcherChannels, "id=$1", watcher_id); err != nil {
+			return nil, err
+		}
+	}
+
+	for section_id := range section_ids {
+		if err := pruneSection(txCtx, tx, section_id); err != nil {
+			return nil, fmt.Errorf("failed to prune section: %w", err)
+		}
+	}
+
+	if notices != nil {
+		for _, watch := range watches {
+			if err := enqueueJobs(txCtx, tx, now, notices(watch)...); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return watches, nil
+}
+
+func (r PostgresRepository) PurgeUnverified(ctx context.Context, now time.Time) (int, error) {
+	txCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	tx, err := r.db.BeginTx(txCtx, &sql.TxOptions{})
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	if err := pgWatcherChannels.remove(txCtx, tx, "SELECT id FROM watchers WHERE verify_by IS NOT NULL AND verify_by<=$1", now.Unix()); err != nil {
+		return 0, err
+	}
+
+	rows, err := tx.QueryContext(txCtx, "DELETE FROM watchers WHERE verify_by IS NOT NULL AND verify_by<=$1 RETURNING section_id", now.Unix())
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete unverified watchers: %w", err)
+	}
+
+	watchers := 0
+	section_ids := make(map[int]struct{})
+	defer rows.Close()
+	for rows.Next() {
+		var section_id int
+		if err := rows.Scan(&section_id); err != nil {
+			return 0, fmt.Errorf("failed to scan row: %w", err)
+		}
+
+		watchers++
+		section_ids[section_id] = struct{}{}
+	}
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("failed to iterate rows: %w", err)
+	}
+	rows.Close()
+
+	for section_id := range section_ids {
+		if err := pruneSection(txCtx, tx, section_id); err != nil {
+			return 0, fmt.Errorf("failed to prune section: %w", err)
+		}
+	}
+
+	unverifiedGroups := "SELECT id FROM watch_groups WHERE verify_by IS NOT NULL AND verify_by<=$1"
+	if err := pgGroupChannels.remove(txCtx, tx, unverifiedGroups, now.Unix()); err != nil {
+		return 0, err
+	}
+
+	if _, err := tx.ExecContext(txCtx, "DELETE FROM watch_group_sections WHERE group_id IN ("+unverifiedGroups+")", now.Unix()); err != nil {
+		return 0, fmt.Errorf("failed to delete unverified group sections: %w", err)
+	}
+
+	res, err := tx.ExecContext(txCtx, "DELETE FROM watch_groups WHERE verify_by IS NOT NULL AND verify_by<=$1", now.Unix())
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete unverified watch groups: %w", err)
+	}
+
+	groups, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to count deleted watch groups: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return watchers + int(groups), nil
+}
+
+func (r PostgresRepository) RemoveWatcher(ctx context.Context, section coursesense.Section, watcher coursesense.Watcher) error {
+	return r.SettleSection(ctx, coursesense.SectionUpdate{Section: section, Remove: []coursesense.Watcher{watcher}})
+}
+
+func (r PostgresRepository) UpdateWatcher(ctx context.Context, section coursesense.Section, watcher coursesense.Watcher) error {
+	txCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	tx, err := r.db.BeginTx(txCtx, &sql.TxOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	section_id, err := getSectionID(txCtx, tx, section)
+	if err != nil {
+		return fmt.Errorf("failed to get section_id from db: %w", err)
+	}
+
+	if err := updateWatcher(txCtx, tx, pgWatcherChannels, section_id, watcher); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+func (r PostgresRepository) SettleSection(ctx context.Context, update coursesense.SectionUpdate, jobs ...coursesense.Job) error {
+	txCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	tx, err := r.db.BeginTx(txCtx, &sql.TxOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	section_id, err := getSectionID(txCtx, tx, update.Section)
+	if err != nil {
+		return fmt.Errorf("failed to get section_id from db: %w", err)
+	}
+
+	for _, watcher := range update.Remove {
+		if err := deleteWatchers(txCtx, tx, pgWatcherChannels, "section_id=$1 AND contact_key=$2", section_id, watcher.ContactKey()); err != nil {
+			return err
+		}
+	}
+
+	for _, watcher := range update.Update {
+		if err := updateWatcher(txCtx, tx, pgWatcherChannels, section_id, watcher); err != nil {
+			return err
+		}
+	}
+
+	if err := pruneSection(txCtx, tx, section_id); err != nil {
+		return fmt.Errorf("failed to prune section: %w", err)
+	}
+
+	if err := enqueueJobs(txCtx, tx, time.Now(), jobs...); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+func (r PostgresRepository) AddWatchGroup(ctx context.Context, group coursesense.WatchGroup) (bool, error) {
+	txCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	tx, err := r.db.BeginTx(txCtx, &sql.TxOptions{})
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	// no row can be locked for a group that doesn't exist yet, so registrations of one contact take turns instead
+	if _, err := tx.ExecContext(txCtx, "SELECT pg_advisory_xact_lock(hashtext($1))", group.Watcher.ContactKey()); err != nil {
+		return false, fmt.Errorf("failed to lock contact: %w", err)
+	}
+
+	exists, err := watchGroupExists(txCtx, tx, group)
+	if err != nil {
+		return false, err
+	}
+	if exists {
+		log.Debug().Msg("watch group already exists in db")
+		return false, nil
+	}
+
+	row, err := newSQLWatcher(group.Watcher)
+	if err != nil {
+		return false, err
+	}
+
+	var group_id int
+	args := append([]any{group.Course.Department, group.Course.Code, group.Term}, row.values()...)
+	err = tx.QueryRowContext(txCtx, "INSERT INTO watch_groups (department, course_code, term, "+watcherColumns+") VALUES ($1, $2, $3, "+watcherPlaceholders(3)+") RETURNING id", args...).Scan(&group_id)
+	if err != nil {
+		return false, fmt.Errorf("insert statement failed: %w", err)
+	}
+
+	for _, section := range group.Sections {
+		_, err := tx.ExecContext(txCtx, "INSERT INTO watch_group_sections (group_id, code) VALUES ($1, $2) ON CONFLICT DO NOTHING", group_id, section.Code)
+		if err != nil {
+			return false, fmt.Errorf("failed to insert group section: %w", err)
+		}
+	}
+
+	if err := pgGroupChannels.set(txCtx, tx, group_id, group.Watcher.Channels); err != nil {
+		return false, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return true, nil
+}
+
+func (r PostgresRepository) GetWatchGroups(ctx context.Context) ([]coursesense.WatchGroup, error) {
+	channels, err := pgGroupChannels.get(ctx, r.db, "SELECT id FROM watch_groups")
+	if err != nil {
+		return nil, err
+	}
+
+	// whole course watches have no section rows, hence the left join
+	rows, err := r.db.QueryContext(ctx, "SELECT watch_groups.id, watch_groups.department, watch_groups.course_code, watch_groups.term, watch_group_sections.code, "+watcherColumns+" FROM watch_groups LEFT JOIN watch_group_sections ON watch_groups.id=watch_group_sections.group_id ORDER BY watch_groups.id, watch_group_sections.code")
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch watch groups from the db: %w", err)
+	}
+	defer rows.Close()
+
+	var groups []coursesense.WatchGroup
+	for rows.Next() {
+		var group_id int
+		var course coursesense.Course
+		var term string
+		var code sql.NullString
+		var watcher sqlWatcher
+
+		dest := append([]any{&group_id, &course.Department, &course.Code, &term, &code}, watcher.fields()...)
+		if err := rows.Scan(dest...); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+
+		// rows are ordered by group, so each new id starts a new group
+		id := strconv.Itoa(group_id)
+		if len(groups) == 0 || groups[len(groups)-1].ID != id {
+			result, err := watcher.watcher(channels[group_id])
+			if err != nil {
+				return nil, err
+			}
+
+			groups = append(groups, coursesense.WatchGroup{ID: id, Course: course, Term: term, Watcher: result})
+		}
+
+		if code.Valid {
+			section := coursesense.Section{Course: course, Code: code.String, Term: term}
+			groups[len(groups)-1].Sections = append(groups[len(groups)-1].Sections, section)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate rows: %w", err)
+	}
+
+	log.Info().Int("count", len(groups)).Msg("retrieved watch groups")
+
+	return groups, nil
+}
+
+func (r PostgresRepository) UpdateWatchGroup(ctx context.Context, group coursesense.WatchGroup, jobs ...coursesense.Job) error {
+	id, err := strconv.Atoi(group.ID)
+	if err != nil {
+		return fmt.Errorf("bad watch group id %q: %w", group.ID, err)
+	}
+
+	txCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	tx, err := r.db.BeginTx(txCtx, &sql.TxOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	row, err := newSQLWatcher(group.Watcher)
+	if err != nil {
+		return err
+	}
+
+	args := append([]any{id}, row.values()...)
+	if _, err = tx.ExecContext(txCtx, "UPDATE watch_groups SET "+watcherAssignments(1)+" WHERE id=$1", args...); err != nil {
+		return fmt.Errorf("failed to update watch group: %w", err)
+	}
+
+	if err := pgGroupChannels.set(txCtx, tx, id, group.Watcher.Channels); err != nil {
+		return err
+	}
+
+	if err := enqueueJobs(txCtx, tx, time.Now(), jobs...); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+func (r PostgresRepository) RemoveWatchGroup(ctx context.Context, id string, jobs ...coursesense.Job) error {
+	group_id, err := strconv.Atoi(id)
+	if err != nil {
+		return fmt.Errorf("bad watch group id %q: %w", id, err)
+	}
+
+	txCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	tx, err := r.db.BeginTx(txCtx, &sql.TxOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	if err := pgGroupChannels.remove(txCtx, tx, "$1", group_id); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(txCtx, "DELETE FROM watch_group_sections WHERE group_id=$1", group_id); err != nil {
+		return fmt.Errorf("failed to delete group sections: %w", err)
+	}
+
+	if _, err := tx.ExecContext(txCtx, "DELETE FROM watch_groups WHERE id=$1", group_id); err != nil {
+		return fmt.Errorf("failed to delete watch group: %w", err)
+	}
+
+	if err := enqueueJobs(txCtx, tx, time.Now(), jobs...); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+func (r PostgresRepository) ClaimJobs(ctx context.Context, now time.Time, limit int, lease time.Duration) ([]coursesense.Job, error) {
+	txCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	tx, err := r.db.BeginTx(txCtx, &sql.TxOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	// jobs being claimed by another instance are skipped rather than waited on
+	rows, err := tx.QueryContext(txCtx, "SELECT "+jobColumns+" FROM jobs WHERE status=$1 AND next_attempt_at<=$2 ORDER BY next_attempt_at, id LIMIT $3 FOR UPDATE SKIP LOCKED", coursesense.JobPending, now.Unix(), limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch due jobs from the db: %w", err)
+	}
+
+	var jobs []coursesense.Job
+	defer rows.Close()
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+
+		jobs = append(jobs, job)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate rows: %w", err)
+	}
+	rows.Close()
+
+	leasedUntil := now.Add(lease)
+	for i := range jobs {
+		if _, err := tx.ExecContext(txCtx, "UPDATE jobs SET next_attempt_at=$1 WHERE id=$2", leasedUntil.Unix(), jobs[i].ID); err != nil {
+			return nil, fmt.Errorf("failed to lease job: %w", err)
+		}
+		jobs[i].NextAttemptAt = leasedUntil
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return jobs, nil
+}
+
+func (r PostgresRepository) UpdateJob(ctx context.Context, job coursesense.Job) error {
+	payload, err := encodeJobPayload(job)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.db.ExecContext(ctx, "UPDATE jobs SET notifier=$1, payload=$2, status=$3, attempts=$4, next_attempt_at=$5, last_error=$6 WHERE id=$7", job.Notifier, payload, job.Status, job.Attempts, job.NextAttemptAt.Unix(), job.LastError, job.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update job: %w", err)
+	}
+
+	return nil
+}
+
+func (r PostgresRepository) CompleteJob(ctx context.Context, id string) error {
+	if _, err := r.db.ExecContext(ctx, "DELETE FROM jobs WHERE id=$1", id); err != nil {
+		return fmt.Errorf("failed to delete job: %w", err)
+	}
+
+	return nil
+}
+
+func (r PostgresRepository) GetJob(ctx context.Context, id string) (coursesense.Job, error) {
+	job, err := scanJob(r.db.QueryRowContext(ctx, "SELECT "+jobColumns+" FROM jobs WHERE id=$1", id))
+	if err != nil {
+		return coursesense.Job{}, fmt.Errorf("failed to fetch job from the db: %w", err)
+	}
+
+	return job, nil
+}
+
+func (r PostgresRepository) GetJobs(ctx context.Context, status coursesense.JobStatus) ([]coursesense.Job, error) {
+	rows, err := r.db.QueryContext(ctx, "SELECT "+jobColumns+" FROM jobs WHERE status=$1 ORDER BY created_at, id", status)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch jobs from the db: %w", err)
+	}
+	defer rows.Close()
+
+	var jobs []coursesense.Job
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+
+		jobs = append(jobs, job)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate rows: %w", err)
+	}
+
+	return jobs, nil
+}
+
+func (r PostgresRepository) AddToDigest(ctx context.Context, digest coursesense.Digest) error {
+	txCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	tx, err := r.db.BeginTx(txCtx, &sql.TxOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	key := digest.Watcher.ContactKey()
+	for {
+		payload, err := encodeDigestPayload(digest)
+		if err != nil {
+			return err
+		}
+
+		// a new digest is inserted as it is. FOR UPDATE locks nothing when the row is missing, so two openings
+		// reaching a watcher at once could otherwise both insert and the second would overwrite the first
+		result, err := tx.ExecContext(txCtx, "INSERT INTO digests (contact_key, payload, flush_at) VALUES ($1, $2, $3) ON CONFLICT (contact_key) DO NOTHING", key, payload, digest.FlushAt.Unix())
+		if err != nil {
+			return fmt.Errorf("failed to persist digest: %w", err)
+		}
+		inserted, err := result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("failed to check for an existing digest: %w", err)
+		}
+		if inserted > 0 {
+			break
+		}
+
+		// the existing digest stays locked until the merged one replaces it
+		existing, err := scanDigest(tx.QueryRowContext(txCtx, "SELECT "+digestColumns+" FROM digests WHERE contact_key=$1 FOR UPDATE", key))
+		if errors.Is(err, sql.ErrNoRows) {
+			// flushed in the meantime, the digest starts over
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to fetch digest from the db: %w", err)
+		}
+
+		merged := mergeDigest(existing, digest)
+		payload, err = encodeDigestPayload(merged)
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.ExecContext(txCtx, "UPDATE digests SET payload=$1, flush_at=$2 WHERE contact_key=$3", payload, merged.FlushAt.Unix(), key); err != nil {
+			return fmt.Errorf("failed to persist digest: %w", err)
+		}
+		break
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+func (r PostgresRepository) GetDueDigests(ctx context.Context, now time.Time) ([]coursesense.Digest, error) {
+	rows, err := r.db.QueryContext(ctx, "SELECT "+digestColumns+" FROM digests WHERE flush_at<=$1 ORDER BY flush_at, id", now.Unix())
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch due digests from the db: %w", err)
+	}
+	defer rows.Close()
+
+	var digests []coursesense.Digest
+	for rows.Next() {
+		digest, err := scanDigest(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+
+		digests = append(digests, digest)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate rows: %w", err)
+	}
+
+	return digests, nil
+}
+
+func (r PostgresRepository) FlushDigest(ctx context.Context, digest coursesense.Digest, jobs ...coursesense.Job) error {
+	txCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	tx, err := r.db.BeginTx(txCtx, &sql.TxOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	if _, err := tx.ExecContext(txCtx, "DELETE FROM digests WHERE id=$1", digest.ID); err != nil {
+		return fmt.Errorf("failed to delete digest: %w", err)
+	}
+
+	if err := enqueueJobs(txCtx, tx, time.Now(), jobs...); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
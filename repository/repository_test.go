@@ -0,0 +1,569 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	coursesense "github.com/jacobmichels/Course-Sense-Go"
+	"github.com/jacobmichels/Course-Sense-Go/config"
+)
+
+var (
+	course = coursesense.Course{Department: "CIS", Code: 2750}
+	first  = coursesense.Section{Course: course, Code: "0101", Term: "F23"}
+	second = coursesense.Section{Course: course, Code: "0102", Term: "F23"}
+)
+
+// migrations are found relative to the working directory, which is the repository root when the service runs
+func TestMain(m *testing.M) {
+	if err := os.Chdir(".."); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to change to the repository root: %v\n", err)
+		os.Exit(1)
+	}
+
+	os.Exit(m.Run())
+}
+
+type backend struct {
+	name string
+	new  func(t *testing.T) coursesense.Repository
+}
+
+// the backends the shared tests run against, postgres only when a database is given
+func backends() []backend {
+	return []backend{
+		{"memory", newTestMemory},
+		{"sqlite", newTestSQLite},
+		{"postgres", func(t *testing.T) coursesense.Repository { return newTestPostgres(t) }},
+	}
+}
+
+// runs the test against an empty repository of every backend
+func forEachBackend(t *testing.T, test func(t *testing.T, repo coursesense.Repository)) {
+	for _, b := range backends() {
+		t.Run(b.name, func(t *testing.T) {
+			test(t, b.new(t))
+		})
+	}
+}
+
+func newTestMemory(t *testing.T) coursesense.Repository {
+	t.Helper()
+
+	repo, err := New(context.Background(), config.Database{Type: "memory"})
+	if err != nil {
+		t.Fatalf("failed to create memory repository: %v", err)
+	}
+
+	return repo
+}
+
+func newTestSQLite(t *testing.T) coursesense.Repository {
+	t.Helper()
+
+	repo, err := New(context.Background(), config.Database{Type: "sqlite", SQLite: config.SQLite{ConnectionString: filepath.Join(t.TempDir(), "coursesense.db")}})
+	if err != nil {
+		t.Fatalf("failed to create sqlite repository: %v", err)
+	}
+
+	return repo
+}
+
+func emailWatcher(address string) coursesense.Watcher {
+	return coursesense.Watcher{Channels: []coursesense.Channel{{Kind: coursesense.ChannelEmail, Address: address}}}
+}
+
+func addWatcher(t *testing.T, repo coursesense.Repository, section coursesense.Section, watcher coursesense.Watcher) {
+	t.Helper()
+
+	if _, err := repo.AddWatcher(context.Background(), section, watcher); err != nil {
+		t.Fatalf("failed to add %s to %s: %v", watcher, section, err)
+	}
+}
+
+// returns the addresses of the section's watchers, in order
+func watcherAddresses(t *testing.T, repo coursesense.Repository, section coursesense.Section) []string {
+	t.Helper()
+
+	watchers, err := repo.GetWatchers(context.Background(), section)
+	if err != nil {
+		t.Fatalf("failed to get watchers of %s: %v", section, err)
+	}
+
+	var addresses []string
+	for _, watcher := range watchers {
+		addresses = append(addresses, watcher.Address(coursesense.ChannelEmail))
+	}
+
+	return addresses
+}
+
+func seatNotification(sections ...coursesense.Section) coursesense.Notification {
+	notification := coursesense.Notification{Kind: coursesense.NotificationSeatsAvailable, Seats: make(map[coursesense.Section]uint)}
+	for _, section := range sections {
+		notification.Sections = append(notification.Sections, section)
+		notification.Seats[section] = 1
+	}
+
+	return notification
+}
+
+func TestAddToDigestMerges(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, repo coursesense.Repository) {
+		ctx := context.Background()
+		now := time.Now().Truncate(time.Second)
+		watcher := emailWatcher("a@example.com")
+
+		if err := repo.AddToDigest(ctx, coursesense.Digest{Watcher: watcher, Notification: seatNotification(first), FlushAt: now.Add(time.Hour)}); err != nil {
+			t.Fatalf("failed to add to digest: %v", err)
+		}
+		if err := repo.AddToDigest(ctx, coursesense.Digest{Watcher: watcher, Notification: seatNotification(second), FlushAt: now.Add(time.Minute)}); err != nil {
+			t.Fatalf("failed to add to digest: %v", err)
+		}
+
+		if digests, err := repo.GetDueDigests(ctx, now); err != nil || len(digests) != 0 {
+			t.Fatalf("got due digests %v, %v before the earlier flush time", digests, err)
+		}
+
+		digests, err := repo.GetDueDigests(ctx, now.Add(time.Minute))
+		if err != nil {
+			t.Fatalf("failed to get due digests: %v", err)
+		}
+		if len(digests) != 1 || len(digests[0].Notification.Sections) != 2 || !digests[0].FlushAt.Equal(now.Add(time.Minute)) {
+			t.Fatalf("got due digests %v, want one with both openings flushed at the earlier time", digests)
+		}
+	})
+}
+
+func TestClaimJobsLeasesThem(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, repo coursesense.Repository) {
+		ctx := context.Background()
+		addWatcher(t, repo, first, emailWatcher("a@example.com"))
+
+		var jobs []coursesense.Job
+		for i := 0; i < 3; i++ {
+			jobs = append(jobs, coursesense.Job{Notifier: "email", Notification: seatNotification(first), Watchers: []coursesense.Watcher{emailWatcher("a@example.com")}})
+		}
+		if err := repo.SettleSection(ctx, coursesense.SectionUpdate{Section: first}, jobs...); err != nil {
+			t.Fatalf("failed to queue jobs: %v", err)
+		}
+
+		now := time.Now().Add(time.Second)
+		claimed, err := repo.ClaimJobs(ctx, now, 2, time.Minute)
+		if err != nil || len(claimed) != 2 {
+			t.Fatalf("got %d jobs, %v, want 2 claimed", len(claimed), err)
+		}
+		claimed, err = repo.ClaimJobs(ctx, now, 2, time.Minute)
+		if err != nil || len(claimed) != 1 {
+			t.Fatalf("got %d jobs, %v, want only the unclaimed job", len(claimed), err)
+		}
+		claimed, err = repo.ClaimJobs(ctx, now.Add(2*time.Minute), 5, time.Minute)
+		if err != nil || len(claimed) != 3 {
+			t.Fatalf("got %d jobs, %v, want all 3 once their leases ran out", len(claimed), err)
+		}
+	})
+}
+
+func TestPurgeExpired(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, repo coursesense.Repository) {
+		ctx := context.Background()
+		now := time.Now().Truncate(time.Second)
+
+		expired := emailWatcher("expired@example.com")
+		expired.ExpiresAt = now.Add(-time.Minute)
+		current := emailWatcher("current@example.com")
+		current.ExpiresAt = now.Add(time.Hour)
+		addWatcher(t, repo, first, expired)
+		addWatcher(t, repo, first, current)
+		addWatcher(t, repo, second, expired)
+
+		notices := func(watch coursesense.Watch) []coursesense.Job {
+			notification := coursesense.Notification{Kind: coursesense.NotificationWatchExpired, Sections: []coursesense.Section{watch.Section}}
+			return []coursesense.Job{{Notifier: "email", Notification: notification, Watchers: []coursesense.Watcher{watch.Watcher}}}
+		}
+		watches, err := repo.PurgeExpired(ctx, now, notices)
+		if err != nil {
+			t.Fatalf("failed to purge expired watches: %v", err)
+		}
+		if len(watches) != 2 {
+			t.Fatalf("got purged watches %v, want both of the expired watcher's", watches)
+		}
+
+		if got := watcherAddresses(t, repo, first); len(got) != 1 || got[0] != "current@example.com" {
+			t.Fatalf("got watchers %v, want the current watcher left", got)
+		}
+		sections, err := repo.GetWatchedSections(ctx)
+		if err != nil || len(sections) != 1 || sections[0] != first {
+			t.Fatalf("got watched sections %v, %v, want the emptied section pruned", sections, err)
+		}
+
+		jobs, err := repo.GetJobs(ctx, coursesense.JobPending)
+		if err != nil || len(jobs) != 2 {
+			t.Fatalf("got %d jobs, %v, want a notice per purged watch", len(jobs), err)
+		}
+	})
+}
+
+func TestPurgeUnverified(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, repo coursesense.Repository) {
+		ctx := context.Background()
+		now := time.Now().Truncate(time.Second)
+
+		lapsed := emailWatcher("lapsed@example.com")
+		lapsed.VerifyBy = now.Add(-time.Minute)
+		pending := emailWatcher("pending@example.com")
+		pending.VerifyBy = now.Add(time.Hour)
+		addWatcher(t, repo, first, lapsed)
+		addWatcher(t, repo, first, pending)
+		addWatcher(t, repo, first, emailWatcher("verified@example.com"))
+
+		purged, err := repo.PurgeUnverified(ctx, now)
+		if err != nil || purged != 1 {
+			t.Fatalf("got %d purged, %v, want the lapsed watcher only", purged, err)
+		}
+
+		got := watcherAddresses(t, repo, first)
+		sort.Strings(got)
+		if len(got) != 2 || got[0] != "pending@example.com" || got[1] != "verified@example.com" {
+			t.Fatalf("got watchers %v, want the pending and verified watchers left", got)
+		}
+	})
+}
+
+func TestAddWatcherDedupesOnContactKey(t *testing.T) {
+	sms := coursesense.Channel{Kind: coursesense.ChannelSMS, Address: "+15195551234"}
+	email := coursesense.Channel{Kind: coursesense.ChannelEmail, Address: "a@example.com"}
+
+	quiet := emailWatcher("a@example.com")
+	quiet.QuietHours = coursesense.QuietHours{Start: "22:00", End: "07:00"}
+
+	tests := []struct {
+		name     string
+		watchers []coursesense.Watcher
+		// whether each watcher was added
+		added []bool
+		// the contact keys of the section's watchers afterwards, in order
+		want []string
+	}{
+		{
+			name:     "same contact twice",
+			watchers: []coursesense.Watcher{emailWatcher("a@example.com"), emailWatcher("a@example.com")},
+			added:    []bool{true, false},
+			want:     []string{"email:a@example.com"},
+		},
+		{
+			name:     "same contact with other settings keeps the first",
+			watchers: []coursesense.Watcher{emailWatcher("a@example.com"), quiet},
+			added:    []bool{true, false},
+			want:     []string{"email:a@example.com"},
+		},
+		{
+			name: "channels in another order",
+			watchers: []coursesense.Watcher{
+				{Channels: []coursesense.Channel{email, sms}},
+				{Channels: []coursesense.Channel{sms, email}},
+			},
+			added: []bool{true, false},
+			want:  []string{(coursesense.Watcher{Channels: []coursesense.Channel{email, sms}}).ContactKey()},
+		},
+		{
+			name:     "an extra channel is another contact",
+			watchers: []coursesense.Watcher{emailWatcher("a@example.com"), {Channels: []coursesense.Channel{email, sms}}},
+			added:    []bool{true, true},
+			want:     []string{"email:a@example.com", (coursesense.Watcher{Channels: []coursesense.Channel{email, sms}}).ContactKey()},
+		},
+		{
+			name:     "different addresses",
+			watchers: []coursesense.Watcher{emailWatcher("a@example.com"), emailWatcher("b@example.com")},
+			added:    []bool{true, true},
+			want:     []string{"email:a@example.com", "email:b@example.com"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			forEachBackend(t, func(t *testing.T, repo coursesense.Repository) {
+				ctx := context.Background()
+				for i, watcher := range test.watchers {
+					added, err := repo.AddWatcher(ctx, first, watcher)
+					if err != nil {
+						t.Fatalf("failed to add watcher: %v", err)
+					}
+					if added != test.added[i] {
+						t.Fatalf("watcher %d: got added %v, want %v", i, added, test.added[i])
+					}
+				}
+
+				watchers, err := repo.GetWatchers(ctx, first)
+				if err != nil {
+					t.Fatalf("failed to get watchers: %v", err)
+				}
+				var got []string
+				for _, watcher := range watchers {
+					got = append(got, watcher.ContactKey())
+				}
+				if strings.Join(got, ",") != strings.Join(test.want, ",") {
+					t.Fatalf("got watchers %v, want %v", got, test.want)
+				}
+				if len(watchers) > 0 && watchers[0].QuietHours.Enabled() {
+					t.Fatalf("got quiet hours %v, want the first registration left as it was", watchers[0].QuietHours)
+				}
+			})
+		})
+	}
+}
+
+func TestWatcherPositions(t *testing.T) {
+	tests := []struct {
+		name string
+		// registered in order, with "-" removing the watcher named after it
+		steps []string
+		// the section's watchers afterwards along with their positions, in queue order
+		want []string
+	}{
+		{
+			name:  "registration order",
+			steps: []string{"a", "b", "c"},
+			want:  []string{"a:1", "b:2", "c:3"},
+		},
+		{
+			name:  "a repeated registration keeps its place",
+			steps: []string{"a", "b", "a"},
+			want:  []string{"a:1", "b:2"},
+		},
+		{
+			name:  "removals leave gaps",
+			steps: []string{"a", "b", "c", "-b", "d"},
+			want:  []string{"a:1", "c:3", "d:4"},
+		},
+		{
+			name:  "an emptied section starts its queue over",
+			steps: []string{"a", "b", "-a", "-b", "c"},
+			want:  []string{"c:1"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			forEachBackend(t, func(t *testing.T, repo coursesense.Repository) {
+				ctx := context.Background()
+				// another section's queue doesn't move this one's
+				addWatcher(t, repo, second, emailWatcher("other@example.com"))
+
+				for _, step := range test.steps {
+					if name := strings.TrimPrefix(step, "-"); name != step {
+						if err := repo.RemoveWatcher(ctx, first, emailWatcher(name+"@example.com")); err != nil {
+							t.Fatalf("failed to remove %s: %v", name, err)
+						}
+						continue
+					}
+					addWatcher(t, repo, first, emailWatcher(step+"@example.com"))
+				}
+
+				watchers, err := repo.GetWatchers(ctx, first)
+				if err != nil {
+					t.Fatalf("failed to get watchers: %v", err)
+				}
+				var got []string
+				for _, watcher := range watchers {
+					name := strings.TrimSuffix(watcher.Address(coursesense.ChannelEmail), "@example.com")
+					got = append(got, fmt.Sprintf("%s:%d", name, watcher.Position))
+				}
+				if strings.Join(got, ",") != strings.Join(test.want, ",") {
+					t.Fatalf("got queue %v, want %v", got, test.want)
+				}
+			})
+		})
+	}
+}
+
+func TestSettleSection(t *testing.T) {
+	held := emailWatcher("b@example.com")
+	held.Held = true
+
+	job := coursesense.Job{
+		Notifier:     "multi",
+		Notification: seatNotification(first),
+		Watchers:     []coursesense.Watcher{emailWatcher("a@example.com")},
+		Parts:        map[string][]string{"email": {"email:a@example.com"}},
+	}
+
+	tests := []struct {
+		name   string
+		update coursesense.SectionUpdate
+		jobs   []coursesense.Job
+		// the watchers left on the section, nil if it is no longer watched
+		want     []string
+		wantHeld bool
+	}{
+		{
+			name:     "removes notified watchers and holds others",
+			update:   coursesense.SectionUpdate{Section: first, Remove: []coursesense.Watcher{emailWatcher("a@example.com")}, Update: []coursesense.Watcher{held}},
+			jobs:     []coursesense.Job{job},
+			want:     []string{"b@example.com"},
+			wantHeld: true,
+		},
+		{
+			name:   "the last watcher takes the section with it",
+			update: coursesense.SectionUpdate{Section: first, Remove: []coursesense.Watcher{emailWatcher("a@example.com"), emailWatcher("b@example.com")}},
+			jobs:   []coursesense.Job{job, job},
+		},
+		{
+			name:   "jobs alone",
+			update: coursesense.SectionUpdate{Section: first},
+			jobs:   []coursesense.Job{job},
+			want:   []string{"a@example.com", "b@example.com"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			forEachBackend(t, func(t *testing.T, repo coursesense.Repository) {
+				ctx := context.Background()
+				addWatcher(t, repo, first, emailWatcher("a@example.com"))
+				addWatcher(t, repo, first, emailWatcher("b@example.com"))
+
+				if err := repo.SettleSection(ctx, test.update, test.jobs...); err != nil {
+					t.Fatalf("failed to settle section: %v", err)
+				}
+
+				sections, err := repo.GetWatchedSections(ctx)
+				if err != nil {
+					t.Fatalf("failed to get watched sections: %v", err)
+				}
+				if test.want == nil {
+					if len(sections) != 0 {
+						t.Fatalf("got watched sections %v, want none", sections)
+					}
+				} else {
+					watchers, err := repo.GetWatchers(ctx, first)
+					if err != nil {
+						t.Fatalf("failed to get watchers: %v", err)
+					}
+					var got []string
+					for _, watcher := range watchers {
+						got = append(got, watcher.Address(coursesense.ChannelEmail))
+						if watcher.Held != (test.wantHeld && watcher.ContactKey() == held.ContactKey()) {
+							t.Fatalf("got %s held %v", watcher, watcher.Held)
+						}
+					}
+					if strings.Join(got, ",") != strings.Join(test.want, ",") {
+						t.Fatalf("got watchers %v, want %v", got, test.want)
+					}
+				}
+
+				jobs, err := repo.GetJobs(ctx, coursesense.JobPending)
+				if err != nil {
+					t.Fatalf("failed to get jobs: %v", err)
+				}
+				if len(jobs) != len(test.jobs) {
+					t.Fatalf("got %d jobs, want %d", len(jobs), len(test.jobs))
+				}
+				ids := make(map[string]bool)
+				for _, got := range jobs {
+					ids[got.ID] = true
+					if got.ID == "" || got.Notifier != job.Notifier || got.Attempts != 0 || got.NextAttemptAt.IsZero() {
+						t.Fatalf("got job %+v, want it pending with an id", got)
+					}
+					if len(got.Watchers) != 1 || got.Watchers[0].ContactKey() != "email:a@example.com" || len(got.Notification.Sections) != 1 {
+						t.Fatalf("got job %+v, want its notification and watchers stored", got)
+					}
+					if len(got.Parts) != 1 || strings.Join(got.Parts["email"], ",") != "email:a@example.com" {
+						t.Fatalf("got parts %v, want them stored", got.Parts)
+					}
+				}
+				if len(ids) != len(jobs) {
+					t.Fatalf("got job ids %v, want one per job", ids)
+				}
+			})
+		})
+	}
+}
+
+func TestAddWatchGroupDedupes(t *testing.T) {
+	third := coursesense.Section{Course: course, Code: "0103", Term: "F23"}
+	group := func(address string, sections ...coursesense.Section) coursesense.WatchGroup {
+		return coursesense.WatchGroup{Course: course, Term: "F23", Sections: sections, Watcher: emailWatcher(address)}
+	}
+
+	tests := []struct {
+		name   string
+		groups []coursesense.WatchGroup
+		// whether each group was added
+		added []bool
+	}{
+		{
+			name:   "same group twice",
+			groups: []coursesense.WatchGroup{group("a@example.com", first, second), group("a@example.com", first, second)},
+			added:  []bool{true, false},
+		},
+		{
+			name:   "sections in another order",
+			groups: []coursesense.WatchGroup{group("a@example.com", first, second), group("a@example.com", second, first)},
+			added:  []bool{true, false},
+		},
+		{
+			name:   "same whole course twice",
+			groups: []coursesense.WatchGroup{group("a@example.com"), group("a@example.com")},
+			added:  []bool{true, false},
+		},
+		{
+			name:   "other sections",
+			groups: []coursesense.WatchGroup{group("a@example.com", first, second), group("a@example.com", first, third), group("a@example.com", first, second, third)},
+			added:  []bool{true, true, true},
+		},
+		{
+			name:   "whole course and some of its sections",
+			groups: []coursesense.WatchGroup{group("a@example.com"), group("a@example.com", first, second)},
+			added:  []bool{true, true},
+		},
+		{
+			name:   "other contacts",
+			groups: []coursesense.WatchGroup{group("a@example.com", first, second), group("b@example.com", first, second)},
+			added:  []bool{true, true},
+		},
+		{
+			name: "other term",
+			groups: []coursesense.WatchGroup{
+				group("a@example.com"),
+				{Course: course, Term: "W24", Watcher: emailWatcher("a@example.com")},
+			},
+			added: []bool{true, true},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			forEachBackend(t, func(t *testing.T, repo coursesense.Repository) {
+				ctx := context.Background()
+				want := 0
+				for i, group := range test.groups {
+					added, err := repo.AddWatchGroup(ctx, group)
+					if err != nil {
+						t.Fatalf("failed to add group: %v", err)
+					}
+					if added != test.added[i] {
+						t.Fatalf("group %d: got added %v, want %v", i, added, test.added[i])
+					}
+					if added {
+						want++
+					}
+				}
+
+				groups, err := repo.GetWatchGroups(ctx)
+				if err != nil {
+					t.Fatalf("failed to get groups: %v", err)
+				}
+				if len(groups) != want {
+					t.Fatalf("got %d groups, want %d", len(groups), want)
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,394 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	coursesense "github.com/jacobmichels/Course-Sense-Go"
+)
+
+// the sqlite and postgres repositories share their schema and most of their queries
+
+// the columns holding a watcher's fields, in the order expected by sqlWatcher
+// both the watchers and watch_groups tables store a watcher using these columns
+var watcherColumnNames = []string{"contact_key", "expires_at", "timezone", "quiet_start", "quiet_end", "quiet_hold_urgent", "held", "timetable", "digest", "verify_by", "locale"}
+
+var watcherColumns = strings.Join(watcherColumnNames, ", ")
+
+// returns numbered placeholders for the watcher columns, starting after the given number of preceding arguments
+func watcherPlaceholders(offset int) string {
+	placeholders := make([]string, len(watcherColumnNames))
+	for i := range watcherColumnNames {
+		placeholders[i] = fmt.Sprintf("$%d", offset+i+1)
+	}
+
+	return strings.Join(placeholders, ", ")
+}
+
+// returns column=placeholder assignments for the watcher columns, starting after the given number of preceding arguments
+func watcherAssignments(offset int) string {
+	assignments := make([]string, len(watcherColumnNames))
+	for i, column := range watcherColumnNames {
+		assignments[i] = fmt.Sprintf("%s=$%d", column, offset+i+1)
+	}
+
+	return strings.Join(assignments, ", ")
+}
+
+// a watcher as stored in the watchers table of a sql database
+type sqlWatcher struct {
+	// identifies the watcher across all of its channels
+	contactKey      string
+	expiresAt       sql.NullInt64
+	timezone        string
+	quietStart      string
+	quietEnd        string
+	quietHoldUrgent bool
+	held            bool
+	// json encoded, or empty if the watcher has no timetable
+	timetable string
+	digest    bool
+	verifyBy  sql.NullInt64
+	locale    string
+}
+
+// the watcher's channels are stored separately, see channelTable
+func newSQLWatcher(watcher coursesense.Watcher) (sqlWatcher, error) {
+	var timetable string
+	if !watcher.Timetable.Empty() {
+		encoded, err := json.Marshal(watcher.Timetable)
+		if err != nil {
+			return sqlWatcher{}, fmt.Errorf("failed to encode timetable: %w", err)
+		}
+		timetable = string(encoded)
+	}
+
+	return sqlWatcher{
+		contactKey:      watcher.ContactKey(),
+		expiresAt:       expiryToSQL(watcher.ExpiresAt),
+		timezone:        watcher.Timezone,
+		quietStart:      watcher.QuietHours.Start,
+		quietEnd:        watcher.QuietHours.End,
+		quietHoldUrgent: watcher.QuietHours.HoldUrgent,
+		held:            watcher.Held,
+		timetable:       timetable,
+		digest:          watcher.Digest,
+		verifyBy:        expiryToSQL(watcher.VerifyBy),
+		locale:          watcher.Locale,
+	}, nil
+}
+
+// returns the column values, matching the order of watcherColumns
+func (w sqlWatcher) values() []any {
+	return []any{w.contactKey, w.expiresAt, w.timezone, w.quietStart, w.quietEnd, w.quietHoldUrgent, w.held, w.timetable, w.digest, w.verifyBy, w.locale}
+}
+
+// returns scan destinations, matching the order of watcherColumns
+func (w *sqlWatcher) fields() []any {
+	return []any{&w.contactKey, &w.expiresAt, &w.timezone, &w.quietStart, &w.quietEnd, &w.quietHoldUrgent, &w.held, &w.timetable, &w.digest, &w.verifyBy, &w.locale}
+}
+
+// returns the watcher with the given channels
+func (w sqlWatcher) watcher(channels []coursesense.Channel) (coursesense.Watcher, error) {
+	watcher := coursesense.Watcher{
+		Channels:  channels,
+		ExpiresAt: expiryFromSQL(w.expiresAt),
+		Timezone:  w.timezone,
+		QuietHours: coursesense.QuietHours{
+			Start:      w.quietStart,
+			End:        w.quietEnd,
+			HoldUrgent: w.quietHoldUrgent,
+		},
+		Held:     w.held,
+		Digest:   w.digest,
+		VerifyBy: expiryFromSQL(w.verifyBy),
+		Locale:   w.locale,
+	}
+
+	if w.timetable != "" {
+		if err := json.Unmarshal([]byte(w.timetable), &watcher.Timetable); err != nil {
+			return coursesense.Watcher{}, fmt.Errorf("failed to decode timetable: %w", err)
+		}
+	}
+
+	return watcher, nil
+}
+
+// a table holding the channels of the watchers or watch groups, one row per channel
+type channelTable struct {
+	name string
+	// the column referencing the watch
+	owner string
+	// the column keeping the channels in the order they were registered
+	order string
+}
+
+// replaces the channels of a watch
+func (t channelTable) set(txCtx context.Context, tx *sql.Tx, id int, channels []coursesense.Channel) error {
+	if _, err := tx.ExecContext(txCtx, "DELETE FROM "+t.name+" WHERE "+t.owner+"=$1", id); err != nil {
+		return fmt.Errorf("failed to delete channels: %w", err)
+	}
+
+	for _, channel := range channels {
+		_, err := tx.ExecContext(txCtx, "INSERT INTO "+t.name+" ("+t.owner+", kind, address, verified, preference) VALUES ($1, $2, $3, $4, $5)", id, channel.Kind, channel.Address, channel.Verified, channel.Preference)
+		if err != nil {
+			return fmt.Errorf("failed to insert %s channel: %w", channel.Kind, err)
+		}
+	}
+
+	return nil
+}
+
+// returns the channels of the watches whose ids are selected by the query, keyed by watch id
+func (t channelTable) get(ctx context.Context, q querier, ids string, args ...any) (map[int][]coursesense.Channel, error) {
+	rows, err := q.QueryContext(ctx, "SELECT "+t.owner+", kind, address, verified, preference FROM "+t.name+" WHERE "+t.owner+" IN ("+ids+") ORDER BY "+t.order, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch channels from the db: %w", err)
+	}
+	defer rows.Close()
+
+	channels := make(map[int][]coursesense.Channel)
+	for rows.Next() {
+		var id int
+		var channel coursesense.Channel
+		if err := rows.Scan(&id, &channel.Kind, &channel.Address, &channel.Verified, &channel.Preference); err != nil {
+			return nil, fmt.Errorf("failed to scan channel: %w", err)
+		}
+
+		channels[id] = append(channels[id], channel)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate channels: %w", err)
+	}
+
+	return channels, nil
+}
+
+// deletes the channels of the watches whose ids are selected by the query
+func (t channelTable) remove(ctx context.Context, e execer, ids string, args ...any) error {
+	if _, err := e.ExecContext(ctx, "DELETE FROM "+t.name+" WHERE "+t.owner+" IN ("+ids+")", args...); err != nil {
+		return fmt.Errorf("failed to delete channels: %w", err)
+	}
+
+	return nil
+}
+
+// deletes the watchers matching the condition, along with their channels
+func deleteWatchers(ctx context.Context, e execer, channels channelTable, condition string, args ...any) error {
+	if err := channels.remove(ctx, e, "SELECT id FROM watchers WHERE "+condition, args...); err != nil {
+		return err
+	}
+
+	if _, err := e.ExecContext(ctx, "DELETE FROM watchers WHERE "+condition, args...); err != nil {
+		return fmt.Errorf("failed to delete watcher: %w", err)
+	}
+
+	return nil
+}
+
+// updates a watcher of a section and replaces its channels. Watchers that aren't persisted are ignored
+func updateWatcher(txCtx context.Context, tx *sql.Tx, channels channelTable, section_id int, watcher coursesense.Watcher) error {
+	var watcher_id int
+	err := tx.QueryRowContext(txCtx, "SELECT id FROM watchers WHERE section_id=$1 AND contact_key=$2", section_id, watcher.ContactKey()).Scan(&watcher_id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to get watcher id: %w", err)
+	}
+
+	row, err := newSQLWatcher(watcher)
+	if err != nil {
+		return err
+	}
+
+	args := append([]any{watcher_id}, row.values()...)
+	if _, err = tx.ExecContext(txCtx, "UPDATE watchers SET "+watcherAssignments(1)+" WHERE id=$1", args...); err != nil {
+		return fmt.Errorf("failed to update watcher: %w", err)
+	}
+
+	return channels.set(txCtx, tx, watcher_id, watcher.Channels)
+}
+
+// the subset of *sql.DB and *sql.Tx used for lookups
+type querier interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// the subset of *sql.DB and *sql.Tx used for changes
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// returns the id of a section already persisted
+func getSectionID(ctx context.Context, q querier, section coursesense.Section) (int, error) {
+	var section_id int
+	err := q.QueryRowContext(ctx, "SELECT sections.id FROM sections left join courses on sections.course_id=courses.id WHERE sections.code=$1 AND sections.term=$2 AND courses.department=$3 AND courses.code=$4", section.Code, section.Term, section.Course.Department, section.Course.Code).Scan(&section_id)
+	if err != nil {
+		return 0, err
+	}
+
+	return section_id, nil
+}
+
+// reports whether the group's watcher already has a group watching the same sections
+func watchGroupExists(ctx context.Context, q querier, group coursesense.WatchGroup) (bool, error) {
+	// whole course watches have no section rows, hence the left join
+	rows, err := q.QueryContext(ctx, "SELECT watch_groups.id, watch_group_sections.code FROM watch_groups LEFT JOIN watch_group_sections ON watch_groups.id=watch_group_sections.group_id WHERE watch_groups.department=$1 AND watch_groups.course_code=$2 AND watch_groups.term=$3 AND watch_groups.contact_key=$4", group.Course.Department, group.Course.Code, group.Term, group.Watcher.ContactKey())
+	if err != nil {
+		return false, fmt.Errorf("failed to fetch watch groups from the db: %w", err)
+	}
+
+	existing := make(map[int]coursesense.WatchGroup)
+	defer rows.Close()
+	for rows.Next() {
+		var group_id int
+		var code sql.NullString
+		if err := rows.Scan(&group_id, &code); err != nil {
+			return false, fmt.Errorf("failed to scan row: %w", err)
+		}
+
+		stored := existing[group_id]
+		if code.Valid {
+			stored.Sections = append(stored.Sections, coursesense.Section{Course: group.Course, Code: code.String, Term: group.Term})
+		}
+		existing[group_id] = stored
+	}
+	if err := rows.Err(); err != nil {
+		return false, fmt.Errorf("failed to iterate rows: %w", err)
+	}
+
+	// the query matched the rest of the watch
+	codes := strings.Join(group.SectionCodes(), ",")
+	for _, stored := range existing {
+		if strings.Join(stored.SectionCodes(), ",") == codes {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// deletes a section if it has no watchers left, and its course if no other sections reference it
+func pruneSection(txCtx context.Context, tx *sql.Tx, section_id int) error {
+	var count int
+	err := tx.QueryRowContext(txCtx, "SELECT COUNT(*) FROM watchers WHERE section_id=$1", section_id).Scan(&count)
+	if err != nil {
+		return fmt.Errorf("failed to count section watchers: %w", err)
+	}
+
+	if count > 0 {
+		return nil
+	}
+
+	var course_id int
+	err = tx.QueryRowContext(txCtx, "SELECT course_id FROM sections WHERE id=$1", section_id).Scan(&course_id)
+	if err != nil {
+		return fmt.Errorf("failed to fetch course_id from db: %w", err)
+	}
+
+	if _, err = tx.ExecContext(txCtx, "DELETE FROM sections WHERE id=$1", section_id); err != nil {
+		return fmt.Errorf("failed to delete section: %w", err)
+	}
+
+	err = tx.QueryRowContext(txCtx, "SELECT COUNT(*) FROM sections WHERE course_id=$1", course_id).Scan(&count)
+	if err != nil {
+		return fmt.Errorf("failed to count same course sections: %w", err)
+	}
+
+	if count == 0 {
+		log.Debug().Int("course_id", course_id).Msg("deleting course")
+		if _, err = tx.ExecContext(txCtx, "DELETE FROM courses WHERE id=$1", course_id); err != nil {
+			return fmt.Errorf("failed to delete course: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// converts a watch expiry into unix seconds, or NULL if the watch never expires
+func expiryToSQL(expiresAt time.Time) sql.NullInt64 {
+	if expiresAt.IsZero() {
+		return sql.NullInt64{}
+	}
+
+	return sql.NullInt64{Int64: expiresAt.Unix(), Valid: true}
+}
+
+func expiryFromSQL(expiresAt sql.NullInt64) time.Time {
+	if !expiresAt.Valid {
+		return time.Time{}
+	}
+
+	return time.Unix(expiresAt.Int64, 0)
+}
+
+// inserts jobs into the outbox, due immediately
+func enqueueJobs(txCtx context.Context, tx *sql.Tx, now time.Time, jobs ...coursesense.Job) error {
+	for _, job := range jobs {
+		payload, err := encodeJobPayload(job)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(txCtx, "INSERT INTO jobs (notifier, payload, status, next_attempt_at, created_at) VALUES ($1, $2, $3, $4, $4)", job.Notifier, payload, coursesense.JobPending, now.Unix())
+		if err != nil {
+			return fmt.Errorf("failed to enqueue job: %w", err)
+		}
+	}
+
+	return nil
+}
+
+const jobColumns = "id, notifier, payload, status, attempts, next_attempt_at, last_error, created_at"
+
+// the subset of *sql.Rows and *sql.Row used to scan a job
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanJob(row scanner) (coursesense.Job, error) {
+	var job coursesense.Job
+	var id, nextAttemptAt, createdAt int64
+	var payload, status string
+	if err := row.Scan(&id, &job.Notifier, &payload, &status, &job.Attempts, &nextAttemptAt, &job.LastError, &createdAt); err != nil {
+		return coursesense.Job{}, err
+	}
+
+	if err := decodeJobPayload(payload, &job); err != nil {
+		return coursesense.Job{}, err
+	}
+
+	job.ID = strconv.FormatInt(id, 10)
+	job.Status = coursesense.JobStatus(status)
+	job.NextAttemptAt = time.Unix(nextAttemptAt, 0)
+	job.CreatedAt = time.Unix(createdAt, 0)
+	return job, nil
+}
+
+const digestColumns = "id, payload, flush_at"
+
+func scanDigest(row scanner) (coursesense.Digest, error) {
+	var digest coursesense.Digest
+	var id, flushAt int64
+	var payload string
+	if err := row.Scan(&id, &payload, &flushAt); err != nil {
+		return coursesense.Digest{}, err
+	}
+
+	if err := decodeDigestPayload(payload, &digest); err != nil {
+		return coursesense.Digest{}, err
+	}
+
+	digest.ID = strconv.FormatInt(id, 10)
+	digest.FlushAt = time.Unix(flushAt, 0)
+	return digest, nil
+}
@@ -5,6 +5,8 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"strconv"
+	"time"
 
 	"github.com/rs/zerolog/log"
 
@@ -23,6 +25,12 @@ type SQLiteRepository struct {
 	cfg config.SQLite
 }
 
+// sqlite keeps rows in insertion order by rowid
+var (
+	watcherChannels = channelTable{"watcher_channels", "watcher_id", "rowid"}
+	groupChannels   = channelTable{"watch_group_channels", "group_id", "rowid"}
+)
+
 // creates a new repository backed by sqlite
 // returns an error if the connection cannot be established or if a ping fails
 func newSQLiteRepository(ctx context.Context, cfg config.SQLite) (SQLiteRepository, error) {
@@ -64,43 +72,43 @@ func newSQLiteRepository(ctx context.Context, cfg config.SQLite) (SQLiteReposito
 	return SQLiteRepository{db, cfg}, nil
 }
 
-func (r SQLiteRepository) AddWatcher(ctx context.Context, section coursesense.Section, watcher coursesense.Watcher) error {
+func (r SQLiteRepository) AddWatcher(ctx context.Context, section coursesense.Section, watcher coursesense.Watcher) (bool, error) {
 	txCtx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
 	log.Debug().Msg("starting database transaction")
 	tx, err := r.db.BeginTx(txCtx, &sql.TxOptions{})
 	if err != nil {
-		return fmt.Errorf("failed to begin transaction: %w", err)
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
 	}
 
 	// first insert the course
 	course_id, err := persistCourse(txCtx, tx, section.Course)
 	if err != nil {
-		return fmt.Errorf("failed to persist course: %w", err)
+		return false, fmt.Errorf("failed to persist course: %w", err)
 	}
 	log.Debug().Msg("course persisted")
 
 	// then insert the section
 	section_id, err := persistSection(txCtx, tx, section, course_id)
 	if err != nil {
-		return fmt.Errorf("failed to persist section: %w", err)
+		return false, fmt.Errorf("failed to persist section: %w", err)
 	}
 	log.Debug().Msg("section persisted")
 
 	// finally we can insert the watcher and commit the transaction
-	err = persistWatcher(txCtx, tx, watcher, section_id)
+	added, err := persistWatcher(txCtx, tx, watcher, section_id)
 	if err != nil {
-		return fmt.Errorf("failed to persist watcher: %w", err)
+		return false, fmt.Errorf("failed to persist watcher: %w", err)
 	}
 	log.Debug().Msg("watcher persisted")
 
 	if err = tx.Commit(); err != nil {
-		return fmt.Errorf("failed to commit transaction: %w", err)
+		return false, fmt.Errorf("failed to commit transaction: %w", err)
 	}
 	log.Debug().Msg("transaction committed")
 
-	return nil
+	return added, nil
 }
 
 // insert a course into sqlite if needed
@@ -161,24 +169,48 @@ func persistSection(txCtx context.Context, tx *sql.Tx, section coursesense.Secti
 	return section_id, nil
 }
 
-// insert a watcher into sqlite if needed
-func persistWatcher(txCtx context.Context, tx *sql.Tx, watcher coursesense.Watcher, section_id int) error {
+// insert a watcher into sqlite if needed, reporting whether it was inserted
+func persistWatcher(txCtx context.Context, tx *sql.Tx, watcher coursesense.Watcher, section_id int) (bool, error) {
 	// check if identical watcher already exists in db
 	var watcher_id int
-	err := tx.QueryRowContext(txCtx, "SELECT id FROM watchers WHERE email=$1 AND section_id=$2", watcher.Email, section_id).Scan(&watcher_id)
+	err := tx.QueryRowContext(txCtx, "SELECT id FROM watchers WHERE contact_key=$1 AND section_id=$2", watcher.ContactKey(), section_id).Scan(&watcher_id)
 	if err != nil && errors.Is(err, sql.ErrNoRows) {
 		// if it doesn't exist, insert it
 		log.Debug().Msg("inserting watcher into db")
-		_, err := tx.ExecContext(txCtx, "INSERT INTO watchers (email, section_id) VALUES ($1, $2)", watcher.Email, section_id)
+		row, err := newSQLWatcher(watcher)
+		if err != nil {
+			return false, err
+		}
+
+		// new watchers join the back of the section's queue
+		var position int
+		err = tx.QueryRowContext(txCtx, "SELECT COALESCE(MAX(position), 0) + 1 FROM watchers WHERE section_id=$1", section_id).Scan(&position)
+		if err != nil {
+			return false, fmt.Errorf("failed to get queue position: %w", err)
+		}
+
+		args := append([]any{section_id, position}, row.values()...)
+		res, err := tx.ExecContext(txCtx, "INSERT INTO watchers (section_id, position, "+watcherColumns+") VALUES ($1, $2, "+watcherPlaceholders(2)+")", args...)
+		if err != nil {
+			return false, fmt.Errorf("insert statement failed: %w", err)
+		}
+
+		watcher_id, err := res.LastInsertId()
 		if err != nil {
-			return fmt.Errorf("insert statement failed: %w", err)
+			return false, fmt.Errorf("failed to fetch inserted watcher id: %w", err)
+		}
+
+		if err := watcherChannels.set(txCtx, tx, int(watcher_id), watcher.Channels); err != nil {
+			return false, err
 		}
+
+		return true, nil
 	} else if err != nil {
-		return fmt.Errorf("failed to check if watcher already exists in database: %w", err)
+		return false, fmt.Errorf("failed to check if watcher already exists in database: %w", err)
 	}
 
 	log.Debug().Msg("watcher already exists in db")
-	return nil
+	return false, nil
 }
 
 func (r SQLiteRepository) GetWatchedSections(ctx context.Context) ([]coursesense.Section, error) {
@@ -216,8 +248,13 @@ func (r SQLiteRepository) GetWatchers(ctx context.Context, section coursesense.S
 		return nil, fmt.Errorf("failed to get section_id from db: %w", err)
 	}
 
+	channels, err := watcherChannels.get(ctx, r.db, "SELECT id FROM watchers WHERE section_id=$1", section_id)
+	if err != nil {
+		return nil, err
+	}
+
 	// then get the watchers
-	rows, err := r.db.QueryContext(ctx, "SELECT email FROM watchers WHERE section_id=$1", section_id)
+	rows, err := r.db.QueryContext(ctx, "SELECT id, position, "+watcherColumns+" FROM watchers WHERE section_id=$1 ORDER BY position", section_id)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch relevant watchers from db: %w", err)
 	}
@@ -226,13 +263,20 @@ func (r SQLiteRepository) GetWatchers(ctx context.Context, section coursesense.S
 
 	defer rows.Close()
 	for rows.Next() {
-		var watcher coursesense.Watcher
+		var watcher sqlWatcher
+		var watcher_id, position int
 
-		if err := rows.Scan(&watcher.Email); err != nil {
+		if err := rows.Scan(append([]any{&watcher_id, &position}, watcher.fields()...)...); err != nil {
 			return nil, fmt.Errorf("failed to scan row: %w", err)
 		}
 
-		watchers = append(watchers, watcher)
+		result, err := watcher.watcher(channels[watcher_id])
+		if err != nil {
+			return nil, err
+		}
+		result.Position = position
+
+		watchers = append(watchers, result)
 	}
 	if err := rows.Err(); err != nil {
 		return nil, fmt.Errorf("failed to iterate rows: %w", err)
@@ -252,9 +296,8 @@ func (r SQLiteRepository) Cleanup(ctx context.Context, section coursesense.Secti
 		return fmt.Errorf("failed to get section_id from db: %w", err)
 	}
 
-	_, err = r.db.ExecContext(ctx, "DELETE FROM watchers WHERE section_id=$1", section_id)
-	if err != nil {
-		return fmt.Errorf("failed to execute delete command: %w", err)
+	if err := deleteWatchers(ctx, r.db, watcherChannels, "section_id=$1", section_id); err != nil {
+		return err
 	}
 
 	// get the id of the course referenced by the section
@@ -288,3 +331,597 @@ func (r SQLiteRepository) Cleanup(ctx context.Context, section coursesense.Secti
 
 	return nil
 }
+
+func (r SQLiteRepository) PurgeExpired(ctx context.Context, now time.Time, notices func(coursesense.Watch) []coursesense.Job) ([]coursesense.Watch, error) {
+	txCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	tx, err := r.db.BeginTx(txCtx, &sql.TxOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	channels, err := watcherChannels.get(txCtx, tx, "SELECT id FROM watchers WHERE expires_at IS NOT NULL AND expires_at<=$1", now.Unix())
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.QueryContext(txCtx, "SELECT watchers.id, sections.id, sections.code, sections.term, courses.code, courses.department, "+watcherColumns+" FROM watchers JOIN sections ON watchers.section_id=sections.id JOIN courses ON sections.course_id=courses.id WHERE watchers.expires_at IS NOT NULL AND watchers.expires_at<=$1", now.Unix())
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch expired watchers from the db: %w", err)
+	}
+
+	var watches []coursesense.Watch
+	var watcher_ids []int
+	section_ids := make(map[int]struct{})
+
+	defer rows.Close()
+	for rows.Next() {
+		var watch coursesense.Watch
+		var watcher sqlWatcher
+		var watcher_id, section_id int
+
+		dest := append([]any{&watcher_id, &section_id, &watch.Section.Code, &watch.Section.Term, &watch.Section.Course.Code, &watch.Section.Course.Department}, watcher.fields()...)
+		if err := rows.Scan(dest...); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+
+		if watch.Watcher, err = watcher.watcher(channels[watcher_id]); err != nil {
+			return nil, err
+		}
+
+		watches = append(watches, watch)
+		watcher_ids = append(watcher_ids, watcher_id)
+		section_ids[section_id] = struct{}{}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate rows: %w", err)
+	}
+	rows.Close()
+
+	for _, watcher_id := range watcher_ids {
+		if err := deleteWatchers(txCtx, tx, watcherChannels, "id=$1", watcher_id); err != nil {
+			return nil, err
+		}
+	}
+
+	for section_id := range section_ids {
+		if err := pruneSection(txCtx, tx, section_id); err != nil {
+			return nil, fmt.Errorf("failed to prune section: %w", err)
+		}
+	}
+
+	if notices != nil {
+		for _, watch := range watches {
+			if err := enqueueJobs(txCtx, tx, now, notices(watch)...); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return watches, nil
+}
+
+func (r SQLiteRepository) PurgeUnverified(ctx context.Context, now time.Time) (int, error) {
+	txCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	tx, err := r.db.BeginTx(txCtx, &sql.TxOptions{})
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	rows, err := tx.QueryContext(txCtx, "SELECT id, section_id FROM watchers WHERE verify_by IS NOT NULL AND verify_by<=$1", now.Unix())
+	if err != nil {
+		return 0, fmt.Errorf("failed to fetch unverified watchers from the db: %w", err)
+	}
+
+	var watcher_ids []int
+	section_ids := make(map[int]struct{})
+
+	defer rows.Close()
+	for rows.Next() {
+		var watcher_id, section_id int
+		if err := rows.Scan(&watcher_id, &section_id); err != nil {
+			return 0, fmt.Errorf("failed to scan row: %w", err)
+		}
+
+		watcher_ids = append(watcher_ids, watcher_id)
+		section_ids[section_id] = struct{}{}
+	}
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("failed to iterate rows: %w", err)
+	}
+	rows.Close()
+
+	for _, watcher_id := range watcher_ids {
+		if err := deleteWatchers(txCtx, tx, watcherChannels, "id=$1", watcher_id); err != nil {
+			return 0, err
+		}
+	}
+
+	for section_id := range section_ids {
+		if err := pruneSection(txCtx, tx, section_id); err != nil {
+			return 0, fmt.Errorf("failed to prune section: %w", err)
+		}
+	}
+
+	if err := groupChannels.remove(txCtx, tx, "SELECT id FROM watch_groups WHERE verify_by IS NOT NULL AND verify_by<=$1", now.Unix()); err != nil {
+		return 0, err
+	}
+
+	if _, err := tx.ExecContext(txCtx, "DELETE FROM watch_group_sections WHERE group_id IN (SELECT id FROM watch_groups WHERE verify_by IS NOT NULL AND verify_by<=$1)", now.Unix()); err != nil {
+		return 0, fmt.Errorf("failed to delete unverified group sections: %w", err)
+	}
+
+	res, err := tx.ExecContext(txCtx, "DELETE FROM watch_groups WHERE verify_by IS NOT NULL AND verify_by<=$1", now.Unix())
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete unverified watch groups: %w", err)
+	}
+
+	groups, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to count deleted watch groups: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return len(watcher_ids) + int(groups), nil
+}
+
+func (r SQLiteRepository) RemoveWatcher(ctx context.Context, section coursesense.Section, watcher coursesense.Watcher) error {
+	txCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	tx, err := r.db.BeginTx(txCtx, &sql.TxOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	section_id, err := getSectionID(txCtx, tx, section)
+	if err != nil {
+		return fmt.Errorf("failed to get section_id from db: %w", err)
+	}
+
+	if err := deleteWatchers(txCtx, tx, watcherChannels, "section_id=$1 AND contact_key=$2", section_id, watcher.ContactKey()); err != nil {
+		return err
+	}
+
+	if err := pruneSection(txCtx, tx, section_id); err != nil {
+		return fmt.Errorf("failed to prune section: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+func (r SQLiteRepository) UpdateWatcher(ctx context.Context, section coursesense.Section, watcher coursesense.Watcher) error {
+	txCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	tx, err := r.db.BeginTx(txCtx, &sql.TxOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	section_id, err := getSectionID(txCtx, tx, section)
+	if err != nil {
+		return fmt.Errorf("failed to get section_id from db: %w", err)
+	}
+
+	if err := updateWatcher(txCtx, tx, watcherChannels, section_id, watcher); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+func (r SQLiteRepository) SettleSection(ctx context.Context, update coursesense.SectionUpdate, jobs ...coursesense.Job) error {
+	txCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	tx, err := r.db.BeginTx(txCtx, &sql.TxOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	section_id, err := getSectionID(txCtx, tx, update.Section)
+	if err != nil {
+		return fmt.Errorf("failed to get section_id from db: %w", err)
+	}
+
+	for _, watcher := range update.Remove {
+		if err := deleteWatchers(txCtx, tx, watcherChannels, "section_id=$1 AND contact_key=$2", section_id, watcher.ContactKey()); err != nil {
+			return err
+		}
+	}
+
+	for _, watcher := range update.Update {
+		if err := updateWatcher(txCtx, tx, watcherChannels, section_id, watcher); err != nil {
+			return err
+		}
+	}
+
+	if err := pruneSection(txCtx, tx, section_id); err != nil {
+		return fmt.Errorf("failed to prune section: %w", err)
+	}
+
+	if err := enqueueJobs(txCtx, tx, time.Now(), jobs...); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+func (r SQLiteRepository) AddWatchGroup(ctx context.Context, group coursesense.WatchGroup) (bool, error) {
+	txCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	tx, err := r.db.BeginTx(txCtx, &sql.TxOptions{})
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	exists, err := watchGroupExists(txCtx, tx, group)
+	if err != nil {
+		return false, err
+	}
+	if exists {
+		log.Debug().Msg("watch group already exists in db")
+		return false, nil
+	}
+
+	row, err := newSQLWatcher(group.Watcher)
+	if err != nil {
+		return false, err
+	}
+
+	args := append([]any{group.Course.Department, group.Course.Code, group.Term}, row.values()...)
+	res, err := tx.ExecContext(txCtx, "INSERT INTO watch_groups (department, course_code, term, "+watcherColumns+") VALUES ($1, $2, $3, "+watcherPlaceholders(3)+")", args...)
+	if err != nil {
+		return false, fmt.Errorf("insert statement failed: %w", err)
+	}
+
+	group_id, err := res.LastInsertId()
+	if err != nil {
+		return false, fmt.Errorf("failed to fetch inserted group id: %w", err)
+	}
+
+	if err := groupChannels.set(txCtx, tx, int(group_id), group.Watcher.Channels); err != nil {
+		return false, err
+	}
+
+	for _, section := range group.Sections {
+		_, err := tx.ExecContext(txCtx, "INSERT OR IGNORE INTO watch_group_sections (group_id, code) VALUES ($1, $2)", group_id, section.Code)
+		if err != nil {
+			return false, fmt.Errorf("failed to insert group section: %w", err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return true, nil
+}
+
+func (r SQLiteRepository) GetWatchGroups(ctx context.Context) ([]coursesense.WatchGroup, error) {
+	channels, err := groupChannels.get(ctx, r.db, "SELECT id FROM watch_groups")
+	if err != nil {
+		return nil, err
+	}
+
+	// whole course watches have no section rows, hence the left join
+	rows, err := r.db.QueryContext(ctx, "SELECT watch_groups.id, watch_groups.department, watch_groups.course_code, watch_groups.term, watch_group_sections.code, "+watcherColumns+" FROM watch_groups LEFT JOIN watch_group_sections ON watch_groups.id=watch_group_sections.group_id ORDER BY watch_groups.id")
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch watch groups from the db: %w", err)
+	}
+
+	var groups []coursesense.WatchGroup
+
+	defer rows.Close()
+	for rows.Next() {
+		var group_id int
+		var course coursesense.Course
+		var term string
+		var code sql.NullString
+		var watcher sqlWatcher
+
+		dest := append([]any{&group_id, &course.Department, &course.Code, &term, &code}, watcher.fields()...)
+		if err := rows.Scan(dest...); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+
+		// rows are ordered by group, so each new id starts a new group
+		id := strconv.Itoa(group_id)
+		if len(groups) == 0 || groups[len(groups)-1].ID != id {
+			result, err := watcher.watcher(channels[group_id])
+			if err != nil {
+				return nil, err
+			}
+
+			groups = append(groups, coursesense.WatchGroup{ID: id, Course: course, Term: term, Watcher: result})
+		}
+
+		if code.Valid {
+			section := coursesense.Section{Course: course, Code: code.String, Term: term}
+			groups[len(groups)-1].Sections = append(groups[len(groups)-1].Sections, section)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate rows: %w", err)
+	}
+
+	log.Info().Int("count", len(groups)).Msg("retrieved watch groups")
+
+	return groups, nil
+}
+
+func (r SQLiteRepository) UpdateWatchGroup(ctx context.Context, group coursesense.WatchGroup, jobs ...coursesense.Job) error {
+	txCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	tx, err := r.db.BeginTx(txCtx, &sql.TxOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	row, err := newSQLWatcher(group.Watcher)
+	if err != nil {
+		return err
+	}
+
+	args := append([]any{group.ID}, row.values()...)
+	_, err = tx.ExecContext(txCtx, "UPDATE watch_groups SET "+watcherAssignments(1)+" WHERE id=$1", args...)
+	if err != nil {
+		return fmt.Errorf("failed to update watch group: %w", err)
+	}
+
+	id, err := strconv.Atoi(group.ID)
+	if err != nil {
+		return fmt.Errorf("bad watch group id %q: %w", group.ID, err)
+	}
+
+	if err := groupChannels.set(txCtx, tx, id, group.Watcher.Channels); err != nil {
+		return err
+	}
+
+	if err := enqueueJobs(txCtx, tx, time.Now(), jobs...); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+func (r SQLiteRepository) RemoveWatchGroup(ctx context.Context, id string, jobs ...coursesense.Job) error {
+	txCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	tx, err := r.db.BeginTx(txCtx, &sql.TxOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	if err := groupChannels.remove(txCtx, tx, "$1", id); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(txCtx, "DELETE FROM watch_group_sections WHERE group_id=$1", id); err != nil {
+		return fmt.Errorf("failed to delete group sections: %w", err)
+	}
+
+	if _, err := tx.ExecContext(txCtx, "DELETE FROM watch_groups WHERE id=$1", id); err != nil {
+		return fmt.Errorf("failed to delete watch group: %w", err)
+	}
+
+	if err := enqueueJobs(txCtx, tx, time.Now(), jobs...); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+func (r SQLiteRepository) ClaimJobs(ctx context.Context, now time.Time, limit int, lease time.Duration) ([]coursesense.Job, error) {
+	txCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	tx, err := r.db.BeginTx(txCtx, &sql.TxOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	rows, err := tx.QueryContext(txCtx, "SELECT "+jobColumns+" FROM jobs WHERE status=$1 AND next_attempt_at<=$2 ORDER BY next_attempt_at, id LIMIT $3", coursesense.JobPending, now.Unix(), limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch due jobs from the db: %w", err)
+	}
+
+	var jobs []coursesense.Job
+	defer rows.Close()
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+
+		jobs = append(jobs, job)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate rows: %w", err)
+	}
+	rows.Close()
+
+	leasedUntil := now.Add(lease)
+	for i := range jobs {
+		if _, err := tx.ExecContext(txCtx, "UPDATE jobs SET next_attempt_at=$1 WHERE id=$2", leasedUntil.Unix(), jobs[i].ID); err != nil {
+			return nil, fmt.Errorf("failed to lease job: %w", err)
+		}
+		jobs[i].NextAttemptAt = leasedUntil
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return jobs, nil
+}
+
+func (r SQLiteRepository) UpdateJob(ctx context.Context, job coursesense.Job) error {
+	payload, err := encodeJobPayload(job)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.db.ExecContext(ctx, "UPDATE jobs SET notifier=$1, payload=$2, status=$3, attempts=$4, next_attempt_at=$5, last_error=$6 WHERE id=$7", job.Notifier, payload, job.Status, job.Attempts, job.NextAttemptAt.Unix(), job.LastError, job.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update job: %w", err)
+	}
+
+	return nil
+}
+
+func (r SQLiteRepository) CompleteJob(ctx context.Context, id string) error {
+	if _, err := r.db.ExecContext(ctx, "DELETE FROM jobs WHERE id=$1", id); err != nil {
+		return fmt.Errorf("failed to delete job: %w", err)
+	}
+
+	return nil
+}
+
+func (r SQLiteRepository) GetJob(ctx context.Context, id string) (coursesense.Job, error) {
+	job, err := scanJob(r.db.QueryRowContext(ctx, "SELECT "+jobColumns+" FROM jobs WHERE id=$1", id))
+	if err != nil {
+		return coursesense.Job{}, fmt.Errorf("failed to fetch job from the db: %w", err)
+	}
+
+	return job, nil
+}
+
+func (r SQLiteRepository) GetJobs(ctx context.Context, status coursesense.JobStatus) ([]coursesense.Job, error) {
+	rows, err := r.db.QueryContext(ctx, "SELECT "+jobColumns+" FROM jobs WHERE status=$1 ORDER BY created_at, id", status)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch jobs from the db: %w", err)
+	}
+	defer rows.Close()
+
+	var jobs []coursesense.Job
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+
+		jobs = append(jobs, job)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate rows: %w", err)
+	}
+
+	return jobs, nil
+}
+
+func (r SQLiteRepository) AddToDigest(ctx context.Context, digest coursesense.Digest) error {
+	txCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	tx, err := r.db.BeginTx(txCtx, &sql.TxOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	key := digest.Watcher.ContactKey()
+	existing, err := scanDigest(tx.QueryRowContext(txCtx, "SELECT "+digestColumns+" FROM digests WHERE contact_key=$1", key))
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("failed to fetch digest from the db: %w", err)
+	}
+	if err == nil {
+		digest = mergeDigest(existing, digest)
+	}
+
+	payload, err := encodeDigestPayload(digest)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(txCtx, "INSERT INTO digests (contact_key, payload, flush_at) VALUES ($1, $2, $3) ON CONFLICT(contact_key) DO UPDATE SET payload=excluded.payload, flush_at=excluded.flush_at", key, payload, digest.FlushAt.Unix())
+	if err != nil {
+		return fmt.Errorf("failed to persist digest: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+func (r SQLiteRepository) GetDueDigests(ctx context.Context, now time.Time) ([]coursesense.Digest, error) {
+	rows, err := r.db.QueryContext(ctx, "SELECT "+digestColumns+" FROM digests WHERE flush_at<=$1 ORDER BY flush_at, id", now.Unix())
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch due digests from the db: %w", err)
+	}
+	defer rows.Close()
+
+	var digests []coursesense.Digest
+	for rows.Next() {
+		digest, err := scanDigest(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+
+		digests = append(digests, digest)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate rows: %w", err)
+	}
+
+	return digests, nil
+}
+
+func (r SQLiteRepository) FlushDigest(ctx context.Context, digest coursesense.Digest, jobs ...coursesense.Job) error {
+	txCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	tx, err := r.db.BeginTx(txCtx, &sql.TxOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	if _, err := tx.ExecContext(txCtx, "DELETE FROM digests WHERE id=$1", digest.ID); err != nil {
+		return fmt.Errorf("failed to delete digest: %w", err)
+	}
+
+	if err := enqueueJobs(txCtx, tx, time.Now(), jobs...); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
@@ -2,26 +2,43 @@ package server
 
 import (
 	"context"
+	"crypto/subtle"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"html/template"
+	"io"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/rs/zerolog/log"
 
 	coursesense "github.com/jacobmichels/Course-Sense-Go"
+	"github.com/jacobmichels/Course-Sense-Go/i18n"
 	"github.com/julienschmidt/httprouter"
 )
 
 type Server struct {
 	registrationService coursesense.RegistrationService
 	triggerService      coursesense.TriggerService
-	addr                string
+	conflictService     coursesense.ConflictService
+	outboxService       coursesense.OutboxService
+	// nil if unsubscribe links are disabled
+	unsubscribeService coursesense.UnsubscribeService
+	// nil if email verification is disabled
+	verificationService coursesense.VerificationService
+	// nil unless the development mail sink is enabled
+	mailSinkService coursesense.MailSinkService
+	// nil unless the telegram bot receives updates through a webhook
+	telegramService coursesense.TelegramService
+	addr            string
+	// bearer token guarding the admin routes, which are disabled if it is empty
+	adminToken string
 }
 
-func NewServer(addr string, r coursesense.RegistrationService, t coursesense.TriggerService) Server {
-	return Server{r, t, addr}
+func NewServer(addr string, r coursesense.RegistrationService, t coursesense.TriggerService, c coursesense.ConflictService, o coursesense.OutboxService, u coursesense.UnsubscribeService, v coursesense.VerificationService, m coursesense.MailSinkService, tg coursesense.TelegramService, adminToken string) Server {
+	return Server{r, t, c, o, u, v, m, tg, addr, adminToken}
 }
 
 func (s Server) Start(ctx context.Context) error {
@@ -30,6 +47,36 @@ func (s Server) Start(ctx context.Context) error {
 	// register routes
 	r.GET("/ping", s.pingHandler())
 	r.PUT("/register", s.registerHandler())
+	r.POST("/conflicts", s.conflictsHandler())
+
+	if s.unsubscribeService != nil {
+		// GET for links clicked in a browser, POST for one-click unsubscribe from mail clients (RFC 8058)
+		r.GET("/unsubscribe", s.unsubscribeHandler())
+		r.POST("/unsubscribe", s.unsubscribeHandler())
+	}
+
+	if s.verificationService != nil {
+		// GET only shows a confirmation form, so link scanners in mail clients don't activate watches
+		r.GET("/verify", s.verifyFormHandler())
+		r.POST("/verify", s.verifyHandler())
+	}
+
+	if s.telegramService != nil {
+		r.POST("/telegram/webhook", s.telegramHandler())
+	}
+
+	if s.mailSinkService != nil {
+		log.Warn().Msg("mail sink enabled, captured emails are listed at /dev/mail without authentication")
+		r.GET("/dev/mail", s.mailListHandler())
+		r.GET("/dev/mail/:id", s.mailHandler())
+	}
+
+	if s.adminToken != "" {
+		r.GET("/admin/jobs", s.admin(s.failedJobsHandler()))
+		r.POST("/admin/jobs/:id/replay", s.admin(s.replayJobHandler()))
+	} else {
+		log.Info().Msg("admin token not set, admin routes disabled")
+	}
 
 	srv := http.Server{Addr: s.addr, Handler: r}
 	log.Info().Msgf("listening on %s", s.addr)
@@ -66,18 +113,78 @@ func (s Server) pingHandler() httprouter.Handle {
 	}
 }
 
+// Exactly one of Section, Sections or Course must be set.
+// Sections registers a watch group, notifying the watcher once for any of them.
+// Course along with Term registers a watch group on every section of the course in that term
 type RegisterRequest struct {
-	Section coursesense.Section `json:"section"`
-	Watcher coursesense.Watcher `json:"watcher"`
+	Section  coursesense.Section   `json:"section"`
+	Sections []coursesense.Section `json:"sections"`
+	Course   *coursesense.Course   `json:"course"`
+	Term     string                `json:"term"`
+	Watcher  WatcherRequest        `json:"watcher"`
+}
+
+// A watcher as sent by clients. The flat contact fields of older clients are still accepted and become channels
+type WatcherRequest struct {
+	coursesense.Watcher
+	coursesense.LegacyContact
+}
+
+// returns the watcher with the legacy contact fields merged into its channels
+func (r WatcherRequest) watcher() coursesense.Watcher {
+	watcher := r.Watcher
+	watcher.Channels = append(append([]coursesense.Channel{}, r.Watcher.Channels...), r.LegacyContact.Channels()...)
+	// only the service can vouch for an address
+	for i := range watcher.Channels {
+		watcher.Channels[i].Verified = false
+	}
+
+	return watcher
 }
 
 func (r RegisterRequest) Valid() error {
+	if r.Watcher.Locale != "" {
+		if _, ok := i18n.Normalize(r.Watcher.Locale); !ok {
+			return fmt.Errorf("unsupported locale %q, supported locales are %v", r.Watcher.Locale, i18n.Locales())
+		}
+	}
+
+	set := 0
+	if r.Section != (coursesense.Section{}) {
+		set++
+	}
+	if len(r.Sections) > 0 {
+		set++
+	}
+	if r.Course != nil {
+		set++
+	}
+	if set > 1 {
+		return errors.New("only one of section, sections and course can be set")
+	}
+
+	if r.isGroup() {
+		return r.group().Valid()
+	}
+
 	err := r.Section.Valid()
 	if err != nil {
 		return err
 	}
 
-	return r.Watcher.Valid()
+	return r.Watcher.watcher().Valid()
+}
+
+func (r RegisterRequest) isGroup() bool {
+	return len(r.Sections) > 0 || r.Course != nil
+}
+
+func (r RegisterRequest) group() coursesense.WatchGroup {
+	if r.Course != nil {
+		return coursesense.WatchGroup{Course: *r.Course, Term: r.Term, Watcher: r.Watcher.watcher()}
+	}
+
+	return coursesense.WatchGroup{Course: r.Sections[0].Course, Term: r.Sections[0].Term, Sections: r.Sections, Watcher: r.Watcher.watcher()}
 }
 
 func (s Server) registerHandler() httprouter.Handle {
@@ -87,26 +194,373 @@ func (s Server) registerHandler() httprouter.Handle {
 		var req RegisterRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 			log.Error().Msgf("error decoding register request: %s", err)
-			http.Error(w, "Failed to parse request", http.StatusBadRequest)
+			http.Error(w, i18n.T(i18n.Match(r.Header.Get("Accept-Language")), i18n.ParseFailed), http.StatusBadRequest)
 			return
 		}
 
+		req.Watcher.Locale = watcherLocale(r, req.Watcher.Locale)
+		locale := req.Watcher.Locale
+
 		if err := req.Valid(); err != nil {
 			log.Error().Msgf("register request invalid: %s", err)
-			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			http.Error(w, i18n.T(locale, i18n.InvalidRequest), http.StatusBadRequest)
+			return
+		}
+
+		if req.isGroup() {
+			s.registerGroup(w, r, req.group())
 			return
 		}
 
-		if err := s.registrationService.Register(r.Context(), req.Section, req.Watcher); err != nil {
+		watcher := req.Watcher.watcher()
+		if err := s.registrationService.Register(r.Context(), req.Section, watcher); err != nil {
 			log.Error().Msgf("registration failed: %s", err)
-			http.Error(w, "Registration failed, please ensure the course you are registering for exists. If error persists please contact service owner", http.StatusBadRequest)
+			http.Error(w, i18n.T(locale, i18n.RegisterFailed), registerStatus(err))
 			return
 		}
 
 		w.WriteHeader(http.StatusCreated)
-		if _, err := w.Write([]byte("Registered for section\n")); err != nil {
+		if _, err := w.Write([]byte(s.registered(i18n.Registered, watcher))); err != nil {
 			log.Error().Msgf("error writing register response: %s", err)
 		}
-		log.Info().Msgf("Register request succeeded: %s*%d*%s*%s for %s", req.Section.Course.Department, req.Section.Course.Code, req.Section.Code, req.Section.Term, req.Watcher.Email)
+		log.Info().Msgf("Register request succeeded: %s*%d*%s*%s for %s", req.Section.Course.Department, req.Section.Course.Code, req.Section.Code, req.Section.Term, watcher)
+	}
+}
+
+// an explicit locale wins over the Accept-Language header. Unsupported ones are kept for validation to reject
+func watcherLocale(r *http.Request, explicit string) string {
+	if explicit == "" {
+		return i18n.Match(r.Header.Get("Accept-Language"))
+	}
+
+	if locale, ok := i18n.Normalize(explicit); ok {
+		return locale
+	}
+
+	return explicit
+}
+
+func (s Server) registerGroup(w http.ResponseWriter, r *http.Request, group coursesense.WatchGroup) {
+	if err := s.registrationService.RegisterGroup(r.Context(), group); err != nil {
+		log.Error().Msgf("group registration failed: %s", err)
+		http.Error(w, i18n.T(group.Watcher.Locale, i18n.RegisterGroupFailed), registerStatus(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	if _, err := w.Write([]byte(s.registered(i18n.RegisteredGroup, group.Watcher))); err != nil {
+		log.Error().Msgf("error writing register response: %s", err)
+	}
+	log.Info().Msgf("Register request succeeded: %s for %s", group, group.Watcher)
+}
+
+// addresses sent too many verification emails are asked to come back later, other failures are the request's fault
+func registerStatus(err error) int {
+	if errors.Is(err, coursesense.ErrTooManyVerifications) {
+		return http.StatusTooManyRequests
+	}
+
+	return http.StatusBadRequest
+}
+
+// returns the register response in the watcher's locale, asking watchers with a pending watch to confirm it
+func (s Server) registered(message i18n.Key, watcher coursesense.Watcher) string {
+	if s.verificationService != nil && !s.verificationService.Deadline(watcher).IsZero() {
+		return i18n.T(watcher.Locale, message) + i18n.T(watcher.Locale, i18n.ConfirmByEmail) + "\n"
+	}
+
+	return i18n.T(watcher.Locale, message) + "\n"
+}
+
+type ConflictsRequest struct {
+	Sections  []coursesense.Section `json:"sections"`
+	Timetable coursesense.Timetable `json:"timetable"`
+}
+
+func (r ConflictsRequest) Valid() error {
+	if len(r.Sections) == 0 {
+		return errors.New("at least one section is required")
+	}
+
+	for _, section := range r.Sections {
+		if err := section.Valid(); err != nil {
+			return err
+		}
+	}
+
+	return r.Timetable.Valid()
+}
+
+type SectionConflict struct {
+	Section      coursesense.Section `json:"section"`
+	ConflictFree bool                `json:"conflict_free"`
+}
+
+// reports which of the requested sections fit around a timetable
+func (s Server) conflictsHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		log.Info().Msg("Conflicts request received")
+
+		var req ConflictsRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			log.Error().Msgf("error decoding conflicts request: %s", err)
+			http.Error(w, "Failed to parse request", http.StatusBadRequest)
+			return
+		}
+
+		if err := req.Valid(); err != nil {
+			log.Error().Msgf("conflicts request invalid: %s", err)
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		conflicts, err := s.conflictService.Conflicts(r.Context(), req.Timetable, req.Sections)
+		if err != nil {
+			log.Error().Msgf("conflict check failed: %s", err)
+			http.Error(w, "Failed to check for conflicts, please ensure the sections exist. If error persists please contact service owner", http.StatusBadRequest)
+			return
+		}
+
+		notification := coursesense.Notification{Sections: req.Sections, Conflicts: conflicts}
+		results := make([]SectionConflict, 0, len(req.Sections))
+		for _, section := range req.Sections {
+			results = append(results, SectionConflict{Section: section, ConflictFree: notification.ConflictFree(section)})
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(results); err != nil {
+			log.Error().Msgf("error writing conflicts response: %s", err)
+		}
+	}
+}
+
+// rejects requests without the admin bearer token
+func (s Server) admin(next httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(s.adminToken)) != 1 {
+			log.Error().Msgf("unauthorized admin request to %s", r.URL.Path)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		next(w, r, p)
+	}
+}
+
+// lists the notification jobs that were dead-lettered
+func (s Server) failedJobsHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		log.Info().Msg("Failed jobs request received")
+
+		jobs, err := s.outboxService.FailedJobs(r.Context())
+		if err != nil {
+			log.Error().Msgf("failed to get failed jobs: %s", err)
+			http.Error(w, "Failed to get failed jobs", http.StatusInternalServerError)
+			return
+		}
+
+		if jobs == nil {
+			jobs = []coursesense.Job{}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(jobs); err != nil {
+			log.Error().Msgf("error writing failed jobs response: %s", err)
+		}
+	}
+}
+
+// removes the watches of an unsubscribe link. The token is the only credential
+func (s Server) unsubscribeHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		log.Info().Msg("Unsubscribe request received")
+
+		err := s.unsubscribeService.Unsubscribe(r.Context(), r.URL.Query().Get("token"))
+		switch {
+		case errors.Is(err, coursesense.ErrExpiredToken):
+			http.Error(w, "This link has expired", http.StatusGone)
+			return
+		case errors.Is(err, coursesense.ErrInvalidToken):
+			log.Error().Msgf("unsubscribe token rejected: %s", err)
+			http.Error(w, "This link is invalid", http.StatusBadRequest)
+			return
+		case err != nil:
+			log.Error().Msgf("unsubscribe failed: %s", err)
+			http.Error(w, "Unsubscribe failed, please try again later", http.StatusInternalServerError)
+			return
+		}
+
+		if _, err := w.Write([]byte("You have stopped watching these sections\n")); err != nil {
+			log.Error().Msgf("error writing unsubscribe response: %s", err)
+		}
+	}
+}
+
+var verifyForm = template.Must(template.New("verify").Parse(`<!DOCTYPE html>
+<html>
+<body style="font-family: sans-serif; color: #222;">
+<form method="post" action="/verify">
+<input type="hidden" name="token" value="{{.}}">
+<p>Confirm your Course Sense watch to start receiving notifications.</p>
+<button type="submit">Confirm</button>
+</form>
+</body>
+</html>
+`))
+
+func (s Server) verifyFormHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := verifyForm.Execute(w, r.URL.Query().Get("token")); err != nil {
+			log.Error().Msgf("error writing verify form: %s", err)
+		}
+	}
+}
+
+// activates the pending watch of a verification link. The token is the only credential
+func (s Server) verifyHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		log.Info().Msg("Verify request received")
+
+		err := s.verificationService.Verify(r.Context(), r.FormValue("token"))
+		switch {
+		case errors.Is(err, coursesense.ErrExpiredToken):
+			http.Error(w, "This link has expired, please register again", http.StatusGone)
+			return
+		case errors.Is(err, coursesense.ErrWatchNotFound):
+			http.Error(w, "This watch no longer exists, please register again", http.StatusNotFound)
+			return
+		case errors.Is(err, coursesense.ErrInvalidToken):
+			log.Error().Msgf("verification token rejected: %s", err)
+			http.Error(w, "This link is invalid", http.StatusBadRequest)
+			return
+		case err != nil:
+			log.Error().Msgf("verification failed: %s", err)
+			http.Error(w, "Verification failed, please try again later", http.StatusInternalServerError)
+			return
+		}
+
+		if _, err := w.Write([]byte("Your watch is active, we will let you know when space opens up\n")); err != nil {
+			log.Error().Msgf("error writing verify response: %s", err)
+		}
+	}
+}
+
+// passes updates posted by Telegram on to the bot. The secret header is the only credential
+func (s Server) telegramHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+		if err != nil {
+			log.Error().Msgf("error reading telegram update: %s", err)
+			http.Error(w, "Failed to read update", http.StatusBadRequest)
+			return
+		}
+
+		err = s.telegramService.HandleUpdate(r.Context(), r.Header.Get("X-Telegram-Bot-Api-Secret-Token"), body)
+		switch {
+		case errors.Is(err, coursesense.ErrInvalidToken):
+			log.Error().Msgf("telegram update rejected: %s", err)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		case err != nil:
+			log.Error().Msgf("telegram update failed: %s", err)
+			http.Error(w, "Invalid update", http.StatusBadRequest)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+var mailList = template.Must(template.New("mail").Parse(`<!DOCTYPE html>
+<html>
+<head><title>Captured email</title></head>
+<body style="font-family: sans-serif; color: #222;">
+<h1>Captured email</h1>
+{{- if .}}
+<table cellpadding="6">
+<tr><th align="left">Date</th><th align="left">To</th><th align="left">Subject</th><th></th></tr>
+{{- range .}}
+<tr>
+<td>{{.Date.Format "2006-01-02 15:04:05"}}</td>
+<td>{{.To}}</td>
+<td><a href="/dev/mail/{{.ID}}?part=html">{{.Subject}}</a></td>
+<td><a href="/dev/mail/{{.ID}}?part=text">text</a> <a href="/dev/mail/{{.ID}}">source</a></td>
+</tr>
+{{- end}}
+</table>
+{{- else}}
+<p>Nothing captured yet.</p>
+{{- end}}
+</body>
+</html>
+`))
+
+// lists the emails captured by the mail sink, newest first
+func (s Server) mailListHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		emails, err := s.mailSinkService.Emails(r.Context())
+		if err != nil {
+			log.Error().Msgf("failed to list captured emails: %s", err)
+			http.Error(w, "Failed to list captured emails", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := mailList.Execute(w, emails); err != nil {
+			log.Error().Msgf("error writing mail list: %s", err)
+		}
+	}
+}
+
+// shows a captured email. The part query parameter picks the html or text body, the full source is shown without it
+func (s Server) mailHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		email, err := s.mailSinkService.Email(r.Context(), p.ByName("id"))
+		switch {
+		case errors.Is(err, coursesense.ErrEmailNotFound):
+			http.Error(w, "Email not found", http.StatusNotFound)
+			return
+		case err != nil:
+			log.Error().Msgf("failed to read captured email: %s", err)
+			http.Error(w, "Failed to read captured email", http.StatusInternalServerError)
+			return
+		}
+
+		body := email.Raw
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		switch r.URL.Query().Get("part") {
+		case "html":
+			// anything can be sent to the sink's smtp server, so captured emails don't get to run scripts
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Header().Set("Content-Security-Policy", "script-src 'none'")
+			body = []byte(email.HTML)
+		case "text":
+			body = []byte(email.Text)
+		}
+
+		if _, err := w.Write(body); err != nil {
+			log.Error().Msgf("error writing captured email: %s", err)
+		}
+	}
+}
+
+// puts a dead-lettered job back in the queue
+func (s Server) replayJobHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		id := p.ByName("id")
+		log.Info().Msgf("Replay request received for job %s", id)
+
+		if err := s.outboxService.Replay(r.Context(), id); err != nil {
+			log.Error().Msgf("replay failed: %s", err)
+			http.Error(w, "Replay failed, please ensure the job exists and is dead", http.StatusBadRequest)
+			return
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+		if _, err := w.Write([]byte("Job requeued\n")); err != nil {
+			log.Error().Msgf("error writing replay response: %s", err)
+		}
 	}
 }
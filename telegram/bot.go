@@ -0,0 +1,265 @@
+package telegram
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	coursesense "github.com/jacobmichels/Course-Sense-Go"
+	"github.com/jacobmichels/Course-Sense-Go/i18n"
+)
+
+// Bot implements TelegramService
+var _ coursesense.TelegramService = Bot{}
+
+// a failed long poll is retried after this long
+const pollBackoff = 5 * time.Second
+
+// Answers the commands sent to the bot, linking the chat as a watcher channel:
+// /watch DEPT*CODE*SECTION*TERM, /list, and /stop with an optional section
+type Bot struct {
+	client       Client
+	registration coursesense.RegistrationService
+	repository   coursesense.Repository
+	// sent by Telegram with webhook updates, empty when long polling
+	secret string
+}
+
+func NewBot(client Client, r coursesense.RegistrationService, repository coursesense.Repository, secret string) Bot {
+	return Bot{client, r, repository, secret}
+}
+
+// Poll long polls for updates until the context is cancelled
+func (b Bot) Poll(ctx context.Context, timeout time.Duration) {
+	log.Info().Msgf("starting telegram bot: long polling for %d seconds at a time", int(timeout.Seconds()))
+	// updates are held for getUpdates only while no webhook is set
+	if err := b.client.DeleteWebhook(ctx); err != nil {
+		log.Error().Msgf("failed to delete telegram webhook: %v", err)
+	}
+
+	var offset int64
+	for ctx.Err() == nil {
+		updates, err := b.client.GetUpdates(ctx, offset, timeout)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+
+			log.Error().Msgf("failed to get telegram updates: %v", err)
+			select {
+			case <-ctx.Done():
+			case <-time.After(pollBackoff):
+			}
+			continue
+		}
+
+		for _, update := range updates {
+			b.handle(ctx, update)
+			// acknowledges the update, Telegram drops it on the next poll
+			offset = update.ID + 1
+		}
+	}
+}
+
+// SetWebhook has Telegram post updates to the URL, which should lead to HandleUpdate
+func (b Bot) SetWebhook(ctx context.Context, url string) error {
+	if err := b.client.SetWebhook(ctx, url, b.secret); err != nil {
+		return fmt.Errorf("failed to set telegram webhook: %w", err)
+	}
+
+	log.Info().Msgf("telegram updates will be posted to %s", url)
+	return nil
+}
+
+func (b Bot) HandleUpdate(ctx context.Context, secret string, body []byte) error {
+	if b.secret == "" || subtle.ConstantTimeCompare([]byte(secret), []byte(b.secret)) != 1 {
+		return fmt.Errorf("%w: telegram webhook secret doesn't match", coursesense.ErrInvalidToken)
+	}
+
+	var update Update
+	if err := json.Unmarshal(body, &update); err != nil {
+		return fmt.Errorf("failed to decode telegram update: %w", err)
+	}
+
+	b.handle(ctx, update)
+	return nil
+}
+
+// answers a command. Failures are only logged, an update is never handled twice
+func (b Bot) handle(ctx context.Context, update Update) {
+	if update.Message == nil {
+		return
+	}
+
+	command, arg := parseCommand(update.Message.Text)
+	if command == "" {
+		return
+	}
+
+	chat := strconv.FormatInt(update.Message.Chat.ID, 10)
+	var locale string
+	if update.Message.From != nil {
+		locale, _ = i18n.Normalize(update.Message.From.LanguageCode)
+	}
+
+	log.Info().Msgf("Telegram %s command received", command)
+
+	var reply string
+	switch command {
+	case "/watch":
+		reply = b.watch(ctx, chat, locale, arg)
+	case "/list":
+		reply = b.list(ctx, chat, locale)
+	case "/stop":
+		reply = b.stop(ctx, chat, locale, arg)
+	default:
+		reply = i18n.T(locale, i18n.BotHelp)
+	}
+
+	if err := b.client.SendMessage(ctx, update.Message.Chat.ID, reply); err != nil {
+		log.Error().Msgf("failed to answer telegram %s command: %v", command, err)
+	}
+}
+
+// returns the command, without the bot's name appended in group chats, and its argument
+func parseCommand(text string) (string, string) {
+	fields := strings.Fields(text)
+	if len(fields) == 0 || !strings.HasPrefix(fields[0], "/") {
+		return "", ""
+	}
+
+	command, _, _ := strings.Cut(fields[0], "@")
+	return strings.ToLower(command), strings.Join(fields[1:], " ")
+}
+
+func (b Bot) watch(ctx context.Context, chat, locale, arg string) string {
+	section, err := coursesense.ParseSection(strings.ToUpper(arg))
+	if err != nil || section.Valid() != nil {
+		return i18n.T(locale, i18n.BotBadSection, arg)
+	}
+
+	// the chat proved it is reachable by messaging the bot
+	watcher := coursesense.Watcher{
+		Channels: []coursesense.Channel{{Kind: coursesense.ChannelTelegram, Address: chat, Verified: true, Preference: coursesense.PreferenceAll}},
+		Locale:   locale,
+	}
+	if err := b.registration.Register(ctx, section, watcher); err != nil {
+		log.Error().Msgf("telegram registration failed: %v", err)
+		return i18n.T(locale, i18n.BotWatchFailed, section)
+	}
+
+	log.Info().Msgf("Telegram chat registered for %s", section)
+	return i18n.T(locale, i18n.BotWatching, section)
+}
+
+func (b Bot) list(ctx context.Context, chat, locale string) string {
+	watches, err := b.watches(ctx, chat)
+	if err != nil {
+		log.Error().Msgf("failed to list telegram watches: %v", err)
+		return i18n.T(locale, i18n.BotFailed)
+	}
+
+	if len(watches) == 0 {
+		return i18n.T(locale, i18n.BotNoWatches)
+	}
+
+	var lines []string
+	for _, watch := range watches {
+		lines = append(lines, "- "+watch.String())
+	}
+
+	return i18n.T(locale, i18n.BotWatches, strings.Join(lines, "\n"))
+}
+
+// removes every watch of the chat, or only the one named
+func (b Bot) stop(ctx context.Context, chat, locale, arg string) string {
+	watches, err := b.watches(ctx, chat)
+	if err != nil {
+		log.Error().Msgf("failed to list telegram watches: %v", err)
+		return i18n.T(locale, i18n.BotFailed)
+	}
+
+	target := strings.ToUpper(arg)
+	var stopped []string
+	for _, watch := range watches {
+		if target != "" && watch.String() != target {
+			continue
+		}
+
+		if watch.group != nil {
+			err = b.repository.RemoveWatchGroup(ctx, watch.group.ID)
+		} else {
+			err = b.repository.RemoveWatcher(ctx, watch.section, watch.watcher)
+		}
+		if err != nil {
+			log.Error().Msgf("failed to remove telegram watch on %s: %v", watch, err)
+			return i18n.T(locale, i18n.BotFailed)
+		}
+		stopped = append(stopped, watch.String())
+	}
+
+	switch {
+	case len(stopped) > 0:
+		return i18n.T(locale, i18n.BotStopped, strings.Join(stopped, ", "))
+	case target != "":
+		return i18n.T(locale, i18n.BotNotWatching, target)
+	default:
+		return i18n.T(locale, i18n.BotNoWatches)
+	}
+}
+
+// a chat's watch on a section, or a watch group
+type chatWatch struct {
+	section coursesense.Section
+	watcher coursesense.Watcher
+	group   *coursesense.WatchGroup
+}
+
+func (w chatWatch) String() string {
+	if w.group != nil {
+		return w.group.String()
+	}
+
+	return w.section.String()
+}
+
+// returns the watches of every watcher the chat is linked to, including those registered through the API
+func (b Bot) watches(ctx context.Context, chat string) ([]chatWatch, error) {
+	sections, err := b.repository.GetWatchedSections(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get watched sections: %w", err)
+	}
+
+	var watches []chatWatch
+	for _, section := range sections {
+		watchers, err := b.repository.GetWatchers(ctx, section)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get watchers for %s: %w", section, err)
+		}
+
+		for _, watcher := range watchers {
+			if watcher.Address(coursesense.ChannelTelegram) == chat {
+				watches = append(watches, chatWatch{section: section, watcher: watcher})
+			}
+		}
+	}
+
+	groups, err := b.repository.GetWatchGroups(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get watch groups: %w", err)
+	}
+
+	for i := range groups {
+		if groups[i].Watcher.Address(coursesense.ChannelTelegram) == chat {
+			watches = append(watches, chatWatch{group: &groups[i]})
+		}
+	}
+
+	return watches, nil
+}
@@ -0,0 +1,218 @@
+package telegram
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	coursesense "github.com/jacobmichels/Course-Sense-Go"
+	"github.com/jacobmichels/Course-Sense-Go/config"
+	"github.com/jacobmichels/Course-Sense-Go/i18n"
+	"github.com/jacobmichels/Course-Sense-Go/register"
+	"github.com/jacobmichels/Course-Sense-Go/repository"
+)
+
+const chatID = 42
+
+var (
+	course = coursesense.Course{Department: "CIS", Code: 2750}
+	first  = coursesense.Section{Course: course, Code: "0101", Term: "F23"}
+	second = coursesense.Section{Course: course, Code: "0102", Term: "F23"}
+)
+
+type stubSections struct{}
+
+func (stubSections) Exists(ctx context.Context, section coursesense.Section) (bool, error) {
+	return true, nil
+}
+
+func (stubSections) GetAvailableSeats(ctx context.Context, section coursesense.Section) (uint, error) {
+	return 0, nil
+}
+
+func (stubSections) GetCourseSections(ctx context.Context, course coursesense.Course, term string) (map[coursesense.Section]uint, error) {
+	return map[coursesense.Section]uint{first: 0, second: 0}, nil
+}
+
+func (stubSections) GetMeetings(ctx context.Context, section coursesense.Section) ([]coursesense.Meeting, error) {
+	return nil, nil
+}
+
+// stands in for the Bot API, recording the messages the bot sends
+type stubAPI struct {
+	mu       sync.Mutex
+	messages []string
+}
+
+func (s *stubAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var params struct {
+		ChatID int64  `json:"chat_id"`
+		Text   string `json:"text"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil || !strings.HasSuffix(r.URL.Path, "/sendMessage") {
+		w.Write([]byte(`{"ok":false,"error_code":400,"description":"Bad Request"}`))
+		return
+	}
+
+	s.mu.Lock()
+	s.messages = append(s.messages, params.Text)
+	s.mu.Unlock()
+
+	w.Write([]byte(`{"ok":true,"result":{}}`))
+}
+
+// returns the messages sent since the last call
+func (s *stubAPI) sent() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	messages := s.messages
+	s.messages = nil
+	return messages
+}
+
+func newBot(t *testing.T, secret string) (Bot, *stubAPI, coursesense.Repository) {
+	t.Helper()
+
+	api := &stubAPI{}
+	srv := httptest.NewServer(api)
+	t.Cleanup(srv.Close)
+
+	repo, err := repository.New(context.Background(), config.Database{Type: "memory"})
+	if err != nil {
+		t.Fatalf("failed to create repository: %v", err)
+	}
+
+	return NewBot(NewClient(srv.URL, "token"), register.NewRegister(stubSections{}, repo, nil, nil), repo, secret), api, repo
+}
+
+// an update carrying a message from the chat, as Telegram posts it
+func update(chat int64, text, language string) []byte {
+	body, _ := json.Marshal(Update{ID: 1, Message: &Message{ID: 1, Chat: Chat{ID: chat}, From: &User{LanguageCode: language}, Text: text}})
+	return body
+}
+
+func TestParseCommand(t *testing.T) {
+	tests := []struct {
+		text, command, arg string
+	}{
+		{"/watch CIS*2750*0101*F23", "/watch", "CIS*2750*0101*F23"},
+		{"/WATCH@coursesense_bot  cis*2750*0101*f23 ", "/watch", "cis*2750*0101*f23"},
+		{"/list", "/list", ""},
+		{"/stop a b", "/stop", "a b"},
+		{"hello", "", ""},
+		{"", "", ""},
+	}
+
+	for _, test := range tests {
+		command, arg := parseCommand(test.text)
+		if command != test.command || arg != test.arg {
+			t.Errorf("parseCommand(%q) = %q, %q, want %q, %q", test.text, command, arg, test.command, test.arg)
+		}
+	}
+}
+
+func TestHandleUpdateChecksSecret(t *testing.T) {
+	tests := []struct {
+		name    string
+		secret  string
+		given   string
+		wantErr bool
+	}{
+		{name: "matching secret", secret: "s3cret", given: "s3cret"},
+		{name: "wrong secret", secret: "s3cret", given: "guess", wantErr: true},
+		{name: "missing secret", secret: "s3cret", given: "", wantErr: true},
+		{name: "no secret configured", secret: "", given: "", wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			bot, api, _ := newBot(t, test.secret)
+
+			err := bot.HandleUpdate(context.Background(), test.given, update(chatID, "/list", ""))
+			if test.wantErr {
+				if !errors.Is(err, coursesense.ErrInvalidToken) {
+					t.Fatalf("got %v, want ErrInvalidToken", err)
+				}
+				if sent := api.sent(); len(sent) != 0 {
+					t.Fatalf("answered %v to an update that wasn't from Telegram", sent)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("failed to handle update: %v", err)
+			}
+			if sent := api.sent(); len(sent) != 1 {
+				t.Fatalf("got replies %v, want one", sent)
+			}
+		})
+	}
+}
+
+func TestHandleUpdateRejectsMalformedBodies(t *testing.T) {
+	bot, _, _ := newBot(t, "s3cret")
+	if err := bot.HandleUpdate(context.Background(), "s3cret", []byte("{")); err == nil {
+		t.Fatal("handled a malformed update")
+	}
+}
+
+func TestCommands(t *testing.T) {
+	ctx := context.Background()
+	bot, api, repo := newBot(t, "s3cret")
+
+	// another chat's watch is never listed or stopped
+	other := coursesense.Watcher{Channels: []coursesense.Channel{{Kind: coursesense.ChannelTelegram, Address: "7", Verified: true}}}
+	if _, err := repo.AddWatcher(ctx, first, other); err != nil {
+		t.Fatalf("failed to add watcher: %v", err)
+	}
+
+	steps := []struct {
+		text     string
+		language string
+		want     string
+	}{
+		{text: "hello", want: ""},
+		{text: "/start", want: i18n.T("", i18n.BotHelp)},
+		{text: "/list", want: i18n.T("", i18n.BotNoWatches)},
+		{text: "/watch CIS*2750", want: i18n.T("", i18n.BotBadSection, "CIS*2750")},
+		{text: "/watch cis*2750*0101*f23", want: i18n.T("", i18n.BotWatching, first)},
+		{text: "/watch@coursesense_bot CIS*2750*0102*F23", language: "fr-CA", want: i18n.T("fr", i18n.BotWatching, second)},
+		{text: "/list", want: i18n.T("", i18n.BotWatches, "- "+first.String()+"\n- "+second.String())},
+		{text: "/stop CIS*2750*0103*F23", want: i18n.T("", i18n.BotNotWatching, "CIS*2750*0103*F23")},
+		{text: "/stop cis*2750*0102*f23", want: i18n.T("", i18n.BotStopped, second)},
+		{text: "/list", want: i18n.T("", i18n.BotWatches, "- "+first.String())},
+		{text: "/stop", want: i18n.T("", i18n.BotStopped, first)},
+		{text: "/stop", want: i18n.T("", i18n.BotNoWatches)},
+	}
+
+	for _, step := range steps {
+		if err := bot.HandleUpdate(ctx, "s3cret", update(chatID, step.text, step.language)); err != nil {
+			t.Fatalf("failed to handle %q: %v", step.text, err)
+		}
+
+		sent := api.sent()
+		if step.want == "" {
+			if len(sent) != 0 {
+				t.Fatalf("answered %v to %q, want no reply", sent, step.text)
+			}
+			continue
+		}
+		if len(sent) != 1 || sent[0] != step.want {
+			t.Fatalf("got replies %q to %q, want %q", sent, step.text, step.want)
+		}
+	}
+
+	watchers, err := repo.GetWatchers(ctx, first)
+	if err != nil {
+		t.Fatalf("failed to get watchers: %v", err)
+	}
+	if len(watchers) != 1 || watchers[0].Address(coursesense.ChannelTelegram) != "7" {
+		t.Fatalf("got watchers %v, want only the other chat's", watchers)
+	}
+}
@@ -0,0 +1,198 @@
+package telegram
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// calls other than long polls are given this long when the context has no deadline
+	callTimeout = 10 * time.Second
+	// rate limited calls are retried this many times, if Telegram asks to wait no longer than maxRetryAfter
+	maxAttempts   = 3
+	maxRetryAfter = 30 * time.Second
+)
+
+// Calls the Telegram Bot API
+type Client struct {
+	http *http.Client
+	// API root, e.g. https://api.telegram.org
+	baseURL string
+	token   string
+}
+
+func NewClient(baseURL, token string) Client {
+	// no client timeout, long polls hold the request open. Every call is bounded by its context instead
+	return Client{&http.Client{}, strings.TrimSuffix(baseURL, "/"), token}
+}
+
+// APIError is an unsuccessful response from the Bot API
+type APIError struct {
+	Method      string
+	Code        int
+	Description string
+	// set when rate limited
+	RetryAfter time.Duration
+}
+
+func (e APIError) Error() string {
+	return fmt.Sprintf("telegram %s failed with %d: %s", e.Method, e.Code, e.Description)
+}
+
+type response struct {
+	OK          bool            `json:"ok"`
+	Result      json.RawMessage `json:"result"`
+	ErrorCode   int             `json:"error_code"`
+	Description string          `json:"description"`
+	Parameters  struct {
+		RetryAfter int `json:"retry_after"`
+	} `json:"parameters"`
+}
+
+// Update is an incoming update, only messages are requested
+type Update struct {
+	ID      int64    `json:"update_id"`
+	Message *Message `json:"message"`
+}
+
+type Message struct {
+	ID   int64  `json:"message_id"`
+	Chat Chat   `json:"chat"`
+	From *User  `json:"from"`
+	Text string `json:"text"`
+}
+
+type Chat struct {
+	ID int64 `json:"id"`
+}
+
+type User struct {
+	// IETF language tag of the user's client, may be empty
+	LanguageCode string `json:"language_code"`
+}
+
+func (c Client) SendMessage(ctx context.Context, chatID int64, text string) error {
+	params := map[string]any{"chat_id": chatID, "text": text, "disable_web_page_preview": true}
+	return c.call(ctx, "sendMessage", params, nil)
+}
+
+// GetUpdates long polls for the updates after offset, waiting up to timeout for one to arrive
+func (c Client) GetUpdates(ctx context.Context, offset int64, timeout time.Duration) ([]Update, error) {
+	// the request is allowed to outlast the poll
+	pollCtx, cancel := context.WithTimeout(ctx, timeout+callTimeout)
+	defer cancel()
+
+	params := map[string]any{"offset": offset, "timeout": int(timeout.Seconds()), "allowed_updates": []string{"message"}}
+	var updates []Update
+	if err := c.call(pollCtx, "getUpdates", params, &updates); err != nil {
+		return nil, err
+	}
+
+	return updates, nil
+}
+
+// SetWebhook has Telegram post updates to the URL along with the secret, instead of holding them for GetUpdates
+func (c Client) SetWebhook(ctx context.Context, url, secret string) error {
+	params := map[string]any{"url": url, "secret_token": secret, "allowed_updates": []string{"message"}}
+	return c.call(ctx, "setWebhook", params, nil)
+}
+
+// DeleteWebhook switches back to GetUpdates, which Telegram refuses while a webhook is set
+func (c Client) DeleteWebhook(ctx context.Context) error {
+	return c.call(ctx, "deleteWebhook", map[string]any{}, nil)
+}
+
+// calls a method, decoding its result into result unless it is nil. Rate limited calls are retried
+func (c Client) call(ctx context.Context, method string, params any, result any) error {
+	body, err := json.Marshal(params)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s params: %w", method, err)
+	}
+
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, callTimeout)
+		defer cancel()
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := c.do(ctx, method, body, result)
+
+		var apiErr APIError
+		if !errors.As(err, &apiErr) || apiErr.RetryAfter == 0 || attempt == maxAttempts || apiErr.RetryAfter > maxRetryAfter {
+			return err
+		}
+
+		log.Debug().Msgf("rate limited by telegram, retrying %s in %s", method, apiErr.RetryAfter)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(apiErr.RetryAfter):
+		}
+	}
+}
+
+func (c Client) do(ctx context.Context, method string, body []byte, result any) error {
+	req, err := http.NewRequestWithContext(ctx, "POST", fmt.Sprintf("%s/bot%s/%s", c.baseURL, c.token, method), bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := c.http.Do(req)
+	if err != nil {
+		// the error holds the URL, which holds the token
+		return fmt.Errorf("telegram %s request failed: %w", method, redact(err, c.token))
+	}
+	defer res.Body.Close()
+
+	var decoded response
+	if err := json.NewDecoder(io.LimitReader(res.Body, 1<<20)).Decode(&decoded); err != nil {
+		return fmt.Errorf("failed to decode telegram %s response with status %s: %w", method, res.Status, err)
+	}
+
+	if !decoded.OK {
+		return APIError{Method: method, Code: decoded.ErrorCode, Description: decoded.Description, RetryAfter: time.Duration(decoded.Parameters.RetryAfter) * time.Second}
+	}
+
+	if result == nil {
+		return nil
+	}
+
+	if err := json.Unmarshal(decoded.Result, result); err != nil {
+		return fmt.Errorf("failed to decode telegram %s result: %w", method, err)
+	}
+
+	return nil
+}
+
+type redactedError struct {
+	message string
+	err     error
+}
+
+func (e redactedError) Error() string {
+	return e.message
+}
+
+func (e redactedError) Unwrap() error {
+	return e.err
+}
+
+// hides the bot token in an error message, keeping the error itself for errors.Is
+func redact(err error, token string) error {
+	if token == "" {
+		return err
+	}
+
+	return redactedError{strings.ReplaceAll(err.Error(), token, "<token>"), err}
+}
@@ -0,0 +1,105 @@
+package timetable
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	coursesense "github.com/jacobmichels/Course-Sense-Go"
+)
+
+// Checker implements CachingConflictService
+var _ coursesense.CachingConflictService = Checker{}
+
+type Checker struct {
+	sectionService coursesense.SectionService
+	// nil unless the checker was made by WithMeetingCache
+	cache *meetingCache
+}
+
+// meetings per section, so a section in several timetables or notifications is only looked up once
+type meetingCache struct {
+	mu       sync.Mutex
+	meetings map[coursesense.Section][]coursesense.Meeting
+}
+
+func NewChecker(s coursesense.SectionService) Checker {
+	return Checker{s, nil}
+}
+
+// returns a checker that looks up the meetings of each section at most once, meant to last a single trigger
+func (c Checker) WithMeetingCache() coursesense.ConflictService {
+	return Checker{c.sectionService, &meetingCache{meetings: make(map[coursesense.Section][]coursesense.Meeting)}}
+}
+
+func (c Checker) Conflicts(ctx context.Context, timetable coursesense.Timetable, sections []coursesense.Section) ([]coursesense.Section, error) {
+	// Conflict steps
+	// 1. Collect the timetable's busy blocks, looking up the meeting times of its sections
+	// 2. Look up the meeting times of each candidate section
+	// 3. Any candidate with a meeting overlapping a busy block is a conflict
+
+	if timetable.Empty() {
+		return nil, nil
+	}
+
+	busy := append([]coursesense.Meeting{}, timetable.Meetings...)
+	for _, section := range timetable.Sections {
+		meetings, err := c.meetings(ctx, section)
+		if err != nil {
+			return nil, err
+		}
+
+		busy = append(busy, meetings...)
+	}
+
+	var conflicts []coursesense.Section
+	for _, section := range sections {
+		meetings, err := c.meetings(ctx, section)
+		if err != nil {
+			return nil, err
+		}
+
+		if overlaps(meetings, busy) {
+			conflicts = append(conflicts, section)
+		}
+	}
+
+	return conflicts, nil
+}
+
+// returns the meeting times of a section, looking them up only if the cache doesn't have them
+func (c Checker) meetings(ctx context.Context, section coursesense.Section) ([]coursesense.Meeting, error) {
+	if c.cache != nil {
+		c.cache.mu.Lock()
+		meetings, ok := c.cache.meetings[section]
+		c.cache.mu.Unlock()
+		if ok {
+			return meetings, nil
+		}
+	}
+
+	meetings, err := c.sectionService.GetMeetings(ctx, section)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get meetings for %s: %w", section, err)
+	}
+
+	if c.cache != nil {
+		c.cache.mu.Lock()
+		c.cache.meetings[section] = meetings
+		c.cache.mu.Unlock()
+	}
+
+	return meetings, nil
+}
+
+func overlaps(meetings, busy []coursesense.Meeting) bool {
+	for _, meeting := range meetings {
+		for _, block := range busy {
+			if meeting.Overlaps(block) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
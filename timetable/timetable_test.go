@@ -0,0 +1,118 @@
+package timetable
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	coursesense "github.com/jacobmichels/Course-Sense-Go"
+)
+
+var (
+	course   = coursesense.Course{Department: "CIS", Code: 2750}
+	lecture  = coursesense.Section{Course: course, Code: "0101", Term: "F23"}
+	clashing = coursesense.Section{Course: course, Code: "0102", Term: "F23"}
+	free     = coursesense.Section{Course: course, Code: "0103", Term: "F23"}
+)
+
+// serves fixed meetings, counting the lookups of each section
+type countingSections struct {
+	meetings map[coursesense.Section][]coursesense.Meeting
+	lookups  map[coursesense.Section]int
+}
+
+func (s countingSections) Exists(ctx context.Context, section coursesense.Section) (bool, error) {
+	return true, nil
+}
+
+func (s countingSections) GetAvailableSeats(ctx context.Context, section coursesense.Section) (uint, error) {
+	return 0, nil
+}
+
+func (s countingSections) GetCourseSections(ctx context.Context, course coursesense.Course, term string) (map[coursesense.Section]uint, error) {
+	return nil, nil
+}
+
+func (s countingSections) GetMeetings(ctx context.Context, section coursesense.Section) ([]coursesense.Meeting, error) {
+	s.lookups[section]++
+	return s.meetings[section], nil
+}
+
+func newSections() countingSections {
+	return countingSections{
+		meetings: map[coursesense.Section][]coursesense.Meeting{
+			lecture:  {{Days: []time.Weekday{time.Monday, time.Wednesday}, Start: "10:00", End: "11:20"}},
+			clashing: {{Days: []time.Weekday{time.Wednesday}, Start: "11:00", End: "12:00"}},
+			free:     {{Days: []time.Weekday{time.Tuesday}, Start: "10:00", End: "11:20"}},
+		},
+		lookups: make(map[coursesense.Section]int),
+	}
+}
+
+func TestConflicts(t *testing.T) {
+	tests := []struct {
+		name      string
+		timetable coursesense.Timetable
+		want      []coursesense.Section
+	}{
+		{"empty timetable", coursesense.Timetable{}, nil},
+		{"timetable section", coursesense.Timetable{Sections: []coursesense.Section{lecture}}, []coursesense.Section{clashing}},
+		{"busy block", coursesense.Timetable{Meetings: []coursesense.Meeting{{Days: []time.Weekday{time.Tuesday}, Start: "09:00", End: "10:30"}}}, []coursesense.Section{free}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			checker := NewChecker(newSections())
+			got, err := checker.Conflicts(context.Background(), test.timetable, []coursesense.Section{clashing, free})
+			if err != nil {
+				t.Fatalf("failed to check conflicts: %v", err)
+			}
+
+			if len(got) != len(test.want) {
+				t.Fatalf("got conflicts %v, want %v", got, test.want)
+			}
+			for i := range got {
+				if got[i] != test.want[i] {
+					t.Fatalf("got conflicts %v, want %v", got, test.want)
+				}
+			}
+		})
+	}
+}
+
+func TestConflictsMeetingCache(t *testing.T) {
+	timetable := coursesense.Timetable{Sections: []coursesense.Section{lecture}}
+	candidates := []coursesense.Section{clashing, free}
+
+	tests := []struct {
+		name   string
+		cached bool
+		// lookups of each section after three checks
+		want int
+	}{
+		{"uncached", false, 3},
+		{"cached", true, 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sections := newSections()
+			var checker coursesense.ConflictService = NewChecker(sections)
+			if test.cached {
+				checker = NewChecker(sections).WithMeetingCache()
+			}
+
+			for i := 0; i < 3; i++ {
+				if _, err := checker.Conflicts(context.Background(), timetable, candidates); err != nil {
+					t.Fatalf("failed to check conflicts: %v", err)
+				}
+			}
+
+			for _, section := range []coursesense.Section{lecture, clashing, free} {
+				if sections.lookups[section] != test.want {
+					t.Fatalf("got %d lookups of %s, want %d", sections.lookups[section], section, test.want)
+				}
+			}
+		})
+	}
+}
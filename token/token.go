@@ -0,0 +1,95 @@
+package token
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	coursesense "github.com/jacobmichels/Course-Sense-Go"
+)
+
+// Signs claims into tokens that can be put in links, and checks them when the links are followed
+type Signer struct {
+	secret []byte
+}
+
+func NewSigner(secret string) Signer {
+	return Signer{[]byte(secret)}
+}
+
+// the signed part of a token
+type envelope struct {
+	// what the token is for, so a token made for one kind of link can't be used for another
+	Purpose string          `json:"p"`
+	Expires int64           `json:"e"`
+	Claims  json.RawMessage `json:"c"`
+}
+
+// Sign returns a url safe token holding the claims, valid until the expiry
+func (s Signer) Sign(purpose string, claims any, expires time.Time) (string, error) {
+	encoded, err := json.Marshal(claims)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode claims: %w", err)
+	}
+
+	body, err := json.Marshal(envelope{purpose, expires.Unix(), encoded})
+	if err != nil {
+		return "", fmt.Errorf("failed to encode token: %w", err)
+	}
+
+	payload := base64.RawURLEncoding.EncodeToString(body)
+	return payload + "." + base64.RawURLEncoding.EncodeToString(s.mac(payload)), nil
+}
+
+// Verify checks that the token was signed for the purpose and hasn't expired, decoding its claims
+func (s Signer) Verify(purpose, token string, now time.Time, claims any) error {
+	payload, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return fmt.Errorf("%w: missing signature", coursesense.ErrInvalidToken)
+	}
+
+	decoded, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(decoded, s.mac(payload)) {
+		return fmt.Errorf("%w: bad signature", coursesense.ErrInvalidToken)
+	}
+
+	body, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return fmt.Errorf("%w: %v", coursesense.ErrInvalidToken, err)
+	}
+
+	var e envelope
+	if err := json.Unmarshal(body, &e); err != nil {
+		return fmt.Errorf("%w: %v", coursesense.ErrInvalidToken, err)
+	}
+
+	if e.Purpose != purpose {
+		return fmt.Errorf("%w: signed for %q", coursesense.ErrInvalidToken, e.Purpose)
+	}
+
+	if now.Unix() > e.Expires {
+		return coursesense.ErrExpiredToken
+	}
+
+	if err := json.Unmarshal(e.Claims, claims); err != nil {
+		return fmt.Errorf("%w: %v", coursesense.ErrInvalidToken, err)
+	}
+
+	return nil
+}
+
+func (s Signer) mac(payload string) []byte {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
+
+// WatcherID identifies a watcher in a token without revealing its contact details
+func WatcherID(watcher coursesense.Watcher) string {
+	sum := sha256.Sum256([]byte(watcher.ContactKey()))
+	return base64.RawURLEncoding.EncodeToString(sum[:16])
+}
@@ -3,32 +3,59 @@ package trigger
 import (
 	"context"
 	"fmt"
+	"math"
+	"sort"
+	"time"
 
 	"github.com/rs/zerolog/log"
 
 	coursesense "github.com/jacobmichels/Course-Sense-Go"
+	"github.com/jacobmichels/Course-Sense-Go/config"
 )
 
 // Trigger implements TriggerService
 var _ coursesense.TriggerService = Trigger{}
 
 type Trigger struct {
-	sectionService coursesense.SectionService
-	watcherService coursesense.Repository
-	notifiers      []coursesense.Notifier
+	sectionService  coursesense.SectionService
+	watcherService  coursesense.Repository
+	conflictService coursesense.ConflictService
+	cfg             config.Notifications
+	notifiers       []coursesense.Notifier
 }
 
-func NewTrigger(s coursesense.SectionService, w coursesense.Repository, n ...coursesense.Notifier) Trigger {
-	return Trigger{s, w, n}
+func NewTrigger(s coursesense.SectionService, w coursesense.Repository, c coursesense.ConflictService, cfg config.Notifications, n ...coursesense.Notifier) Trigger {
+	return Trigger{s, w, c, cfg, n}
 }
 
+// available seats per section, so sections shared by several watches are only polled once per trigger
+type seatCache map[coursesense.Section]uint
+
+// sections broadcast during a trigger, so a section watched by several watches is only broadcast once
+type announcements map[coursesense.Section]bool
+
 // This function triggers a poll of webadvisor
 func (t Trigger) Trigger(ctx context.Context) error {
 	// Trigger steps
-	// 1. Get all watched sections from the watcher service
-	// 2. Loop over the sections, checking the available capacity on each
-	// 3. If availability is found, use the notifiers to notify the watchers for that section
-	// 4. Remove said watchers once successfully notified
+	// 1. Purge expired watches so they are no longer polled, and pending watches that were never confirmed
+	// 2. Get all watched sections from the watcher service
+	// 3. Loop over the sections, checking the available capacity on each
+	// 4. If availability is found, queue notification jobs for the watchers of that section, holding back for those in quiet hours.
+	//    In fair mode only as many watchers as there are seats are notified, in registration order
+	// 5. Remove said watchers in the same transaction as the jobs are queued, the outbox worker delivers them
+	// 6. Repeat for watch groups, notifying once with every section in the group that has seats.
+	//    Whole course watches resolve the course's current sections first
+	// 7. Openings for watchers in digest mode are gathered into their digest instead, and due digests are sent
+	// Broadcast notifiers get one job per opening, when it first reaches or holds a watcher, regardless of timetables, digests or quiet hours
+	// Watches still waiting on their watcher to confirm their email are skipped throughout
+
+	if err := t.purgeExpired(ctx); err != nil {
+		return fmt.Errorf("failed to purge expired watches: %w", err)
+	}
+
+	if err := t.purgeUnverified(ctx); err != nil {
+		return fmt.Errorf("failed to purge unverified watches: %w", err)
+	}
 
 	sections, err := t.watcherService.GetWatchedSections(ctx)
 	if err != nil {
@@ -37,36 +64,622 @@ func (t Trigger) Trigger(ctx context.Context) error {
 
 	if len(sections) == 0 {
 		log.Info().Msg("No watched sections")
-		return nil
 	}
 
+	// t is a copy, so the cached conflict service only lasts this trigger and meetings are looked up again on the next
+	if c, ok := t.conflictService.(coursesense.CachingConflictService); ok {
+		t.conflictService = c.WithMeetingCache()
+	}
+
+	seats := make(seatCache)
+	announced := make(announcements)
 	for _, section := range sections {
-		available, err := t.sectionService.GetAvailableSeats(ctx, section)
+		available, err := t.availableSeats(ctx, seats, section)
 		if err != nil {
-			return fmt.Errorf("failed to get available seats for %s: %w", section, err)
+			return err
 		}
 
-		log.Info().Msgf("%d available seats found for %s", available, section)
+		watchers, err := t.watcherService.GetWatchers(ctx, section)
+		if err != nil {
+			return fmt.Errorf("failed to get watchers for %s: %w", section, err)
+		}
 
 		if available == 0 {
+			if err := t.releaseHeld(ctx, section, watchers); err != nil {
+				return err
+			}
 			continue
 		}
 
-		watchers, err := t.watcherService.GetWatchers(ctx, section)
-		if err != nil {
-			return fmt.Errorf("failed to get watchers for %s: %w", section, err)
+		if err := t.notifySection(ctx, announced, section, available, watchers); err != nil {
+			return err
+		}
+	}
+
+	groups, err := t.watcherService.GetWatchGroups(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get watch groups: %w", err)
+	}
+
+	for _, group := range groups {
+		if err := t.triggerGroup(ctx, seats, announced, group); err != nil {
+			return err
+		}
+	}
+
+	return t.flushDigests(ctx)
+}
+
+// returns the available seats in a section, polling webadvisor only if the section hasn't been polled during this trigger
+func (t Trigger) availableSeats(ctx context.Context, seats seatCache, section coursesense.Section) (uint, error) {
+	if available, ok := seats[section]; ok {
+		return available, nil
+	}
+
+	available, err := t.sectionService.GetAvailableSeats(ctx, section)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get available seats for %s: %w", section, err)
+	}
+
+	log.Info().Msgf("%d available seats found for %s", available, section)
+	seats[section] = available
+
+	return available, nil
+}
+
+// notifies a section's watchers of available seats, respecting quiet hours, timetables and fair mode
+// watchers outside their quiet hours are notified and removed. Watchers inside them only receive urgent notifiers
+// and stay registered, so the held notifications go out on the first poll after the window ends if seats are still open.
+// Watchers skipping openings that conflict with their timetable also stay registered, as do watchers queued by fair mode
+func (t Trigger) notifySection(ctx context.Context, announced announcements, section coursesense.Section, available uint, watchers []coursesense.Watcher) error {
+	now := time.Now()
+	notification := seatNotification(section, available)
+
+	limit := len(watchers)
+	if t.cfg.Fair.Enabled {
+		sort.SliceStable(watchers, func(i, j int) bool { return watchers[i].Position < watchers[j].Position })
+		limit = t.fairLimit(available)
+	}
+
+	// some watchers stay registered: pending, queued, skipping a conflict, or in quiet hours
+	remaining := 0
+	var plain, notified, digested []coursesense.Watcher
+	var jobs []coursesense.Job
+	for _, watcher := range watchers {
+		// pending watchers don't take a place in the fair queue
+		if watcher.Pending() {
+			remaining++
+			continue
 		}
 
-		for _, notifier := range t.notifiers {
-			err := notifier.Notify(ctx, section, watchers...)
+		if len(notified)+len(digested) == limit {
+			remaining++
+			continue
+		}
+
+		if watcher.Digest {
+			personal, ok, err := t.personalize(ctx, notification, watcher)
 			if err != nil {
-				return fmt.Errorf("failed to notify watchers for %s: %w", section, err)
+				return err
+			}
+
+			if !ok {
+				remaining++
+				continue
+			}
+
+			if err := t.addToDigest(ctx, personal, watcher, now); err != nil {
+				return err
+			}
+			digested = append(digested, watcher)
+			continue
+		}
+
+		if watcher.Timetable.Empty() {
+			plain = append(plain, watcher)
+			notified = append(notified, watcher)
+			continue
+		}
+
+		personal, ok, err := t.personalize(ctx, notification, watcher)
+		if err != nil {
+			return err
+		}
+
+		if !ok {
+			remaining++
+			continue
+		}
+
+		jobs = append(jobs, t.jobs(personal, []coursesense.Watcher{watcher}, now)...)
+		notified = append(notified, watcher)
+	}
+
+	jobs = append(jobs, t.jobs(notification, plain, now)...)
+
+	// the opening is in their digest, which takes care of quiet hours when it is sent
+	update := coursesense.SectionUpdate{Section: section, Remove: digested}
+	for _, watcher := range notified {
+		if !watcher.InQuietHours(now) {
+			update.Remove = append(update.Remove, watcher)
+			continue
+		}
+
+		remaining++
+		if !watcher.Held {
+			watcher.Held = true
+			update.Update = append(update.Update, watcher)
+		}
+	}
+
+	// held watchers were reached when the opening was broadcast, so it is only broadcast again for watchers new to it
+	var reached []coursesense.Watcher
+	broadcast := false
+	for _, watcher := range append(append([]coursesense.Watcher{}, notified...), digested...) {
+		reached = append(reached, watcher)
+		broadcast = broadcast || !watcher.Held
+	}
+	broadcast = broadcast && !announced[section]
+	if broadcast {
+		jobs = append(jobs, t.broadcastJobs(notification, reached)...)
+	}
+
+	if remaining > 0 {
+		log.Info().Int("count", remaining).Msgf("keeping watchers of %s that are pending, queued, in quiet hours or skipping conflicts", section)
+	}
+
+	if len(update.Remove) == 0 && len(update.Update) == 0 && len(jobs) == 0 {
+		return nil
+	}
+
+	if err := t.watcherService.SettleSection(ctx, update, jobs...); err != nil {
+		return fmt.Errorf("failed to queue notifications for %s: %w", section, err)
+	}
+
+	if broadcast {
+		announced[section] = true
+	}
+
+	return nil
+}
+
+// clears the held flag of a closed section's watchers, so the next opening reaches them like any other.
+// Held watchers still registered never had their held delivery go out, the seats were taken before their quiet hours ended
+func (t Trigger) releaseHeld(ctx context.Context, section coursesense.Section, watchers []coursesense.Watcher) error {
+	update := coursesense.SectionUpdate{Section: section}
+	for _, watcher := range watchers {
+		if watcher.Held {
+			watcher.Held = false
+			update.Update = append(update.Update, watcher)
+		}
+	}
+
+	if len(update.Update) == 0 {
+		return nil
+	}
+
+	if err := t.watcherService.SettleSection(ctx, update); err != nil {
+		return fmt.Errorf("failed to release held watchers of %s: %w", section, err)
+	}
+	log.Info().Int("count", len(update.Update)).Msgf("released held watchers of %s, its seats closed", section)
+
+	return nil
+}
+
+func seatNotification(section coursesense.Section, available uint) coursesense.Notification {
+	return coursesense.Notification{
+		Kind:     coursesense.NotificationSeatsAvailable,
+		Sections: []coursesense.Section{section},
+		Seats:    map[coursesense.Section]uint{section: available},
+	}
+}
+
+// returns how many watchers fair mode notifies for the given number of open seats
+func (t Trigger) fairLimit(available uint) int {
+	limit := int(math.Ceil(float64(available) * t.cfg.Fair.Multiplier))
+	if limit < 1 {
+		return 1
+	}
+
+	return limit
+}
+
+// tailors a seat notification to a watcher's timetable, flagging the sections that conflict with it
+// if the watcher skips conflicts those sections are dropped instead, and false is returned when none are left
+func (t Trigger) personalize(ctx context.Context, notification coursesense.Notification, watcher coursesense.Watcher) (coursesense.Notification, bool, error) {
+	if watcher.Timetable.Empty() {
+		return notification, true, nil
+	}
+
+	conflicts, err := t.conflictService.Conflicts(ctx, watcher.Timetable, notification.Sections)
+	if err != nil {
+		return coursesense.Notification{}, false, fmt.Errorf("failed to check %s's timetable: %w", watcher, err)
+	}
+
+	if !watcher.Timetable.SkipConflicts {
+		notification.Conflicts = conflicts
+		return notification, true, nil
+	}
+
+	var sections []coursesense.Section
+	for _, section := range notification.Sections {
+		if !contains(conflicts, section) {
+			sections = append(sections, section)
+		}
+	}
+
+	if len(sections) == 0 {
+		log.Info().Msgf("skipping openings that conflict with %s's timetable", watcher)
+		return coursesense.Notification{}, false, nil
+	}
+
+	notification.Sections = sections
+	return notification, true, nil
+}
+
+func contains(sections []coursesense.Section, section coursesense.Section) bool {
+	for _, s := range sections {
+		if s == section {
+			return true
+		}
+	}
+
+	return false
+}
+
+// checks every section in a group, notifying the watcher once with all sections that have seats
+// expired groups are removed without being polled
+func (t Trigger) triggerGroup(ctx context.Context, seats seatCache, announced announcements, group coursesense.WatchGroup) error {
+	now := time.Now()
+
+	// unconfirmed groups are left for purgeUnverified, without expiry notices to an address that may not be theirs
+	if group.Watcher.Pending() {
+		return nil
+	}
+
+	if group.Watcher.Expired(now) {
+		var notices []coursesense.Job
+		if t.cfg.NotifyOnExpiry {
+			notices = t.expiryJobs(groupNotification(coursesense.NotificationWatchExpired, group, group.Sections), group.Watcher)
+		}
+
+		if err := t.watcherService.RemoveWatchGroup(ctx, group.ID, notices...); err != nil {
+			return fmt.Errorf("failed to remove expired group %s: %w", group, err)
+		}
+		log.Info().Msgf("purged expired watch group %s", group)
+
+		return nil
+	}
+
+	sections := group.Sections
+	if group.WholeCourse() {
+		var err error
+		if sections, err = t.courseSections(ctx, seats, group); err != nil {
+			return err
+		}
+	}
+
+	var open []coursesense.Section
+	for _, section := range sections {
+		available, err := t.availableSeats(ctx, seats, section)
+		if err != nil {
+			return err
+		}
+
+		if available > 0 {
+			open = append(open, section)
+		}
+	}
+
+	if len(open) == 0 {
+		// the opening the watcher was held for closed, the next one reaches them like any other
+		if group.Watcher.Held {
+			group.Watcher.Held = false
+			if err := t.watcherService.UpdateWatchGroup(ctx, group); err != nil {
+				return fmt.Errorf("failed to release held group %s: %w", group, err)
+			}
+		}
+		return nil
+	}
+
+	notification := groupNotification(coursesense.NotificationSeatsAvailable, group, open)
+	notification.Seats = make(map[coursesense.Section]uint, len(open))
+	for _, section := range open {
+		notification.Seats[section] = seats[section]
+	}
+
+	notification, ok, err := t.personalize(ctx, notification, group.Watcher)
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		return nil
+	}
+
+	// the open sections not yet broadcast, unless a held watcher's opening was broadcast when they were held
+	var broadcast []coursesense.Section
+	var jobs []coursesense.Job
+	if !group.Watcher.Held {
+		for _, section := range open {
+			if !announced[section] {
+				broadcast = append(broadcast, section)
+				jobs = append(jobs, t.broadcastJobs(seatNotification(section, seats[section]), []coursesense.Watcher{group.Watcher})...)
+			}
+		}
+	}
+
+	if group.Watcher.Digest {
+		if err := t.addToDigest(ctx, notification, group.Watcher, now); err != nil {
+			return err
+		}
+
+		if err := t.watcherService.RemoveWatchGroup(ctx, group.ID, jobs...); err != nil {
+			return fmt.Errorf("failed to remove group %s: %w", group, err)
+		}
+		announce(announced, broadcast)
+		return nil
+	}
+
+	jobs = append(jobs, t.jobs(notification, []coursesense.Watcher{group.Watcher}, now)...)
+
+	if !group.Watcher.InQuietHours(now) {
+		if err := t.watcherService.RemoveWatchGroup(ctx, group.ID, jobs...); err != nil {
+			return fmt.Errorf("failed to remove group %s: %w", group, err)
+		}
+		announce(announced, broadcast)
+		return nil
+	}
+
+	log.Info().Msgf("holding notifications for watch group %s in quiet hours", group)
+
+	// broadcast and urgent notifiers only fire on the poll the watcher is held
+	if !group.Watcher.Held {
+		group.Watcher.Held = true
+		if err := t.watcherService.UpdateWatchGroup(ctx, group, jobs...); err != nil {
+			return fmt.Errorf("failed to update group %s: %w", group, err)
+		}
+		announce(announced, broadcast)
+	}
+
+	return nil
+}
+
+func announce(announced announcements, sections []coursesense.Section) {
+	for _, section := range sections {
+		announced[section] = true
+	}
+}
+
+// resolves the current sections of a whole course watch, so sections added after registration are included
+// the seats found are cached for the rest of the trigger
+func (t Trigger) courseSections(ctx context.Context, seats seatCache, group coursesense.WatchGroup) ([]coursesense.Section, error) {
+	courseSeats, err := t.sectionService.GetCourseSections(ctx, group.Course, group.Term)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get sections of %s: %w", group, err)
+	}
+
+	var sections []coursesense.Section
+	for section, available := range courseSeats {
+		seats[section] = available
+		sections = append(sections, section)
+	}
+
+	sort.Slice(sections, func(i, j int) bool { return sections[i].Code < sections[j].Code })
+	log.Info().Int("count", len(sections)).Msgf("resolved sections of %s", group)
+
+	return sections, nil
+}
+
+func groupNotification(kind coursesense.NotificationKind, group coursesense.WatchGroup, sections []coursesense.Section) coursesense.Notification {
+	notification := coursesense.Notification{Kind: kind, Sections: sections}
+	if group.WholeCourse() {
+		course := group.Course
+		notification.Course = &course
+		notification.Term = group.Term
+	}
+
+	return notification
+}
+
+// returns the jobs delivering a notification, one per notifier with watchers it should reach right now
+// through a channel they chose. Broadcast notifiers are left to broadcastJobs
+func (t Trigger) jobs(notification coursesense.Notification, watchers []coursesense.Watcher, now time.Time) []coursesense.Job {
+	var jobs []coursesense.Job
+	for _, notifier := range t.notifiers {
+		if broadcasts(notifier) {
+			continue
+		}
+
+		if composite, ok := notifier.(coursesense.CompositeNotifier); ok {
+			if job, ok := compositeJob(composite, notification, watchers, now); ok {
+				jobs = append(jobs, job)
+			}
+			continue
+		}
+
+		var recipients []coursesense.Watcher
+		for _, watcher := range watchers {
+			if routes(notifier, watcher, notification.Kind) && deliverNow(notifier.Urgent(), watcher, now) {
+				recipients = append(recipients, watcher)
+			}
+		}
+
+		if len(recipients) == 0 {
+			continue
+		}
+
+		jobs = append(jobs, coursesense.Job{Notifier: notifier.Name(), Notification: notification, Watchers: recipients})
+	}
+
+	return jobs
+}
+
+// returns the job delivering a notification through the parts of a composite that should reach each watcher right now.
+// Reports false if no part should
+func compositeJob(composite coursesense.CompositeNotifier, notification coursesense.Notification, watchers []coursesense.Watcher, now time.Time) (coursesense.Job, bool) {
+	job := coursesense.Job{Notifier: composite.Name(), Notification: notification, Parts: make(map[string][]string)}
+	for _, watcher := range watchers {
+		if !composite.Routes(watcher, notification.Kind) {
+			continue
+		}
+
+		reached := false
+		for _, part := range composite.Parts() {
+			if deliverNow(part.Urgent, watcher, now) {
+				job.Parts[part.Name] = append(job.Parts[part.Name], watcher.ContactKey())
+				reached = true
 			}
 		}
 
-		if err := t.watcherService.Cleanup(ctx, section); err != nil {
-			return fmt.Errorf("failed to cleanup section %s: %w", section, err)
+		if reached {
+			job.Watchers = append(job.Watchers, watcher)
+		}
+	}
+
+	return job, len(job.Watchers) > 0
+}
+
+// returns a job per broadcast notifier announcing an opening to destinations of its own. Broadcasts aren't personal,
+// so they go out right away whatever the watchers' timetables, digests or quiet hours
+func (t Trigger) broadcastJobs(notification coursesense.Notification, watchers []coursesense.Watcher) []coursesense.Job {
+	var jobs []coursesense.Job
+	for _, notifier := range t.notifiers {
+		if broadcasts(notifier) {
+			jobs = append(jobs, coursesense.Job{Notifier: notifier.Name(), Notification: notification, Watchers: watchers})
+		}
+	}
+
+	return jobs
+}
+
+// reports whether the watcher wants notifications of the given kind from a notifier
+// broadcast notifiers don't reach the watcher through a channel of theirs, so they are always given the watcher
+func routes(notifier coursesense.Notifier, watcher coursesense.Watcher, kind coursesense.NotificationKind) bool {
+	if composite, ok := notifier.(coursesense.CompositeNotifier); ok {
+		return composite.Routes(watcher, kind)
+	}
+
+	channel := notifier.Channel()
+	return channel == "" || watcher.Routes(channel, kind)
+}
+
+// reports whether the notifier posts to destinations of its own rather than reaching watchers through their channels
+func broadcasts(notifier coursesense.Notifier) bool {
+	if _, ok := notifier.(coursesense.CompositeNotifier); ok {
+		return false
+	}
+
+	return notifier.Channel() == ""
+}
+
+// decides whether an urgent or regular notifier should deliver a seat notification to a watcher at the given time
+func deliverNow(urgent bool, watcher coursesense.Watcher, now time.Time) bool {
+	if !watcher.InQuietHours(now) {
+		// urgent notifiers already reached held watchers during quiet hours, unless the watcher held them too
+		return !(watcher.Held && urgent && !watcher.QuietHours.HoldUrgent)
+	}
+
+	return urgent && !watcher.Held && !watcher.QuietHours.HoldUrgent
+}
+
+// removes expired watches, letting their watchers know if configured to
+func (t Trigger) purgeExpired(ctx context.Context) error {
+	var notices func(coursesense.Watch) []coursesense.Job
+	if t.cfg.NotifyOnExpiry {
+		notices = func(watch coursesense.Watch) []coursesense.Job {
+			if watch.Watcher.Pending() {
+				return nil
+			}
+			notification := coursesense.Notification{Kind: coursesense.NotificationWatchExpired, Sections: []coursesense.Section{watch.Section}}
+			return t.expiryJobs(notification, watch.Watcher)
+		}
+	}
+
+	expired, err := t.watcherService.PurgeExpired(ctx, time.Now(), notices)
+	if err != nil {
+		return err
+	}
+
+	if len(expired) > 0 {
+		log.Info().Int("count", len(expired)).Msg("purged expired watches")
+	}
+
+	return nil
+}
+
+// removes pending watches whose watchers didn't confirm their email in time
+func (t Trigger) purgeUnverified(ctx context.Context) error {
+	purged, err := t.watcherService.PurgeUnverified(ctx, time.Now())
+	if err != nil {
+		return err
+	}
+
+	if purged > 0 {
+		log.Info().Int("count", purged).Msg("purged unverified watches")
+	}
+
+	return nil
+}
+
+// returns the jobs letting a watcher know their watch expired, through every notifier they chose regardless of quiet hours
+func (t Trigger) expiryJobs(notification coursesense.Notification, watcher coursesense.Watcher) []coursesense.Job {
+	var jobs []coursesense.Job
+	for _, notifier := range t.notifiers {
+		if !routes(notifier, watcher, notification.Kind) {
+			continue
+		}
+		jobs = append(jobs, coursesense.Job{Notifier: notifier.Name(), Notification: notification, Watchers: []coursesense.Watcher{watcher}})
+	}
+
+	return jobs
+}
+
+// gathers an opening into the watcher's digest, which is sent once the window closes or right away if the opening is urgent.
+// The digest is stored before the watch is removed, so a failure in between at worst gathers the opening twice
+func (t Trigger) addToDigest(ctx context.Context, notification coursesense.Notification, watcher coursesense.Watcher, now time.Time) error {
+	flushAt := now.Add(time.Duration(t.cfg.Digest.WindowSecs) * time.Second)
+	if t.urgent(notification) {
+		flushAt = now
+	}
+
+	digest := coursesense.Digest{Watcher: watcher, Notification: notification, FlushAt: flushAt}
+	if err := t.watcherService.AddToDigest(ctx, digest); err != nil {
+		return fmt.Errorf("failed to add to digest of %s: %w", watcher, err)
+	}
+
+	return nil
+}
+
+// reports whether any opening in the notification is scarce enough that waiting for the digest window would likely miss it
+func (t Trigger) urgent(notification coursesense.Notification) bool {
+	for _, section := range notification.Sections {
+		if notification.Seats[section] <= uint(t.cfg.Digest.UrgentSeats) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// queues the digests that are due. Digests of watchers in quiet hours wait for the window to end
+func (t Trigger) flushDigests(ctx context.Context) error {
+	now := time.Now()
+	digests, err := t.watcherService.GetDueDigests(ctx, now)
+	if err != nil {
+		return fmt.Errorf("failed to get due digests: %w", err)
+	}
+
+	for _, digest := range digests {
+		if digest.Watcher.InQuietHours(now) {
+			continue
+		}
+
+		jobs := t.jobs(digest.Notification, []coursesense.Watcher{digest.Watcher}, now)
+		if err := t.watcherService.FlushDigest(ctx, digest, jobs...); err != nil {
+			return fmt.Errorf("failed to flush digest of %s: %w", digest.Watcher, err)
 		}
+		log.Info().Int("sections", len(digest.Notification.Sections)).Msgf("queued digest for %s", digest.Watcher)
 	}
 
 	return nil
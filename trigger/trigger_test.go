@@ -0,0 +1,426 @@
+package trigger
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	coursesense "github.com/jacobmichels/Course-Sense-Go"
+	"github.com/jacobmichels/Course-Sense-Go/config"
+	"github.com/jacobmichels/Course-Sense-Go/notifier"
+	"github.com/jacobmichels/Course-Sense-Go/repository"
+	"github.com/jacobmichels/Course-Sense-Go/timetable"
+)
+
+var (
+	course  = coursesense.Course{Department: "CIS", Code: 2750}
+	section = coursesense.Section{Course: course, Code: "0101", Term: "F23"}
+	other   = coursesense.Section{Course: course, Code: "0102", Term: "F23"}
+)
+
+type stubSections map[coursesense.Section]uint
+
+func (s stubSections) Exists(ctx context.Context, section coursesense.Section) (bool, error) {
+	_, ok := s[section]
+	return ok, nil
+}
+
+func (s stubSections) GetAvailableSeats(ctx context.Context, section coursesense.Section) (uint, error) {
+	return s[section], nil
+}
+
+func (s stubSections) GetCourseSections(ctx context.Context, course coursesense.Course, term string) (map[coursesense.Section]uint, error) {
+	return s, nil
+}
+
+func (s stubSections) GetMeetings(ctx context.Context, section coursesense.Section) ([]coursesense.Meeting, error) {
+	return nil, nil
+}
+
+// counts the meeting lookups of each section
+type countingSections struct {
+	stubSections
+	lookups map[coursesense.Section]int
+}
+
+func (s countingSections) GetMeetings(ctx context.Context, section coursesense.Section) ([]coursesense.Meeting, error) {
+	s.lookups[section]++
+	return nil, nil
+}
+
+type stubConflicts struct{}
+
+func (stubConflicts) Conflicts(ctx context.Context, timetable coursesense.Timetable, sections []coursesense.Section) ([]coursesense.Section, error) {
+	return nil, nil
+}
+
+type stubNotifier struct {
+	name    string
+	channel coursesense.ChannelKind
+	urgent  bool
+}
+
+func (n stubNotifier) Name() string                     { return n.name }
+func (n stubNotifier) Channel() coursesense.ChannelKind { return n.channel }
+func (n stubNotifier) Urgent() bool                     { return n.urgent }
+
+func (n stubNotifier) Notify(ctx context.Context, notification coursesense.Notification, watchers ...coursesense.Watcher) error {
+	return nil
+}
+
+// digests wait for their window, so the jobs queued are the ones for the opening itself
+var cfg = config.Notifications{Digest: config.Digest{WindowSecs: 3600}}
+
+var notifiers = []coursesense.Notifier{
+	stubNotifier{name: "email", channel: coursesense.ChannelEmail},
+	stubNotifier{name: "sms", channel: coursesense.ChannelSMS, urgent: true},
+	stubNotifier{name: "webhook", urgent: true},
+	stubNotifier{name: "discord-broadcast"},
+}
+
+func emailWatcher(address string) coursesense.Watcher {
+	return coursesense.Watcher{Channels: []coursesense.Channel{{Kind: coursesense.ChannelEmail, Address: address}}}
+}
+
+// quiet hours around the current time, in UTC
+func quietNow() coursesense.QuietHours {
+	now := time.Now().UTC()
+	return coursesense.QuietHours{Start: now.Add(-time.Hour).Format("15:04"), End: now.Add(time.Hour).Format("15:04")}
+}
+
+func newRepository(t *testing.T) coursesense.Repository {
+	t.Helper()
+
+	repo, err := repository.New(context.Background(), config.Database{Type: "memory"})
+	if err != nil {
+		t.Fatalf("failed to create repository: %v", err)
+	}
+
+	return repo
+}
+
+// counts the pending jobs queued for each notifier
+func queued(t *testing.T, repo coursesense.Repository) map[string]int {
+	t.Helper()
+
+	jobs, err := repo.GetJobs(context.Background(), coursesense.JobPending)
+	if err != nil {
+		t.Fatalf("failed to get jobs: %v", err)
+	}
+
+	counts := make(map[string]int)
+	for _, job := range jobs {
+		counts[job.Notifier]++
+	}
+
+	return counts
+}
+
+func TestTriggerBroadcastsOncePerOpening(t *testing.T) {
+	timetabled := emailWatcher("timetable@example.com")
+	timetabled.Timetable = coursesense.Timetable{Sections: []coursesense.Section{other}}
+
+	digested := emailWatcher("digest@example.com")
+	digested.Digest = true
+
+	quiet := emailWatcher("quiet@example.com")
+	quiet.Channels = append(quiet.Channels, coursesense.Channel{Kind: coursesense.ChannelSMS, Address: "+15195551234"})
+	quiet.QuietHours = quietNow()
+
+	tests := []struct {
+		name     string
+		watchers []coursesense.Watcher
+		groups   []coursesense.WatchGroup
+		want     map[string]int
+	}{
+		{
+			name:     "single watcher",
+			watchers: []coursesense.Watcher{emailWatcher("plain@example.com")},
+			want:     map[string]int{"email": 1, "webhook": 1, "discord-broadcast": 1},
+		},
+		{
+			name:     "personalized, digest and quiet watchers",
+			watchers: []coursesense.Watcher{emailWatcher("plain@example.com"), timetabled, digested, quiet},
+			want:     map[string]int{"email": 2, "sms": 1, "webhook": 1, "discord-broadcast": 1},
+		},
+		{
+			name:     "only watchers in quiet hours",
+			watchers: []coursesense.Watcher{quiet},
+			want:     map[string]int{"sms": 1, "webhook": 1, "discord-broadcast": 1},
+		},
+		{
+			name:     "section also watched by a group",
+			watchers: []coursesense.Watcher{emailWatcher("plain@example.com")},
+			groups:   []coursesense.WatchGroup{{Course: course, Term: "F23", Sections: []coursesense.Section{section}, Watcher: emailWatcher("group@example.com")}},
+			want:     map[string]int{"email": 2, "webhook": 1, "discord-broadcast": 1},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			repo := newRepository(t)
+			for _, watcher := range test.watchers {
+				if _, err := repo.AddWatcher(ctx, section, watcher); err != nil {
+					t.Fatalf("failed to add watcher: %v", err)
+				}
+			}
+			for _, group := range test.groups {
+				if _, err := repo.AddWatchGroup(ctx, group); err != nil {
+					t.Fatalf("failed to add group: %v", err)
+				}
+			}
+
+			trigger := NewTrigger(stubSections{section: 5}, repo, stubConflicts{}, cfg, notifiers...)
+			if err := trigger.Trigger(ctx); err != nil {
+				t.Fatalf("trigger failed: %v", err)
+			}
+
+			got := queued(t, repo)
+			for notifier, want := range test.want {
+				if got[notifier] != want {
+					t.Errorf("%s: got %d jobs, want %d", notifier, got[notifier], want)
+				}
+			}
+			if len(got) != len(test.want) {
+				t.Errorf("got jobs for %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestTriggerDoesNotBroadcastHeldWatchersAgain(t *testing.T) {
+	ctx := context.Background()
+	repo := newRepository(t)
+
+	quiet := emailWatcher("quiet@example.com")
+	quiet.QuietHours = quietNow()
+	if _, err := repo.AddWatcher(ctx, section, quiet); err != nil {
+		t.Fatalf("failed to add watcher: %v", err)
+	}
+
+	trigger := NewTrigger(stubSections{section: 5}, repo, stubConflicts{}, cfg, notifiers...)
+	if err := trigger.Trigger(ctx); err != nil {
+		t.Fatalf("trigger failed: %v", err)
+	}
+	if got := queued(t, repo); got["webhook"] != 1 || got["discord-broadcast"] != 1 {
+		t.Fatalf("got jobs %v when the watcher was held, want one broadcast each", got)
+	}
+
+	// a poll during the window changes nothing
+	if err := trigger.Trigger(ctx); err != nil {
+		t.Fatalf("trigger failed: %v", err)
+	}
+	if got := queued(t, repo); got["webhook"] != 1 || got["discord-broadcast"] != 1 || got["email"] != 0 {
+		t.Fatalf("got jobs %v during quiet hours, want the first broadcast only", got)
+	}
+
+	// the window ends
+	watchers, err := repo.GetWatchers(ctx, section)
+	if err != nil {
+		t.Fatalf("failed to get watchers: %v", err)
+	}
+	if len(watchers) != 1 || !watchers[0].Held {
+		t.Fatalf("got watchers %v, want the held watcher", watchers)
+	}
+	watchers[0].QuietHours = coursesense.QuietHours{}
+	if err := repo.UpdateWatcher(ctx, section, watchers[0]); err != nil {
+		t.Fatalf("failed to update watcher: %v", err)
+	}
+
+	if err := trigger.Trigger(ctx); err != nil {
+		t.Fatalf("trigger failed: %v", err)
+	}
+	if got := queued(t, repo); got["webhook"] != 1 || got["discord-broadcast"] != 1 || got["email"] != 1 {
+		t.Fatalf("got jobs %v after quiet hours, want one broadcast and the held email", got)
+	}
+}
+
+func TestTriggerHoldsCompositePartsOnTheirOwn(t *testing.T) {
+	ctx := context.Background()
+	repo := newRepository(t)
+
+	multi, err := notifier.NewMulti("multi",
+		notifier.Child{Notifier: notifiers[0], Policy: notifier.PolicyRequired},
+		notifier.Child{Notifier: notifiers[1], Policy: notifier.PolicyRequired},
+	)
+	if err != nil {
+		t.Fatalf("failed to create multi notifier: %v", err)
+	}
+
+	quiet := emailWatcher("quiet@example.com")
+	quiet.Channels = append(quiet.Channels, coursesense.Channel{Kind: coursesense.ChannelSMS, Address: "+15195551234"})
+	quiet.QuietHours = quietNow()
+	if _, err := repo.AddWatcher(ctx, section, quiet); err != nil {
+		t.Fatalf("failed to add watcher: %v", err)
+	}
+
+	// parts of the pending jobs, by name
+	parts := func() []string {
+		jobs, err := repo.GetJobs(ctx, coursesense.JobPending)
+		if err != nil {
+			t.Fatalf("failed to get jobs: %v", err)
+		}
+
+		var names []string
+		for _, job := range jobs {
+			for name, keys := range job.Parts {
+				if len(keys) != 1 || keys[0] != quiet.ContactKey() {
+					t.Fatalf("got part %s reaching %v, want the quiet watcher", name, keys)
+				}
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+
+		return names
+	}
+
+	trigger := NewTrigger(stubSections{section: 5}, repo, stubConflicts{}, cfg, multi)
+	if err := trigger.Trigger(ctx); err != nil {
+		t.Fatalf("trigger failed: %v", err)
+	}
+	if got := parts(); strings.Join(got, ",") != "sms" {
+		t.Fatalf("got parts %v during quiet hours, want only the urgent sms", got)
+	}
+
+	// the window ends
+	watchers, err := repo.GetWatchers(ctx, section)
+	if err != nil {
+		t.Fatalf("failed to get watchers: %v", err)
+	}
+	if len(watchers) != 1 || !watchers[0].Held {
+		t.Fatalf("got watchers %v, want the held watcher", watchers)
+	}
+	watchers[0].QuietHours = coursesense.QuietHours{}
+	if err := repo.UpdateWatcher(ctx, section, watchers[0]); err != nil {
+		t.Fatalf("failed to update watcher: %v", err)
+	}
+
+	if err := trigger.Trigger(ctx); err != nil {
+		t.Fatalf("trigger failed: %v", err)
+	}
+	if got := parts(); strings.Join(got, ",") != "email,sms" {
+		t.Fatalf("got parts %v after quiet hours, want the held email queued after the sms", got)
+	}
+}
+
+// completes every pending job, as the outbox does once they are delivered
+func deliver(t *testing.T, repo coursesense.Repository) {
+	t.Helper()
+
+	jobs, err := repo.GetJobs(context.Background(), coursesense.JobPending)
+	if err != nil {
+		t.Fatalf("failed to get jobs: %v", err)
+	}
+	for _, job := range jobs {
+		if err := repo.CompleteJob(context.Background(), job.ID); err != nil {
+			t.Fatalf("failed to complete job: %v", err)
+		}
+	}
+}
+
+func TestTriggerReleasesHeldWatchersWhenSeatsClose(t *testing.T) {
+	quiet := emailWatcher("quiet@example.com")
+	quiet.Channels = append(quiet.Channels, coursesense.Channel{Kind: coursesense.ChannelSMS, Address: "+15195551234"})
+	quiet.QuietHours = quietNow()
+
+	tests := []struct {
+		name  string
+		watch func(ctx context.Context, repo coursesense.Repository) error
+		// reports whether the watcher is held
+		held func(ctx context.Context, repo coursesense.Repository) (bool, error)
+	}{
+		{
+			name: "section watcher",
+			watch: func(ctx context.Context, repo coursesense.Repository) error {
+				_, err := repo.AddWatcher(ctx, section, quiet)
+				return err
+			},
+			held: func(ctx context.Context, repo coursesense.Repository) (bool, error) {
+				watchers, err := repo.GetWatchers(ctx, section)
+				return len(watchers) == 1 && watchers[0].Held, err
+			},
+		},
+		{
+			name: "group",
+			watch: func(ctx context.Context, repo coursesense.Repository) error {
+				_, err := repo.AddWatchGroup(ctx, coursesense.WatchGroup{Course: course, Term: "F23", Sections: []coursesense.Section{section}, Watcher: quiet})
+				return err
+			},
+			held: func(ctx context.Context, repo coursesense.Repository) (bool, error) {
+				groups, err := repo.GetWatchGroups(ctx)
+				return len(groups) == 1 && groups[0].Watcher.Held, err
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			repo := newRepository(t)
+			if err := test.watch(ctx, repo); err != nil {
+				t.Fatalf("failed to add watch: %v", err)
+			}
+
+			sections := stubSections{section: 5}
+			trigger := NewTrigger(sections, repo, stubConflicts{}, cfg, notifiers...)
+			want := map[string]int{"sms": 1, "webhook": 1, "discord-broadcast": 1}
+
+			// opens in quiet hours, then closes, then opens again
+			for i, seats := range []uint{5, 0, 5} {
+				sections[section] = seats
+				if err := trigger.Trigger(ctx); err != nil {
+					t.Fatalf("trigger failed: %v", err)
+				}
+
+				held, err := test.held(ctx, repo)
+				if err != nil {
+					t.Fatalf("failed to get watch: %v", err)
+				}
+				if held != (seats > 0) {
+					t.Fatalf("poll %d with %d seats: got held %v", i, seats, held)
+				}
+
+				got := queued(t, repo)
+				if seats == 0 && len(got) != 0 {
+					t.Fatalf("poll %d: got jobs %v once the seats closed", i, got)
+				}
+				if seats > 0 && (len(got) != len(want) || got["sms"] != 1 || got["webhook"] != 1 || got["discord-broadcast"] != 1) {
+					t.Fatalf("poll %d: got jobs %v, want the sms and broadcasts", i, got)
+				}
+				deliver(t, repo)
+			}
+		})
+	}
+}
+
+func TestTriggerLooksUpMeetingsOncePerTrigger(t *testing.T) {
+	ctx := context.Background()
+	repo := newRepository(t)
+
+	sections := countingSections{stubSections{section: 5, other: 0}, make(map[coursesense.Section]int)}
+	trigger := NewTrigger(sections, repo, timetable.NewChecker(sections), cfg, notifiers...)
+
+	for poll := 1; poll <= 2; poll++ {
+		// every watcher shares a timetable, and is removed once notified
+		for _, address := range []string{"a@example.com", "b@example.com", "c@example.com"} {
+			watcher := emailWatcher(address)
+			watcher.Timetable = coursesense.Timetable{Sections: []coursesense.Section{other}}
+			if _, err := repo.AddWatcher(ctx, section, watcher); err != nil {
+				t.Fatalf("failed to add watcher: %v", err)
+			}
+		}
+
+		if err := trigger.Trigger(ctx); err != nil {
+			t.Fatalf("trigger failed: %v", err)
+		}
+
+		// the cache only lasts a trigger, so each poll looks the sections up once more
+		if sections.lookups[section] != poll || sections.lookups[other] != poll {
+			t.Fatalf("poll %d: got meeting lookups %v, want %d per section", poll, sections.lookups, poll)
+		}
+	}
+}
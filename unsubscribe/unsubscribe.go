@@ -0,0 +1,195 @@
+package unsubscribe
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	coursesense "github.com/jacobmichels/Course-Sense-Go"
+	"github.com/jacobmichels/Course-Sense-Go/token"
+)
+
+// Service implements UnsubscribeService
+var _ coursesense.UnsubscribeService = Service{}
+
+const tokenPurpose = "unsubscribe"
+
+// notifications about more sections than this unsubscribe from the sections' courses instead,
+// keeping links short enough for the List-Unsubscribe header
+const maxSections = 10
+
+type Service struct {
+	repository coursesense.Repository
+	signer     token.Signer
+	// public URL of the server, links point to its /unsubscribe endpoint
+	baseURL string
+	ttl     time.Duration
+}
+
+func NewService(r coursesense.Repository, signer token.Signer, baseURL string, ttl time.Duration) Service {
+	return Service{r, signer, strings.TrimSuffix(baseURL, "/"), ttl}
+}
+
+// what an unsubscribe token identifies: one watcher's watches on some sections or courses
+type claims struct {
+	// hash of the watcher's contact key, so links don't reveal the watcher's other channels
+	Watcher string `json:"w"`
+	// as DEPT*CODE*SECTION*TERM
+	Sections []string `json:"s,omitempty"`
+	// as DEPT*CODE*TERM
+	Courses []string `json:"c,omitempty"`
+}
+
+func (s Service) UnsubscribeURL(notification coursesense.Notification, watcher coursesense.Watcher) string {
+	c := claims{Watcher: token.WatcherID(watcher)}
+	switch {
+	case notification.Course != nil:
+		c.Courses = []string{courseID(*notification.Course, notification.Term)}
+	case len(notification.Sections) > maxSections:
+		seen := make(map[string]bool)
+		for _, section := range notification.Sections {
+			id := courseID(section.Course, section.Term)
+			if !seen[id] {
+				seen[id] = true
+				c.Courses = append(c.Courses, id)
+			}
+		}
+	default:
+		for _, section := range notification.Sections {
+			c.Sections = append(c.Sections, section.String())
+		}
+	}
+
+	signed, err := s.signer.Sign(tokenPurpose, c, time.Now().Add(s.ttl))
+	if err != nil {
+		log.Error().Msgf("failed to sign unsubscribe token: %v", err)
+		return ""
+	}
+
+	return s.baseURL + "/unsubscribe?token=" + url.QueryEscape(signed)
+}
+
+func (s Service) Unsubscribe(ctx context.Context, signed string) error {
+	// Unsubscribe steps
+	// 1. Verify the token and decode the sections and courses it covers
+	// 2. Remove the watcher from every watched section covered
+	// 3. Remove the watcher's watch groups on a covered section or course
+
+	var c claims
+	if err := s.signer.Verify(tokenPurpose, signed, time.Now(), &c); err != nil {
+		return err
+	}
+
+	scope, err := newScope(c)
+	if err != nil {
+		return err
+	}
+
+	sections, err := s.repository.GetWatchedSections(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get watched sections: %w", err)
+	}
+
+	removed := 0
+	for _, section := range sections {
+		if !scope.covers(section) {
+			continue
+		}
+
+		watchers, err := s.repository.GetWatchers(ctx, section)
+		if err != nil {
+			return fmt.Errorf("failed to get watchers for %s: %w", section, err)
+		}
+
+		for _, watcher := range watchers {
+			if token.WatcherID(watcher) != c.Watcher {
+				continue
+			}
+
+			if err := s.repository.RemoveWatcher(ctx, section, watcher); err != nil {
+				return fmt.Errorf("failed to remove watcher from %s: %w", section, err)
+			}
+			removed++
+		}
+	}
+
+	groups, err := s.repository.GetWatchGroups(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get watch groups: %w", err)
+	}
+
+	for _, group := range groups {
+		if token.WatcherID(group.Watcher) != c.Watcher || !scope.coversGroup(group) {
+			continue
+		}
+
+		if err := s.repository.RemoveWatchGroup(ctx, group.ID); err != nil {
+			return fmt.Errorf("failed to remove group %s: %w", group, err)
+		}
+		removed++
+	}
+
+	log.Info().Int("count", removed).Msg("removed watches through unsubscribe link")
+	return nil
+}
+
+func courseID(course coursesense.Course, term string) string {
+	return fmt.Sprintf("%s*%d*%s", course.Department, course.Code, term)
+}
+
+// the sections and courses covered by a token
+type scope struct {
+	sections map[coursesense.Section]bool
+	// keyed by courseID
+	courses map[string]bool
+}
+
+func newScope(c claims) (scope, error) {
+	s := scope{make(map[coursesense.Section]bool), make(map[string]bool)}
+	for _, id := range c.Sections {
+		section, err := coursesense.ParseSection(id)
+		if err != nil {
+			return scope{}, fmt.Errorf("%w: %v", coursesense.ErrInvalidToken, err)
+		}
+
+		s.sections[section] = true
+	}
+
+	for _, id := range c.Courses {
+		s.courses[id] = true
+	}
+
+	return s, nil
+}
+
+func (s scope) covers(section coursesense.Section) bool {
+	return s.sections[section] || s.courses[courseID(section.Course, section.Term)]
+}
+
+// a group is covered if its course is, or if any of its sections are. Whole course groups are covered by any section of the course
+func (s scope) coversGroup(group coursesense.WatchGroup) bool {
+	if s.courses[courseID(group.Course, group.Term)] {
+		return true
+	}
+
+	if group.WholeCourse() {
+		for section := range s.sections {
+			if section.Course == group.Course && section.Term == group.Term {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, section := range group.Sections {
+		if s.sections[section] {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,90 @@
+package verify
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	coursesense "github.com/jacobmichels/Course-Sense-Go"
+)
+
+// the window maxPerHour counts emails over
+const limitWindow = time.Hour
+
+// the address already has a recent link for the watch
+var errCoolingDown = errors.New("verification sent recently")
+
+// limits the verification emails sent to an address, so registrations can't be used to flood someone's inbox.
+// It is kept in memory, so a restart forgets what was sent
+type limiter struct {
+	// between emails about the same watch, 0 allows a resend every time
+	cooldown time.Duration
+	// emails to one address per hour, 0 doesn't cap them
+	maxPerHour int
+
+	mu   sync.Mutex
+	sent map[string][]sentEmail
+}
+
+type sentEmail struct {
+	watch string
+	at    time.Time
+}
+
+func newLimiter(cooldown time.Duration, maxPerHour int) *limiter {
+	return &limiter{cooldown: cooldown, maxPerHour: maxPerHour, sent: make(map[string][]sentEmail)}
+}
+
+// decides whether an email about the watch can be sent to the address now, recording it if so.
+// Returns errCoolingDown if the address was sent a link for the watch within the cooldown,
+// and ErrTooManyVerifications if it hit its hourly cap
+func (l *limiter) allow(address, watch string, now time.Time) error {
+	// mail servers treat addresses alike whatever their case, so changing it doesn't get around the limits
+	address = strings.ToLower(address)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.forget(now)
+
+	count := 0
+	for _, email := range l.sent[address] {
+		if email.watch == watch && now.Sub(email.at) < l.cooldown {
+			return errCoolingDown
+		}
+		if now.Sub(email.at) < limitWindow {
+			count++
+		}
+	}
+
+	if l.maxPerHour > 0 && count >= l.maxPerHour {
+		return coursesense.ErrTooManyVerifications
+	}
+
+	l.sent[address] = append(l.sent[address], sentEmail{watch, now})
+	return nil
+}
+
+// drops emails old enough that they no longer limit anything
+func (l *limiter) forget(now time.Time) {
+	keep := limitWindow
+	if l.cooldown > keep {
+		keep = l.cooldown
+	}
+
+	for address, emails := range l.sent {
+		var recent []sentEmail
+		for _, email := range emails {
+			if now.Sub(email.at) < keep {
+				recent = append(recent, email)
+			}
+		}
+
+		if len(recent) == 0 {
+			delete(l.sent, address)
+		} else {
+			l.sent[address] = recent
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package verify
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	coursesense "github.com/jacobmichels/Course-Sense-Go"
+)
+
+func TestLimiter(t *testing.T) {
+	start := time.Date(2023, 9, 1, 12, 0, 0, 0, time.UTC)
+
+	type request struct {
+		address string
+		watch   string
+		after   time.Duration
+		want    error
+	}
+
+	tests := []struct {
+		name     string
+		requests []request
+	}{
+		{
+			name: "resend after the cooldown",
+			requests: []request{
+				{"a@example.com", "s1", 0, nil},
+				{"a@example.com", "s1", 5 * time.Minute, errCoolingDown},
+				{"A@EXAMPLE.COM", "s1", 9 * time.Minute, errCoolingDown},
+				{"a@example.com", "s1", 10 * time.Minute, nil},
+			},
+		},
+		{
+			name: "other watches aren't cooling down",
+			requests: []request{
+				{"a@example.com", "s1", 0, nil},
+				{"a@example.com", "s2", time.Minute, nil},
+			},
+		},
+		{
+			name: "hourly cap",
+			requests: []request{
+				{"a@example.com", "s1", 0, nil},
+				{"a@example.com", "s2", time.Minute, nil},
+				{"a@example.com", "s3", 2 * time.Minute, nil},
+				{"a@example.com", "s4", 3 * time.Minute, coursesense.ErrTooManyVerifications},
+				{"b@example.com", "s4", 3 * time.Minute, nil},
+				{"a@example.com", "s4", time.Hour, nil},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			l := newLimiter(10*time.Minute, 3)
+			for _, r := range test.requests {
+				if err := l.allow(r.address, r.watch, start.Add(r.after)); !errors.Is(err, r.want) {
+					t.Fatalf("%s about %s after %s: got %v, want %v", r.address, r.watch, r.after, err, r.want)
+				}
+			}
+		})
+	}
+}
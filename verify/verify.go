@@ -0,0 +1,216 @@
+package verify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	coursesense "github.com/jacobmichels/Course-Sense-Go"
+	"github.com/jacobmichels/Course-Sense-Go/token"
+)
+
+// Service implements VerificationService
+var _ coursesense.VerificationService = Service{}
+
+const tokenPurpose = "verify"
+
+type Service struct {
+	repository coursesense.Repository
+	signer     token.Signer
+	sender     coursesense.VerificationSender
+	// public URL of the server, links point to its /verify endpoint
+	baseURL string
+	// how long watchers have to confirm before their pending watch is purged
+	ttl     time.Duration
+	limiter *limiter
+}
+
+func NewService(r coursesense.Repository, signer token.Signer, sender coursesense.VerificationSender, baseURL string, ttl, cooldown time.Duration, maxPerHour int) Service {
+	return Service{r, signer, sender, strings.TrimSuffix(baseURL, "/"), ttl, newLimiter(cooldown, maxPerHour)}
+}
+
+// what a verification token identifies: one watcher's pending watch on a section or a group
+type claims struct {
+	// hash of the watcher's contact key
+	Watcher string `json:"w"`
+	// as DEPT*CODE*SECTION*TERM, set for section watches
+	Section string `json:"s,omitempty"`
+	// see groupKey, set for watch groups
+	Group string `json:"g,omitempty"`
+}
+
+// only email addresses are confirmed, watchers without one are active right away
+func (s Service) Deadline(watcher coursesense.Watcher) time.Time {
+	channel, ok := watcher.Channel(coursesense.ChannelEmail)
+	if !ok || channel.Verified {
+		return time.Time{}
+	}
+
+	return time.Now().Add(s.ttl)
+}
+
+func (s Service) RequestSection(ctx context.Context, section coursesense.Section, watcher coursesense.Watcher) error {
+	return s.request(ctx, section.String(), watcher, claims{Watcher: token.WatcherID(watcher), Section: section.String()})
+}
+
+func (s Service) RequestGroup(ctx context.Context, group coursesense.WatchGroup) error {
+	return s.request(ctx, group.String(), group.Watcher, claims{Watcher: token.WatcherID(group.Watcher), Group: groupKey(group)})
+}
+
+// signs a link valid until the watch is purged and sends it to the watcher's email address, unless the limiter holds it back
+func (s Service) request(ctx context.Context, watch string, watcher coursesense.Watcher, c claims) error {
+	email := watcher.Address(coursesense.ChannelEmail)
+	if err := s.limiter.allow(email, watch, time.Now()); errors.Is(err, errCoolingDown) {
+		log.Info().Msgf("not resending verification for %s to %s, the last one is recent", watch, email)
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to send verification for %s: %w", watch, err)
+	}
+
+	signed, err := s.signer.Sign(tokenPurpose, c, watcher.VerifyBy)
+	if err != nil {
+		return fmt.Errorf("failed to sign verification token: %w", err)
+	}
+
+	verification := coursesense.Verification{
+		Email:     email,
+		Watch:     watch,
+		URL:       s.baseURL + "/verify?token=" + url.QueryEscape(signed),
+		ExpiresAt: watcher.VerifyBy,
+		Locale:    watcher.Locale,
+	}
+
+	if err := s.sender.SendVerification(ctx, verification); err != nil {
+		return fmt.Errorf("failed to send verification for %s: %w", watch, err)
+	}
+
+	return nil
+}
+
+func (s Service) Verify(ctx context.Context, signed string) error {
+	// Verify steps
+	// 1. Verify the token and decode the watch it identifies
+	// 2. Find the watcher's watch on the section, or the watcher's group
+	// 3. Mark the email channel verified and clear the deadline, activating the watch
+
+	var c claims
+	if err := s.signer.Verify(tokenPurpose, signed, time.Now(), &c); err != nil {
+		return err
+	}
+
+	if c.Group != "" {
+		return s.verifyGroup(ctx, c)
+	}
+
+	section, err := coursesense.ParseSection(c.Section)
+	if err != nil {
+		return fmt.Errorf("%w: %v", coursesense.ErrInvalidToken, err)
+	}
+
+	watcher, err := s.findWatcher(ctx, section, c.Watcher)
+	if err != nil {
+		return err
+	}
+
+	if !watcher.Pending() {
+		return nil
+	}
+
+	if err := s.repository.UpdateWatcher(ctx, section, activate(watcher)); err != nil {
+		return fmt.Errorf("failed to activate watch on %s: %w", section, err)
+	}
+
+	log.Info().Msgf("activated watch on %s for %s", section, watcher)
+	return nil
+}
+
+func (s Service) findWatcher(ctx context.Context, section coursesense.Section, id string) (coursesense.Watcher, error) {
+	// the section is looked up among the watched ones, it is gone if its last watcher was purged
+	sections, err := s.repository.GetWatchedSections(ctx)
+	if err != nil {
+		return coursesense.Watcher{}, fmt.Errorf("failed to get watched sections: %w", err)
+	}
+
+	for _, watched := range sections {
+		if watched != section {
+			continue
+		}
+
+		watchers, err := s.repository.GetWatchers(ctx, section)
+		if err != nil {
+			return coursesense.Watcher{}, fmt.Errorf("failed to get watchers for %s: %w", section, err)
+		}
+
+		for _, watcher := range watchers {
+			if token.WatcherID(watcher) == id {
+				return watcher, nil
+			}
+		}
+	}
+
+	return coursesense.Watcher{}, fmt.Errorf("%w: %s", coursesense.ErrWatchNotFound, section)
+}
+
+func (s Service) verifyGroup(ctx context.Context, c claims) error {
+	groups, err := s.repository.GetWatchGroups(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get watch groups: %w", err)
+	}
+
+	found := false
+	for _, group := range groups {
+		if token.WatcherID(group.Watcher) != c.Watcher || groupKey(group) != c.Group {
+			continue
+		}
+		found = true
+
+		if !group.Watcher.Pending() {
+			continue
+		}
+
+		group.Watcher = activate(group.Watcher)
+		if err := s.repository.UpdateWatchGroup(ctx, group); err != nil {
+			return fmt.Errorf("failed to activate group %s: %w", group, err)
+		}
+		log.Info().Msgf("activated watch group %s for %s", group, group.Watcher)
+	}
+
+	if !found {
+		return fmt.Errorf("%w: %s", coursesense.ErrWatchNotFound, c.Group)
+	}
+
+	return nil
+}
+
+// returns the watcher with its email confirmed and no deadline left
+func activate(watcher coursesense.Watcher) coursesense.Watcher {
+	channels := make([]coursesense.Channel, len(watcher.Channels))
+	for i, channel := range watcher.Channels {
+		if channel.Kind == coursesense.ChannelEmail {
+			channel.Verified = true
+		}
+		channels[i] = channel
+	}
+	watcher.Channels = channels
+	watcher.VerifyBy = time.Time{}
+
+	return watcher
+}
+
+// identifies a group by what it watches, as the repository may not return its sections in registration order.
+// Identical groups of one watcher are verified together
+func groupKey(group coursesense.WatchGroup) string {
+	codes := make([]string, len(group.Sections))
+	for i, section := range group.Sections {
+		codes[i] = section.Code
+	}
+	sort.Strings(codes)
+
+	return fmt.Sprintf("%s*%d*{%s}*%s", group.Course.Department, group.Course.Code, strings.Join(codes, ","), group.Term)
+}
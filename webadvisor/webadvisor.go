@@ -4,17 +4,22 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/http/cookiejar"
 	"strings"
+	"time"
 
 	coursesense "github.com/jacobmichels/Course-Sense-Go"
 )
 
 var _ coursesense.SectionService = WebAdvisorSectionService{}
 
+// ErrSchema is returned when Colleague responds in a shape we don't understand, usually after an update on their end
+var ErrSchema = errors.New("unexpected colleague response")
+
 type WebAdvisorSectionService struct {
 	http *http.Client
 }
@@ -38,7 +43,7 @@ func (w WebAdvisorSectionService) Exists(ctx context.Context, section coursesens
 		return false, fmt.Errorf("failed to get request verification token: %w", err)
 	}
 
-	courseID, sectionIDs, err := w.searchCourses(ctx, token, section)
+	courseID, sectionIDs, err := w.searchCourses(ctx, token, section.Course)
 	if err != nil {
 		return false, fmt.Errorf("failed to search for course: %w", err)
 	}
@@ -63,7 +68,7 @@ func (w WebAdvisorSectionService) GetAvailableSeats(ctx context.Context, section
 		return 0, fmt.Errorf("failed to get request verification token: %w", err)
 	}
 
-	courseID, sectionIDs, err := w.searchCourses(ctx, token, section)
+	courseID, sectionIDs, err := w.searchCourses(ctx, token, section.Course)
 	if err != nil {
 		return 0, fmt.Errorf("failed to search for course: %w", err)
 	}
@@ -82,6 +87,60 @@ func (w WebAdvisorSectionService) GetAvailableSeats(ctx context.Context, section
 	return 0, fmt.Errorf("section not found")
 }
 
+func (w WebAdvisorSectionService) GetCourseSections(ctx context.Context, course coursesense.Course, term string) (map[coursesense.Section]uint, error) {
+	token, err := w.getRequestVerificationToken(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get request verification token: %w", err)
+	}
+
+	courseID, sectionIDs, err := w.searchCourses(ctx, token, course)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search for course: %w", err)
+	}
+
+	webAdvisorSections, err := w.listSections(ctx, token, courseID, sectionIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sections: %w", err)
+	}
+
+	results := make(map[coursesense.Section]uint)
+	for _, webAdvisorSection := range webAdvisorSections {
+		if webAdvisorSection.Section.TermId != term {
+			continue
+		}
+
+		section := coursesense.Section{Course: course, Code: webAdvisorSection.Section.Number, Term: term}
+		results[section] = webAdvisorSection.Section.Available
+	}
+
+	return results, nil
+}
+
+func (w WebAdvisorSectionService) GetMeetings(ctx context.Context, section coursesense.Section) ([]coursesense.Meeting, error) {
+	token, err := w.getRequestVerificationToken(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get request verification token: %w", err)
+	}
+
+	courseID, sectionIDs, err := w.searchCourses(ctx, token, section.Course)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search for course: %w", err)
+	}
+
+	webAdvisorSections, err := w.listSections(ctx, token, courseID, sectionIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sections: %w", err)
+	}
+
+	for _, webAdvisorSection := range webAdvisorSections {
+		if webAdvisorSection.Section.Number == section.Code && webAdvisorSection.Section.TermId == section.Term {
+			return webAdvisorSection.meetings()
+		}
+	}
+
+	return nil, fmt.Errorf("section not found")
+}
+
 func (w WebAdvisorSectionService) getRequestVerificationToken(ctx context.Context) (string, error) {
 	req, err := http.NewRequestWithContext(ctx, "GET", "https://colleague-ss.uoguelph.ca/Student/Courses", nil)
 	if err != nil {
@@ -117,7 +176,7 @@ func extractToken(body io.Reader) (string, error) {
 	}
 
 	if token == "" {
-		return "", fmt.Errorf("token not found")
+		return "", fmt.Errorf("%w: token not found", ErrSchema)
 	}
 
 	return token, nil
@@ -133,8 +192,8 @@ type CourseSearchResponse struct {
 }
 
 // Returns the course ID, and section IDs
-func (w WebAdvisorSectionService) searchCourses(ctx context.Context, token string, section coursesense.Section) (string, []string, error) {
-	data := bytes.NewBufferString(fmt.Sprintf(`{"searchParameters":"{\"keyword\":null,\"terms\":[],\"requirement\":null,\"subrequirement\":null,\"courseIds\":null,\"sectionIds\":null,\"requirementText\":null,\"subrequirementText\":\"\",\"group\":null,\"startTime\":null,\"endTime\":null,\"openSections\":null,\"subjects\":[\"%s\"],\"academicLevels\":[],\"courseLevels\":[],\"synonyms\":[],\"courseTypes\":[],\"topicCodes\":[],\"days\":[],\"locations\":[],\"faculty\":[],\"onlineCategories\":null,\"keywordComponents\":[],\"startDate\":null,\"endDate\":null,\"startsAtTime\":null,\"endsByTime\":null,\"pageNumber\":1,\"sortOn\":\"None\",\"sortDirection\":\"Ascending\",\"subjectsBadge\":[],\"locationsBadge\":[],\"termFiltersBadge\":[],\"daysBadge\":[],\"facultyBadge\":[],\"academicLevelsBadge\":[],\"courseLevelsBadge\":[],\"courseTypesBadge\":[],\"topicCodesBadge\":[],\"onlineCategoriesBadge\":[],\"openSectionsBadge\":\"\",\"openAndWaitlistedSectionsBadge\":\"\",\"subRequirementText\":null,\"quantityPerPage\":500,\"openAndWaitlistedSections\":null,\"searchResultsView\":\"CatalogListing\"}"}`, section.Course.Department))
+func (w WebAdvisorSectionService) searchCourses(ctx context.Context, token string, course coursesense.Course) (string, []string, error) {
+	data := bytes.NewBufferString(fmt.Sprintf(`{"searchParameters":"{\"keyword\":null,\"terms\":[],\"requirement\":null,\"subrequirement\":null,\"courseIds\":null,\"sectionIds\":null,\"requirementText\":null,\"subrequirementText\":\"\",\"group\":null,\"startTime\":null,\"endTime\":null,\"openSections\":null,\"subjects\":[\"%s\"],\"academicLevels\":[],\"courseLevels\":[],\"synonyms\":[],\"courseTypes\":[],\"topicCodes\":[],\"days\":[],\"locations\":[],\"faculty\":[],\"onlineCategories\":null,\"keywordComponents\":[],\"startDate\":null,\"endDate\":null,\"startsAtTime\":null,\"endsByTime\":null,\"pageNumber\":1,\"sortOn\":\"None\",\"sortDirection\":\"Ascending\",\"subjectsBadge\":[],\"locationsBadge\":[],\"termFiltersBadge\":[],\"daysBadge\":[],\"facultyBadge\":[],\"academicLevelsBadge\":[],\"courseLevelsBadge\":[],\"courseTypesBadge\":[],\"topicCodesBadge\":[],\"onlineCategoriesBadge\":[],\"openSectionsBadge\":\"\",\"openAndWaitlistedSectionsBadge\":\"\",\"subRequirementText\":null,\"quantityPerPage\":500,\"openAndWaitlistedSections\":null,\"searchResultsView\":\"CatalogListing\"}"}`, course.Department))
 	req, err := http.NewRequestWithContext(ctx, "POST", "https://colleague-ss.uoguelph.ca/Student/Courses/SearchAsync", data)
 	if err != nil {
 		return "", nil, fmt.Errorf("failed to create request: %w", err)
@@ -153,16 +212,16 @@ func (w WebAdvisorSectionService) searchCourses(ctx context.Context, token strin
 	var courseList CourseSearchResponse
 	err = json.NewDecoder(res.Body).Decode(&courseList)
 	if err != nil {
-		return "", nil, fmt.Errorf("failed to decode json: %w", err)
+		return "", nil, fmt.Errorf("%w: failed to decode json: %v", ErrSchema, err)
 	}
 
-	for _, course := range courseList.Courses {
-		if course.SubjectCode == section.Course.Department && course.Number == fmt.Sprintf("%d", section.Course.Code) {
-			return course.Id, course.MatchingSectionIds, nil
+	for _, result := range courseList.Courses {
+		if result.SubjectCode == course.Department && result.Number == fmt.Sprintf("%d", course.Code) {
+			return result.Id, result.MatchingSectionIds, nil
 		}
 	}
 
-	return "", nil, fmt.Errorf("%s*%d*%s*%s not found", section.Course.Department, section.Course.Code, section.Term, section.Code)
+	return "", nil, fmt.Errorf("%s*%d not found", course.Department, course.Code)
 }
 
 type SectionListResponse struct {
@@ -176,13 +235,50 @@ type SectionListResponse struct {
 
 type WebAdvisorSection struct {
 	Section struct {
-		Capacity  uint
-		Available uint
-		CourseId  string
-		Id        string
-		Number    string
-		TermId    string
+		Capacity              uint
+		Available             uint
+		CourseId              string
+		Id                    string
+		Number                string
+		TermId                string
+		FormattedMeetingTimes []struct {
+			// days of the week, 0 being Sunday
+			Days                       []int
+			StartTimeDisplay           string
+			EndTimeDisplay             string
+			InstructionalMethodDisplay string
+		}
+	}
+}
+
+// converts the section's meeting times into weekly meetings
+// exams are one-off and can't be moved around, so they are left out
+func (s WebAdvisorSection) meetings() ([]coursesense.Meeting, error) {
+	var meetings []coursesense.Meeting
+	for _, meetingTime := range s.Section.FormattedMeetingTimes {
+		// online sections have no meeting times
+		if len(meetingTime.Days) == 0 || meetingTime.StartTimeDisplay == "" || strings.EqualFold(meetingTime.InstructionalMethodDisplay, "EXAM") {
+			continue
+		}
+
+		start, err := time.Parse("3:04 PM", meetingTime.StartTimeDisplay)
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to parse meeting start time: %v", ErrSchema, err)
+		}
+		end, err := time.Parse("3:04 PM", meetingTime.EndTimeDisplay)
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to parse meeting end time: %v", ErrSchema, err)
+		}
+
+		meeting := coursesense.Meeting{Start: start.Format("15:04"), End: end.Format("15:04")}
+		for _, day := range meetingTime.Days {
+			meeting.Days = append(meeting.Days, time.Weekday(day))
+		}
+
+		meetings = append(meetings, meeting)
 	}
+
+	return meetings, nil
 }
 
 func (w WebAdvisorSectionService) listSections(ctx context.Context, token, courseId string, sectionIds []string) ([]WebAdvisorSection, error) {
@@ -205,7 +301,7 @@ func (w WebAdvisorSectionService) listSections(ctx context.Context, token, cours
 	var sectionList SectionListResponse
 	err = json.NewDecoder(res.Body).Decode(&sectionList)
 	if err != nil {
-		return nil, fmt.Errorf("failed to decode json: %w", err)
+		return nil, fmt.Errorf("%w: failed to decode json: %v", ErrSchema, err)
 	}
 
 	var results []WebAdvisorSection